@@ -2,9 +2,13 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"github.com/tuan882612/apiutils"
@@ -20,8 +24,19 @@ const (
 	Cli        CacheType = "cli"
 	Restricted CacheType = "restricted"
 	Session    CacheType = "session"
+	// failed totp codes outside of a login challenge
+	TOTPAttempts CacheType = "totpattempts"
 )
 
+// webauthn ceremonies
+const (
+	PasskeyRegister = "register"
+	PasskeyLogin    = "login"
+)
+
+// Returned along with the record when an already rotated refresh token is presented again.
+var ErrRefreshReuse = errors.New("refresh token reused")
+
 type Cache struct {
 	cache *redis.Client
 }
@@ -146,17 +161,357 @@ func (r *Cache) AddSession(ctx context.Context, userID uuid.UUID) error {
 	return nil
 }
 
-// Adds reset key to the cache.
-func (r *Cache) AddResetKey(ctx context.Context, userID uuid.UUID, resetKeyHash string) error {
-	key := "reset:" + userID.String()
-	if err := r.cache.Set(key, resetKeyHash, 30*time.Minute).Err(); err != nil {
-		log.Error().Str("location", "AddResetKeyCache").Msgf("%v: failed to add reset key: %v", userID, err)
+// Adds a 3 minute ttl twofa challenge to the cache.
+func (r *Cache) AddTwofa(ctx context.Context, userID uuid.UUID, body *email.Twofa) error {
+	data, err := body.Serialize()
+	if err != nil {
+		log.Error().Str("location", "AddTwofaCache").Msgf("%v: failed to serialize twofa data: %v", userID, err)
+		return err
+	}
+
+	key := "twofa:" + userID.String()
+	if err := r.cache.Set(key, data, 3*time.Minute).Err(); err != nil {
+		log.Error().Str("location", "AddTwofaCache").Msgf("%v: failed to add twofa data: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Records the time step of an accepted totp code, reporting false when the step is not past the
+// last accepted one (the code or an older one was already used).
+func (r *Cache) AcceptTOTPStep(ctx context.Context, userID uuid.UUID, step uint64, ttl time.Duration) (bool, error) {
+	key := "totpstep:" + userID.String()
+	accepted := false
+
+	err := r.cache.Watch(func(tx *redis.Tx) error {
+		last, err := tx.Get(key).Uint64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		if err == nil && step <= last {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(key, strconv.FormatUint(step, 10), ttl)
+			return nil
+		})
+		accepted = err == nil
+
+		return err
+	}, key)
+
+	if err != nil {
+		log.Error().Str("location", "AcceptTOTPStep").Msgf("%v: failed to record totp step: %v", userID, err)
+		return false, err
+	}
+
+	return accepted, nil
+}
+
+// Counts a failed totp code and returns the failures so far, the count lives for 30 minutes.
+func (r *Cache) AddTOTPFailure(ctx context.Context, userID uuid.UUID) (int64, error) {
+	key := string(TOTPAttempts) + ":" + userID.String()
+
+	pipe := r.cache.TxPipeline()
+	incrCmd := pipe.Incr(key)
+	pipe.Expire(key, 30*time.Minute)
+
+	if _, err := pipe.Exec(); err != nil {
+		log.Error().Str("location", "AddTOTPFailure").Msgf("%v: failed to count totp failure: %v", userID, err)
+		return 0, err
+	}
+
+	return incrCmd.Val(), nil
+}
+
+// Adds a 5 minute ttl webauthn ceremony session to the cache.
+func (r *Cache) AddPasskeySession(ctx context.Context, userID uuid.UUID, ceremony string, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		log.Error().Str("location", "AddPasskeySession").Msgf("%v: failed to serialize webauthn session: %v", userID, err)
+		return err
+	}
+
+	key := "webauthn:" + ceremony + ":" + userID.String()
+	if err := r.cache.Set(key, data, 5*time.Minute).Err(); err != nil {
+		log.Error().Str("location", "AddPasskeySession").Msgf("%v: failed to add webauthn session: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves and removes a webauthn ceremony session so each challenge can only be answered once.
+func (r *Cache) TakePasskeySession(ctx context.Context, userID uuid.UUID, ceremony string) (*webauthn.SessionData, error) {
+	key := "webauthn:" + ceremony + ":" + userID.String()
+
+	// create a pipeline
+	pipe := r.cache.TxPipeline()
+	getCmd := pipe.Get(key)
+	pipe.Del(key)
+
+	// execute the pipeline
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		log.Error().Str("location", "TakePasskeySession").Msgf("%v: failed to get webauthn session: %v", userID, err)
+		return nil, err
+	}
+
+	data, err := getCmd.Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, apiutils.NewErrNotFound("webauthn session not found")
+		}
+
+		log.Error().Str("location", "TakePasskeySession").Msgf("%v: failed to get webauthn session: %v", userID, err)
+		return nil, err
+	}
+
+	session := &webauthn.SessionData{}
+	if err := json.Unmarshal(data, session); err != nil {
+		log.Error().Str("location", "TakePasskeySession").Msgf("%v: failed to deserialize webauthn session: %v", userID, err)
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Adds a refresh token record to its family.
+func (r *Cache) AddRefreshToken(ctx context.Context, hash string, record *RefreshRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Error().Str("location", "AddRefreshToken").Msgf("%v: failed to serialize refresh token: %v", record.UserID, err)
+		return err
+	}
+
+	// create a pipeline
+	familyKey := "family:" + record.FamilyID
+	pipe := r.cache.TxPipeline()
+	pipe.Set("refresh:"+hash, data, ttl)
+	pipe.SAdd(familyKey, hash)
+	pipe.Expire(familyKey, ttl)
+
+	// execute the pipeline
+	if _, err := pipe.Exec(); err != nil {
+		log.Error().Str("location", "AddRefreshToken").Msgf("%v: failed to add refresh token: %v", record.UserID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves a refresh token record.
+func (r *Cache) GetRefreshToken(ctx context.Context, hash string) (*RefreshRecord, error) {
+	data, err := r.cache.Get("refresh:" + hash).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, apiutils.NewErrUnauthorized("invalid refresh token")
+		}
+
+		log.Error().Str("location", "GetRefreshToken").Msgf("failed to get refresh token: %v", err)
+		return nil, err
+	}
+
+	record := &RefreshRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		log.Error().Str("location", "GetRefreshToken").Msgf("failed to deserialize refresh token: %v", err)
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// Marks the refresh token as used and adds its successor to the family in one transaction.
+func (r *Cache) RotateRefreshToken(ctx context.Context, hash, nextHash string, ttl time.Duration) (*RefreshRecord, error) {
+	key := "refresh:" + hash
+	record := &RefreshRecord{}
+
+	err := r.cache.Watch(func(tx *redis.Tx) error {
+		data, err := tx.Get(key).Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				return apiutils.NewErrUnauthorized("invalid refresh token")
+			}
+
+			return err
+		}
+
+		if err := json.Unmarshal(data, record); err != nil {
+			return err
+		}
+
+		// a used token is kept until it expires so replays can be detected
+		if record.Used {
+			return ErrRefreshReuse
+		}
+
+		used, err := json.Marshal(&RefreshRecord{UserID: record.UserID, FamilyID: record.FamilyID, Used: true})
+		if err != nil {
+			return err
+		}
+
+		next, err := json.Marshal(&RefreshRecord{UserID: record.UserID, FamilyID: record.FamilyID})
+		if err != nil {
+			return err
+		}
+
+		familyKey := "family:" + record.FamilyID
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(key, used, tx.TTL(key).Val())
+			pipe.Set("refresh:"+nextHash, next, ttl)
+			pipe.SAdd(familyKey, nextHash)
+			pipe.Expire(familyKey, ttl)
+			return nil
+		})
+
+		return err
+	}, key)
+
+	if err != nil {
+		if _, ok := err.(apiutils.ErrUnauthorized); !ok && err != ErrRefreshReuse {
+			log.Error().Str("location", "RotateRefreshToken").Msgf("failed to rotate refresh token: %v", err)
+		}
+
+		return record, err
+	}
+
+	return record, nil
+}
+
+// Deletes every refresh token in the family.
+func (r *Cache) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	familyKey := "family:" + familyID
+	hashes, err := r.cache.SMembers(familyKey).Result()
+	if err != nil {
+		log.Error().Str("location", "RevokeRefreshFamily").Msgf("%s: failed to get refresh family: %v", familyID, err)
+		return err
+	}
+
+	keys := []string{familyKey}
+	for _, hash := range hashes {
+		keys = append(keys, "refresh:"+hash)
+	}
+
+	if err := r.cache.Del(keys...).Err(); err != nil {
+		log.Error().Str("location", "RevokeRefreshFamily").Msgf("%s: failed to revoke refresh family: %v", familyID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Adds or replaces a session in the user's session registry.
+func (r *Cache) SetUserSession(ctx context.Context, userID uuid.UUID, session *SessionInfo) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		log.Error().Str("location", "SetUserSession").Msgf("%v: failed to serialize session: %v", userID, err)
+		return err
+	}
+
+	// the registry lives as long as its newest session
+	key := "sessions:" + userID.String()
+	pipe := r.cache.TxPipeline()
+	pipe.HSet(key, session.SessionID, data)
+	pipe.ExpireAt(key, session.Expires)
+
+	if _, err := pipe.Exec(); err != nil {
+		log.Error().Str("location", "SetUserSession").Msgf("%v: failed to add session: %v", userID, err)
 		return err
 	}
 
 	return nil
 }
 
+// Retrieves a session from the user's session registry.
+func (r *Cache) GetUserSession(ctx context.Context, userID uuid.UUID, sessionID string) (*SessionInfo, error) {
+	data, err := r.cache.HGet("sessions:"+userID.String(), sessionID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, apiutils.NewErrNotFound("session not found")
+		}
+
+		log.Error().Str("location", "GetUserSession").Msgf("%v: failed to get session: %v", userID, err)
+		return nil, err
+	}
+
+	session := &SessionInfo{}
+	if err := json.Unmarshal(data, session); err != nil {
+		log.Error().Str("location", "GetUserSession").Msgf("%v: failed to deserialize session: %v", userID, err)
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Retrieves every active session of the user, expired sessions are pruned along the way.
+func (r *Cache) GetUserSessions(ctx context.Context, userID uuid.UUID) ([]*SessionInfo, error) {
+	key := "sessions:" + userID.String()
+	data, err := r.cache.HGetAll(key).Result()
+	if err != nil {
+		log.Error().Str("location", "GetUserSessions").Msgf("%v: failed to get sessions: %v", userID, err)
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := []*SessionInfo{}
+	expired := []string{}
+	for sessionID, raw := range data {
+		session := &SessionInfo{}
+		if err := json.Unmarshal([]byte(raw), session); err != nil {
+			log.Error().Str("location", "GetUserSessions").Msgf("%v: failed to deserialize session: %v", userID, err)
+			return nil, err
+		}
+
+		if session.Expires.Before(now) {
+			expired = append(expired, sessionID)
+			continue
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if len(expired) > 0 {
+		if err := r.cache.HDel(key, expired...).Err(); err != nil {
+			log.Error().Str("location", "GetUserSessions").Msgf("%v: failed to prune sessions: %v", userID, err)
+			return nil, err
+		}
+	}
+
+	return sessions, nil
+}
+
+// Removes a session from the registry, deletes its refresh tokens and
+// marks its jti as revoked for as long as its access tokens stay valid.
+func (r *Cache) RevokeUserSession(ctx context.Context, userID uuid.UUID, sessionID string, accessTTL time.Duration) error {
+	if err := r.RevokeRefreshFamily(ctx, sessionID); err != nil {
+		return err
+	}
+
+	pipe := r.cache.TxPipeline()
+	pipe.HDel("sessions:"+userID.String(), sessionID)
+	pipe.Set("revoked:"+sessionID, userID.String(), accessTTL)
+
+	if _, err := pipe.Exec(); err != nil {
+		log.Error().Str("location", "RevokeUserSession").Msgf("%v: failed to revoke session: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Checks if the session (jti) has been revoked.
+func (r *Cache) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	n, err := r.cache.Exists("revoked:" + sessionID).Result()
+	if err != nil {
+		log.Error().Str("location", "IsSessionRevoked").Msgf("%s: failed to check revoked session: %v", sessionID, err)
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
 // Updates the user's twofa data.
 func (r *Cache) UpdateTwofa(ctx context.Context, userID uuid.UUID, body *email.Twofa) error {
 	data, err := body.Serialize()
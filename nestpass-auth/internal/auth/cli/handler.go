@@ -2,7 +2,6 @@ package cli
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/tuan882612/apiutils"
 
@@ -35,23 +34,51 @@ func (h *Handler) VerifyCliKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jwtToken, err := h.cliService.VerifyCliKey(ctx, userID, cliKey)
+	pair, err := h.cliService.VerifyCliKey(ctx, userID, cliKey)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
-	csrfToken, err := auth.GenerateStateToken()
+	if err := setCliCookies(w, pair); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+// Handles exchanging the refresh token for a new token pair
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	pair, err := h.cliService.Refresh(r.Context(), auth.GetRefreshToken(r))
 	if err != nil {
+		auth.ClearAuthCookies(w, true)
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
+	if err := setCliCookies(w, pair); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+// helper: setCliCookies sets the http only jwt, refresh and csrf cookies used by the cli.
+func setCliCookies(w http.ResponseWriter, pair *auth.TokenPair) error {
+	csrfToken, err := auth.GenerateStateToken()
+	if err != nil {
+		return err
+	}
+
 	// Set JWT as HttpOnly cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:     "Authorization",
-		Value:    jwtToken,
-		Expires:  time.Now().Add(12 * time.Hour),
+		Value:    pair.AccessToken,
+		Expires:  pair.AccessExpires,
 		Path:     "/",
 		HttpOnly: true,
 		Secure:   true,
@@ -65,9 +92,9 @@ func (h *Handler) VerifyCliKey(w http.ResponseWriter, r *http.Request) {
 		Secure:   true,
 		SameSite: http.SameSiteNoneMode,
 	})
+	auth.SetRefreshCookie(w, pair, true)
 
-	resp := apiutils.NewRes(http.StatusOK, "", nil)
-	resp.SendRes(w)
+	return nil
 }
 
 // Handles the initial login phase (sending the verification code)
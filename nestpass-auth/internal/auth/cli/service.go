@@ -8,44 +8,43 @@ import (
 	"github.com/tuan882612/apiutils/securityutils"
 
 	"project/internal/auth"
-	"project/internal/auth/jwt"
 )
 
 // Service for handling cli authentication.
 type Service struct {
-	authRepo   *auth.Repository // base auth repository
-	cacheRepo  *auth.Cache      // cache repository
-	jwtManager *jwt.Manager
+	authRepo     *auth.Repository // base auth repository
+	cacheRepo    *auth.Cache      // cache repository
+	tokenManager *auth.TokenManager
 }
 
 // Creates a new cli authentication service with the given dependencies.
 func NewService(deps *auth.Dependencies) *Service {
 	return &Service{
-		authRepo:   deps.Repository,
-		cacheRepo:  deps.Cache,
-		jwtManager: deps.JWTManager,
+		authRepo:     deps.Repository,
+		cacheRepo:    deps.Cache,
+		tokenManager: deps.TokenManager,
 	}
 }
 
 // Verifies the cli key
-func (s *Service) VerifyCliKey(ctx context.Context, userID uuid.UUID, inputCliKey string) (string, error) {
+func (s *Service) VerifyCliKey(ctx context.Context, userID uuid.UUID, inputCliKey string) (*auth.TokenPair, error) {
 	// retrieve the cli key from the cache and compare it with the input cli key
 	cliKey, err := s.cacheRepo.GetData(ctx, userID, auth.Cli)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if cliKey != inputCliKey {
-		return "", apiutils.NewErrUnauthorized("invalid clikey")
+		return nil, apiutils.NewErrUnauthorized("invalid clikey")
 	}
 
-	// generate a new jwt token
-	token, err := s.jwtManager.GenerateToken(userID)
-	if err != nil {
-		return "", err
-	}
+	// issue a new jwt token along with a refresh token
+	return s.tokenManager.Issue(ctx, userID)
+}
 
-	return token, nil
+// Exchanges a refresh token for a new token pair.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*auth.TokenPair, error) {
+	return s.tokenManager.Rotate(ctx, refreshToken)
 }
 
 // Initial twofa login
@@ -3,6 +3,8 @@ package auth
 import (
 	"project/internal/auth/email"
 	"project/internal/auth/jwt"
+	"project/internal/auth/totp"
+	"project/internal/auth/vault"
 	"project/internal/config"
 	"project/internal/database"
 	"project/internal/ping"
@@ -13,7 +15,10 @@ type Dependencies struct {
 	Repository   *Repository // base auth repository
 	Cache        *Cache      // twofa cache repository
 	JWTManager   *jwt.Manager
+	TokenManager *TokenManager
+	TOTPManager  *totp.Manager
 	EmailManager *email.Manager
+	VaultManager *vault.Manager
 	PingManager  *ping.PingManager
 	ProdEnv      bool
 }
@@ -39,13 +44,27 @@ func NewDependencies(cfg *config.Configuration) (*Dependencies, error) {
 		return nil, err
 	}
 
-	jwtManager := jwt.NewManager(cfg)
+	jwtManager, err := jwt.NewManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	vaultManager, err := vault.NewManager(cfg, jwtManager)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenManager := NewTokenManager(cache, jwtManager, cfg.JWT.RefreshDuration)
+	totpManager := totp.NewManager(cfg)
 
 	return &Dependencies{
 		Repository:   repo,
 		Cache:        cache,
 		JWTManager:   jwtManager,
+		TokenManager: tokenManager,
+		TOTPManager:  totpManager,
 		EmailManager: emailManager,
+		VaultManager: vaultManager,
 		PingManager:  pingManager,
 		ProdEnv:      cfg.Server.ProdEnv,
 	}, nil
@@ -12,6 +12,7 @@ type Twofa struct {
 	Code       string
 	Retries    int
 	UserStatus string
+	Totp       bool `json:",omitempty"` // code is checked against the user's totp secret
 }
 
 // Deserialize the json data into the struct.
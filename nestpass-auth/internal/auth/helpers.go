@@ -3,8 +3,12 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"net/http"
+	"time"
 )
 
+const RefreshCookie = "refresh_token"
+
 // Generate CSRF token
 func GenerateStateToken() (string, error) {
 	b := make([]byte, 32)
@@ -14,3 +18,70 @@ func GenerateStateToken() (string, error) {
 	}
 	return base64.StdEncoding.EncodeToString(b), nil
 }
+
+// Sets the jwt authorization cookie and the refresh cookie along with a new double submit csrf token cookie.
+// Only the csrf token is readable by scripts, the tokens are http only.
+func SetAuthCookies(w http.ResponseWriter, pair *TokenPair, secure bool) error {
+	csrfToken, err := GenerateStateToken()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "Authorization",
+		Value:    pair.AccessToken,
+		Expires:  pair.AccessExpires,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteNoneMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    csrfToken,
+		Path:     "/",
+		HttpOnly: false,
+		Secure:   secure,
+		SameSite: http.SameSiteNoneMode,
+	})
+	SetRefreshCookie(w, pair, secure)
+
+	return nil
+}
+
+// Sets the http only refresh token cookie.
+func SetRefreshCookie(w http.ResponseWriter, pair *TokenPair, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshCookie,
+		Value:    pair.RefreshToken,
+		Expires:  pair.RefreshExpires,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+// Expires the authorization, csrf and refresh cookies.
+func ClearAuthCookies(w http.ResponseWriter, secure bool) {
+	for _, name := range []string{"Authorization", "token", RefreshCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
+			Secure:   secure,
+			SameSite: http.SameSiteNoneMode,
+		})
+	}
+}
+
+// Reads the refresh token from its cookie, falling back to the X-Refresh-Token header for cli clients.
+func GetRefreshToken(r *http.Request) string {
+	if cookie, err := r.Cookie(RefreshCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	return r.Header.Get("X-Refresh-Token")
+}
@@ -1,33 +1,78 @@
 package jwt
 
 import (
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
 
 	"project/internal/config"
 )
 
+// how long service tokens for internal calls are valid for
+const ServiceTokenDuration = time.Minute
+
 // Handles the creation of JWT tokens and other related tasks.
 type Manager struct {
-	secert   string
+	keys     []*Key // the first key signs new tokens
+	byID     map[string]*Key
 	duration time.Duration
 }
 
-// Constructor for the JWT manager.
-func NewManager(cfg *config.Configuration) *Manager {
-	return &Manager{secert: cfg.JWT.SignKey, duration: cfg.JWT.Duration}
+// Constructor for the JWT manager, loads every configured signing key.
+func NewManager(cfg *config.Configuration) (*Manager, error) {
+	keys := []*Key{}
+	for _, file := range cfg.JWT.KeyFiles {
+		key, err := LoadKey(file)
+		if err != nil {
+			log.Error().Str("location", "NewManager").Msgf("failed to load signing key %s: %v", file, err)
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return NewManagerWithKeys(keys, cfg.JWT.Duration)
+}
+
+// Constructor for the JWT manager with already loaded keys, the first key signs new tokens.
+func NewManagerWithKeys(keys []*Key, duration time.Duration) (*Manager, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+
+	byID := map[string]*Key{}
+	for _, key := range keys {
+		byID[key.ID] = key
+	}
+
+	return &Manager{keys: keys, byID: byID, duration: duration}, nil
+}
+
+// Returns how long generated tokens are valid for.
+func (j *Manager) Duration() time.Duration {
+	return j.duration
 }
 
-// Generates a JWT token for the user.
-func (j *Manager) GenerateToken(userID uuid.UUID) (string, error) {
+// Returns every public key the manager accepts, including keys being rotated out.
+func (j *Manager) JWKS() *JWKS {
+	jwks := &JWKS{Keys: []JWK{}}
+	for _, key := range j.keys {
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+
+	return jwks
+}
+
+// Generates a JWT token for the user, the session id is carried as the jti claim.
+func (j *Manager) GenerateToken(userID uuid.UUID, sessionID string) (string, error) {
 	// create new claims
-	claims := NewClaims(userID, j.duration)
+	claims := NewClaims(userID, sessionID, j.duration)
 
-	// sign the claims and return the token
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.secert))
+	token, err := j.sign(claims)
 	if err != nil {
 		log.Error().Str("location", "GenerateToken").Msgf("failed to generate token: %v", err)
 		return "", err
@@ -35,3 +80,77 @@ func (j *Manager) GenerateToken(userID uuid.UUID) (string, error) {
 
 	return token, nil
 }
+
+// Generates a token authenticating this server to an internal service for a call on behalf of the user.
+func (j *Manager) GenerateServiceToken(userID uuid.UUID, audience string) (string, error) {
+	token, err := j.sign(NewServiceClaims(userID, audience, ServiceTokenDuration))
+	if err != nil {
+		log.Error().Str("location", "GenerateServiceToken").Msgf("failed to generate token: %v", err)
+		return "", err
+	}
+
+	return token, nil
+}
+
+// helper: sign signs the claims with the active key.
+func (j *Manager) sign(claims *Claims) (string, error) {
+	key := j.keys[0]
+	unsigned := jwt.NewWithClaims(key.method, claims)
+	unsigned.Header["kid"] = key.ID
+	return unsigned.SignedString(key.private)
+}
+
+// Decodes and validates an access token issued by the manager.
+func (j *Manager) DecodeToken(token string) (*Claims, error) {
+	claims, err := j.decode(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// service tokens are only valid for the audience they were issued to
+	if len(claims.Audience) != 0 {
+		return nil, apiutils.NewErrUnauthorized("invalid token")
+	}
+
+	return claims, nil
+}
+
+// Decodes and validates a service token the manager issued to the audience.
+func (j *Manager) DecodeServiceToken(token, audience string) (*Claims, error) {
+	return j.decode(token, jwt.WithAudience(audience))
+}
+
+// helper: decode verifies the token with the key matching its kid and returns the claims.
+func (j *Manager) decode(token string, opts ...jwt.ParserOption) (*Claims, error) {
+	opts = append(opts, jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+
+	payload, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := j.byID[kid]
+		if !ok || key.method.Alg() != token.Method.Alg() {
+			return nil, jwt.ErrTokenUnverifiable
+		}
+
+		return key.Public(), nil
+	}, opts...)
+
+	// handle all possible errors from parsing the token
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenMalformed) {
+			return nil, apiutils.NewErrBadRequest(err.Error())
+		} else if errors.Is(err, jwt.ErrSignatureInvalid) || errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, apiutils.NewErrUnauthorized(err.Error())
+		}
+
+		log.Error().Str("location", "DecodeToken").Msgf("failed to decode token: %v", err)
+		return nil, apiutils.NewErrUnauthorized("invalid token")
+	}
+
+	claims, ok := payload.Claims.(*Claims)
+	if !ok {
+		log.Error().Str("location", "DecodeToken").Msg("failed to parse claims")
+		return nil, errors.New("failed to parse claims")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,185 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newECKey(t *testing.T) *Key {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func newEdKey(t *testing.T) *Key {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func Test_GenerateAndDecode(t *testing.T) {
+	for name, key := range map[string]*Key{"ES256": newECKey(t), "EdDSA": newEdKey(t)} {
+		t.Run(name, func(t *testing.T) {
+			manager, err := NewManagerWithKeys([]*Key{key}, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			userID := uuid.New()
+			token, err := manager.GenerateToken(userID, "session")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != key.ID || parsed.Method.Alg() != name {
+				t.Fatalf("unexpected header %v", parsed.Header)
+			}
+
+			claims, err := manager.DecodeToken(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != userID || claims.ID != "session" {
+				t.Fatalf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func Test_KeyRotation(t *testing.T) {
+	oldKey, newKey := newECKey(t), newEdKey(t)
+	before, _ := NewManagerWithKeys([]*Key{oldKey}, time.Minute)
+	token, err := before.GenerateToken(uuid.New(), "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the old key still verifies while it is kept around
+	rotating, _ := NewManagerWithKeys([]*Key{newKey, oldKey}, time.Minute)
+	if _, err := rotating.DecodeToken(token); err != nil {
+		t.Fatalf("token signed by retained key rejected: %v", err)
+	}
+
+	// and is rejected once it is dropped
+	after, _ := NewManagerWithKeys([]*Key{newKey}, time.Minute)
+	if _, err := after.DecodeToken(token); err == nil {
+		t.Fatal("token signed by removed key accepted")
+	}
+
+	if len(rotating.JWKS().Keys) != 2 {
+		t.Fatalf("expected both keys in jwks, got %d", len(rotating.JWKS().Keys))
+	}
+}
+
+func Test_RejectsSymmetricTokens(t *testing.T) {
+	manager, _ := NewManagerWithKeys([]*Key{newEdKey(t)}, time.Minute)
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodHS256, NewClaims(uuid.New(), "session", time.Minute))
+	unsigned.Header["kid"] = manager.keys[0].ID
+	token, err := unsigned.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.DecodeToken(token); err == nil {
+		t.Fatal("hmac token accepted")
+	}
+}
+
+func Test_ParseKey(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParseKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk := key.JWK()
+	if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Kid != key.ID || jwk.Alg != "EdDSA" {
+		t.Fatalf("unexpected jwk %+v", jwk)
+	}
+
+	if _, err := ParseKey([]byte("not a key")); err == nil {
+		t.Fatal("expected error for invalid pem")
+	}
+}
+
+func Test_ServiceToken(t *testing.T) {
+	manager, _ := NewManagerWithKeys([]*Key{newEdKey(t)}, time.Hour)
+
+	userID := uuid.New()
+	token, err := manager.GenerateServiceToken(userID, "nestpass.resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := manager.DecodeServiceToken(token, "nestpass.resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.UserID != userID || len(claims.Audience) != 1 || claims.Audience[0] != "nestpass.resource" {
+		t.Fatalf("unexpected service claims %+v", claims)
+	}
+
+	if claims.ExpiresAt.Sub(claims.IssuedAt.Time) != ServiceTokenDuration {
+		t.Fatal("service token does not use its own duration")
+	}
+}
+
+func Test_ServiceTokenAudience(t *testing.T) {
+	manager, _ := NewManagerWithKeys([]*Key{newEdKey(t)}, time.Hour)
+
+	userID := uuid.New()
+	service, _ := manager.GenerateServiceToken(userID, "nestpass.resource")
+	access, _ := manager.GenerateToken(userID, uuid.NewString())
+
+	if _, err := manager.DecodeToken(access); err != nil {
+		t.Fatalf("access token rejected: %v", err)
+	}
+
+	// neither token type is accepted in place of the other
+	if _, err := manager.DecodeToken(service); err == nil {
+		t.Fatal("service token accepted as access token")
+	}
+	if _, err := manager.DecodeServiceToken(access, "nestpass.resource"); err == nil {
+		t.Fatal("access token accepted as service token")
+	}
+	if _, err := manager.DecodeServiceToken(service, "nestpass.email"); err == nil {
+		t.Fatal("service token for another audience accepted")
+	}
+}
@@ -0,0 +1,132 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing key along with its key id.
+type Key struct {
+	ID      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// Public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+}
+
+// Set of public keys served on the jwks endpoint.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Loads a PKCS#8 PEM encoded P-256 (ES256) or Ed25519 (EdDSA) private key from a file.
+func LoadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKey(data)
+}
+
+// Parses a PKCS#8 PEM encoded P-256 (ES256) or Ed25519 (EdDSA) private key.
+func ParseKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid pem key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(parsed)
+}
+
+// Wraps a private key, the key id is the RFC 7638 thumbprint of its public key.
+func NewKey(private interface{}) (*Key, error) {
+	key := &Key{}
+	switch k := private.(type) {
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("unsupported ecdsa curve, only P-256 is supported")
+		}
+		key.method, key.private = jwt.SigningMethodES256, k
+	case ed25519.PrivateKey:
+		key.method, key.private = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+
+	// kid is the thumbprint of the required members in lexicographic order
+	jwk := key.JWK()
+	var thumb []byte
+	if jwk.Kty == "EC" {
+		thumb, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y})
+	} else {
+		thumb, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+	}
+	sum := sha256.Sum256(thumb)
+	key.ID = base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return key, nil
+}
+
+// Returns the public half of the key.
+func (k *Key) Public() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// Returns the public key in JSON Web Key format.
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.method.Alg()}
+	switch pub := k.Public().(type) {
+	case *ecdsa.PublicKey:
+		jwk.Kty, jwk.Crv = "EC", "P-256"
+		jwk.X = encodeCoordinate(pub.X)
+		jwk.Y = encodeCoordinate(pub.Y)
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+
+	return jwk
+}
+
+// helper: encodeCoordinate encodes a P-256 coordinate padded to 32 bytes.
+func encodeCoordinate(n *big.Int) string {
+	b := make([]byte, 32)
+	return base64.RawURLEncoding.EncodeToString(n.FillBytes(b))
+}
@@ -14,9 +14,10 @@ type Claims struct {
 }
 
 // Creates a new Claims struct.
-func NewClaims(userID uuid.UUID, duration time.Duration) *Claims {
+func NewClaims(userID uuid.UUID, sessionID string, duration time.Duration) *Claims {
 	return &Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -25,3 +26,10 @@ func NewClaims(userID uuid.UUID, duration time.Duration) *Claims {
 		UserID: userID,
 	}
 }
+
+// Creates claims for a short lived service token, the audience keeps it from being accepted as an access token.
+func NewServiceClaims(userID uuid.UUID, audience string, duration time.Duration) *Claims {
+	claims := NewClaims(userID, uuid.NewString(), duration)
+	claims.Audience = jwt.ClaimStrings{audience}
+	return claims
+}
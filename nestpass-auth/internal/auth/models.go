@@ -19,6 +19,24 @@ type User struct {
 	UserStatus string
 }
 
+// Refresh token data stored in the cache under the token hash.
+type RefreshRecord struct {
+	UserID   uuid.UUID
+	FamilyID string
+	Used     bool
+}
+
+// Active session listed in the session registry, the session id is the jti of its access tokens.
+type SessionInfo struct {
+	SessionID string    `json:"session_id"`
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	IssuedAt  time.Time `json:"issued_at"`
+	LastUsed  time.Time `json:"last_used"`
+	Expires   time.Time `json:"expires"`
+	Current   bool      `json:"current"`
+}
+
 // user statuses
 const (
 	NonRegUser   = "nonreg"
@@ -12,11 +12,12 @@ import (
 )
 
 type Handler struct {
-	svc *Service
+	svc     *Service
+	prodEnv bool
 }
 
 func NewHandler(cfg *config.Configuration, deps *auth.Dependencies) *Handler {
-	return &Handler{svc: NewService(cfg.OAuth, deps)}
+	return &Handler{svc: NewService(cfg.OAuth, deps), prodEnv: deps.ProdEnv}
 }
 
 func (h *Handler) Invoke(w http.ResponseWriter, r *http.Request) {
@@ -59,27 +60,35 @@ func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
 		MaxAge:  -1,
 	})
 
-	authToken, err := h.svc.UserLoginSignup(ctx, token)
+	pair, err := h.svc.UserLoginSignup(ctx, token)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    authToken,
-		Expires:  time.Now().Add(12 * time.Hour),
-		Path:     "/",
-		Secure:   true,
-		HttpOnly: true,
-	})
+	// always secure, browsers also accept secure cookies from http://localhost during development
+	if err := auth.SetAuthCookies(w, pair, true); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
 
 	resp := apiutils.NewRes(http.StatusOK, "authenticated successfully", nil)
 	resp.SendRes(w)
 }
 
 func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement token refresh logic here
+	pair, err := h.svc.Refresh(r.Context(), auth.GetRefreshToken(r))
+	if err != nil {
+		auth.ClearAuthCookies(w, h.prodEnv)
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := auth.SetAuthCookies(w, pair, h.prodEnv); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
 	resp := apiutils.NewRes(http.StatusOK, "", nil)
 	resp.SendRes(w)
 }
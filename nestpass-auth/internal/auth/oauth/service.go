@@ -16,16 +16,15 @@ import (
 	"golang.org/x/oauth2/google"
 
 	"project/internal/auth"
-	"project/internal/auth/jwt"
 	"project/internal/config"
 )
 
 const userInfoURL = "https://www.googleapis.com/oauth2/v3/userinfo"
 
 type Service struct {
-	oauthCfg   *oauth2.Config
-	repo       *auth.Repository
-	jwtManager *jwt.Manager
+	oauthCfg     *oauth2.Config
+	repo         *auth.Repository
+	tokenManager *auth.TokenManager
 }
 
 func NewService(oauthCfg *config.OAuthConfig, deps *auth.Dependencies) *Service {
@@ -37,9 +36,9 @@ func NewService(oauthCfg *config.OAuthConfig, deps *auth.Dependencies) *Service
 		Endpoint:     google.Endpoint,
 	}
 	return &Service{
-		oauthCfg:   cfg,
-		repo:       deps.Repository,
-		jwtManager: deps.JWTManager,
+		oauthCfg:     cfg,
+		repo:         deps.Repository,
+		tokenManager: deps.TokenManager,
 	}
 }
 
@@ -94,10 +93,10 @@ func (s *Service) CallbackOAuth(ctx context.Context, code string, state string,
 	return token, nil
 }
 
-func (s *Service) UserLoginSignup(ctx context.Context, token *oauth2.Token) (string, error) {
+func (s *Service) UserLoginSignup(ctx context.Context, token *oauth2.Token) (*auth.TokenPair, error) {
 	data, err := s.getOAuthData(ctx, token)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	user, err := s.repo.GetUserCredentials(ctx, data.Email)
@@ -130,22 +129,17 @@ func (s *Service) UserLoginSignup(ctx context.Context, token *oauth2.Token) (str
 				log.Info().Msgf("%v: registered user", newUser.UserID)
 			}()
 
-			authToken, err := s.jwtManager.GenerateToken(newUser.UserID)
-			if err != nil {
-				return "", err
-			}
-
-			return authToken, nil
+			return s.tokenManager.Issue(ctx, newUser.UserID)
 		default:
 			// some other error occurred
-			return "", err
+			return nil, err
 		}
 	}
 
-	authToken, err := s.jwtManager.GenerateToken(user.UserID)
-	if err != nil {
-		return "", err
-	}
+	return s.tokenManager.Issue(ctx, user.UserID)
+}
 
-	return authToken, nil
+// Exchanges a refresh token for a new token pair.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*auth.TokenPair, error) {
+	return s.tokenManager.Rotate(ctx, refreshToken)
 }
@@ -0,0 +1,105 @@
+package passkey
+
+import (
+	"net/http"
+
+	"github.com/tuan882612/apiutils"
+
+	"project/internal/auth"
+	"project/internal/config"
+	"project/pkg/helpers"
+)
+
+// struct for handling passkey requests
+type Handler struct {
+	passkeyService *Service
+	prodEnv        bool
+}
+
+// NewHandler returns a new handler for passkey requests
+func NewHandler(cfg *config.Configuration, deps *auth.Dependencies) (*Handler, error) {
+	svc, err := NewService(cfg.Security, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{passkeyService: svc, prodEnv: deps.ProdEnv}, nil
+}
+
+// Handles starting the registration ceremony for the authenticated user
+func (h *Handler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, err := helpers.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	creation, err := h.passkeyService.BeginRegistration(r.Context(), userID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", creation)
+	resp.SendRes(w)
+}
+
+// Handles finishing the registration ceremony
+func (h *Handler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, err := helpers.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.passkeyService.FinishRegistration(r.Context(), userID, r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusCreated, "", nil)
+	resp.SendRes(w)
+}
+
+// Handles starting the login ceremony
+func (h *Handler) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	input := &auth.Resend{}
+	if err := input.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	assertion, userID, err := h.passkeyService.BeginLogin(r.Context(), input.Email)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", assertion)
+	resp.AddHeader(w, map[string]string{"X-Uid": userID})
+	resp.SendRes(w)
+}
+
+// Handles finishing the login ceremony
+func (h *Handler) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	userID, err := helpers.GetUidHeader(r)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	pair, err := h.passkeyService.FinishLogin(r.Context(), userID, r.Body)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	// Set JWT, refresh and CSRF cookies
+	if err := auth.SetAuthCookies(w, pair, h.prodEnv); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
@@ -0,0 +1,44 @@
+package passkey
+
+import (
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+
+	"project/internal/config"
+)
+
+// User adapts a nestpass user to the webauthn.User interface.
+type User struct {
+	UserID      uuid.UUID
+	Email       string
+	Credentials []webauthn.Credential
+}
+
+func (u *User) WebAuthnID() []byte {
+	return u.UserID[:]
+}
+
+func (u *User) WebAuthnName() string {
+	return u.Email
+}
+
+func (u *User) WebAuthnDisplayName() string {
+	return u.Email
+}
+
+func (u *User) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *User) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
+
+// Creates the relying party from the security configuration.
+func NewWebAuthn(cfg *config.SecurityConfig) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     cfg.WebAuthnOrigins,
+	})
+}
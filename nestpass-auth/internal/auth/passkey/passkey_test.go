@@ -0,0 +1,260 @@
+package passkey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+
+	"project/internal/config"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:5173"
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator is a minimal ES256 software authenticator using "none" attestation.
+type softAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	credID    []byte
+	signCount uint32
+	origin    string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+
+	credID := make([]byte, 16)
+	rand.Read(credID)
+
+	return &softAuthenticator{key: key, credID: credID, origin: testOrigin}
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": b64.EncodeToString(challenge),
+		"origin":    a.origin,
+	})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(testRPID))
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, a.signCount)
+
+	data := append(rpHash[:], flags)
+	data = append(data, counter...)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) register(t *testing.T, creation *protocol.CredentialCreation) []byte {
+	coseKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("cbor.Marshal() error: %v", err)
+	}
+
+	// aaguid, credential id length, credential id, public key
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credID)))
+	attested = append(attested, a.credID...)
+	attested = append(attested, coseKey...)
+
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(0x45, attested), // UP | UV | AT
+	})
+	if err != nil {
+		t.Fatalf("cbor.Marshal() error: %v", err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credID),
+		"rawId": b64.EncodeToString(a.credID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", creation.Response.Challenge)),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	})
+	return body
+}
+
+func (a *softAuthenticator) login(t *testing.T, assertion *protocol.CredentialAssertion, userID []byte) []byte {
+	clientData := a.clientData("webauthn.get", assertion.Response.Challenge)
+	authData := a.authData(0x05, nil) // UP | UV
+
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("SignASN1() error: %v", err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credID),
+		"rawId": b64.EncodeToString(a.credID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(userID),
+		},
+	})
+	return body
+}
+
+func newTestWebAuthn(t *testing.T) *webauthn.WebAuthn {
+	webAuthn, err := NewWebAuthn(&config.SecurityConfig{
+		WebAuthnRPID:    testRPID,
+		WebAuthnRPName:  "nestpass",
+		WebAuthnOrigins: []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatalf("NewWebAuthn() error: %v", err)
+	}
+
+	return webAuthn
+}
+
+// registers the authenticator and returns the credential as it would be loaded from the database.
+func registerCredential(t *testing.T, webAuthn *webauthn.WebAuthn, user *User, a *softAuthenticator) webauthn.Credential {
+	creation, session, err := webAuthn.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("BeginRegistration() error: %v", err)
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(a.register(t, creation)))
+	if err != nil {
+		t.Fatalf("ParseCredentialCreationResponseBody() error: %v", err)
+	}
+
+	credential, err := webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		t.Fatalf("CreateCredential() error: %v", err)
+	}
+
+	// round trip through json like the repository does
+	data, _ := json.Marshal(credential)
+	stored := webauthn.Credential{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("json.Unmarshal() error: %v", err)
+	}
+
+	return stored
+}
+
+func Test_RegisterAndLogin(t *testing.T) {
+	webAuthn := newTestWebAuthn(t)
+	user := &User{UserID: uuid.New(), Email: "user@nestpass.dev"}
+	authenticator := newSoftAuthenticator(t)
+
+	user.Credentials = append(user.Credentials, registerCredential(t, webAuthn, user, authenticator))
+
+	for i := 0; i < 2; i++ {
+		authenticator.signCount++
+
+		assertion, session, err := webAuthn.BeginLogin(user)
+		if err != nil {
+			t.Fatalf("BeginLogin() error: %v", err)
+		}
+
+		body := authenticator.login(t, assertion, user.WebAuthnID())
+		parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("ParseCredentialRequestResponseBody() error: %v", err)
+		}
+
+		credential, err := webAuthn.ValidateLogin(user, *session, parsed)
+		if err != nil {
+			t.Fatalf("ValidateLogin() error: %v", err)
+		}
+
+		if credential.Authenticator.CloneWarning {
+			t.Errorf("ValidateLogin() flagged an increasing sign count as cloned")
+		}
+
+		user.Credentials[0] = *credential
+	}
+}
+
+func Test_LoginRejectsReplayedCounter(t *testing.T) {
+	webAuthn := newTestWebAuthn(t)
+	user := &User{UserID: uuid.New(), Email: "user@nestpass.dev"}
+	authenticator := newSoftAuthenticator(t)
+
+	credential := registerCredential(t, webAuthn, user, authenticator)
+	credential.Authenticator.SignCount = 10
+	user.Credentials = append(user.Credentials, credential)
+
+	authenticator.signCount = 10
+	assertion, session, err := webAuthn.BeginLogin(user)
+	if err != nil {
+		t.Fatalf("BeginLogin() error: %v", err)
+	}
+
+	body := authenticator.login(t, assertion, user.WebAuthnID())
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("ParseCredentialRequestResponseBody() error: %v", err)
+	}
+
+	validated, err := webAuthn.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		t.Fatalf("ValidateLogin() error: %v", err)
+	}
+
+	if !validated.Authenticator.CloneWarning {
+		t.Errorf("ValidateLogin() did not flag a non increasing sign count")
+	}
+}
+
+func Test_LoginRejectsWrongOrigin(t *testing.T) {
+	webAuthn := newTestWebAuthn(t)
+	user := &User{UserID: uuid.New(), Email: "user@nestpass.dev"}
+	authenticator := newSoftAuthenticator(t)
+
+	user.Credentials = append(user.Credentials, registerCredential(t, webAuthn, user, authenticator))
+
+	authenticator.signCount++
+	authenticator.origin = "https://evil.example"
+	assertion, session, err := webAuthn.BeginLogin(user)
+	if err != nil {
+		t.Fatalf("BeginLogin() error: %v", err)
+	}
+
+	body := authenticator.login(t, assertion, user.WebAuthnID())
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("ParseCredentialRequestResponseBody() error: %v", err)
+	}
+
+	if _, err := webAuthn.ValidateLogin(user, *session, parsed); err == nil {
+		t.Errorf("ValidateLogin() accepted an assertion from a foreign origin")
+	}
+}
@@ -0,0 +1,191 @@
+package passkey
+
+import (
+	"context"
+	"io"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"project/internal/auth"
+	"project/internal/config"
+)
+
+// Service for handling passkey registration and login ceremonies.
+type Service struct {
+	authRepo     *auth.Repository // base auth repository
+	cacheRepo    *auth.Cache      // cache repository
+	tokenManager *auth.TokenManager
+	webAuthn     *webauthn.WebAuthn
+}
+
+// Creates a new passkey service with the given dependencies.
+func NewService(cfg *config.SecurityConfig, deps *auth.Dependencies) (*Service, error) {
+	webAuthn, err := NewWebAuthn(cfg)
+	if err != nil {
+		log.Error().Str("location", "NewService").Msgf("failed to initialize webauthn: %v", err)
+		return nil, err
+	}
+
+	return &Service{
+		authRepo:     deps.Repository,
+		cacheRepo:    deps.Cache,
+		tokenManager: deps.TokenManager,
+		webAuthn:     webAuthn,
+	}, nil
+}
+
+// helper: getUser loads the user along with all registered credentials.
+func (s *Service) getUser(ctx context.Context, userID uuid.UUID, email string) (*User, error) {
+	credentials, err := s.authRepo.GetPasskeyCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{UserID: userID, Email: email, Credentials: credentials}, nil
+}
+
+// Starts the registration ceremony for the authenticated user.
+func (s *Service) BeginRegistration(ctx context.Context, userID uuid.UUID) (*protocol.CredentialCreation, error) {
+	email, err := s.authRepo.GetUserEmail(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUser(ctx, userID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	// exclude already registered credentials so an authenticator is not registered twice
+	exclusions := []protocol.CredentialDescriptor{}
+	for _, credential := range user.Credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := s.webAuthn.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		log.Error().Str("location", "BeginRegistration").Msgf("%v: failed to begin registration: %v", userID, err)
+		return nil, err
+	}
+
+	if err := s.cacheRepo.AddPasskeySession(ctx, userID, auth.PasskeyRegister, session); err != nil {
+		return nil, err
+	}
+
+	return creation, nil
+}
+
+// Verifies the attestation response and stores the new credential.
+func (s *Service) FinishRegistration(ctx context.Context, userID uuid.UUID, body io.Reader) error {
+	session, err := s.cacheRepo.TakePasskeySession(ctx, userID, auth.PasskeyRegister)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return apiutils.NewErrBadRequest("invalid attestation response")
+	}
+
+	email, err := s.authRepo.GetUserEmail(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.getUser(ctx, userID, email)
+	if err != nil {
+		return err
+	}
+
+	credential, err := s.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		log.Info().Str("location", "FinishRegistration").Msgf("%v: attestation rejected: %v", userID, err)
+		return apiutils.NewErrUnauthorized("attestation rejected")
+	}
+
+	return s.authRepo.AddPasskeyCredential(ctx, userID, credential)
+}
+
+// Starts the login ceremony for the user with the given email.
+func (s *Service) BeginLogin(ctx context.Context, email string) (*protocol.CredentialAssertion, string, error) {
+	creds, err := s.authRepo.GetUserCredentials(ctx, email)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// check if user is inactive
+	if creds.UserStatus != auth.ActiveUser {
+		return nil, "", apiutils.NewErrForbidden("user is not active")
+	}
+
+	// check if user is restricted
+	if _, err := s.cacheRepo.GetData(ctx, creds.UserID, auth.Restricted); err != nil {
+		return nil, "", err
+	}
+
+	user, err := s.getUser(ctx, creds.UserID, email)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(user.Credentials) == 0 {
+		return nil, "", apiutils.NewErrNotFound("no passkeys registered")
+	}
+
+	assertion, session, err := s.webAuthn.BeginLogin(user)
+	if err != nil {
+		log.Error().Str("location", "BeginLogin").Msgf("%v: failed to begin login: %v", creds.UserID, err)
+		return nil, "", err
+	}
+
+	if err := s.cacheRepo.AddPasskeySession(ctx, creds.UserID, auth.PasskeyLogin, session); err != nil {
+		return nil, "", err
+	}
+
+	return assertion, creds.UserID.String(), nil
+}
+
+// Verifies the assertion response and returns a token pair if successful.
+func (s *Service) FinishLogin(ctx context.Context, userID uuid.UUID, body io.Reader) (*auth.TokenPair, error) {
+	session, err := s.cacheRepo.TakePasskeySession(ctx, userID, auth.PasskeyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return nil, apiutils.NewErrBadRequest("invalid assertion response")
+	}
+
+	email, err := s.authRepo.GetUserEmail(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUser(ctx, userID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webAuthn.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		log.Info().Str("location", "FinishLogin").Msgf("%v: assertion rejected: %v", userID, err)
+		return nil, apiutils.NewErrUnauthorized("assertion rejected")
+	}
+
+	// a sign count that did not increase signals a cloned authenticator
+	if credential.Authenticator.CloneWarning {
+		log.Warn().Str("location", "FinishLogin").Msgf("%v: possible cloned authenticator", userID)
+		return nil, apiutils.NewErrUnauthorized("assertion rejected")
+	}
+
+	if err := s.authRepo.UpdatePasskeyCredential(ctx, userID, credential); err != nil {
+		return nil, err
+	}
+
+	return s.tokenManager.Issue(ctx, userID)
+}
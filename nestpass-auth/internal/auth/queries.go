@@ -22,4 +22,43 @@ const (
 		UPDATE users
 		SET password = $2
 		WHERE user_id = $1`
+	AddVaultRewrapQuery string = `
+		INSERT INTO vault_rewraps
+			(rewrap_id, user_id, prev_hash, queued, retry_at)
+		VALUES ($1, $2, $3, $4, $4)`
+	GetUserEmailQuery string = `
+		SELECT email
+		FROM users
+		WHERE user_id = $1`
+	GetTOTPSecretQuery string = `
+		SELECT
+			user_id, nonce, encrypted, confirmed
+		FROM totp_secrets
+		WHERE user_id = $1`
+	UpsertTOTPSecretQuery string = `
+		INSERT INTO totp_secrets
+			(user_id, nonce, encrypted, confirmed)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET nonce = $2, encrypted = $3, confirmed = $4
+		WHERE totp_secrets.confirmed = false`
+	ConfirmTOTPSecretQuery string = `
+		UPDATE totp_secrets
+		SET confirmed = true
+		WHERE user_id = $1`
+	DeleteTOTPSecretQuery string = `
+		DELETE FROM totp_secrets
+		WHERE user_id = $1`
+	GetPasskeyCredentialsQuery string = `
+		SELECT credential
+		FROM passkey_credentials
+		WHERE user_id = $1`
+	AddPasskeyCredentialQuery string = `
+		INSERT INTO passkey_credentials
+			(credential_id, user_id, credential, created)
+		VALUES ($1, $2, $3, $4)`
+	UpdatePasskeyCredentialQuery string = `
+		UPDATE passkey_credentials
+		SET credential = $3, last_used = $4
+		WHERE credential_id = $1 AND user_id = $2`
 )
@@ -2,8 +2,11 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -11,6 +14,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/tuan882612/apiutils"
 
+	"project/internal/auth/totp"
 	"project/internal/database"
 )
 
@@ -100,8 +104,8 @@ func (r *Repository) UpdateUserStatus(ctx context.Context, userID uuid.UUID) err
 }
 
 // Updates the user's password.
-func (r *Repository) UpdateUserPassword(ctx context.Context, userID uuid.UUID, password string) error {
-	if _, err := r.db.Exec(ctx, UpdateUserPasswordQuery, userID, password); err != nil {
+func (r *Repository) UpdateUserPassword(ctx context.Context, tx pgx.Tx, userID uuid.UUID, password string) error {
+	if _, err := tx.Exec(ctx, UpdateUserPasswordQuery, userID, password); err != nil {
 		log.Error().Str("location", "UpdateUserPassword").Msgf("%v: failed to update user password: %v", userID, err)
 		return err
 	}
@@ -109,6 +113,164 @@ func (r *Repository) UpdateUserPassword(ctx context.Context, userID uuid.UUID, p
 	return nil
 }
 
+// Records that the user's vault has to be rewrapped from the password hash before a reset.
+func (r *Repository) AddVaultRewrap(ctx context.Context, tx pgx.Tx, userID uuid.UUID, prevHash string) error {
+	if _, err := tx.Exec(ctx, AddVaultRewrapQuery, uuid.New(), userID, prevHash, time.Now()); err != nil {
+		log.Error().Str("location", "AddVaultRewrap").Msgf("%v: failed to add vault rewrap: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the user's email.
+func (r *Repository) GetUserEmail(ctx context.Context, userID uuid.UUID) (string, error) {
+	var email string
+	row := r.db.QueryRow(ctx, GetUserEmailQuery, userID)
+
+	// scan the row and check for errors
+	if err := row.Scan(&email); err != nil {
+		if err == pgx.ErrNoRows {
+			return "", apiutils.NewErrNotFound("user not found")
+		}
+
+		log.Error().Str("location", "GetUserEmail").Msgf("%v: failed to get user email: %v", userID, err)
+		return "", err
+	}
+
+	return email, nil
+}
+
+// Retrieves the user's encrypted totp secret.
+func (r *Repository) GetTOTPSecret(ctx context.Context, userID uuid.UUID) (*totp.Secret, error) {
+	secret := &totp.Secret{}
+	row := r.db.QueryRow(ctx, GetTOTPSecretQuery, userID)
+
+	// scan the row and check for errors
+	if err := secret.Scan(row); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("totp not enrolled")
+		}
+
+		log.Error().Str("location", "GetTOTPSecret").Msgf("%v: failed to get totp secret: %v", userID, err)
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// Adds or replaces the user's pending totp secret, a confirmed secret is never overwritten.
+func (r *Repository) UpsertTOTPSecret(ctx context.Context, secret *totp.Secret) error {
+	tag, err := r.db.Exec(ctx, UpsertTOTPSecretQuery,
+		secret.UserID,
+		secret.Nonce,
+		secret.Encrypted,
+		secret.Confirmed,
+	)
+
+	if err != nil {
+		log.Error().Str("location", "UpsertTOTPSecret").Msgf("%v: failed to add totp secret: %v", secret.UserID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrConflict("totp already enrolled")
+	}
+
+	return nil
+}
+
+// Marks the user's totp secret as confirmed.
+func (r *Repository) ConfirmTOTPSecret(ctx context.Context, userID uuid.UUID) error {
+	if _, err := r.db.Exec(ctx, ConfirmTOTPSecretQuery, userID); err != nil {
+		log.Error().Str("location", "ConfirmTOTPSecret").Msgf("%v: failed to confirm totp secret: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Removes the user's totp secret.
+func (r *Repository) DeleteTOTPSecret(ctx context.Context, userID uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, DeleteTOTPSecretQuery, userID)
+	if err != nil {
+		log.Error().Str("location", "DeleteTOTPSecret").Msgf("%v: failed to delete totp secret: %v", userID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrNotFound("totp not enrolled")
+	}
+
+	return nil
+}
+
+// Retrieves all of the user's registered passkey credentials.
+func (r *Repository) GetPasskeyCredentials(ctx context.Context, userID uuid.UUID) ([]webauthn.Credential, error) {
+	rows, err := r.db.Query(ctx, GetPasskeyCredentialsQuery, userID)
+	if err != nil {
+		log.Error().Str("location", "GetPasskeyCredentials").Msgf("%v: failed to get passkey credentials: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []webauthn.Credential{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			log.Error().Str("location", "GetPasskeyCredentials").Msgf("%v: failed to scan passkey credential: %v", userID, err)
+			return nil, err
+		}
+
+		credential := webauthn.Credential{}
+		if err := json.Unmarshal(data, &credential); err != nil {
+			log.Error().Str("location", "GetPasskeyCredentials").Msgf("%v: failed to deserialize passkey credential: %v", userID, err)
+			return nil, err
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+// Adds a newly registered passkey credential for the user.
+func (r *Repository) AddPasskeyCredential(ctx context.Context, userID uuid.UUID, credential *webauthn.Credential) error {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		log.Error().Str("location", "AddPasskeyCredential").Msgf("%v: failed to serialize passkey credential: %v", userID, err)
+		return err
+	}
+
+	if _, err := r.db.Exec(ctx, AddPasskeyCredentialQuery, credential.ID, userID, data, time.Now()); err != nil {
+		pgErr := &pgconn.PgError{}
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return apiutils.NewErrConflict("passkey already registered")
+		}
+
+		log.Error().Str("location", "AddPasskeyCredential").Msgf("%v: failed to add passkey credential: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Updates a passkey credential after a successful assertion (sign count, flags).
+func (r *Repository) UpdatePasskeyCredential(ctx context.Context, userID uuid.UUID, credential *webauthn.Credential) error {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		log.Error().Str("location", "UpdatePasskeyCredential").Msgf("%v: failed to serialize passkey credential: %v", userID, err)
+		return err
+	}
+
+	if _, err := r.db.Exec(ctx, UpdatePasskeyCredentialQuery, credential.ID, userID, data, time.Now()); err != nil {
+		log.Error().Str("location", "UpdatePasskeyCredential").Msgf("%v: failed to update passkey credential: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
 // Starts a new postgres transaction.
 func (r *Repository) StartTx(ctx context.Context) (pgx.Tx, error) {
 	tx, err := r.db.Begin(ctx)
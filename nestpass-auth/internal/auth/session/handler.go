@@ -0,0 +1,109 @@
+package session
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tuan882612/apiutils"
+
+	"project/internal/auth"
+	"project/pkg/helpers"
+)
+
+// struct for handling session registry requests
+type Handler struct {
+	sessionService *Service
+	prodEnv        bool
+}
+
+// NewHandler returns a new handler for session registry requests
+func NewHandler(deps *auth.Dependencies) *Handler {
+	return &Handler{sessionService: NewService(deps), prodEnv: deps.ProdEnv}
+}
+
+// Handles listing the user's active sessions
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := helpers.UidFromCtx(ctx)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	sessionID, err := helpers.SessionFromCtx(ctx)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	sessions, err := h.sessionService.List(ctx, userID, sessionID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", sessions)
+	resp.SendRes(w)
+}
+
+// Handles logging out of the current session
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := helpers.UidFromCtx(ctx)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	sessionID, err := helpers.SessionFromCtx(ctx)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.sessionService.Revoke(ctx, userID, sessionID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	auth.ClearAuthCookies(w, h.prodEnv)
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+// Handles revoking one of the user's sessions
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := helpers.UidFromCtx(ctx)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.sessionService.Revoke(ctx, userID, chi.URLParam(r, "session_id")); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+// Handles revoking every session of the user ("log out everywhere")
+func (h *Handler) RevokeAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := helpers.UidFromCtx(ctx)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.sessionService.RevokeAll(ctx, userID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	auth.ClearAuthCookies(w, h.prodEnv)
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
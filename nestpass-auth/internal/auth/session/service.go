@@ -0,0 +1,43 @@
+package session
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"project/internal/auth"
+)
+
+// Service for managing the user's active sessions.
+type Service struct {
+	cacheRepo    *auth.Cache // cache repository
+	tokenManager *auth.TokenManager
+}
+
+// Creates a new session service with the given dependencies.
+func NewService(deps *auth.Dependencies) *Service {
+	return &Service{
+		cacheRepo:    deps.Cache,
+		tokenManager: deps.TokenManager,
+	}
+}
+
+// Lists the user's active sessions.
+func (s *Service) List(ctx context.Context, userID uuid.UUID, currentID string) ([]*auth.SessionInfo, error) {
+	return s.tokenManager.Sessions(ctx, userID, currentID)
+}
+
+// Revokes a single session of the user.
+func (s *Service) Revoke(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	// make sure the session belongs to the user
+	if _, err := s.cacheRepo.GetUserSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	return s.tokenManager.RevokeSession(ctx, userID, sessionID)
+}
+
+// Revokes every session of the user.
+func (s *Service) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	return s.tokenManager.RevokeAll(ctx, userID)
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"project/internal/auth/jwt"
+	"project/pkg/helpers"
+)
+
+// Access and refresh tokens handed out together on login and on every refresh.
+type TokenPair struct {
+	AccessToken    string
+	AccessExpires  time.Time
+	RefreshToken   string
+	RefreshExpires time.Time
+}
+
+// Issues token pairs and rotates refresh tokens with reuse detection.
+type TokenManager struct {
+	cache           *Cache
+	jwtManager      *jwt.Manager
+	refreshDuration time.Duration
+}
+
+// Constructor for the token manager.
+func NewTokenManager(cache *Cache, jwtManager *jwt.Manager, refreshDuration time.Duration) *TokenManager {
+	return &TokenManager{cache: cache, jwtManager: jwtManager, refreshDuration: refreshDuration}
+}
+
+// helper: newRefreshToken generates an opaque refresh token and the hash it is stored under.
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashRefreshToken(token), nil
+}
+
+// helper: hashRefreshToken hashes the token so the cache never holds usable refresh tokens.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// helper: newPair signs an access token for the session and bundles it with the given refresh token.
+func (t *TokenManager) newPair(userID uuid.UUID, sessionID, refreshToken string) (*TokenPair, error) {
+	accessToken, err := t.jwtManager.GenerateToken(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &TokenPair{
+		AccessToken:    accessToken,
+		AccessExpires:  now.Add(t.jwtManager.Duration()),
+		RefreshToken:   refreshToken,
+		RefreshExpires: now.Add(t.refreshDuration),
+	}, nil
+}
+
+// Issues a token pair starting a new session, the refresh token family id doubles as the session id (jti).
+func (t *TokenManager) Issue(ctx context.Context, userID uuid.UUID) (*TokenPair, error) {
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		log.Error().Str("location", "Issue").Msgf("%v: failed to generate refresh token: %v", userID, err)
+		return nil, err
+	}
+
+	record := &RefreshRecord{UserID: userID, FamilyID: uuid.NewString()}
+	if err := t.cache.AddRefreshToken(ctx, hash, record, t.refreshDuration); err != nil {
+		return nil, err
+	}
+
+	// register the session with the requesting client
+	now := time.Now()
+	client := helpers.ClientFromCtx(ctx)
+	session := &SessionInfo{
+		SessionID: record.FamilyID,
+		Device:    client.Device,
+		IP:        client.IP,
+		IssuedAt:  now,
+		LastUsed:  now,
+		Expires:   now.Add(t.refreshDuration),
+	}
+	if err := t.cache.SetUserSession(ctx, userID, session); err != nil {
+		return nil, err
+	}
+
+	return t.newPair(userID, record.FamilyID, token)
+}
+
+// Exchanges a refresh token for a new token pair, presenting an already used token revokes the whole family.
+func (t *TokenManager) Rotate(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	if refreshToken == "" {
+		return nil, apiutils.NewErrUnauthorized("missing refresh token")
+	}
+
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		log.Error().Str("location", "Rotate").Msgf("failed to generate refresh token: %v", err)
+		return nil, err
+	}
+
+	record, err := t.cache.RotateRefreshToken(ctx, hashRefreshToken(refreshToken), hash, t.refreshDuration)
+	if err != nil {
+		if err == ErrRefreshReuse {
+			log.Warn().Str("location", "Rotate").Msgf("%v: refresh token reused, revoking session %s", record.UserID, record.FamilyID)
+			if err := t.RevokeSession(ctx, record.UserID, record.FamilyID); err != nil {
+				return nil, err
+			}
+
+			return nil, apiutils.NewErrUnauthorized("refresh token reused")
+		}
+
+		return nil, err
+	}
+
+	// keep the registry entry alive along with the refresh token
+	session, err := t.cache.GetUserSession(ctx, record.UserID, record.FamilyID)
+	if err != nil {
+		if _, ok := err.(apiutils.ErrNotFound); ok {
+			if err := t.cache.RevokeRefreshFamily(ctx, record.FamilyID); err != nil {
+				return nil, err
+			}
+
+			return nil, apiutils.NewErrUnauthorized("session revoked")
+		}
+
+		return nil, err
+	}
+
+	now := time.Now()
+	client := helpers.ClientFromCtx(ctx)
+	if client.IP != "" {
+		session.IP = client.IP
+	}
+	session.LastUsed = now
+	session.Expires = now.Add(t.refreshDuration)
+	if err := t.cache.SetUserSession(ctx, record.UserID, session); err != nil {
+		return nil, err
+	}
+
+	return t.newPair(record.UserID, record.FamilyID, token)
+}
+
+// Revokes the session the given refresh token belongs to.
+func (t *TokenManager) Revoke(ctx context.Context, refreshToken string) error {
+	record, err := t.cache.GetRefreshToken(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		return err
+	}
+
+	return t.RevokeSession(ctx, record.UserID, record.FamilyID)
+}
+
+// Revokes the session, its access tokens are rejected until they expire.
+func (t *TokenManager) RevokeSession(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	return t.cache.RevokeUserSession(ctx, userID, sessionID, t.jwtManager.Duration())
+}
+
+// Revokes every active session of the user.
+func (t *TokenManager) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	sessions, err := t.cache.GetUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := t.RevokeSession(ctx, userID, session.SessionID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Lists the user's active sessions, flagging the one the request was made with.
+func (t *TokenManager) Sessions(ctx context.Context, userID uuid.UUID, currentID string) ([]*SessionInfo, error) {
+	sessions, err := t.cache.GetUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.SessionID == currentID
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].IssuedAt.After(sessions[j].IssuedAt)
+	})
+
+	return sessions, nil
+}
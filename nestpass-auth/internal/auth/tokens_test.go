@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/tuan882612/apiutils"
+
+	"project/internal/auth/jwt"
+	"project/internal/database"
+)
+
+func newTestTokenManager(t *testing.T) (*TokenManager, *miniredis.Miniredis) {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := jwt.NewKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtManager, err := jwt.NewManagerWithKeys([]*jwt.Key{key}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := miniredis.RunT(t)
+	cache := NewCache(&database.DataAccess{Redis: redis.NewClient(&redis.Options{Addr: server.Addr()})})
+	return NewTokenManager(cache, jwtManager, time.Hour), server
+}
+
+func Test_Rotate(t *testing.T) {
+	manager, _ := newTestTokenManager(t)
+	ctx, userID := context.Background(), uuid.New()
+
+	pair, err := manager.Issue(ctx, userID)
+	if err != nil {
+		t.Fatalf("Issue() error: %v", err)
+	}
+
+	rotated, err := manager.Rotate(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("Rotate() error: %v", err)
+	}
+
+	if rotated.RefreshToken == pair.RefreshToken {
+		t.Fatal("Rotate() handed out the same refresh token")
+	}
+
+	// both access tokens belong to the same session
+	first, _ := manager.jwtManager.DecodeToken(pair.AccessToken)
+	second, err := manager.jwtManager.DecodeToken(rotated.AccessToken)
+	if err != nil || first.ID != second.ID || second.UserID != userID {
+		t.Fatalf("rotated access token claims = %+v, %v", second, err)
+	}
+
+	// the successor keeps rotating
+	if _, err := manager.Rotate(ctx, rotated.RefreshToken); err != nil {
+		t.Fatalf("Rotate() successor error: %v", err)
+	}
+}
+
+func Test_RotateReuseRevokesFamily(t *testing.T) {
+	manager, _ := newTestTokenManager(t)
+	ctx, userID := context.Background(), uuid.New()
+
+	pair, err := manager.Issue(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := manager.Rotate(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// presenting the used token again revokes the whole family
+	if _, err := manager.Rotate(ctx, pair.RefreshToken); err == nil {
+		t.Fatal("Rotate() accepted a reused refresh token")
+	}
+
+	if _, err := manager.Rotate(ctx, rotated.RefreshToken); err == nil {
+		t.Fatal("Rotate() accepted a token of a revoked family")
+	}
+
+	claims, _ := manager.jwtManager.DecodeToken(rotated.AccessToken)
+	if revoked, err := manager.cache.IsSessionRevoked(ctx, claims.ID); err != nil || !revoked {
+		t.Errorf("IsSessionRevoked() = %v, %v, want the session revoked", revoked, err)
+	}
+
+	if sessions, _ := manager.Sessions(ctx, userID, ""); len(sessions) != 0 {
+		t.Errorf("Sessions() = %d sessions, want none", len(sessions))
+	}
+}
+
+func Test_RotateExpired(t *testing.T) {
+	manager, server := newTestTokenManager(t)
+	ctx := context.Background()
+
+	pair, err := manager.Issue(ctx, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.FastForward(manager.refreshDuration + time.Second)
+
+	_, err = manager.Rotate(ctx, pair.RefreshToken)
+	if _, ok := err.(apiutils.ErrUnauthorized); !ok {
+		t.Fatalf("Rotate() error = %v, want unauthorized", err)
+	}
+
+	if _, err := manager.Rotate(ctx, ""); err == nil {
+		t.Error("Rotate() accepted an empty refresh token")
+	}
+}
+
+func Test_AuthCookies(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	pair := &TokenPair{AccessToken: "access", RefreshToken: "refresh", AccessExpires: time.Now().Add(time.Minute)}
+
+	if err := SetAuthCookies(recorder, pair, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cookie := range recorder.Result().Cookies() {
+		if !cookie.Secure {
+			t.Errorf("%s cookie is not secure", cookie.Name)
+		}
+
+		// only the double submit csrf token is meant to be read by scripts
+		if cookie.HttpOnly != (cookie.Name != "token") {
+			t.Errorf("%s cookie http only = %v", cookie.Name, cookie.HttpOnly)
+		}
+	}
+}
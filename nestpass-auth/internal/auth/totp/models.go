@@ -0,0 +1,24 @@
+package totp
+
+import (
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Encrypted TOTP secret as stored in the database.
+type Secret struct {
+	UserID    uuid.UUID
+	Nonce     []byte
+	Encrypted []byte
+	Confirmed bool
+}
+
+func (s *Secret) Scan(row pgx.Row) error {
+	return row.Scan(&s.UserID, &s.Nonce, &s.Encrypted, &s.Confirmed)
+}
+
+// Response data from the totp enroll endpoint.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
@@ -0,0 +1,112 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"project/internal/config"
+	"project/pkg/otp"
+)
+
+// number of periods of clock skew accepted in either direction
+const allowedSkew = 1
+
+// How long the last accepted time step has to be remembered, past it every code at or below the
+// step falls outside the skew window anyway.
+const ReplayWindow = (2*allowedSkew + 2) * otp.Period * time.Second
+
+// Handles TOTP secret generation, encryption at rest and code validation.
+type Manager struct {
+	key    []byte
+	issuer string
+}
+
+// Constructor for the TOTP manager.
+func NewManager(cfg *config.Configuration) *Manager {
+	key := sha256.Sum256([]byte(cfg.Security.TOTPKey))
+	return &Manager{key: key[:], issuer: cfg.Security.TOTPIssuer}
+}
+
+// Generates a new secret for the user and returns it encrypted along with the provisioning data.
+func (m *Manager) NewEnrollment(userID uuid.UUID, account string) (*Secret, *Enrollment, error) {
+	secret, err := otp.NewSecret()
+	if err != nil {
+		log.Error().Str("location", "NewEnrollment").Msgf("%v: failed to generate secret: %v", userID, err)
+		return nil, nil, err
+	}
+
+	encrypted, err := m.encrypt(userID, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enrollment := &Enrollment{
+		Secret: otp.EncodeSecret(secret),
+		URI:    otp.KeyURI(m.issuer, account, secret),
+	}
+
+	return encrypted, enrollment, nil
+}
+
+// Decrypts the stored secret and validates the code against it, returning the time step the code
+// belongs to. Callers only accept steps past the last accepted one so codes cannot be replayed.
+func (m *Manager) Validate(secret *Secret, code string) (uint64, bool, error) {
+	aesgcm, err := m.newGCMBlock()
+	if err != nil {
+		return 0, false, err
+	}
+
+	raw, err := aesgcm.Open(nil, secret.Nonce, secret.Encrypted, secret.UserID[:])
+	if err != nil {
+		log.Error().Str("location", "Validate").Msgf("%v: failed to decrypt totp secret: %v", secret.UserID, err)
+		return 0, false, err
+	}
+
+	step, ok := otp.Match(raw, code, time.Now(), allowedSkew)
+	return step, ok, nil
+}
+
+// helper: encrypt seals the secret bound to the user id.
+func (m *Manager) encrypt(userID uuid.UUID, secret []byte) (*Secret, error) {
+	aesgcm, err := m.newGCMBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		log.Error().Str("location", "encrypt").Msgf("%v: failed to generate nonce: %v", userID, err)
+		return nil, err
+	}
+
+	return &Secret{
+		UserID:    userID,
+		Nonce:     nonce,
+		Encrypted: aesgcm.Seal(nil, nonce, secret, userID[:]),
+		Confirmed: false,
+	}, nil
+}
+
+// helper: newGCMBlock creates the aes-256 gcm block for the manager key.
+func (m *Manager) newGCMBlock() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(m.key)
+	if err != nil {
+		log.Error().Str("location", "newGCMBlock").Msg(err.Error())
+		return nil, err
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		log.Error().Str("location", "newGCMBlock").Msg(err.Error())
+		return nil, err
+	}
+
+	return aesgcm, nil
+}
@@ -3,7 +3,6 @@ package twofa
 import (
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/tuan882612/apiutils"
 
@@ -31,7 +30,9 @@ func (h *Handler) ResendCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.twofaService.ResendCode(r.Context(), input.Email); err != nil {
+	// the mode decides if totp users may get an emailed code, like on verify
+	mode := r.Header.Get("X-Mode")
+	if err := h.twofaService.ResendCode(r.Context(), input.Email, mode); err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
@@ -61,7 +62,7 @@ func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, retryN, err := h.twofaService.VerifyAuthToken(r.Context(), userID, Token.Token, mode)
+	pair, retryN, err := h.twofaService.VerifyAuthToken(r.Context(), userID, Token.Token, mode)
 	if err != nil {
 		w.Header().Set("X-Retry-N", strconv.Itoa(retryN))
 		apiutils.HandleHttpErrors(w, err)
@@ -70,35 +71,35 @@ func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
 
 	resp := apiutils.NewRes(http.StatusOK, "", nil)
 	if mode == "reset" {
-		resp.AddHeader(w, map[string]string{"X-Uid": data})
+		resp.AddHeader(w, map[string]string{"X-Uid": userID.String()})
 	} else {
-		token, err := auth.GenerateStateToken()
-		if err != nil {
+		// Set JWT, refresh and CSRF cookies
+		if err := auth.SetAuthCookies(w, pair, h.prodEnv); err != nil {
 			apiutils.HandleHttpErrors(w, err)
 			return
 		}
-		// Set JWT as HttpOnly cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "Authorization",
-			Value:    data,
-			Expires:  time.Now().Add(12 * time.Hour),
-			Path:     "/",
-			HttpOnly: false,
-			Secure:   h.prodEnv,
-			SameSite: http.SameSiteNoneMode,
-		})
-		http.SetCookie(w, &http.Cookie{
-			Name:     "token",
-			Value:    token,
-			Path:     "/",
-			HttpOnly: false,
-			Secure:   h.prodEnv,
-			SameSite: http.SameSiteNoneMode,
-		})
 	}
 	resp.SendRes(w)
 }
 
+// Handles exchanging the refresh token for a new token pair
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	pair, err := h.twofaService.Refresh(r.Context(), auth.GetRefreshToken(r))
+	if err != nil {
+		auth.ClearAuthCookies(w, h.prodEnv)
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := auth.SetAuthCookies(w, pair, h.prodEnv); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
 // Handles the initial login phase (sending the verification code)
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	input := &auth.Login{}
@@ -107,14 +108,14 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIDStr, err := h.twofaService.LoginSend(r.Context(), input)
+	userIDStr, method, err := h.twofaService.LoginSend(r.Context(), input)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
 	resp := apiutils.NewRes(http.StatusOK, "", nil)
-	resp.AddHeader(w, map[string]string{"X-Uid": userIDStr})
+	resp.AddHeader(w, map[string]string{"X-Uid": userIDStr, "X-Twofa-Method": method})
 	resp.SendRes(w)
 }
 
@@ -178,3 +179,69 @@ func (h *Handler) ResetPasswordFinal(w http.ResponseWriter, r *http.Request) {
 	resp := apiutils.NewRes(http.StatusOK, "", nil)
 	resp.SendRes(w)
 }
+
+// Handles generating a pending totp secret for the authenticated user
+func (h *Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := helpers.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	enrollment, err := h.twofaService.EnrollTOTP(r.Context(), userID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusCreated, "", enrollment)
+	resp.SendRes(w)
+}
+
+// Handles confirming the pending totp secret
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	token := &email.Token{}
+	if err := token.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := helpers.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if retryN, err := h.twofaService.ConfirmTOTP(r.Context(), userID, token.Token); err != nil {
+		w.Header().Set("X-Retry-N", strconv.Itoa(retryN))
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+// Handles removing the totp secret
+func (h *Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	token := &email.Token{}
+	if err := token.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := helpers.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if retryN, err := h.twofaService.DisableTOTP(r.Context(), userID, token.Token); err != nil {
+		w.Header().Set("X-Retry-N", strconv.Itoa(retryN))
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
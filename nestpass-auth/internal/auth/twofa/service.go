@@ -2,37 +2,70 @@ package twofa
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
-	"net/http"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
 	"github.com/tuan882612/apiutils"
 	"github.com/tuan882612/apiutils/securityutils"
 
 	"project/internal/auth"
 	"project/internal/auth/email"
-	"project/internal/auth/jwt"
+	"project/internal/auth/totp"
 	"project/internal/proto/pb/twofapb"
 )
 
+// Data access the service needs from the base auth repository.
+type repository interface {
+	GetUserCredentials(ctx context.Context, email string) (*auth.User, error)
+	GetUserPassword(ctx context.Context, userID uuid.UUID) (string, error)
+	GetUserEmail(ctx context.Context, userID uuid.UUID) (string, error)
+	AddUser(ctx context.Context, tx pgx.Tx, input *auth.Register) error
+	UpdateUserStatus(ctx context.Context, userID uuid.UUID) error
+	UpdateUserPassword(ctx context.Context, tx pgx.Tx, userID uuid.UUID, password string) error
+	AddVaultRewrap(ctx context.Context, tx pgx.Tx, userID uuid.UUID, prevHash string) error
+	GetTOTPSecret(ctx context.Context, userID uuid.UUID) (*totp.Secret, error)
+	UpsertTOTPSecret(ctx context.Context, secret *totp.Secret) error
+	ConfirmTOTPSecret(ctx context.Context, userID uuid.UUID) error
+	DeleteTOTPSecret(ctx context.Context, userID uuid.UUID) error
+	StartTx(ctx context.Context) (pgx.Tx, error)
+}
+
+// Vault operations the service calls on the resource server.
+type vaultService interface {
+	RekeyVault(ctx context.Context, userID uuid.UUID) error
+}
+
 // Service for handling two-factor authentication.
 type Service struct {
-	authRepo     *auth.Repository // base auth repository
-	cacheRepo    *auth.Cache      // cache repository
-	jwtManager   *jwt.Manager
+	authRepo     repository  // base auth repository
+	cacheRepo    *auth.Cache // cache repository
+	tokenManager *auth.TokenManager
+	totpManager  *totp.Manager
 	emailManager *email.Manager
+	vaultManager vaultService
 }
 
+// second factor methods
+const (
+	EmailMethod = "email"
+	TOTPMethod  = "totp"
+)
+
+// wrong codes allowed before the user is restricted, for emailed and totp codes alike
+const maxRetries = 5
+
 // Creates a new two-factor authentication service with the given dependencies.
 func NewService(deps *auth.Dependencies) *Service {
 	return &Service{
 		authRepo:     deps.Repository,
 		cacheRepo:    deps.Cache,
-		jwtManager:   deps.JWTManager,
+		tokenManager: deps.TokenManager,
+		totpManager:  deps.TOTPManager,
 		emailManager: deps.EmailManager,
+		vaultManager: deps.VaultManager,
 	}
 }
 
@@ -69,8 +102,8 @@ func (s *Service) SendVerificationEmail(ctx context.Context, userID uuid.UUID, e
 	return nil
 }
 
-// resend twofa code
-func (s *Service) ResendCode(ctx context.Context, email string) error {
+// resend twofa code, in reset mode totp users get an emailed code as VerifyAuthToken accepts it
+func (s *Service) ResendCode(ctx context.Context, email, mode string) error {
 	user, err := s.authRepo.GetUserCredentials(ctx, email)
 	if err != nil {
 		return err
@@ -81,6 +114,18 @@ func (s *Service) ResendCode(ctx context.Context, email string) error {
 		return apiutils.NewErrForbidden("user is inactive")
 	}
 
+	// an emailed login code would replace the totp challenge and make email a way around the authenticator
+	if mode != "reset" {
+		enrolled, err := s.totpEnrolled(ctx, user.UserID)
+		if err != nil {
+			return err
+		}
+
+		if enrolled {
+			return apiutils.NewErrForbidden("totp enrolled, use the authenticator app")
+		}
+	}
+
 	// send the two-factor auth code to the user's email in the background
 	if err := s.SendVerificationEmail(ctx, user.UserID, email, user.UserStatus); err != nil {
 		return err
@@ -89,22 +134,42 @@ func (s *Service) ResendCode(ctx context.Context, email string) error {
 	return nil
 }
 
-// Verifies the two-factor auth code and returns a JWT token if the verification is successful along with always a retry count.
-func (s *Service) VerifyAuthToken(ctx context.Context, userID uuid.UUID, token, mode string) (string, int, error) {
+// Verifies the two-factor auth code and returns a token pair if the verification is successful along with always a retry count.
+// In reset mode no tokens are issued and the returned pair is nil.
+func (s *Service) VerifyAuthToken(ctx context.Context, userID uuid.UUID, token, mode string) (*auth.TokenPair, int, error) {
 	data, err := s.cacheRepo.GetData(ctx, userID, auth.TwoFA)
 	if err != nil {
-		return "", 0, err
+		return nil, 0, err
 	}
 
 	// check if the data type is correct
 	tfaBody, ok := data.(*email.Twofa)
 	if !ok {
-		return "", 0, errors.New("invalid twofa data")
+		return nil, 0, errors.New("invalid twofa data")
+	}
+
+	// check the code against the user's totp secret or the emailed code
+	valid := tfaBody.Code == token
+	if tfaBody.Totp {
+		valid, err = s.validateTOTP(ctx, userID, token)
+		if err != nil {
+			return nil, 0, err
+		}
+	} else if mode != "reset" {
+		// users with a confirmed totp secret only log in with the authenticator
+		enrolled, err := s.totpEnrolled(ctx, userID)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if enrolled {
+			return nil, 0, apiutils.NewErrForbidden("totp enrolled, use the authenticator app")
+		}
 	}
 
 	var retriesErr error = nil
 	// check if the code is correct
-	if tfaBody.Code != token {
+	if !valid {
 		tfaBody.Retries -= 1
 
 		// check if the user has any retries left and update the twofa data async
@@ -118,7 +183,7 @@ func (s *Service) VerifyAuthToken(ctx context.Context, userID uuid.UUID, token,
 				log.Info().Msgf("%v: updated twofa retries", userID)
 			}()
 
-			return "", tfaBody.Retries, apiutils.NewErrUnauthorized("invalid code")
+			return nil, tfaBody.Retries, apiutils.NewErrUnauthorized("invalid code")
 		}
 
 		// add the user as restricted async
@@ -146,7 +211,7 @@ func (s *Service) VerifyAuthToken(ctx context.Context, userID uuid.UUID, token,
 
 	// check if there was a retries error
 	if retriesErr != nil {
-		return "", tfaBody.Retries, retriesErr
+		return nil, tfaBody.Retries, retriesErr
 	}
 
 	// update the user's status in the background if the user is a non-registered user
@@ -174,48 +239,219 @@ func (s *Service) VerifyAuthToken(ctx context.Context, userID uuid.UUID, token,
 			log.Info().Msgf("%v: added 30 session", userID)
 		}()
 
-		return userID.String(), 0, nil
+		return nil, 0, nil
 	}
 
-	// generate a JWT token
-	authToken, err := s.jwtManager.GenerateToken(userID)
+	// issue a JWT token along with a refresh token
+	pair, err := s.tokenManager.Issue(ctx, userID)
 	if err != nil {
-		log.Error().Str("location", "VerifyAuthToken").Msgf("%v: failed to generate JWT token: %v", userID, err)
-		return "", 0, err
+		log.Error().Str("location", "VerifyAuthToken").Msgf("%v: failed to issue tokens: %v", userID, err)
+		return nil, 0, err
 	}
 
-	return authToken, 0, nil
+	return pair, 0, nil
 }
 
-// Initial twofa login
-func (s *Service) LoginSend(ctx context.Context, input *auth.Login) (string, error) {
+// Exchanges a refresh token for a new token pair.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*auth.TokenPair, error) {
+	return s.tokenManager.Rotate(ctx, refreshToken)
+}
+
+// Initial twofa login, returns the user id and the second factor method the user must verify with.
+func (s *Service) LoginSend(ctx context.Context, input *auth.Login) (string, string, error) {
 	// retrieve the user credentials from the database
 	user, err := s.authRepo.GetUserCredentials(ctx, input.Email)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	// check if user is oauth user
 	if user.Password == "" {
-		return "", apiutils.NewErrBadRequest("user is oauth user")
+		return "", "", apiutils.NewErrBadRequest("user is oauth user")
 	}
 
 	// check if user is inactive
 	if user.UserStatus == auth.InactiveUser {
-		return "", apiutils.NewErrForbidden("user is inactive")
+		return "", "", apiutils.NewErrForbidden("user is inactive")
 	}
 
 	// validate the password
 	if err := securityutils.ValidatePassword(user.Password, input.Password); err != nil {
-		return "", apiutils.NewErrUnauthorized(err.Error())
+		return "", "", apiutils.NewErrUnauthorized(err.Error())
+	}
+
+	// users with a confirmed totp secret skip the email round trip
+	enrolled, err := s.totpEnrolled(ctx, user.UserID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if enrolled {
+		if err := s.SendTOTPChallenge(ctx, user.UserID, user.UserStatus); err != nil {
+			return "", "", err
+		}
+
+		return user.UserID.String(), TOTPMethod, nil
 	}
 
 	// send the two-factor auth code to the user's email in the background
 	if err := s.SendVerificationEmail(ctx, user.UserID, input.Email, user.UserStatus); err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return user.UserID.String(), nil
+	return user.UserID.String(), EmailMethod, nil
+}
+
+// Opens a totp challenge sharing the retry and restriction rules of emailed codes.
+func (s *Service) SendTOTPChallenge(ctx context.Context, userID uuid.UUID, status string) error {
+	// check if data is restricted
+	if _, err := s.cacheRepo.GetData(ctx, userID, auth.Restricted); err != nil {
+		return err
+	}
+
+	tfaBody := &email.Twofa{Retries: maxRetries, UserStatus: status, Totp: true}
+	return s.cacheRepo.AddTwofa(ctx, userID, tfaBody)
+}
+
+// helper: validateTOTP checks the code against the user's confirmed totp secret.
+func (s *Service) validateTOTP(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	secret, err := s.authRepo.GetTOTPSecret(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if !secret.Confirmed {
+		return false, apiutils.NewErrForbidden("totp not confirmed")
+	}
+
+	return s.acceptTOTP(ctx, secret, code)
+}
+
+// helper: acceptTOTP validates the code and records its time step, a code at or below the last
+// accepted step is rejected as if it were wrong.
+func (s *Service) acceptTOTP(ctx context.Context, secret *totp.Secret, code string) (bool, error) {
+	step, valid, err := s.totpManager.Validate(secret, code)
+	if err != nil || !valid {
+		return false, err
+	}
+
+	return s.cacheRepo.AcceptTOTPStep(ctx, secret.UserID, step, totp.ReplayWindow)
+}
+
+// helper: totpEnrolled checks if the user has a confirmed totp secret.
+func (s *Service) totpEnrolled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	secret, err := s.authRepo.GetTOTPSecret(ctx, userID)
+	if err != nil {
+		if _, ok := err.(apiutils.ErrNotFound); ok {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return secret.Confirmed, nil
+}
+
+// helper: checkTOTP validates a code outside of a login challenge and returns the retries left.
+// Wrong codes count toward the same restriction as challenge retries.
+func (s *Service) checkTOTP(ctx context.Context, secret *totp.Secret, code string) (int, error) {
+	userID := secret.UserID
+
+	// check if data is restricted
+	if _, err := s.cacheRepo.GetData(ctx, userID, auth.Restricted); err != nil {
+		return 0, err
+	}
+
+	valid, err := s.acceptTOTP(ctx, secret, code)
+	if err != nil {
+		return 0, err
+	}
+
+	if valid {
+		if err := s.cacheRepo.DeleteData(ctx, userID, auth.TOTPAttempts); err != nil {
+			return 0, err
+		}
+
+		return maxRetries, nil
+	}
+
+	failures, err := s.cacheRepo.AddTOTPFailure(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if retries := maxRetries - int(failures); retries > 0 {
+		return retries, apiutils.NewErrUnauthorized("invalid code")
+	}
+
+	if err := s.cacheRepo.AddRestricted(ctx, userID); err != nil {
+		return 0, err
+	}
+
+	if err := s.cacheRepo.DeleteData(ctx, userID, auth.TOTPAttempts); err != nil {
+		return 0, err
+	}
+
+	log.Info().Msgf("%v: restricted user", userID)
+	return 0, apiutils.NewErrUnauthorized("too many retries")
+}
+
+// Generates a pending totp secret for the user, replacing any previous unconfirmed one.
+func (s *Service) EnrollTOTP(ctx context.Context, userID uuid.UUID) (*totp.Enrollment, error) {
+	email, err := s.authRepo.GetUserEmail(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, enrollment, err := s.totpManager.NewEnrollment(userID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authRepo.UpsertTOTPSecret(ctx, secret); err != nil {
+		return nil, err
+	}
+
+	return enrollment, nil
+}
+
+// Confirms the pending totp secret with a code from the authenticator app, returning the retries left.
+func (s *Service) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) (int, error) {
+	secret, err := s.authRepo.GetTOTPSecret(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if secret.Confirmed {
+		return 0, apiutils.NewErrConflict("totp already enrolled")
+	}
+
+	retries, err := s.checkTOTP(ctx, secret, code)
+	if err != nil {
+		return retries, err
+	}
+
+	return retries, s.authRepo.ConfirmTOTPSecret(ctx, userID)
+}
+
+// Removes the user's totp secret after checking a current code, login falls back to emailed codes.
+// Returns the retries left.
+func (s *Service) DisableTOTP(ctx context.Context, userID uuid.UUID, code string) (int, error) {
+	secret, err := s.authRepo.GetTOTPSecret(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if !secret.Confirmed {
+		return 0, apiutils.NewErrForbidden("totp not confirmed")
+	}
+
+	retries, err := s.checkTOTP(ctx, secret, code)
+	if err != nil {
+		return retries, err
+	}
+
+	return retries, s.authRepo.DeleteTOTPSecret(ctx, userID)
 }
 
 // Initial twofa register
@@ -298,21 +534,6 @@ func (s *Service) ResetPasswordFinal(ctx context.Context, userID uuid.UUID, pass
 		log.Info().Msgf("%v: deleted session", userID)
 	}()
 
-	// add reset key to cache in background
-	go func() {
-		// new context with a timeout
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-
-		prevHashed64 := base64.StdEncoding.EncodeToString([]byte(prevHashed))
-		if err := s.cacheRepo.AddResetKey(ctx, userID, prevHashed64); err != nil {
-			log.Error().Str("location", "ResetPasswordFinal").Msgf("%v: failed to add reset key: %v", userID, err)
-			return
-		}
-
-		log.Info().Msgf("%v: added reset key", userID)
-	}()
-
 	// hash the new password
 	currHashed, err := securityutils.HashPassword(password)
 	if err != nil {
@@ -320,30 +541,37 @@ func (s *Service) ResetPasswordFinal(ctx context.Context, userID uuid.UUID, pass
 		return err
 	}
 
-	// update the user's password
-	if err := s.authRepo.UpdateUserPassword(ctx, userID, currHashed); err != nil {
+	tx, err := s.authRepo.StartTx(ctx)
+	if err != nil {
+		log.Error().Str("location", "ResetPasswordFinal").Msgf("%v: failed to start transaction: %v", userID, err)
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	// rehash the user's passwords from resource server
-	req, err := http.NewRequest(http.MethodPatch, "http://localhost:2000/api/v1/rehash", nil)
-	if err != nil {
-		log.Error().Str("location", "ResetPasswordFinal").Msgf("%v: failed to create request: %v", userID, err)
+	// the resource server rewraps the vault with the previous hash, which is recorded with the
+	// new password so the vault can not be left wrapped with a password no longer known
+	if err := s.authRepo.AddVaultRewrap(ctx, tx, userID, prevHashed); err != nil {
 		return err
 	}
-	req.Header.Set("X-Uid", userID.String())
 
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		log.Error().Str("location", "ResetPasswordFinal").Msgf("%v: failed to send request: %v", userID, err)
+	// update the user's password
+	if err := s.authRepo.UpdateUserPassword(ctx, tx, userID, currHashed); err != nil {
+		return err
+	}
+
+	// commit the transaction
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "ResetPasswordFinal").Msgf("%v: failed to commit transaction: %v", userID, err)
 		return err
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		log.Error().Str("location", "ResetPasswordFinal").Msgf("%v: failed to rehash passwords", userID)
-		return errors.New("failed to rehash passwords")
+	// rekey the user's vault on the resource server, a failed call leaves the rewrap pending
+	// and the resource server retries it
+	rpcCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := s.vaultManager.RekeyVault(rpcCtx, userID); err != nil {
+		log.Warn().Str("location", "ResetPasswordFinal").Msgf("%v: vault rewrap left to the resource server: %v", userID, err)
 	}
 
 	return nil
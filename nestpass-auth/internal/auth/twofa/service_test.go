@@ -0,0 +1,264 @@
+package twofa
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tuan882612/apiutils"
+	"github.com/tuan882612/apiutils/securityutils"
+	"google.golang.org/grpc"
+
+	"project/internal/auth"
+	"project/internal/auth/email"
+	"project/internal/auth/totp"
+	"project/internal/config"
+	"project/internal/database"
+	"project/internal/proto/pb/twofapb"
+	"project/pkg/otp"
+)
+
+// fakeRepo keeps a single user and totp secret in memory.
+type fakeRepo struct {
+	repository
+	user    *auth.User
+	secret  *totp.Secret
+	rewraps []string // previous hashes of committed password resets
+}
+
+// fakeTx applies the writes of the fake repository on commit.
+type fakeTx struct {
+	pgx.Tx
+	repo     *fakeRepo
+	password string
+	rewraps  []string
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.repo.user.Password = tx.password
+	tx.repo.rewraps = append(tx.repo.rewraps, tx.rewraps...)
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error { return nil }
+
+func (f *fakeRepo) StartTx(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{repo: f, password: f.user.Password}, nil
+}
+
+func (f *fakeRepo) GetUserPassword(ctx context.Context, userID uuid.UUID) (string, error) {
+	return f.user.Password, nil
+}
+
+func (f *fakeRepo) UpdateUserPassword(ctx context.Context, tx pgx.Tx, userID uuid.UUID, password string) error {
+	tx.(*fakeTx).password = password
+	return nil
+}
+
+func (f *fakeRepo) AddVaultRewrap(ctx context.Context, tx pgx.Tx, userID uuid.UUID, prevHash string) error {
+	tx.(*fakeTx).rewraps = append(tx.(*fakeTx).rewraps, prevHash)
+	return nil
+}
+
+func (f *fakeRepo) GetUserCredentials(ctx context.Context, email string) (*auth.User, error) {
+	return f.user, nil
+}
+
+func (f *fakeRepo) GetTOTPSecret(ctx context.Context, userID uuid.UUID) (*totp.Secret, error) {
+	if f.secret == nil {
+		return nil, apiutils.NewErrNotFound("totp not enrolled")
+	}
+
+	secret := *f.secret
+	return &secret, nil
+}
+
+func (f *fakeRepo) ConfirmTOTPSecret(ctx context.Context, userID uuid.UUID) error {
+	f.secret.Confirmed = true
+	return nil
+}
+
+func (f *fakeRepo) DeleteTOTPSecret(ctx context.Context, userID uuid.UUID) error {
+	f.secret = nil
+	return nil
+}
+
+// fakeEmailClient records the users it was asked to email a code.
+type fakeEmailClient struct {
+	sent chan string
+}
+
+func (f *fakeEmailClient) GenerateTwoFACode(ctx context.Context, in *twofapb.TwoFAPayload, opts ...grpc.CallOption) (*empty.Empty, error) {
+	f.sent <- in.UserId
+	return &empty.Empty{}, nil
+}
+
+// fakeVault fails every call to the resource server.
+type fakeVault struct{}
+
+func (fakeVault) RekeyVault(ctx context.Context, userID uuid.UUID) error {
+	return errors.New("resource server unavailable")
+}
+
+// newTestService enrolls a user with a pending totp secret and returns the raw secret.
+func newTestService(t *testing.T) (*Service, *fakeRepo, []byte) {
+	t.Helper()
+
+	cache := auth.NewCache(&database.DataAccess{Redis: redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})})
+	manager := totp.NewManager(&config.Configuration{Security: &config.SecurityConfig{TOTPKey: "test key", TOTPIssuer: "nestpass"}})
+
+	userID := uuid.New()
+	secret, enrollment, err := manager.NewEnrollment(userID, "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := otp.DecodeSecret(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &fakeRepo{user: &auth.User{UserID: userID, UserStatus: auth.ActiveUser}, secret: secret}
+	return &Service{authRepo: repo, cacheRepo: cache, totpManager: manager}, repo, raw
+}
+
+func Test_TOTPReplay(t *testing.T) {
+	service, repo, raw := newTestService(t)
+	ctx, userID, now := context.Background(), repo.user.UserID, time.Now()
+
+	code := otp.TOTP(raw, now)
+	if _, err := service.ConfirmTOTP(ctx, userID, code); err != nil {
+		t.Fatalf("ConfirmTOTP() error: %v", err)
+	}
+
+	// the confirming code cannot be used again, neither to disable totp nor to log in
+	if retries, err := service.DisableTOTP(ctx, userID, code); err == nil || retries != maxRetries-1 {
+		t.Fatalf("DisableTOTP() replay = %d, %v", retries, err)
+	}
+
+	if err := service.SendTOTPChallenge(ctx, userID, auth.ActiveUser); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := service.VerifyAuthToken(ctx, userID, code, "login"); err == nil {
+		t.Fatal("VerifyAuthToken() accepted a replayed code")
+	}
+
+	// a code of a later time step is still accepted
+	if _, err := service.DisableTOTP(ctx, userID, otp.TOTP(raw, now.Add(otp.Period*time.Second))); err != nil {
+		t.Fatalf("DisableTOTP() error: %v", err)
+	}
+
+	if repo.secret != nil {
+		t.Error("DisableTOTP() kept the secret")
+	}
+}
+
+func Test_TOTPLockout(t *testing.T) {
+	service, repo, raw := newTestService(t)
+	ctx, userID := context.Background(), repo.user.UserID
+	repo.secret.Confirmed = true
+
+	wrong := otp.TOTP(raw, time.Now().Add(-time.Hour))
+	for want := maxRetries - 1; want > 0; want-- {
+		retries, err := service.DisableTOTP(ctx, userID, wrong)
+		if _, ok := err.(apiutils.ErrUnauthorized); !ok || retries != want {
+			t.Fatalf("DisableTOTP() = %d, %v, want %d retries", retries, err, want)
+		}
+	}
+
+	if _, err := service.DisableTOTP(ctx, userID, wrong); err == nil {
+		t.Fatal("DisableTOTP() accepted a wrong code")
+	}
+
+	// once restricted even a correct code is refused, and so is logging in
+	if _, err := service.DisableTOTP(ctx, userID, otp.TOTP(raw, time.Now())); err == nil {
+		t.Fatal("DisableTOTP() accepted a code from a restricted user")
+	}
+
+	if repo.secret == nil {
+		t.Fatal("DisableTOTP() removed the secret of a restricted user")
+	}
+
+	if err := service.SendTOTPChallenge(ctx, userID, auth.ActiveUser); err == nil {
+		t.Error("SendTOTPChallenge() opened a challenge for a restricted user")
+	}
+}
+
+func Test_EmailCodeRefusedForTOTP(t *testing.T) {
+	service, repo, _ := newTestService(t)
+	ctx, userID := context.Background(), repo.user.UserID
+	repo.secret.Confirmed = true
+
+	if err := service.ResendCode(ctx, "user@example.com", "login"); err == nil {
+		t.Fatal("ResendCode() emailed a code to a totp user")
+	}
+
+	// an emailed challenge opened some other way still does not log the user in
+	if err := service.cacheRepo.AddTwofa(ctx, userID, &email.Twofa{Code: "123456", Retries: maxRetries}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := service.VerifyAuthToken(ctx, userID, "123456", "login"); err == nil {
+		t.Error("VerifyAuthToken() logged a totp user in with an emailed code")
+	}
+}
+
+func Test_ResendResetCodeForTOTP(t *testing.T) {
+	service, repo, _ := newTestService(t)
+	ctx, userID := context.Background(), repo.user.UserID
+	repo.secret.Confirmed = true
+
+	client := &fakeEmailClient{sent: make(chan string, 1)}
+	service.emailManager = &email.Manager{Client: client}
+
+	// a password reset only ever verifies emailed codes, so totp users can ask for another one
+	if err := service.ResendCode(ctx, "user@example.com", "reset"); err != nil {
+		t.Fatalf("ResendCode() error: %v", err)
+	}
+
+	select {
+	case sent := <-client.sent:
+		if sent != userID.String() {
+			t.Errorf("ResendCode() emailed %s, want %s", sent, userID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ResendCode() did not email a reset code")
+	}
+}
+
+func Test_ResetPasswordFinalKeepsRewrapWhenRekeyFails(t *testing.T) {
+	service, repo, _ := newTestService(t)
+	ctx, userID := context.Background(), repo.user.UserID
+	service.vaultManager = fakeVault{}
+
+	prevHashed, err := securityutils.HashPassword("previous password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.user.Password = prevHashed
+
+	if err := service.cacheRepo.AddSession(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	// the password changes even though the resource server could not be reached
+	if err := service.ResetPasswordFinal(ctx, userID, "new password"); err != nil {
+		t.Fatalf("ResetPasswordFinal() error: %v", err)
+	}
+
+	if err := securityutils.ValidatePassword(repo.user.Password, "new password"); err != nil {
+		t.Fatal("ResetPasswordFinal() did not change the password")
+	}
+
+	// the previous hash stays recorded for the resource server to rewrap the vault with
+	if len(repo.rewraps) != 1 || repo.rewraps[0] != prevHashed {
+		t.Fatalf("pending rewraps = %v, want the previous hash", repo.rewraps)
+	}
+}
@@ -0,0 +1,53 @@
+package vault
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
+
+	"project/internal/auth/jwt"
+	"project/internal/config"
+	"project/internal/proto"
+	"project/internal/proto/pb/vaultpb"
+)
+
+// audience of the service tokens accepted by the resource server
+const ResourceAudience = "nestpass.resource"
+
+// Manager calls the resource server's internal vault service.
+type Manager struct {
+	Client     vaultpb.VaultServiceClient
+	jwtManager *jwt.Manager
+}
+
+// Used to initialize the vault service client.
+func NewManager(cfg *config.Configuration, jwtManager *jwt.Manager) (*Manager, error) {
+	// initialize connection to grpc server
+	conn, err := proto.NewGRPCConn(cfg.Server.ResourceGRPCAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// load vault service client
+	return &Manager{Client: vaultpb.NewVaultServiceClient(conn), jwtManager: jwtManager}, nil
+}
+
+// Rekeys the user's vault after a password reset. Every call carries a short lived
+// service token bound to the user, so it can not be replayed for other vaults.
+func (m *Manager) RekeyVault(ctx context.Context, userID uuid.UUID) error {
+	token, err := m.jwtManager.GenerateServiceToken(userID, ResourceAudience)
+	if err != nil {
+		return err
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	payload := &vaultpb.RekeyPayload{UserId: userID.String()}
+	if _, err := m.Client.RekeyVault(ctx, payload); err != nil {
+		log.Error().Str("location", "RekeyVault").Msgf("%v: failed to rekey vault: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
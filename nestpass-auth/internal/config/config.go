@@ -10,6 +10,7 @@ type Configuration struct {
 	Database *DatabaseConfig
 	JWT      *JWTConfig
 	OAuth    *OAuthConfig
+	Security *SecurityConfig
 }
 
 func New() *Configuration {
@@ -18,6 +19,7 @@ func New() *Configuration {
 		Database: newDatabaseConfig(),
 		JWT:      newJWTConfig(),
 		OAuth:    newOauthConfig(),
+		Security: newSecurityConfig(),
 	}
 }
 
@@ -27,6 +29,7 @@ func (c *Configuration) Validate() error {
 		"Database": c.Database,
 		"JWT":      c.JWT,
 		"OAuth":    c.OAuth,
+		"Security": c.Security,
 	}
 
 	validator := validator.New()
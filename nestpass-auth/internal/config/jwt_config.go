@@ -2,24 +2,39 @@ package config
 
 import (
 	"os"
+	"strings"
 	"time"
 )
 
 type JWTConfig struct {
-	Duration time.Duration `validate:"required"`
-	SignKey  string        `validate:"required"`
-	EmailKey string        `validate:"required"`
+	Duration        time.Duration `validate:"required"`
+	RefreshDuration time.Duration `validate:"required"`
+	KeyFiles        []string      `validate:"required,min=1"` // first key signs, the rest only verify
+	EmailKey        string        `validate:"required"`
 }
 
 func newJWTConfig() *JWTConfig {
 	duration, err := time.ParseDuration(os.Getenv("TOKEN_DURATION"))
 	if err != nil {
-		duration = 12 * time.Hour
+		duration = 15 * time.Minute
+	}
+
+	refreshDuration, err := time.ParseDuration(os.Getenv("REFRESH_DURATION"))
+	if err != nil {
+		refreshDuration = 7 * 24 * time.Hour
+	}
+
+	keyFiles := []string{}
+	for _, file := range strings.Split(os.Getenv("JWT_KEY_FILES"), ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			keyFiles = append(keyFiles, file)
+		}
 	}
 
 	return &JWTConfig{
-		SignKey:  os.Getenv("SIGN_KEY"),
-		EmailKey: os.Getenv("EMAIL_KEY"),
-		Duration: duration,
+		KeyFiles:        keyFiles,
+		EmailKey:        os.Getenv("EMAIL_KEY"),
+		Duration:        duration,
+		RefreshDuration: refreshDuration,
 	}
 }
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+type SecurityConfig struct {
+	TOTPKey         string   `validate:"required"`
+	TOTPIssuer      string   `validate:"required"`
+	WebAuthnRPID    string   `validate:"required"`
+	WebAuthnRPName  string   `validate:"required"`
+	WebAuthnOrigins []string `validate:"required,min=1"`
+}
+
+func newSecurityConfig() *SecurityConfig {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "nestpass"
+	}
+
+	rpName := os.Getenv("WEBAUTHN_RP_NAME")
+	if rpName == "" {
+		rpName = "nestpass"
+	}
+
+	origins := []string{}
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	return &SecurityConfig{
+		TOTPKey:         os.Getenv("TOTP_KEY"),
+		TOTPIssuer:      issuer,
+		WebAuthnRPID:    os.Getenv("WEBAUTHN_RP_ID"),
+		WebAuthnRPName:  rpName,
+		WebAuthnOrigins: origins,
+	}
+}
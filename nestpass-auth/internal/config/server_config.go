@@ -12,6 +12,8 @@ type ServerConfig struct {
 	GRPCPort   string `validate:"required"`
 	Host       string `validate:"required"`
 	ProdEnv    bool
+	// address of the resource server's internal grpc service
+	ResourceGRPCAddr string `validate:"required"`
 }
 
 func newServerConfig() *ServerConfig {
@@ -29,10 +31,11 @@ func newServerConfig() *ServerConfig {
 	}
 
 	return &ServerConfig{
-		Host:       os.Getenv("HOST"),
-		Port:       os.Getenv("PORT"),
-		GRPCPort:   os.Getenv("GRPC_PORT"),
-		ApiVersion: os.Getenv("API_VERSION"),
-		ProdEnv:    prodEnv,
+		Host:             os.Getenv("HOST"),
+		Port:             os.Getenv("PORT"),
+		GRPCPort:         os.Getenv("GRPC_PORT"),
+		ApiVersion:       os.Getenv("API_VERSION"),
+		ProdEnv:          prodEnv,
+		ResourceGRPCAddr: os.Getenv("RESOURCE_GRPC_ADDR"),
 	}
 }
@@ -1,9 +1,13 @@
 package server
 
 import (
+	"encoding/json"
 	"net/http"
 
+	"github.com/rs/zerolog/log"
 	"github.com/tuan882612/apiutils"
+
+	"project/internal/auth/jwt"
 )
 
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
@@ -17,3 +21,14 @@ func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	resp := apiutils.NewRes(http.StatusNotFound, errMsg, nil)
 	resp.SendRes(w)
 }
+
+// JWKSHandler serves the public signing keys as a plain JWK set so other services can verify tokens.
+func JWKSHandler(jwtManager *jwt.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if err := json.NewEncoder(w).Encode(jwtManager.JWKS()); err != nil {
+			log.Error().Str("location", "JWKSHandler").Msgf("failed to encode jwks: %v", err)
+		}
+	}
+}
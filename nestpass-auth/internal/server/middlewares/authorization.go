@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/tuan882612/apiutils"
+
+	"project/internal/auth"
+	"project/pkg/helpers"
+)
+
+// Authorization verifies the double submit csrf token and the jwt cookie issued by this server,
+// tokens of revoked sessions are rejected.
+func Authorization(deps *auth.Dependencies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// double submit cookie verification
+			csrfToken, err := r.Cookie("token")
+			if err != nil {
+				apiutils.HandleHttpErrors(w, apiutils.NewErrUnauthorized("Missing CSRF token"))
+				return
+			}
+
+			csrfTokenHeader, err := url.QueryUnescape(r.Header.Get("X-CSRF-Token"))
+			if err != nil {
+				apiutils.HandleHttpErrors(w, apiutils.NewErrUnauthorized("CSRF token is invalid"))
+				return
+			}
+
+			if csrfTokenHeader != csrfToken.Value {
+				apiutils.HandleHttpErrors(w, apiutils.NewErrUnauthorized("CSRF tokens do not match"))
+				return
+			}
+
+			// gets AuthToken from cookie
+			cookie, err := r.Cookie("Authorization")
+			if err != nil {
+				apiutils.HandleHttpErrors(w, apiutils.NewErrUnauthorized("missing authorization cookie"))
+				return
+			}
+
+			// decode JWT token
+			claims, err := deps.JWTManager.DecodeToken(cookie.Value)
+			if err != nil {
+				apiutils.HandleHttpErrors(w, err)
+				return
+			}
+
+			// check the session registry
+			revoked, err := deps.Cache.IsSessionRevoked(r.Context(), claims.ID)
+			if err != nil {
+				apiutils.HandleHttpErrors(w, err)
+				return
+			}
+
+			if revoked {
+				apiutils.HandleHttpErrors(w, apiutils.NewErrUnauthorized("session revoked"))
+				return
+			}
+
+			// set user id, session id and call next handler
+			ctx := context.WithValue(r.Context(), helpers.CtxUserID, claims.UserID)
+			ctx = context.WithValue(ctx, helpers.CtxSessionID, claims.ID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"project/pkg/helpers"
+)
+
+// ClientInfo stores the requesting device and ip address for the session registry.
+func ClientInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		client := helpers.ClientInfo{Device: r.UserAgent(), IP: ip}
+		ctx := context.WithValue(r.Context(), helpers.CtxClient, client)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -10,5 +10,6 @@ func Cli(handler *cli.Handler, r chi.Router) func(r chi.Router) {
 	return func(r chi.Router) {
 		r.Get("/verify", handler.VerifyCliKey)
 		r.Post("/login", handler.Login)
+		r.Post("/refresh", handler.Refresh)
 	}
 }
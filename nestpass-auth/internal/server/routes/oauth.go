@@ -10,6 +10,6 @@ func OAuth(handler *oauth.Handler, r chi.Router) func(r chi.Router) {
 	return func(r chi.Router) {
 		r.Get("/", handler.Invoke)
 		r.Get("/callback", handler.Callback)
-		r.Get("/refresh", handler.Refresh)
+		r.Post("/refresh", handler.Refresh)
 	}
 }
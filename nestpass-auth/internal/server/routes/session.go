@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+
+	"project/internal/auth"
+	"project/internal/auth/session"
+	"project/internal/server/middlewares"
+)
+
+func Session(handler *session.Handler, deps *auth.Dependencies, r chi.Router) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Use(middlewares.Authorization(deps))
+		r.Get("/", handler.List)
+		r.Post("/logout", handler.Logout)
+		r.Delete("/", handler.RevokeAll)
+		r.Delete("/{session_id}", handler.Revoke)
+	}
+}
@@ -3,16 +3,26 @@ package routes
 import (
 	"github.com/go-chi/chi/v5"
 
+	"project/internal/auth"
 	"project/internal/auth/twofa"
+	"project/internal/server/middlewares"
 )
 
-func TwoFA(handler *twofa.Handler, r chi.Router) func(r chi.Router) {
+func TwoFA(handler *twofa.Handler, deps *auth.Dependencies, r chi.Router) func(r chi.Router) {
 	return func(r chi.Router) {
 		r.Post("/resend", handler.ResendCode)
 		r.Post("/verify", handler.Verify)
+		r.Post("/refresh", handler.Refresh)
 		r.Post("/login", handler.Login)
 		r.Post("/register", handler.Register)
 		r.Post("/reset", handler.ResetPassword)
 		r.Patch("/reset/final", handler.ResetPasswordFinal)
+
+		r.Route("/totp", func(r chi.Router) {
+			r.Use(middlewares.Authorization(deps))
+			r.Post("/enroll", handler.EnrollTOTP)
+			r.Post("/confirm", handler.ConfirmTOTP)
+			r.Delete("/", handler.DisableTOTP)
+		})
 	}
 }
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+
+	"project/internal/auth"
+	"project/internal/auth/passkey"
+	"project/internal/server/middlewares"
+)
+
+func WebAuthn(handler *passkey.Handler, deps *auth.Dependencies, r chi.Router) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Post("/login/begin", handler.BeginLogin)
+		r.Post("/login/finish", handler.FinishLogin)
+
+		r.Route("/register", func(r chi.Router) {
+			r.Use(middlewares.Authorization(deps))
+			r.Post("/begin", handler.BeginRegistration)
+			r.Post("/finish", handler.FinishRegistration)
+		})
+	}
+}
@@ -10,8 +10,11 @@ import (
 	"project/internal/auth"
 	"project/internal/auth/cli"
 	"project/internal/auth/oauth"
+	"project/internal/auth/passkey"
+	"project/internal/auth/session"
 	"project/internal/auth/twofa"
 	"project/internal/config"
+	"project/internal/server/middlewares"
 	"project/internal/server/routes"
 )
 
@@ -55,14 +58,22 @@ func (s *Server) SetupRouter() error {
 	cliHandler := cli.NewHandler(s.AuthDeps)
 	twofaHandler := twofa.NewHandler(s.AuthDeps)
 	oauthHandler := oauth.NewHandler(s.Cfg, s.AuthDeps)
+	sessionHandler := session.NewHandler(s.AuthDeps)
+	passkeyHandler, err := passkey.NewHandler(s.Cfg, s.AuthDeps)
+	if err != nil {
+		return err
+	}
 
 	// routing all api endpoints
 	s.Router.NotFound(NotFoundHandler)
+	s.Router.Get("/.well-known/jwks.json", JWKSHandler(s.AuthDeps.JWTManager))
 	s.Router.Route(s.ApiVersion, func(r chi.Router) {
 		r.Get("/health", HealthHandler)
 		r.Route("/cli", routes.Cli(cliHandler, r))
-		r.Route("/twofa", routes.TwoFA(twofaHandler, r))
+		r.Route("/twofa", routes.TwoFA(twofaHandler, s.AuthDeps, r))
 		r.Route("/oauth", routes.OAuth(oauthHandler, r))
+		r.Route("/webauthn", routes.WebAuthn(passkeyHandler, s.AuthDeps, r))
+		r.Route("/sessions", routes.Session(sessionHandler, s.AuthDeps, r))
 	})
 
 	return nil
@@ -70,8 +81,9 @@ func (s *Server) SetupRouter() error {
 
 // helper: setupMiddleware setups all middlewares.
 func (s *Server) setupMiddleware() {
+	s.Router.Use(middleware.RealIP)
 	s.Router.Use(middleware.Logger)
-
+	s.Router.Use(middlewares.ClientInfo)
 }
 
 // Starts the HTTP server.
@@ -0,0 +1,7 @@
+-- authenticator secret of a user, encrypted by the server, unconfirmed until the first valid code
+CREATE TABLE totp_secrets (
+	user_id   uuid PRIMARY KEY REFERENCES users (user_id) ON DELETE CASCADE,
+	nonce     bytea NOT NULL,
+	encrypted bytea NOT NULL,
+	confirmed boolean NOT NULL DEFAULT false
+);
@@ -0,0 +1,11 @@
+-- registered passkeys, credential is the serialized webauthn credential holding the public key,
+-- sign count and authenticator flags
+CREATE TABLE passkey_credentials (
+	credential_id bytea PRIMARY KEY,
+	user_id       uuid NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+	credential    jsonb NOT NULL,
+	created       timestamptz NOT NULL,
+	last_used     timestamptz
+);
+
+CREATE INDEX passkey_credentials_user_id_idx ON passkey_credentials (user_id);
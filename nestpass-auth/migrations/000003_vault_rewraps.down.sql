@@ -0,0 +1 @@
+DROP TABLE vault_rewraps;
@@ -0,0 +1,14 @@
+-- password resets whose vault is still wrapped with a key derived from an earlier password, one
+-- row per reset holding the hash the password had before it, rewrapped and removed by the
+-- resource server
+CREATE TABLE vault_rewraps (
+	rewrap_id uuid PRIMARY KEY,
+	user_id   uuid NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+	prev_hash text NOT NULL,
+	queued    timestamptz NOT NULL,
+	attempts  integer NOT NULL DEFAULT 0,
+	retry_at  timestamptz NOT NULL
+);
+
+CREATE INDEX vault_rewraps_user_id_queued_idx ON vault_rewraps (user_id, queued);
+CREATE INDEX vault_rewraps_retry_at_idx ON vault_rewraps (retry_at);
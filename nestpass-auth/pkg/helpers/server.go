@@ -1,12 +1,28 @@
 package helpers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/google/uuid"
 	"github.com/tuan882612/apiutils"
 )
 
+type ctxKey string
+
+const (
+	CtxUserID    ctxKey = "user_id"
+	CtxSessionID ctxKey = "session_id"
+	CtxClient    ctxKey = "client"
+)
+
+// Device and address of the client making the request.
+type ClientInfo struct {
+	Device string
+	IP     string
+}
+
 func GetUidHeader(r *http.Request) (uuid.UUID, error) {
 	uidStr := r.Header.Get("X-Uid")
 	if uidStr == "" {
@@ -20,3 +36,29 @@ func GetUidHeader(r *http.Request) (uuid.UUID, error) {
 
 	return uid, nil
 }
+
+// Parses and retrieves the user id set by the authorization middleware.
+func UidFromCtx(ctx context.Context) (uuid.UUID, error) {
+	uid, ok := ctx.Value(CtxUserID).(uuid.UUID)
+	if !ok {
+		return uuid.Nil, errors.New("error parsing user id")
+	}
+
+	return uid, nil
+}
+
+// Retrieves the session id (jti) set by the authorization middleware.
+func SessionFromCtx(ctx context.Context) (string, error) {
+	sid, ok := ctx.Value(CtxSessionID).(string)
+	if !ok || sid == "" {
+		return "", errors.New("error parsing session id")
+	}
+
+	return sid, nil
+}
+
+// Retrieves the client info set by the client info middleware, empty if it was never set.
+func ClientFromCtx(ctx context.Context) ClientInfo {
+	client, _ := ctx.Value(CtxClient).(ClientInfo)
+	return client
+}
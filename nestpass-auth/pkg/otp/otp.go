@@ -0,0 +1,101 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits     = 6
+	Period     = 30
+	SecretSize = 20
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generates a new random shared secret.
+func NewSecret() ([]byte, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// Encodes the secret as unpadded base32 (the format authenticator apps expect).
+func EncodeSecret(secret []byte) string {
+	return b32.EncodeToString(secret)
+}
+
+// Decodes an unpadded base32 secret, ignoring case and spaces.
+func DecodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return b32.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// Computes the RFC 4226 HOTP value for the given counter.
+func HOTP(secret []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, code%1000000)
+}
+
+// Computes the RFC 6238 TOTP value for the given time.
+func TOTP(secret []byte, t time.Time) string {
+	return HOTP(secret, uint64(t.Unix())/Period)
+}
+
+// Validates a TOTP code allowing for the given number of periods of clock skew in either direction.
+func Validate(secret []byte, code string, t time.Time, skew int) bool {
+	_, ok := Match(secret, code, t, skew)
+	return ok
+}
+
+// Like Validate but also returns the counter (time step) the code matched, callers use it to
+// reject codes that were already accepted.
+func Match(secret []byte, code string, t time.Time, skew int) (uint64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	counter := int64(t.Unix()) / Period
+	for i := -skew; i <= skew; i++ {
+		expected := HOTP(secret, uint64(counter+int64(i)))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return uint64(counter + int64(i)), true
+		}
+	}
+
+	return 0, false
+}
+
+// Builds an otpauth:// key uri for provisioning authenticator apps.
+func KeyURI(issuer, account string, secret []byte) string {
+	params := url.Values{}
+	params.Set("secret", EncodeSecret(secret))
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(Period))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
@@ -0,0 +1,93 @@
+package otp
+
+import (
+	"testing"
+	"time"
+)
+
+// test vectors from RFC 4226 appendix D
+func Test_HOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	expected := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	for counter, code := range expected {
+		if got := HOTP(secret, uint64(counter)); got != code {
+			t.Errorf("HOTP(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// test vectors from RFC 6238 appendix B (SHA1, truncated to 6 digits)
+func Test_TOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	cases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, code := range cases {
+		if got := TOTP(secret, time.Unix(unix, 0)); got != code {
+			t.Errorf("TOTP(%d) = %s, want %s", unix, got, code)
+		}
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	prev := TOTP(secret, now.Add(-Period*time.Second))
+
+	if !Validate(secret, TOTP(secret, now), now, 0) {
+		t.Errorf("Validate() rejected the current code")
+	}
+
+	if !Validate(secret, prev, now, 1) {
+		t.Errorf("Validate() rejected a code within the skew window")
+	}
+
+	if Validate(secret, prev, now, 0) {
+		t.Errorf("Validate() accepted a code outside the skew window")
+	}
+
+	if Validate(secret, "12345", now, 1) {
+		t.Errorf("Validate() accepted a malformed code")
+	}
+}
+
+func Test_Match(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	counter := uint64(now.Unix()) / Period
+
+	if step, ok := Match(secret, TOTP(secret, now), now, 1); !ok || step != counter {
+		t.Errorf("Match() = %d, %v, want %d", step, ok, counter)
+	}
+
+	prev := TOTP(secret, now.Add(-Period*time.Second))
+	if step, ok := Match(secret, prev, now, 1); !ok || step != counter-1 {
+		t.Errorf("Match() = %d, %v, want %d", step, ok, counter-1)
+	}
+}
+
+func Test_SecretEncoding(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret() error: %v", err)
+	}
+
+	decoded, err := DecodeSecret(EncodeSecret(secret))
+	if err != nil {
+		t.Fatalf("DecodeSecret() error: %v", err)
+	}
+
+	if string(decoded) != string(secret) {
+		t.Errorf("DecodeSecret() did not round trip the secret")
+	}
+}
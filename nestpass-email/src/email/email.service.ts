@@ -39,10 +39,12 @@ export class EmailService {
    * Returns the email template based on the email type
    *
    * @param emailType EmailType
+   * @param contactEmail email of the other user in a notification
+   * @param days days a notification refers to
    * @returns string
    * - email template based on the email type
    */
-  getTemplate(emailType: EmailType): string {
+  getTemplate(emailType: EmailType, contactEmail = '', days = 0): string {
     switch (emailType) {
       case EmailType.TWOFA:
         return `
@@ -74,6 +76,25 @@ export class EmailService {
           </tbody>
         </table>
         `;
+      case EmailType.EMERGENCY_REQUESTED:
+        return `
+        <p style="font-size: medium; font-family: Arial;">
+          <b>${contactEmail}</b> requested emergency access to your vault.
+          Access is granted in <b>${days} days</b> unless you veto the request.
+        </p>
+        `;
+      case EmailType.EMERGENCY_GRANTED:
+        return `
+        <p style="font-size: medium; font-family: Arial;">
+          <b>${contactEmail}</b> granted you emergency access to their vault for <b>${days} days</b>.
+        </p>
+        `;
+      case EmailType.EMERGENCY_VETOED:
+        return `
+        <p style="font-size: medium; font-family: Arial;">
+          <b>${contactEmail}</b> denied your emergency access to their vault.
+        </p>
+        `;
       default:
         return '';
     }
@@ -7,4 +7,7 @@ export default interface Email {
 export enum EmailType {
   TWOFA = '2fa',
   BASE = 'base',
+  EMERGENCY_REQUESTED = 'emergency_requested',
+  EMERGENCY_GRANTED = 'emergency_granted',
+  EMERGENCY_VETOED = 'emergency_vetoed',
 }
@@ -15,3 +15,11 @@ export interface CachePayload {
   Retries: number;
   UserStatus: string;
 }
+
+export interface NotificationPayload {
+  userId: string;
+  email: string;
+  type: string;
+  contactEmail: string;
+  days: number;
+}
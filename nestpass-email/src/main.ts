@@ -16,10 +16,11 @@ async function bootstrap() {
         transport: Transport.GRPC,
         options: {
           url: process.env.HOST + ':' + process.env.PORT,
-          package: ['twofa', 'ping'],
+          package: ['twofa', 'ping', 'notification'],
           protoPath: [
             join(__dirname, '../src/twofa/twofa.proto'),
             join(__dirname, '../src/ping/ping.proto'),
+            join(__dirname, '../src/notification/notification.proto'),
           ],
           channelOptions: {
             'grpc.keepalive_time_ms': 1800000, // 30 minutes in milliseconds
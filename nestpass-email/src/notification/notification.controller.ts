@@ -1,9 +1,25 @@
 import { Controller, Logger } from '@nestjs/common';
+import { GrpcMethod } from '@nestjs/microservices';
+import { NotificationPayload } from 'src/interfaces/payload.interface';
 import { NotificationService } from './notification.service';
 
+/**
+ * Grpc entrypoint for notification emails sent on behalf of the resource server.
+ */
 @Controller()
 export class NotificationController {
-  private loggger = new Logger('EmailController');
+  private loggger = new Logger('NotificationController');
 
   constructor(private readonly notificationService: NotificationService) {}
+
+  /**
+   * Send a notification email of the given type to the user.
+   *
+   * @param data NotificationPayload
+   */
+  @GrpcMethod('NotificationService', 'SendNotification')
+  async sendNotification(data: NotificationPayload): Promise<void> {
+    await this.notificationService.sendNotification(data);
+    this.loggger.log(data.userId + `: ${data.type} notification sent`);
+  }
 }
@@ -1,7 +1,61 @@
+import { status } from '@grpc/grpc-js';
 import { Injectable } from '@nestjs/common';
+import { RpcException } from '@nestjs/microservices';
 import { EmailService } from 'src/email/email.service';
+import Email, { EmailType } from 'src/interfaces/email.interface';
+import { NotificationPayload } from 'src/interfaces/payload.interface';
 
+/**
+ * Service for building and sending notification emails.
+ */
 @Injectable()
 export class NotificationService {
   constructor(private readonly emailService: EmailService) {}
+
+  /**
+   * Sends the notification email matching the payload type.
+   *
+   * @param payload NotificationPayload
+   * @returns Promise<void>
+   */
+  public async sendNotification(payload: NotificationPayload): Promise<void> {
+    if (!payload.userId || !payload.email || !payload.type) {
+      throw new RpcException({
+        details: 'Payload param is missing: userId, email or type',
+        code: status.INVALID_ARGUMENT,
+      });
+    }
+
+    const email: Email = {
+      to: payload.email,
+      subject: this.getSubject(payload),
+      template: this.emailService.getTemplate(
+        payload.type as EmailType,
+        payload.contactEmail,
+        payload.days,
+      ),
+    };
+
+    if (!email.subject || !email.template) {
+      throw new RpcException({
+        details: `Unknown notification type: ${payload.type}`,
+        code: status.INVALID_ARGUMENT,
+      });
+    }
+
+    await this.emailService.sendEmail(email);
+  }
+
+  private getSubject(payload: NotificationPayload): string {
+    switch (payload.type) {
+      case EmailType.EMERGENCY_REQUESTED:
+        return 'nestpass - Emergency access requested by ' + payload.contactEmail;
+      case EmailType.EMERGENCY_GRANTED:
+        return 'nestpass - Emergency access granted by ' + payload.contactEmail;
+      case EmailType.EMERGENCY_VETOED:
+        return 'nestpass - Emergency access denied by ' + payload.contactEmail;
+      default:
+        return '';
+    }
+  }
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"os"
+	"strconv"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog/log"
@@ -12,29 +13,83 @@ type Configuration struct {
 	ApiVersion string `validate:"required"`
 	Port       string `validate:"required"`
 	Host       string `validate:"required"`
+	GRPCPort   string `validate:"required"` // internal service for the auth server
 	PgURL      string `validate:"required"`
 	RedisURL   string `validate:"required"`
 	RedisPsw   string `validate:"required"`
-	SignKey    string `validate:"required"`
+	JWKSURL    string `validate:"required,url"`
+	// vault key derivation policy, vaults derived with weaker settings are upgraded on use
+	KDFAlgorithm   string `validate:"oneof=argon2id pbkdf2-sha256"`
+	KDFMemory      uint32
+	KDFIterations  uint32 `validate:"required"`
+	KDFParallelism uint8
+	// revisions kept per password entry, zero disables the history
+	HistoryRetention int `validate:"min=0"`
+	// days trashed passwords and categories are kept before they are purged
+	TrashRetentionDays int `validate:"min=1"`
+	// directory of sha1 range files breached passwords are checked against, unset disables the check
+	BreachCorpusDir string `validate:"omitempty,dir"`
+	// address of the email service notifications are sent through
+	EmailGRPCAddr string `validate:"required,hostname_port"`
+	// directory attachment blobs are stored in, the size of a single attachment and the total a
+	// user may store in MiB
+	AttachmentDir     string `validate:"required"`
+	AttachmentMaxSize int    `validate:"min=1"`
+	AttachmentQuota   int    `validate:"min=1"`
+	// key list cursors are signed with
+	PaginationSecret string `validate:"required,min=32"`
+}
+
+// helper: getUint reads an unsigned integer variable falling back to the default.
+func getUint(key string, def uint64, bits int) uint64 {
+	n, err := strconv.ParseUint(os.Getenv(key), 10, bits)
+	if err != nil {
+		return def
+	}
+
+	return n
 }
 
 func New() *Configuration {
 	apiVersion := os.Getenv("API_VERSION")
 	port := os.Getenv("PORT")
 	host := os.Getenv("HOST")
+	grpcPort := os.Getenv("GRPC_PORT")
 	pgUrl := os.Getenv("PG_URL")
 	redisUrl := os.Getenv("REDIS_URL")
 	redisPsw := os.Getenv("REDIS_PSW")
-	singKey := os.Getenv("SIGN_KEY")
+	jwksUrl := os.Getenv("JWKS_URL")
+	emailGRPCAddr := os.Getenv("EMAIL_GRPC_ADDR")
+	kdfAlgorithm := os.Getenv("KDF_ALGORITHM")
+	kdfIterations := uint64(3)
+	if kdfAlgorithm == "" {
+		kdfAlgorithm = "argon2id"
+	} else if kdfAlgorithm == "pbkdf2-sha256" {
+		kdfIterations = 600000
+	}
 
 	return &Configuration{
 		Host:       host,
 		Port:       port,
+		GRPCPort:   grpcPort,
 		ApiVersion: apiVersion,
 		PgURL:      pgUrl,
 		RedisURL:   redisUrl,
 		RedisPsw:   redisPsw,
-		SignKey:    singKey,
+		JWKSURL:    jwksUrl,
+		// defaults follow the OWASP argon2id recommendation
+		KDFAlgorithm:       kdfAlgorithm,
+		KDFMemory:          uint32(getUint("KDF_MEMORY", 64*1024, 32)),
+		KDFIterations:      uint32(getUint("KDF_ITERATIONS", kdfIterations, 32)),
+		KDFParallelism:     uint8(getUint("KDF_PARALLELISM", 4, 8)),
+		HistoryRetention:   int(getUint("PASSWORD_HISTORY_RETENTION", 10, 16)),
+		TrashRetentionDays: int(getUint("TRASH_RETENTION_DAYS", 30, 16)),
+		BreachCorpusDir:    os.Getenv("BREACH_CORPUS_DIR"),
+		EmailGRPCAddr:      emailGRPCAddr,
+		AttachmentDir:      os.Getenv("ATTACHMENT_DIR"),
+		AttachmentMaxSize:  int(getUint("ATTACHMENT_MAX_SIZE_MB", 25, 16)),
+		AttachmentQuota:    int(getUint("ATTACHMENT_QUOTA_MB", 1024, 32)),
+		PaginationSecret:   os.Getenv("PAGINATION_SECRET"),
 	}
 }
 
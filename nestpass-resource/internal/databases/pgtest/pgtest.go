@@ -0,0 +1,198 @@
+// Package pgtest stands in for the postgres pool in repository tests. Queries are answered with
+// rows scripted per statement and every statement run is recorded. Statements are checked against
+// their arguments and rows against the columns scanned, so a query and its script can not drift
+// apart silently.
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DB answers queries with canned rows and records the statements run against it, in or out of
+// a transaction.
+type DB struct {
+	Results map[string][][]any                 // rows of each query
+	Once    map[string][][]any                 // answered by the first run of the query only, before Results
+	Fail    func(sql string, args []any) error // nil when every statement succeeds
+	Queries []Exec
+	Execs   []Exec
+	Commits int
+}
+
+// Statement run against the database.
+type Exec struct {
+	SQL  string
+	Args []any
+}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// helper: check fails statements passed more or fewer arguments than they have placeholders.
+func check(sql string, args []any) error {
+	count := 0
+	for _, match := range placeholder.FindAllStringSubmatch(sql, -1) {
+		n, _ := strconv.Atoi(match[1])
+		count = max(count, n)
+	}
+
+	if count != len(args) {
+		return fmt.Errorf("pgtest: statement takes %d arguments, got %d", count, len(args))
+	}
+
+	return nil
+}
+
+// helper: run checks and records the statement, failing it when Fail says so.
+func (db *DB) run(log *[]Exec, sql string, args []any) error {
+	if err := check(sql, args); err != nil {
+		return err
+	}
+
+	if db.Fail != nil {
+		if err := db.Fail(sql, args); err != nil {
+			return err
+		}
+	}
+
+	*log = append(*log, Exec{SQL: sql, Args: args})
+	return nil
+}
+
+func (db *DB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &tx{db: db}, nil
+}
+
+func (db *DB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if err := db.run(&db.Execs, sql, args); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (db *DB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := db.run(&db.Queries, sql, args); err != nil {
+		return nil, err
+	}
+
+	if scripted, ok := db.Once[sql]; ok {
+		delete(db.Once, sql)
+		return &rows{rows: scripted}, nil
+	}
+
+	return &rows{rows: db.Results[sql]}, nil
+}
+
+func (db *DB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := db.Query(ctx, sql, args...)
+	return &row{rows: rows, err: err}
+}
+
+// Returns the statements run with the query, in order.
+func (db *DB) Executed(sql string) []Exec {
+	execs := []Exec{}
+	for _, exec := range db.Execs {
+		if exec.SQL == sql {
+			execs = append(execs, exec)
+		}
+	}
+
+	return execs
+}
+
+type tx struct {
+	pgx.Tx
+	db   *DB
+	done bool
+}
+
+func (tx *tx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return tx.db.Exec(ctx, sql, args...)
+}
+
+func (tx *tx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return tx.db.Query(ctx, sql, args...)
+}
+
+func (tx *tx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return tx.db.QueryRow(ctx, sql, args...)
+}
+
+func (tx *tx) Commit(ctx context.Context) error {
+	if tx.done {
+		return pgx.ErrTxClosed
+	}
+
+	tx.done = true
+	tx.db.Commits++
+	return nil
+}
+
+func (tx *tx) Rollback(ctx context.Context) error {
+	tx.done = true
+	return nil
+}
+
+type rows struct {
+	pgx.Rows
+	rows [][]any
+	next int
+}
+
+func (r *rows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+// Copies the scripted row into the destinations, a nil value scans as the zero value. A row has to
+// hold a value of the destination's type for every column scanned.
+func (r *rows) Scan(dest ...any) error {
+	scripted := r.rows[r.next-1]
+	if len(scripted) != len(dest) {
+		return fmt.Errorf("pgtest: row has %d values, %d columns scanned", len(scripted), len(dest))
+	}
+
+	for i, value := range scripted {
+		field := reflect.ValueOf(dest[i]).Elem()
+		if value == nil {
+			field.SetZero()
+			continue
+		}
+
+		v := reflect.ValueOf(value)
+		if !v.Type().AssignableTo(field.Type()) {
+			return fmt.Errorf("pgtest: column %d scans into %s, row has %s", i+1, field.Type(), v.Type())
+		}
+
+		field.Set(v)
+	}
+
+	return nil
+}
+
+func (r *rows) Close()     {}
+func (r *rows) Err() error { return nil }
+
+type row struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r *row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	if !r.rows.Next() {
+		return pgx.ErrNoRows
+	}
+
+	return r.rows.Scan(dest...)
+}
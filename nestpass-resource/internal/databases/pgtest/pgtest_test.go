@@ -0,0 +1,42 @@
+package pgtest
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_QueryChecksArguments(t *testing.T) {
+	ctx, db := context.Background(), &DB{}
+
+	if _, err := db.Exec(ctx, "UPDATE t SET a = $1 WHERE b = $2", 1); err == nil {
+		t.Fatal("Exec() ran a statement missing an argument")
+	}
+
+	if _, err := db.Query(ctx, "SELECT a FROM t WHERE b = $1", 1, 2); err == nil {
+		t.Fatal("Query() ran a statement passed an extra argument")
+	}
+
+	if len(db.Execs) != 0 || len(db.Queries) != 0 {
+		t.Fatalf("recorded %+v and %+v, want the failed statements left out", db.Execs, db.Queries)
+	}
+}
+
+func Test_ScanChecksColumns(t *testing.T) {
+	ctx, sql := context.Background(), "SELECT a, b FROM t"
+	db := &DB{Results: map[string][][]any{sql: {{"a", 2}}}}
+
+	var a string
+	var b int
+	if err := db.QueryRow(ctx, sql).Scan(&a, &b); err != nil || a != "a" || b != 2 {
+		t.Fatalf("Scan() = %q, %d, %v", a, b, err)
+	}
+
+	if err := db.QueryRow(ctx, sql).Scan(&a); err == nil {
+		t.Fatal("Scan() dropped a scripted value")
+	}
+
+	// columns scanned out of order
+	if err := db.QueryRow(ctx, sql).Scan(&b, &a); err == nil {
+		t.Fatal("Scan() took a string into an int")
+	}
+}
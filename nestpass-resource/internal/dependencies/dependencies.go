@@ -5,11 +5,21 @@ import (
 
 	"nestpass/internal/config"
 	"nestpass/internal/databases"
+	"nestpass/internal/email"
+	"nestpass/internal/storage"
+	"nestpass/pkg/auth"
+	"nestpass/pkg/pagination"
 )
 
 // Dependencies contains all dependencies for the server.
 type Dependencies struct {
+	Cfg       *config.Configuration
 	Databases *databases.Databases
+	Keys      *auth.KeySet
+	Sessions  *auth.SessionChecker
+	Email     *email.Manager
+	Blobs     storage.BlobStore
+	Pager     *pagination.Pager
 }
 
 // New creates a new dependencies instance.
@@ -21,7 +31,23 @@ func New(cfg *config.Configuration) (*Dependencies, error) {
 		return nil, err
 	}
 
+	emailManager, err := email.NewManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs, err := storage.NewLocalStore(cfg.AttachmentDir)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Dependencies{
+		Cfg:       cfg,
 		Databases: db,
+		Keys:      auth.NewKeySet(cfg.JWKSURL),
+		Sessions:  auth.NewSessionChecker(db.Redis),
+		Email:     emailManager,
+		Blobs:     blobs,
+		Pager:     pagination.NewPager(cfg.PaginationSecret),
 	}, nil
 }
@@ -0,0 +1,33 @@
+package email
+
+import (
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"nestpass/internal/config"
+	"nestpass/internal/proto/pb/notificationpb"
+)
+
+// Types of notifications sent through the email service.
+const (
+	EmergencyRequested = "emergency_requested"
+	EmergencyGranted   = "emergency_granted"
+	EmergencyVetoed    = "emergency_vetoed"
+)
+
+// Manager is used for sending notification emails.
+type Manager struct {
+	Client notificationpb.NotificationServiceClient
+}
+
+// Used to initialize the email service client, the connection is established on first use.
+func NewManager(cfg *config.Configuration) (*Manager, error) {
+	conn, err := grpc.Dial(cfg.EmailGRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Error().Str("location", "email.NewManager").Msgf("failed to connect to email service: %v", err)
+		return nil, err
+	}
+
+	return &Manager{Client: notificationpb.NewNotificationServiceClient(conn)}, nil
+}
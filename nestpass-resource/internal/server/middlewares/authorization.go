@@ -7,11 +7,10 @@ import (
 
 	"github.com/tuan882612/apiutils"
 
-	"nestpass/internal/config"
 	"nestpass/pkg/auth"
 )
 
-func Authorization(cfg *config.Configuration) func(http.Handler) http.Handler {
+func Authorization(keys *auth.KeySet, sessions *auth.SessionChecker, memberships auth.MembershipStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// double submit cookie verification
@@ -42,14 +41,38 @@ func Authorization(cfg *config.Configuration) func(http.Handler) http.Handler {
 			token := cookie.Value
 
 			// decode JWT token
-			claims, err := auth.DecodeToken(token, cfg.SignKey)
+			claims, err := auth.DecodeToken(token, keys)
+			if err != nil {
+				apiutils.HandleHttpErrors(w, err)
+				return
+			}
+
+			// reject tokens of revoked sessions
+			if claims.ID == "" || claims.ExpiresAt == nil {
+				apiutils.HandleHttpErrors(w, apiutils.NewErrUnauthorized("missing session claims"))
+				return
+			}
+
+			revoked, err := sessions.IsRevoked(claims.ID, claims.ExpiresAt.Time)
+			if err != nil {
+				apiutils.HandleHttpErrors(w, err)
+				return
+			}
+
+			if revoked {
+				apiutils.HandleHttpErrors(w, apiutils.NewErrUnauthorized("session revoked"))
+				return
+			}
+
+			// parse and set user id along with the organizations the user is a member of
+			orgs, err := memberships.GetMemberships(r.Context(), claims.UserID)
 			if err != nil {
 				apiutils.HandleHttpErrors(w, err)
 				return
 			}
 
-			// parse and set user id
 			ctx := context.WithValue(r.Context(), auth.CtxUserID, claims.UserID)
+			ctx = context.WithValue(ctx, auth.CtxMemberships, orgs)
 
 			// call next handler
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -7,12 +7,19 @@ import (
 func Categories(handler *APIHandler) func(r chi.Router) {
 	return func(r chi.Router) {
 		r.Get("/", handler.Category.GetAllCategories)
+		r.Get("/tree", handler.Category.GetSubtree)
 
 		r.Route("/category", func(r chi.Router) {
 			r.Get("/", handler.Category.GetCategory)
 			r.Post("/", handler.Category.CreateCategory)
 			r.Patch("/", handler.Category.UpdateCategory)
 			r.Delete("/", handler.Category.DeleteCategory)
+			r.Patch("/move", handler.Category.MoveCategory)
+		})
+		r.Route("/trash", func(r chi.Router) {
+			r.Get("/", handler.Category.GetTrash)
+			r.Post("/restore", handler.Category.RestoreCategory)
+			r.Delete("/", handler.Category.PurgeCategory)
 		})
 		r.Route("/passwords", Passwords(handler))
 	}
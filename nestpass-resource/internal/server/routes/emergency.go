@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+)
+
+func Emergency(handler *APIHandler) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", handler.Emergency.GetContacts)
+		r.Post("/", handler.Emergency.AddContact)
+		r.Delete("/", handler.Emergency.RemoveContact)
+		r.Post("/approve", handler.Emergency.ApproveAccess)
+		r.Post("/veto", handler.Emergency.VetoAccess)
+		r.Get("/granted", handler.Emergency.GetGrantors)
+		r.Post("/request", handler.Emergency.RequestAccess)
+		r.Get("/vault", handler.Emergency.GetVault)
+	}
+}
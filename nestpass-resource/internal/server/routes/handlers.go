@@ -4,19 +4,34 @@ import (
 	"nestpass/internal/dependencies"
 	"nestpass/internal/users"
 	"nestpass/internal/users/categories"
+	"nestpass/internal/users/emergency"
+	"nestpass/internal/users/orgs"
 	"nestpass/internal/users/passwords"
+	"nestpass/internal/users/shares"
 )
 
 type APIHandler struct {
-	User     *users.Handler
-	Category *categories.Handler
-	Password *passwords.Handler
+	User      *users.Handler
+	Category  *categories.Handler
+	Password  *passwords.Handler
+	Org       *orgs.Handler
+	Share     *shares.Handler
+	Emergency *emergency.Handler
 }
 
-func NewAPIHandler(deps *dependencies.Dependencies) *APIHandler {
-	return &APIHandler{
-		User:     users.NewHandler(deps),
-		Category: categories.NewHandler(deps),
-		Password: passwords.NewHandler(deps),
+func NewAPIHandler(deps *dependencies.Dependencies) (*APIHandler, error) {
+	passwordHandler, err := passwords.NewHandler(deps)
+	if err != nil {
+		return nil, err
 	}
+
+	categoryHandler := categories.NewHandler(deps)
+	return &APIHandler{
+		User:      users.NewHandler(deps),
+		Category:  categoryHandler,
+		Password:  passwordHandler,
+		Org:       orgs.NewHandler(deps, passwordHandler),
+		Share:     shares.NewHandler(deps, passwordHandler, categoryHandler),
+		Emergency: emergency.NewHandler(deps, passwordHandler),
+	}, nil
 }
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+)
+
+func Orgs(handler *APIHandler) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", handler.Org.GetOrgs)
+		r.Post("/", handler.Org.CreateOrg)
+		r.Delete("/", handler.Org.DeleteOrg)
+
+		r.Route("/members", func(r chi.Router) {
+			r.Get("/", handler.Org.GetMembers)
+			r.Patch("/", handler.Org.UpdateRole)
+			r.Delete("/", handler.Org.RemoveMember)
+		})
+
+		r.Route("/invites", func(r chi.Router) {
+			r.Get("/", handler.Org.GetInvites)
+			r.Post("/", handler.Org.Invite)
+			r.Delete("/", handler.Org.RevokeInvite)
+			r.Get("/received", handler.Org.GetReceivedInvites)
+			r.Post("/received", handler.Org.AcceptInvite)
+			r.Delete("/received", handler.Org.DeclineInvite)
+		})
+	}
+}
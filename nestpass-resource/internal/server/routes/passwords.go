@@ -7,12 +7,45 @@ import (
 func Passwords(handler *APIHandler) func(r chi.Router) {
 	return func(r chi.Router) {
 		r.Get("/", handler.Password.GetAllPasswords)
+		r.Get("/search", handler.Password.SearchPasswords)
+		r.Get("/health", handler.Password.GetHealth)
+		r.Post("/generate", handler.Password.Generate)
 
 		r.Route("/password", func(r chi.Router) {
 			r.Get("/", handler.Password.GetPassword)
 			r.Post("/", handler.Password.CreatePassword)
 			r.Patch("/", handler.Password.UpdatePassword)
 			r.Delete("/", handler.Password.DeletePassword)
+			r.Get("/otp", handler.Password.GetOTPCode)
+			r.Post("/otp", handler.Password.IssueHOTPCode)
+
+			r.Route("/history", func(r chi.Router) {
+				r.Get("/", handler.Password.GetRevisions)
+				r.Get("/revision", handler.Password.GetRevision)
+				r.Post("/restore", handler.Password.RestoreRevision)
+			})
+
+			r.Route("/attachments", func(r chi.Router) {
+				r.Get("/", handler.Password.GetAttachments)
+				r.Post("/", handler.Password.UploadAttachment)
+				r.Delete("/", handler.Password.DeleteAttachment)
+				r.Get("/file", handler.Password.DownloadAttachment)
+				r.Get("/usage", handler.Password.GetAttachmentUsage)
+			})
+		})
+
+		r.Route("/tags", func(r chi.Router) {
+			r.Get("/", handler.Password.GetTags)
+			r.Post("/", handler.Password.CreateTag)
+			r.Patch("/", handler.Password.RenameTag)
+			r.Delete("/", handler.Password.DeleteTag)
+		})
+
+		r.Route("/trash", func(r chi.Router) {
+			r.Get("/", handler.Password.GetTrash)
+			r.Post("/restore", handler.Password.RestorePassword)
+			r.Delete("/", handler.Password.PurgePassword)
+			r.Delete("/all", handler.Password.EmptyTrash)
 		})
 	}
 }
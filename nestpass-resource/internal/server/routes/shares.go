@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+)
+
+func Shares(handler *APIHandler) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", handler.Share.GetShares)
+		r.Post("/", handler.Share.CreateShare)
+		r.Delete("/", handler.Share.RevokeShare)
+		r.Get("/received", handler.Share.GetSharedWithMe)
+		r.Patch("/received", handler.Share.UpdateShared)
+	}
+}
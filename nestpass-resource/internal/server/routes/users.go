@@ -3,17 +3,21 @@ package routes
 import (
 	"github.com/go-chi/chi/v5"
 
-	"nestpass/internal/config"
+	"nestpass/internal/dependencies"
 	"nestpass/internal/server/middlewares"
 )
 
-func Users(handler *APIHandler, cfg *config.Configuration) func(r chi.Router) {
+func Users(handler *APIHandler, deps *dependencies.Dependencies) func(r chi.Router) {
 	return func(r chi.Router) {
 
-		r.Use(middlewares.Authorization(cfg))
+		r.Use(middlewares.Authorization(deps.Keys, deps.Sessions, handler.Org))
 		r.Get("/", handler.User.GetUser)
 		r.Get("/clikey", handler.User.GetCliKey)
 		r.Put("/clikey", handler.User.CreateCliKey)
+		r.Route("/vault", Vault(handler))
 		r.Route("/categories", Categories(handler))
+		r.Route("/orgs", Orgs(handler))
+		r.Route("/shares", Shares(handler))
+		r.Route("/emergency", Emergency(handler))
 	}
 }
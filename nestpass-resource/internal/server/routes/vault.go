@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+)
+
+func Vault(handler *APIHandler) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", handler.Password.GetVault)
+		r.Post("/client", handler.Password.EnableClientMode)
+		r.Put("/key", handler.Password.UpdateWrappedKey)
+		r.Get("/rekey", handler.Password.GetRekeyStatus)
+		r.Post("/rekey", handler.Password.Rekey)
+		r.Post("/export", handler.Password.Export)
+		r.Post("/import", handler.Password.Import)
+	}
+}
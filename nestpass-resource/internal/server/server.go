@@ -1,25 +1,34 @@
 package server
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
 
 	"nestpass/internal/config"
 	"nestpass/internal/dependencies"
+	"nestpass/internal/proto/pb/vaultpb"
 	"nestpass/internal/server/routes"
+	"nestpass/internal/users/passwords"
+	"nestpass/pkg/auth"
 )
 
 // Server contains components and properties for the server.
 type Server struct {
 	// server components
 	Router *chi.Mux
+	GRPC   *grpc.Server
 	Cfg    *config.Configuration
 	// server properties
 	ApiAddr    string
 	ApiVersion string
+	GRPCAddr   string
 	// dependencies
 	Deps *dependencies.Dependencies
 }
@@ -36,9 +45,11 @@ func New(cfg *config.Configuration) (*Server, error) {
 
 	return &Server{
 		Router:     chi.NewRouter(),
+		GRPC:       grpc.NewServer(grpc.UnaryInterceptor(auth.ServiceAuth(deps.Keys))),
 		Cfg:        cfg,
 		ApiAddr:    cfg.Host + ":" + cfg.Port,
 		ApiVersion: "/api/" + cfg.ApiVersion,
+		GRPCAddr:   cfg.Host + ":" + cfg.GRPCPort,
 		Deps:       deps,
 	}, nil
 }
@@ -49,19 +60,30 @@ func (s *Server) SetupRouter() error {
 	s.setupMiddleware()
 
 	// initialize api handler
-	apiHandler := routes.NewAPIHandler(s.Deps)
+	apiHandler, err := routes.NewAPIHandler(s.Deps)
+	if err != nil {
+		return err
+	}
 
 	// routing all api endpoints
 	s.Router.NotFound(NotFoundHandler)
 	s.Router.Route(s.ApiVersion, func(r chi.Router) {
-		// routing internal endpoints
-		r.Patch("/rehash", apiHandler.Password.RehashAllPasswords)
-
 		// routing user endpoints
 		r.Get("/health", HealthHandler)
-		r.Route("/user", routes.Users(apiHandler, s.Cfg))
+		r.Route("/user", routes.Users(apiHandler, s.Deps))
 	})
 
+	// internal services for the auth server, every call needs a service token
+	vaultpb.RegisterVaultServiceServer(s.GRPC, passwords.NewVaultServer(apiHandler.Password))
+
+	// resume background work left over from a previous run
+	go apiHandler.Password.ResumeRekeyJobs(context.Background())
+	go apiHandler.Password.RunRewraps(context.Background())
+	go apiHandler.Password.IndexVaults(context.Background())
+	go s.runTrashPurger(apiHandler)
+	go s.runEmergencyTimer(apiHandler)
+	go apiHandler.Share.RunSyncs(context.Background())
+
 	return nil
 }
 
@@ -71,8 +93,78 @@ func (s *Server) setupMiddleware() {
 	
 }
 
-// Starts the HTTP server.
+// Starts the internal gRPC server and the HTTP server.
 func (s *Server) Run() {
+	go s.runGRPC()
+
 	log.Info().Msg("server is running on " + s.ApiAddr + s.ApiVersion)
 	http.ListenAndServe(s.ApiAddr, s.Router)
 }
+
+// helper: runGRPC serves the internal services.
+func (s *Server) runGRPC() {
+	listener, err := net.Listen("tcp", s.GRPCAddr)
+	if err != nil {
+		log.Error().Str("location", "runGRPC").Msgf("failed to listen on %s: %v", s.GRPCAddr, err)
+		return
+	}
+
+	log.Info().Msg("grpc server is running on " + s.GRPCAddr)
+	if err := s.GRPC.Serve(listener); err != nil {
+		log.Error().Str("location", "runGRPC").Msgf("grpc server stopped: %v", err)
+	}
+}
+
+// how often trashed items past the retention window are looked for
+const trashPurgeInterval = time.Hour
+
+// helper: runTrashPurger permanently deletes trashed categories and passwords past the retention window
+// and removes the blobs of deleted attachments.
+func (s *Server) runTrashPurger(handler *routes.APIHandler) {
+	retention := time.Duration(s.Cfg.TrashRetentionDays) * 24 * time.Hour
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx := context.Background()
+		cutoff := time.Now().Add(-retention)
+
+		// categories first, they take the passwords inside them along
+		if err := handler.Category.PurgeExpired(ctx, cutoff); err != nil {
+			log.Error().Str("location", "runTrashPurger").Msgf("failed to purge categories: %v", err)
+		}
+
+		if err := handler.Password.PurgeExpired(ctx, cutoff); err != nil {
+			log.Error().Str("location", "runTrashPurger").Msgf("failed to purge passwords: %v", err)
+		}
+
+		// blobs of the attachments purged above and any left over by earlier deletes
+		if removed, err := handler.Password.SweepBlobs(ctx); err != nil {
+			log.Error().Str("location", "runTrashPurger").Msgf("failed to sweep attachment blobs: %v", err)
+		} else if removed > 0 {
+			log.Info().Str("location", "runTrashPurger").Msgf("%v attachment blobs removed", removed)
+		}
+
+		<-ticker.C
+	}
+}
+
+// how often emergency access requests and grants are checked for timers that ran out
+const emergencyTimerInterval = 5 * time.Minute
+
+// helper: runEmergencyTimer grants requests whose wait passed and expires grants whose window closed.
+func (s *Server) runEmergencyTimer(handler *routes.APIHandler) {
+	ticker := time.NewTicker(emergencyTimerInterval)
+	defer ticker.Stop()
+
+	for {
+		processed, err := handler.Emergency.ProcessTimers(context.Background(), time.Now())
+		if err != nil {
+			log.Error().Str("location", "runEmergencyTimer").Msgf("failed to process emergency timers: %v", err)
+		} else if processed > 0 {
+			log.Info().Str("location", "runEmergencyTimer").Msgf("%v emergency contacts processed", processed)
+		}
+
+		<-ticker.C
+	}
+}
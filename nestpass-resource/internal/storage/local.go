@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// LocalStore keeps blobs as files in a directory, sharded by the first two characters of the key.
+type LocalStore struct {
+	dir string
+}
+
+// Creates the store, the directory is created if it does not exist.
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Error().Str("location", "NewLocalStore").Msgf("failed to create %v: %v", dir, err)
+		return nil, err
+	}
+
+	return &LocalStore{dir: dir}, nil
+}
+
+// helper: path maps the key to its file, keys can not point outside the store.
+func (l *LocalStore) path(key string) (string, error) {
+	if len(key) < 3 || strings.ContainsAny(key, `/\.`) {
+		return "", errors.New("invalid blob key")
+	}
+
+	return filepath.Join(l.dir, key[:2], key), nil
+}
+
+func (l *LocalStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		log.Error().Str("location", "LocalStore.Put").Msgf("%v: %v", key, err)
+		return 0, err
+	}
+
+	// written to a temporary file first, so readers never see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".tmp")
+	if err != nil {
+		log.Error().Str("location", "LocalStore.Put").Msgf("%v: %v", key, err)
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		log.Error().Str("location", "LocalStore.Put").Msgf("%v: %v", key, err)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (l *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrBlobNotFound
+		}
+
+		log.Error().Str("location", "LocalStore.Get").Msgf("%v: %v", key, err)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (l *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Error().Str("location", "LocalStore.Delete").Msgf("%v: %v", key, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps opaque blobs by key. Blobs are written once and never changed, backends other
+// than the local filesystem only have to implement these three calls.
+type BlobStore interface {
+	// Stores everything read from r under the key, returns the number of bytes stored.
+	// A failed put leaves nothing behind.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Opens the blob for reading, ErrBlobNotFound when there is none under the key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Removes the blob, removing a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -1,35 +1,44 @@
 package categories
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/tuan882612/apiutils"
 
 	"nestpass/internal/dependencies"
 	"nestpass/pkg/auth"
-	"nestpass/pkg/httputils"
+	"nestpass/pkg/pagination"
 )
 
 type Handler struct {
-	svc *service
+	svc   *service
+	pager *pagination.Pager
 }
 
 func NewHandler(deps *dependencies.Dependencies) *Handler {
 	repo := NewRepository(deps.Databases.Postgres)
 	svc := NewService(repo)
-	return &Handler{svc: svc}
+	return &Handler{svc: svc, pager: deps.Pager}
 }
 
 func (h *Handler) GetAllCategories(w http.ResponseWriter, r *http.Request) {
-	userID, err := auth.UidFromCtx(r.Context())
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
-	params := httputils.GetPaginationParams(r)
-	categories, err := h.svc.GetAllCategories(r.Context(), userID, params)
+	params, err := h.pager.Parse(r)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categories, err := h.svc.GetAllCategories(r.Context(), ownerID, params)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
@@ -40,7 +49,7 @@ func (h *Handler) GetAllCategories(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetCategory(w http.ResponseWriter, r *http.Request) {
-	userID, err := auth.UidFromCtx(r.Context())
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
@@ -52,7 +61,14 @@ func (h *Handler) GetCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	category, err := h.svc.GetCategory(r.Context(), userID, key)
+	// names are only unique among siblings
+	parentID, err := optionalUUID(r, "parent_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	category, err := h.svc.GetCategory(r.Context(), ownerID, key, parentID)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
@@ -69,6 +85,13 @@ func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionCollections)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+	category.UserID = ownerID
+
 	categoryID, err := h.svc.CreateCategory(r.Context(), category)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
@@ -87,6 +110,13 @@ func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionCollections)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+	category.UserID = ownerID
+
 	categoryResp, err := h.svc.UpdateCategory(r.Context(), category)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
@@ -98,7 +128,134 @@ func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
-	userID, err := auth.UidFromCtx(r.Context())
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionCollections)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := uuid.Parse(r.URL.Query().Get("category_id"))
+	if err != nil {
+		apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("invalid category_id"))
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = DeleteReparent
+	}
+
+	if err := h.svc.DeleteCategory(r.Context(), categoryID, ownerID, mode); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetSubtree(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := optionalUUID(r, "category_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	depth := 0
+	if rawDepth := r.URL.Query().Get("depth"); rawDepth != "" {
+		if depth, err = strconv.Atoi(rawDepth); err != nil || depth < 0 {
+			apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("invalid depth"))
+			return
+		}
+	}
+
+	tree, err := h.svc.GetSubtree(r.Context(), ownerID, categoryID, depth)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", tree)
+	resp.SendRes(w)
+}
+
+func (h *Handler) MoveCategory(w http.ResponseWriter, r *http.Request) {
+	move := &Move{}
+	if err := move.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionCollections)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	category, err := h.svc.MoveCategory(r.Context(), ownerID, move)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", category)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	params, err := h.pager.ParseOrder(r, pagination.Desc)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	trash, err := h.svc.GetTrash(r.Context(), ownerID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", trash)
+	resp.SendRes(w)
+}
+
+func (h *Handler) RestoreCategory(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionCollections)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := uuid.Parse(r.URL.Query().Get("category_id"))
+	if err != nil {
+		apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("invalid category_id"))
+		return
+	}
+
+	category, err := h.svc.RestoreCategory(r.Context(), ownerID, categoryID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", category)
+	resp.SendRes(w)
+}
+
+func (h *Handler) PurgeCategory(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionCollections)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
@@ -110,7 +267,7 @@ func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.svc.DeleteCategory(r.Context(), categoryID, userID); err != nil {
+	if err := h.svc.PurgeCategory(r.Context(), ownerID, categoryID); err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
@@ -118,3 +275,28 @@ func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 	resp := apiutils.NewRes(http.StatusOK, "", nil)
 	resp.SendRes(w)
 }
+
+// Permanently deletes the categories trashed before the cutoff.
+func (h *Handler) PurgeExpired(ctx context.Context, cutoff time.Time) error {
+	return h.svc.PurgeExpired(ctx, cutoff)
+}
+
+// Registers a hook run after every write that moves passwords between categories or out of them.
+func (h *Handler) OnWrite(hook WriteHook) {
+	h.svc.OnWrite(hook)
+}
+
+// helper: optionalUUID parses an optional id query parameter, nil when it is missing.
+func optionalUUID(r *http.Request, name string) (*uuid.UUID, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, apiutils.NewErrBadRequest("invalid " + name)
+	}
+
+	return &id, nil
+}
@@ -3,17 +3,23 @@ package categories
 import (
 	"encoding/json"
 	"io"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
+// Category is a folder in the user's category tree, root categories have no parent.
 type Category struct {
-	CategoryID  uuid.UUID `json:"category_id,omitempty"`
-	UserID      uuid.UUID `json:"user_id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
+	CategoryID  uuid.UUID   `json:"category_id,omitempty"`
+	UserID      uuid.UUID   `json:"user_id"`
+	ParentID    *uuid.UUID  `json:"parent_id,omitempty"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Depth       int         `json:"depth,omitempty"` // levels below the root of a listed subtree
+	Children    []*Category `json:"children,omitempty"`
+	DeletedAt   *time.Time  `json:"deleted_at,omitempty"` // set while the category is in the trash
 }
 
 type Scanable interface {
@@ -21,7 +27,17 @@ type Scanable interface {
 }
 
 func (c *Category) Scan(row Scanable) error {
-	return row.Scan(&c.CategoryID, &c.UserID, &c.Name, &c.Description)
+	return row.Scan(&c.CategoryID, &c.UserID, &c.ParentID, &c.Name, &c.Description)
+}
+
+// Scans a category of a subtree listing along with its depth.
+func (c *Category) ScanNode(row Scanable) error {
+	return row.Scan(&c.CategoryID, &c.UserID, &c.ParentID, &c.Name, &c.Description, &c.Depth)
+}
+
+// Scans a trashed category along with the time it was deleted.
+func (c *Category) ScanTrashed(row Scanable) error {
+	return row.Scan(&c.CategoryID, &c.UserID, &c.ParentID, &c.Name, &c.Description, &c.DeletedAt)
 }
 
 func (c *Category) Deserialize(data io.ReadCloser) error {
@@ -38,11 +54,87 @@ func (c *Category) Deserialize(data io.ReadCloser) error {
 	return nil
 }
 
-func New(name, description string, userID uuid.UUID) *Category {
+func New(name, description string, userID uuid.UUID, parentID *uuid.UUID) *Category {
 	return &Category{
 		CategoryID:  uuid.New(),
 		UserID:      userID,
+		ParentID:    parentID,
 		Name:        name,
 		Description: description,
 	}
 }
+
+// Move reparents a category, a nil parent moves it to the root.
+type Move struct {
+	CategoryID uuid.UUID  `json:"category_id" validate:"required"`
+	ParentID   *uuid.UUID `json:"parent_id"`
+}
+
+func (m *Move) Deserialize(data io.ReadCloser) error {
+	if err := json.NewDecoder(data).Decode(m); err != nil {
+		log.Error().Str("location", "Deserialize").Msg(err.Error())
+		return err
+	}
+
+	if err := validator.New().Struct(m); err != nil {
+		log.Error().Str("location", "Deserialize").Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// how the children of a deleted category are handled
+const (
+	DeleteRecursive = "recursive" // the whole subtree is deleted
+	DeleteReparent  = "reparent"  // children move up to the deleted category's parent
+)
+
+// deepest level a subtree listing descends to
+const MaxDepth = 32
+
+// BuildTree nests the categories of a subtree listing under their parents, returning the top level nodes.
+func BuildTree(nodes []*Category) []*Category {
+	byID := map[uuid.UUID]*Category{}
+	for _, node := range nodes {
+		byID[node.CategoryID] = node
+	}
+
+	roots := []*Category{}
+	for _, node := range nodes {
+		if node.ParentID != nil {
+			if parent, ok := byID[*node.ParentID]; ok && node.Depth > 0 {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+
+		roots = append(roots, node)
+	}
+
+	return roots
+}
+
+// Flatten lists every category of a tree, each parent before its children. A subtree listing
+// that was never nested comes back as it is.
+func Flatten(tree []*Category) []*Category {
+	flat := []*Category{}
+	for _, node := range tree {
+		flat = append(flat, node)
+		flat = append(flat, Flatten(node.Children)...)
+	}
+
+	return flat
+}
+
+// createsCycle checks if moving the category under a parent with the given ancestors would
+// make it its own ancestor, ancestors include the parent itself.
+func createsCycle(categoryID uuid.UUID, ancestors []uuid.UUID) bool {
+	for _, id := range ancestors {
+		if id == categoryID {
+			return true
+		}
+	}
+
+	return false
+}
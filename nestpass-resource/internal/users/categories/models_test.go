@@ -0,0 +1,67 @@
+package categories
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func Test_BuildTree(t *testing.T) {
+	userID := uuid.New()
+	root := New("root", "", userID, nil)
+	child := New("child", "", userID, &root.CategoryID)
+	child.Depth = 1
+	grandchild := New("grandchild", "", userID, &child.CategoryID)
+	grandchild.Depth = 2
+	other := New("other", "", userID, nil)
+
+	tree := BuildTree([]*Category{root, other, child, grandchild})
+	if len(tree) != 2 || tree[0] != root || tree[1] != other {
+		t.Fatalf("unexpected top level %+v", tree)
+	}
+	if len(root.Children) != 1 || root.Children[0] != child || child.Children[0] != grandchild {
+		t.Fatal("children not nested under their parents")
+	}
+
+	// a listed subtree starts at a category that has a parent outside of it
+	subtree := BuildTree([]*Category{{CategoryID: child.CategoryID, ParentID: &root.CategoryID}})
+	if len(subtree) != 1 {
+		t.Fatal("subtree root dropped")
+	}
+}
+
+func Test_Flatten(t *testing.T) {
+	userID := uuid.New()
+	root := New("root", "", userID, nil)
+	child := New("child", "", userID, &root.CategoryID)
+	child.Depth = 1
+	grandchild := New("grandchild", "", userID, &child.CategoryID)
+	grandchild.Depth = 2
+	other := New("other", "", userID, nil)
+
+	flat := Flatten(BuildTree([]*Category{root, other, child, grandchild}))
+	if len(flat) != 4 || flat[0] != root || flat[1] != child || flat[2] != grandchild || flat[3] != other {
+		t.Fatalf("unexpected flattened tree %+v", flat)
+	}
+
+	// a listing that was never nested keeps its order
+	listing := []*Category{New("a", "", userID, nil), New("b", "", userID, nil)}
+	if flat := Flatten(listing); len(flat) != 2 || flat[0] != listing[0] || flat[1] != listing[1] {
+		t.Fatal("flat listing changed")
+	}
+}
+
+func Test_CreatesCycle(t *testing.T) {
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+
+	// moving a under c where c -> b -> a
+	if !createsCycle(a, []uuid.UUID{c, b, a}) {
+		t.Fatal("move into own subtree allowed")
+	}
+	if !createsCycle(a, []uuid.UUID{a}) {
+		t.Fatal("move under itself allowed")
+	}
+	if createsCycle(a, []uuid.UUID{c, b}) {
+		t.Fatal("valid move rejected")
+	}
+}
@@ -1,29 +1,183 @@
 package categories
 
 const (
+	// pages start after the boundary id, the first page has none
 	GetAllCategoriesQuery = `
-	SELECT * FROM categories
-	WHERE user_id = $1 AND category_id > $2
+	SELECT category_id, user_id, parent_id, name, description FROM categories
+	WHERE user_id = $1 AND deleted_at IS NULL AND ($2::uuid IS NULL OR category_id > $2)
 	ORDER BY category_id ASC
 	LIMIT $3`
 
+	GetAllCategoriesDescQuery = `
+	SELECT category_id, user_id, parent_id, name, description FROM categories
+	WHERE user_id = $1 AND deleted_at IS NULL AND ($2::uuid IS NULL OR category_id < $2)
+	ORDER BY category_id DESC
+	LIMIT $3`
+
 	GetNameCategoryQuery = `
-	SELECT * FROM categories
-	WHERE name = $1 AND user_id = $2`
+	SELECT category_id, user_id, parent_id, name, description FROM categories
+	WHERE name = $1 AND user_id = $2 AND parent_id IS NOT DISTINCT FROM $3 AND deleted_at IS NULL`
 
 	GetUUIDCategoryQuery = `
-	SELECT * FROM categories
-	WHERE category_id = $1 AND user_id = $2`
+	SELECT category_id, user_id, parent_id, name, description FROM categories
+	WHERE category_id = $1 AND user_id = $2 AND deleted_at IS NULL`
+
+	// subtree below the category, or the whole tree when the category is null
+	GetSubtreeQuery = `
+	WITH RECURSIVE tree AS (
+		SELECT category_id, user_id, parent_id, name, description, 0 AS depth FROM categories
+		WHERE user_id = $1 AND deleted_at IS NULL AND (category_id = $2 OR ($2::uuid IS NULL AND parent_id IS NULL))
+		UNION ALL
+		SELECT c.category_id, c.user_id, c.parent_id, c.name, c.description, t.depth + 1 FROM categories c
+		JOIN tree t ON c.parent_id = t.category_id
+		WHERE c.user_id = $1 AND c.deleted_at IS NULL AND t.depth < $3
+	)
+	SELECT category_id, user_id, parent_id, name, description, depth FROM tree
+	ORDER BY depth ASC, name ASC`
+
+	// the category and every category above it, none when the category is in the trash
+	GetAncestorsQuery = `
+	WITH RECURSIVE ancestors AS (
+		SELECT category_id, parent_id FROM categories
+		WHERE category_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		UNION ALL
+		SELECT c.category_id, c.parent_id FROM categories c
+		JOIN ancestors a ON c.category_id = a.parent_id
+		WHERE c.user_id = $2
+	)
+	SELECT category_id FROM ancestors`
+
+	// the category and every category below it, trashed ones included
+	GetDescendantIDsQuery = `
+	WITH RECURSIVE tree AS (
+		SELECT category_id FROM categories
+		WHERE category_id = $1 AND user_id = $2
+		UNION ALL
+		SELECT c.category_id FROM categories c
+		JOIN tree t ON c.parent_id = t.category_id
+		WHERE c.user_id = $2
+	)
+	SELECT category_id FROM tree`
+
+	SiblingNameExistsQuery = `
+	SELECT EXISTS (
+		SELECT 1 FROM categories
+		WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND name = $3 AND category_id <> $4
+			AND deleted_at IS NULL
+	)`
+
+	// children of the category whose name is taken at the level of the new parent
+	ReparentConflictQuery = `
+	SELECT EXISTS (
+		SELECT 1 FROM categories c
+		JOIN categories s ON s.user_id = c.user_id AND s.name = c.name
+			AND s.parent_id IS NOT DISTINCT FROM $3 AND s.category_id <> $2 AND s.deleted_at IS NULL
+		WHERE c.user_id = $1 AND c.parent_id = $2 AND c.deleted_at IS NULL
+	)`
+
+	// serializes changes to the user's tree so concurrent moves can not form a cycle
+	LockTreeQuery = `
+	SELECT pg_advisory_xact_lock(hashtextextended('categories:' || $1::text, 0))`
 
 	InsertCategoryQuery = `
-	INSERT INTO categories (category_id, user_id, name, description)
-	VALUES ($1, $2, $3, $4)`
+	INSERT INTO categories (category_id, user_id, parent_id, name, description)
+	VALUES ($1, $2, $3, $4, $5)`
 
 	UpdateCategoryQuery = `
 	UPDATE categories SET name = $1, description = $2
 	WHERE category_id = $3 AND user_id = $4`
 
-	DeleteCategoryQuery = `
+	MoveCategoryQuery = `
+	UPDATE categories SET parent_id = $1
+	WHERE category_id = $2 AND user_id = $3`
+
+	ReparentChildrenQuery = `
+	UPDATE categories SET parent_id = $1
+	WHERE parent_id = $2 AND user_id = $3 AND deleted_at IS NULL`
+
+	// categories already in the trash keep the time they were deleted at
+	TrashCategoriesQuery = `
+	UPDATE categories SET deleted_at = $3
+	WHERE category_id = ANY($1) AND user_id = $2 AND deleted_at IS NULL`
+
+	TrashCategoriesPasswordsQuery = `
+	UPDATE passwords SET deleted_at = $3
+	WHERE category_id = ANY($1) AND user_id = $2 AND deleted_at IS NULL`
+
+	GetTrashQuery = `
+	SELECT category_id, user_id, parent_id, name, description, deleted_at FROM categories
+	WHERE user_id = $1 AND deleted_at IS NOT NULL AND ($2::timestamptz IS NULL OR (deleted_at, category_id) > ($2, $3::uuid))
+	ORDER BY deleted_at ASC, category_id ASC
+	LIMIT $4`
+
+	GetTrashDescQuery = `
+	SELECT category_id, user_id, parent_id, name, description, deleted_at FROM categories
+	WHERE user_id = $1 AND deleted_at IS NOT NULL AND ($2::timestamptz IS NULL OR (deleted_at, category_id) < ($2, $3::uuid))
+	ORDER BY deleted_at DESC, category_id DESC
+	LIMIT $4`
+
+	GetTrashedCategoryQuery = `
+	SELECT category_id, user_id, parent_id, name, description, deleted_at FROM categories
+	WHERE category_id = $1 AND user_id = $2 AND deleted_at IS NOT NULL`
+
+	// only the categories and passwords trashed by the same delete come back
+	RestoreCategoriesQuery = `
+	UPDATE categories SET deleted_at = NULL
+	WHERE category_id = ANY($1) AND user_id = $2 AND deleted_at = $3`
+
+	RestoreCategoriesPasswordsQuery = `
+	UPDATE passwords SET deleted_at = NULL
+	WHERE category_id = ANY($1) AND user_id = $2 AND deleted_at = $3`
+
+	// owners of categories trashed before the cutoff
+	GetExpiredTrashUsersQuery = `
+	SELECT DISTINCT user_id FROM categories
+	WHERE deleted_at < $1`
+
+	// categories trashed before the cutoff along with everything below them
+	GetExpiredCategoryIDsQuery = `
+	WITH RECURSIVE tree AS (
+		SELECT category_id FROM categories
+		WHERE user_id = $1 AND deleted_at < $2
+		UNION
+		SELECT c.category_id FROM categories c
+		JOIN tree t ON c.parent_id = t.category_id
+		WHERE c.user_id = $1
+	)
+	SELECT category_id FROM tree`
+
+	DeleteCategoriesQuery = `
 	DELETE FROM categories
-	WHERE category_id = $1 AND user_id = $2`
+	WHERE category_id = ANY($1) AND user_id = $2`
+
+	DeleteCategoriesHistoryQuery = `
+	DELETE FROM password_history
+	WHERE user_id = $2 AND password_id IN (
+		SELECT password_id FROM passwords
+		WHERE category_id = ANY($1) AND user_id = $2
+	)`
+
+	// attachment blobs are queued for removal once the deletion committed
+	DeleteCategoriesAttachmentsQuery = `
+	WITH deleted AS (
+		DELETE FROM attachments
+		WHERE user_id = $2 AND password_id IN (
+			SELECT password_id FROM passwords
+			WHERE category_id = ANY($1) AND user_id = $2
+		)
+		RETURNING attachment_id
+	)
+	INSERT INTO attachment_deletions (attachment_id, queued)
+	SELECT attachment_id, now() FROM deleted`
+
+	DeleteCategoriesTagsQuery = `
+	DELETE FROM password_tags
+	WHERE user_id = $2 AND password_id IN (
+		SELECT password_id FROM passwords
+		WHERE category_id = ANY($1) AND user_id = $2
+	)`
+
+	DeleteCategoriesPasswordsQuery = `
+	DELETE FROM passwords
+	WHERE category_id = ANY($1) AND user_id = $2`
 )
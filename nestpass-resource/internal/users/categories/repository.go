@@ -3,6 +3,7 @@ package categories
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -11,22 +12,35 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/tuan882612/apiutils"
 
-	"nestpass/pkg/httputils"
+	"nestpass/pkg/pagination"
 )
 
+// postgres operations the repository runs, satisfied by *pgxpool.Pool
+type database interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type repository struct {
-	postgres *pgxpool.Pool
+	postgres database
 }
 
 func NewRepository(pg *pgxpool.Pool) *repository {
 	return &repository{postgres: pg}
 }
 
-func (r *repository) GetAllCategories(ctx context.Context, userID uuid.UUID, params *httputils.Pagination) ([]*Category, error) {
+func (r *repository) GetAllCategories(ctx context.Context, userID uuid.UUID, params *pagination.Params) ([]*Category, error) {
 	categories := []*Category{}
 
-	rows, err := r.postgres.Query(ctx, GetAllCategoriesQuery, userID, params.Index, params.Limit)
+	query := GetAllCategoriesQuery
+	if params.Descending() {
+		query = GetAllCategoriesDescQuery
+	}
+
+	rows, err := r.postgres.Query(ctx, query, userID, params.Boundary(), params.Fetch())
 	if err != nil {
+		log.Error().Str("location", "GetAllCategories").Msgf("%v: %v", userID, err)
 		return nil, err
 	}
 
@@ -43,15 +57,17 @@ func (r *repository) GetAllCategories(ctx context.Context, userID uuid.UUID, par
 	return categories, nil
 }
 
-func (r *repository) GetCategory(ctx context.Context, userID uuid.UUID, key string, isUUID bool) (*Category, error) {
+// Retrieves a category by id, or by name among the children of the parent.
+func (r *repository) GetCategory(ctx context.Context, userID uuid.UUID, key string, isUUID bool, parentID *uuid.UUID) (*Category, error) {
 	category := &Category{}
 
-	query := GetNameCategoryQuery
+	var row pgx.Row
 	if isUUID {
-		query = GetUUIDCategoryQuery
+		row = r.postgres.QueryRow(ctx, GetUUIDCategoryQuery, key, userID)
+	} else {
+		row = r.postgres.QueryRow(ctx, GetNameCategoryQuery, key, userID, parentID)
 	}
 
-	row := r.postgres.QueryRow(ctx, query, key, userID)
 	if err := category.Scan(row); err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, apiutils.NewErrNotFound("category not found")
@@ -68,6 +84,7 @@ func (r *repository) CreateCategory(ctx context.Context, tx pgx.Tx, category *Ca
 	_, err := tx.Exec(ctx, InsertCategoryQuery,
 		&category.CategoryID,
 		&category.UserID,
+		category.ParentID,
 		&category.Name,
 		&category.Description,
 	)
@@ -107,17 +124,236 @@ func (r *repository) UpdateCategory(ctx context.Context, tx pgx.Tx, category *Ca
 	return nil
 }
 
-func (r *repository) DeleteCategory(ctx context.Context, tx pgx.Tx, categoryID, userID uuid.UUID) error {
-	_, err := tx.Exec(ctx, DeleteCategoryQuery, categoryID, userID)
+// Retrieves the subtree below the category down to the depth, the whole tree when categoryID is nil.
+func (r *repository) GetSubtree(ctx context.Context, userID uuid.UUID, categoryID *uuid.UUID, depth int) ([]*Category, error) {
+	rows, err := r.postgres.Query(ctx, GetSubtreeQuery, userID, categoryID, depth)
 	if err != nil {
+		log.Error().Str("location", "GetSubtree").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	categories := []*Category{}
+	for rows.Next() {
+		category := &Category{}
+		if err := category.ScanNode(rows); err != nil {
+			log.Error().Str("location", "GetSubtree").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		categories = append(categories, category)
+	}
+
+	return categories, nil
+}
+
+// Retrieves the ids of the category and every category above it.
+func (r *repository) GetAncestors(ctx context.Context, tx pgx.Tx, userID, categoryID uuid.UUID) ([]uuid.UUID, error) {
+	return r.collectIDs(ctx, tx, "GetAncestors", GetAncestorsQuery, userID, categoryID, userID)
+}
+
+// Retrieves the ids of the category and every category below it.
+func (r *repository) GetDescendantIDs(ctx context.Context, tx pgx.Tx, userID, categoryID uuid.UUID) ([]uuid.UUID, error) {
+	return r.collectIDs(ctx, tx, "GetDescendantIDs", GetDescendantIDsQuery, userID, categoryID, userID)
+}
+
+// helper: collectIDs runs a query returning the user's category ids.
+func (r *repository) collectIDs(ctx context.Context, tx pgx.Tx, location, query string, userID uuid.UUID, args ...any) ([]uuid.UUID, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		log.Error().Str("location", location).Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			log.Error().Str("location", location).Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// Checks if another category under the parent already uses the name.
+func (r *repository) SiblingNameExists(ctx context.Context, tx pgx.Tx, category *Category) (bool, error) {
+	var exists bool
+	row := tx.QueryRow(ctx, SiblingNameExistsQuery, category.UserID, category.ParentID, category.Name, category.CategoryID)
+	if err := row.Scan(&exists); err != nil {
+		log.Error().Str("location", "SiblingNameExists").Msgf("%v: %v", category.UserID, err)
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Checks if moving the category's children under the parent would clash with the names there.
+func (r *repository) ReparentConflict(ctx context.Context, tx pgx.Tx, userID, categoryID uuid.UUID, parentID *uuid.UUID) (bool, error) {
+	var exists bool
+	if err := tx.QueryRow(ctx, ReparentConflictQuery, userID, categoryID, parentID).Scan(&exists); err != nil {
+		log.Error().Str("location", "ReparentConflict").Msgf("%v: %v", userID, err)
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Locks the user's category tree until the transaction ends.
+func (r *repository) LockTree(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	if _, err := tx.Exec(ctx, LockTreeQuery, userID); err != nil {
+		log.Error().Str("location", "LockTree").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) MoveCategory(ctx context.Context, tx pgx.Tx, userID, categoryID uuid.UUID, parentID *uuid.UUID) error {
+	if _, err := tx.Exec(ctx, MoveCategoryQuery, parentID, categoryID, userID); err != nil {
+		log.Error().Str("location", "MoveCategory").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Moves the children of the category under the parent.
+func (r *repository) ReparentChildren(ctx context.Context, tx pgx.Tx, userID, categoryID uuid.UUID, parentID *uuid.UUID) error {
+	if _, err := tx.Exec(ctx, ReparentChildrenQuery, parentID, categoryID, userID); err != nil {
+		log.Error().Str("location", "ReparentChildren").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Permanently deletes the categories along with their passwords, the passwords' history and attachments.
+func (r *repository) DeleteCategories(ctx context.Context, tx pgx.Tx, userID uuid.UUID, categoryIDs []uuid.UUID) error {
+	if _, err := tx.Exec(ctx, DeleteCategoriesHistoryQuery, categoryIDs, userID); err != nil {
+		log.Error().Str("location", "DeleteCategories").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, DeleteCategoriesAttachmentsQuery, categoryIDs, userID); err != nil {
+		log.Error().Str("location", "DeleteCategories").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, DeleteCategoriesTagsQuery, categoryIDs, userID); err != nil {
+		log.Error().Str("location", "DeleteCategories").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, DeleteCategoriesPasswordsQuery, categoryIDs, userID); err != nil {
+		log.Error().Str("location", "DeleteCategories").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, DeleteCategoriesQuery, categoryIDs, userID); err != nil {
+		log.Error().Str("location", "DeleteCategories").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Moves the categories and their passwords to the trash, marked with the same deletion time.
+func (r *repository) TrashCategories(ctx context.Context, tx pgx.Tx, userID uuid.UUID, categoryIDs []uuid.UUID, deletedAt time.Time) error {
+	if _, err := tx.Exec(ctx, TrashCategoriesPasswordsQuery, categoryIDs, userID, deletedAt); err != nil {
+		log.Error().Str("location", "TrashCategories").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, TrashCategoriesQuery, categoryIDs, userID, deletedAt); err != nil {
+		log.Error().Str("location", "TrashCategories").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves a page of the user's trashed categories, most recently deleted first.
+func (r *repository) GetTrash(ctx context.Context, userID uuid.UUID, params *pagination.Params) ([]*Category, error) {
+	query := GetTrashQuery
+	if params.Descending() {
+		query = GetTrashDescQuery
+	}
+
+	rows, err := r.postgres.Query(ctx, query, userID, params.BoundaryValue(), params.Boundary(), params.Fetch())
+	if err != nil {
+		log.Error().Str("location", "GetTrash").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	categories := []*Category{}
+	for rows.Next() {
+		category := &Category{}
+		if err := category.ScanTrashed(rows); err != nil {
+			log.Error().Str("location", "GetTrash").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		categories = append(categories, category)
+	}
+
+	return categories, nil
+}
+
+func (r *repository) GetTrashedCategory(ctx context.Context, tx pgx.Tx, userID, categoryID uuid.UUID) (*Category, error) {
+	category := &Category{}
+	if err := category.ScanTrashed(tx.QueryRow(ctx, GetTrashedCategoryQuery, categoryID, userID)); err != nil {
 		if err == pgx.ErrNoRows {
-			log.Info().Str("location", "DeleteCategory").Msgf("%v: failed to delete category not found", userID)
-			return apiutils.NewErrNotFound("category not found")
+			return nil, apiutils.NewErrNotFound("category not found in trash")
 		}
 
-		log.Error().Str("location", "DeleteCategory").Msgf("%v: %v", userID, err)
+		log.Error().Str("location", "GetTrashedCategory").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// Restores the categories and passwords that were trashed at the given time.
+func (r *repository) RestoreCategories(ctx context.Context, tx pgx.Tx, userID uuid.UUID, categoryIDs []uuid.UUID, deletedAt time.Time) error {
+	if _, err := tx.Exec(ctx, RestoreCategoriesQuery, categoryIDs, userID, deletedAt); err != nil {
+		log.Error().Str("location", "RestoreCategories").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, RestoreCategoriesPasswordsQuery, categoryIDs, userID, deletedAt); err != nil {
+		log.Error().Str("location", "RestoreCategories").Msgf("%v: %v", userID, err)
 		return err
 	}
 
 	return nil
 }
+
+// Retrieves the users owning categories trashed before the cutoff.
+func (r *repository) GetExpiredTrashUsers(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error) {
+	rows, err := r.postgres.Query(ctx, GetExpiredTrashUsersQuery, cutoff)
+	if err != nil {
+		log.Error().Str("location", "GetExpiredTrashUsers").Msg(err.Error())
+		return nil, err
+	}
+
+	users := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			log.Error().Str("location", "GetExpiredTrashUsers").Msg(err.Error())
+			return nil, err
+		}
+
+		users = append(users, id)
+	}
+
+	return users, nil
+}
+
+// Retrieves the ids of the user's categories trashed before the cutoff and everything below them.
+func (r *repository) GetExpiredCategoryIDs(ctx context.Context, tx pgx.Tx, userID uuid.UUID, cutoff time.Time) ([]uuid.UUID, error) {
+	return r.collectIDs(ctx, tx, "GetExpiredCategoryIDs", GetExpiredCategoryIDsQuery, userID, userID, cutoff)
+}
@@ -2,32 +2,85 @@ package categories
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
 
-	"nestpass/pkg/httputils"
+	"nestpass/pkg/pagination"
 )
 
 type service struct {
-	repo *repository
+	repo       *repository
+	writeHooks []WriteHook // run after writes that move passwords between categories, see OnWrite
 }
 
+// WriteHook runs after a write to the owner's category tree committed, with the categories whose
+// passwords or place in the tree changed and the parents they left or joined.
+type WriteHook func(ctx context.Context, ownerID uuid.UUID, categoryIDs []uuid.UUID)
+
 func NewService(repo *repository) *service {
 	return &service{repo: repo}
 }
 
-func (s *service) GetAllCategories(ctx context.Context, userID uuid.UUID, page *httputils.Pagination) ([]*Category, error) {
-	return s.repo.GetAllCategories(ctx, userID, page)
+// Registers a hook run after every write that trashes, restores, purges or moves categories
+// along with their passwords, hooks are registered at startup.
+func (s *service) OnWrite(hook WriteHook) {
+	s.writeHooks = append(s.writeHooks, hook)
+}
+
+// helper: afterWrite runs the write hooks once a write to the owner's tree committed.
+func (s *service) afterWrite(ctx context.Context, ownerID uuid.UUID, categoryIDs []uuid.UUID, parents ...*uuid.UUID) {
+	for _, parentID := range parents {
+		if parentID != nil {
+			categoryIDs = append(categoryIDs, *parentID)
+		}
+	}
+
+	for _, hook := range s.writeHooks {
+		hook(ctx, ownerID, categoryIDs)
+	}
+}
+
+func (s *service) GetAllCategories(ctx context.Context, userID uuid.UUID, params *pagination.Params) (*pagination.Page[*Category], error) {
+	categories, err := s.repo.GetAllCategories(ctx, userID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, categories, func(c *Category) (string, uuid.UUID) {
+		return "", c.CategoryID
+	})
 }
 
-func (s *service) GetCategory(ctx context.Context, userID uuid.UUID, key string) (*Category, error) {
-	isUUID := true 
+// Retrieves a category by id, or by name among the children of the parent (root when nil).
+func (s *service) GetCategory(ctx context.Context, userID uuid.UUID, key string, parentID *uuid.UUID) (*Category, error) {
+	isUUID := true
 	if _, err := uuid.Parse(key); err != nil {
 		isUUID = false
 	}
-		
-	return s.repo.GetCategory(ctx, userID, key, isUUID)
+
+	return s.repo.GetCategory(ctx, userID, key, isUUID, parentID)
+}
+
+// Retrieves the subtree below the category nested down to the depth, the whole tree when categoryID is nil.
+func (s *service) GetSubtree(ctx context.Context, userID uuid.UUID, categoryID *uuid.UUID, depth int) ([]*Category, error) {
+	if depth <= 0 || depth > MaxDepth {
+		depth = MaxDepth
+	}
+
+	nodes, err := s.repo.GetSubtree(ctx, userID, categoryID, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	if categoryID != nil && len(nodes) == 0 {
+		return nil, apiutils.NewErrNotFound("category not found")
+	}
+
+	return BuildTree(nodes), nil
 }
 
 func (s *service) CreateCategory(ctx context.Context, category *Category) (uuid.UUID, error) {
@@ -37,7 +90,15 @@ func (s *service) CreateCategory(ctx context.Context, category *Category) (uuid.
 	}
 	defer tx.Rollback(ctx)
 
-	categoryResp := New(category.Name, category.Description, category.UserID)
+	if err := s.repo.LockTree(ctx, tx, category.UserID); err != nil {
+		return uuid.Nil, err
+	}
+
+	categoryResp := New(category.Name, category.Description, category.UserID, category.ParentID)
+	if err := s.checkPlacement(ctx, tx, categoryResp); err != nil {
+		return uuid.Nil, err
+	}
+
 	if err := s.repo.CreateCategory(ctx, tx, categoryResp); err != nil {
 		return uuid.Nil, err
 	}
@@ -57,6 +118,21 @@ func (s *service) UpdateCategory(ctx context.Context, category *Category) (*Cate
 	}
 	defer tx.Rollback(ctx)
 
+	if err := s.repo.LockTree(ctx, tx, category.UserID); err != nil {
+		return nil, err
+	}
+
+	// renames are checked against the siblings at the category's current place
+	current, err := s.repo.GetCategory(ctx, category.UserID, category.CategoryID.String(), true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	category.ParentID = current.ParentID
+	if err := s.checkPlacement(ctx, tx, category); err != nil {
+		return nil, err
+	}
+
 	if err := s.repo.UpdateCategory(ctx, tx, category); err != nil {
 		return nil, err
 	}
@@ -69,14 +145,107 @@ func (s *service) UpdateCategory(ctx context.Context, category *Category) (*Cate
 	return category, nil
 }
 
-func (s *service) DeleteCategory(ctx context.Context, categoryID, userID uuid.UUID) error {
+// Moves the category with its subtree under the parent, a nil parent moves it to the root.
+func (s *service) MoveCategory(ctx context.Context, userID uuid.UUID, move *Move) (*Category, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.repo.LockTree(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	category, err := s.repo.GetCategory(ctx, userID, move.CategoryID.String(), true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if move.ParentID != nil {
+		ancestors, err := s.repo.GetAncestors(ctx, tx, userID, *move.ParentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ancestors) == 0 {
+			return nil, apiutils.NewErrNotFound("parent category not found")
+		}
+
+		if createsCycle(category.CategoryID, ancestors) {
+			return nil, apiutils.NewErrBadRequest("a category can not be moved into its own subtree")
+		}
+	}
+
+	prevParentID := category.ParentID
+	category.ParentID = move.ParentID
+	exists, err := s.repo.SiblingNameExists(ctx, tx, category)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, apiutils.NewErrConflict("category already exists")
+	}
+
+	if err := s.repo.MoveCategory(ctx, tx, userID, category.CategoryID, category.ParentID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "MoveCategory").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	s.afterWrite(ctx, userID, []uuid.UUID{category.CategoryID}, prevParentID, category.ParentID)
+	return category, nil
+}
+
+// Moves the category with its passwords to the trash. In recursive mode the whole subtree goes
+// with it, otherwise its children move up to its parent.
+func (s *service) DeleteCategory(ctx context.Context, categoryID, userID uuid.UUID, mode string) error {
 	tx, err := s.repo.postgres.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
-	if err := s.repo.DeleteCategory(ctx, tx, categoryID, userID); err != nil {
+	if err := s.repo.LockTree(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	category, err := s.repo.GetCategory(ctx, userID, categoryID.String(), true, nil)
+	if err != nil {
+		return err
+	}
+
+	deleted := []uuid.UUID{categoryID}
+	switch mode {
+	case DeleteRecursive:
+		if deleted, err = s.repo.GetDescendantIDs(ctx, tx, userID, categoryID); err != nil {
+			return err
+		}
+	case DeleteReparent:
+		conflict, err := s.repo.ReparentConflict(ctx, tx, userID, categoryID, category.ParentID)
+		if err != nil {
+			return err
+		}
+
+		if conflict {
+			return apiutils.NewErrConflict("a child category name is already taken at the parent level")
+		}
+
+		if err := s.repo.ReparentChildren(ctx, tx, userID, categoryID, category.ParentID); err != nil {
+			return err
+		}
+	default:
+		return apiutils.NewErrBadRequest("invalid delete mode")
+	}
+
+	// everything trashed by this delete shares the deletion time so it is restored together,
+	// truncated to the precision postgres stores
+	deletedAt := time.Now().Truncate(time.Microsecond)
+	if err := s.repo.TrashCategories(ctx, tx, userID, deleted, deletedAt); err != nil {
 		return err
 	}
 
@@ -85,5 +254,30 @@ func (s *service) DeleteCategory(ctx context.Context, categoryID, userID uuid.UU
 		return err
 	}
 
+	s.afterWrite(ctx, userID, deleted, category.ParentID)
+	return nil
+}
+
+// helper: checkPlacement checks the parent exists and no sibling uses the category's name.
+func (s *service) checkPlacement(ctx context.Context, tx pgx.Tx, category *Category) error {
+	if category.ParentID != nil {
+		if _, err := s.repo.GetCategory(ctx, category.UserID, category.ParentID.String(), true, nil); err != nil {
+			if _, ok := err.(apiutils.ErrNotFound); ok {
+				return apiutils.NewErrNotFound("parent category not found")
+			}
+
+			return err
+		}
+	}
+
+	exists, err := s.repo.SiblingNameExists(ctx, tx, category)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return apiutils.NewErrConflict("category already exists")
+	}
+
 	return nil
 }
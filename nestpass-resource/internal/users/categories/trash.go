@@ -0,0 +1,176 @@
+package categories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/pkg/pagination"
+)
+
+func (s *service) GetTrash(ctx context.Context, userID uuid.UUID, params *pagination.Params) (*pagination.Page[*Category], error) {
+	trash, err := s.repo.GetTrash(ctx, userID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, trash, func(c *Category) (string, uuid.UUID) {
+		return c.DeletedAt.Format(time.RFC3339Nano), c.CategoryID
+	})
+}
+
+// Restores the category along with the subcategories and passwords trashed with it. A category
+// whose parent is no longer available is restored at the root.
+func (s *service) RestoreCategory(ctx context.Context, userID, categoryID uuid.UUID) (*Category, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.repo.LockTree(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	category, err := s.repo.GetTrashedCategory(ctx, tx, userID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if category.ParentID != nil {
+		ancestors, err := s.repo.GetAncestors(ctx, tx, userID, *category.ParentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ancestors) == 0 {
+			category.ParentID = nil
+			if err := s.repo.MoveCategory(ctx, tx, userID, categoryID, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	exists, err := s.repo.SiblingNameExists(ctx, tx, category)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, apiutils.NewErrConflict("a category with the same name already exists")
+	}
+
+	subtree, err := s.repo.GetDescendantIDs(ctx, tx, userID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.RestoreCategories(ctx, tx, userID, subtree, *category.DeletedAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "RestoreCategory").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	s.afterWrite(ctx, userID, subtree, category.ParentID)
+	category.DeletedAt = nil
+	return category, nil
+}
+
+// Permanently deletes the trashed category with everything below it and their passwords.
+func (s *service) PurgeCategory(ctx context.Context, userID, categoryID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.repo.LockTree(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	if _, err := s.repo.GetTrashedCategory(ctx, tx, userID, categoryID); err != nil {
+		return err
+	}
+
+	// categories below a trashed one are always in the trash as well
+	subtree, err := s.repo.GetDescendantIDs(ctx, tx, userID, categoryID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteCategories(ctx, tx, userID, subtree); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "PurgeCategory").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	s.afterWrite(ctx, userID, subtree)
+	return nil
+}
+
+// Permanently deletes every category trashed before the cutoff, one user at a time. A user whose
+// trash fails to purge is logged and left for the next run.
+func (s *service) PurgeExpired(ctx context.Context, cutoff time.Time) error {
+	users, err := s.repo.GetExpiredTrashUsers(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, userID := range users {
+		if err := s.purgeExpired(ctx, userID, cutoff); err != nil {
+			log.Error().Str("location", "PurgeExpired").Msgf("%v: failed to purge trashed categories: %v", userID, err)
+			failed++
+		}
+	}
+
+	if purged := len(users) - failed; purged != 0 {
+		log.Info().Str("location", "PurgeExpired").Msgf("trashed categories of %v users purged", purged)
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("trashed categories of %d users not purged", failed)
+	}
+
+	return nil
+}
+
+// helper: purgeExpired deletes the user's categories trashed before the cutoff.
+func (s *service) purgeExpired(ctx context.Context, userID uuid.UUID, cutoff time.Time) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.repo.LockTree(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	expired, err := s.repo.GetExpiredCategoryIDs(ctx, tx, userID, cutoff)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteCategories(ctx, tx, userID, expired); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "PurgeExpired").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	s.afterWrite(ctx, userID, expired)
+	return nil
+}
@@ -0,0 +1,207 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/databases/pgtest"
+)
+
+func newTestService(results map[string][][]any) (*service, *pgtest.DB) {
+	db := &pgtest.DB{Results: results}
+	return NewService(&repository{postgres: db}), db
+}
+
+func Test_DeleteCategoryTrashesSubtreeAtomically(t *testing.T) {
+	ctx, userID, categoryID, childID := context.Background(), uuid.New(), uuid.New(), uuid.New()
+	results := map[string][][]any{
+		GetUUIDCategoryQuery:  {{categoryID, userID, nil, "Work", ""}},
+		GetDescendantIDsQuery: {{categoryID}, {childID}},
+	}
+
+	svc, db := newTestService(results)
+	written, touched := []uuid.UUID{}, []uuid.UUID{}
+	svc.OnWrite(func(ctx context.Context, ownerID uuid.UUID, categoryIDs []uuid.UUID) {
+		written, touched = append(written, ownerID), categoryIDs
+	})
+	if err := svc.DeleteCategory(ctx, categoryID, userID, DeleteRecursive); err != nil {
+		t.Fatalf("DeleteCategory() error: %v", err)
+	}
+
+	if len(written) != 1 || written[0] != userID {
+		t.Fatalf("write hooks ran for %v, want the owner once", written)
+	}
+
+	// only shares of the trashed subtree are rebuilt, a root category has no parent to report
+	if !reflect.DeepEqual(touched, []uuid.UUID{categoryID, childID}) {
+		t.Fatalf("write hooks reported %v, want the trashed subtree", touched)
+	}
+
+	// the subtree and its passwords are trashed in one transaction under the same deletion time
+	passwords, categories := db.Executed(TrashCategoriesPasswordsQuery), db.Executed(TrashCategoriesQuery)
+	if len(passwords) != 1 || len(categories) != 1 || db.Commits != 1 {
+		t.Fatalf("trashed %d password and %d category batches in %d commits", len(passwords), len(categories), db.Commits)
+	}
+
+	subtree := []uuid.UUID{categoryID, childID}
+	if !reflect.DeepEqual(passwords[0].Args[0], subtree) || !reflect.DeepEqual(categories[0].Args[0], subtree) {
+		t.Fatalf("trashed %v and %v, want the subtree %v", passwords[0].Args[0], categories[0].Args[0], subtree)
+	}
+
+	if passwords[0].Args[2] != categories[0].Args[2] {
+		t.Fatal("passwords and categories trashed at different times")
+	}
+
+	// a failing category update leaves the passwords where they were
+	svc, db = newTestService(results)
+	svc.OnWrite(func(ctx context.Context, ownerID uuid.UUID, categoryIDs []uuid.UUID) {
+		written = append(written, ownerID)
+	})
+	db.Fail = func(sql string, args []any) error {
+		if sql == TrashCategoriesQuery {
+			return errors.New("connection reset")
+		}
+
+		return nil
+	}
+
+	if err := svc.DeleteCategory(ctx, categoryID, userID, DeleteRecursive); err == nil {
+		t.Fatal("DeleteCategory() ignored the failed update")
+	}
+
+	if db.Commits != 0 {
+		t.Fatal("DeleteCategory() committed a partial move to the trash")
+	}
+
+	if len(written) != 1 {
+		t.Fatal("write hooks ran for a delete that rolled back")
+	}
+}
+
+func Test_DeleteCategoryReparent(t *testing.T) {
+	ctx, userID, categoryID, parentID := context.Background(), uuid.New(), uuid.New(), uuid.New()
+	results := map[string][][]any{
+		GetUUIDCategoryQuery:  {{categoryID, userID, &parentID, "Work", ""}},
+		ReparentConflictQuery: {{false}},
+	}
+
+	svc, db := newTestService(results)
+	if err := svc.DeleteCategory(ctx, categoryID, userID, DeleteReparent); err != nil {
+		t.Fatalf("DeleteCategory() error: %v", err)
+	}
+
+	// only the category itself is trashed, its children move up to its parent
+	reparented, trashed := db.Executed(ReparentChildrenQuery), db.Executed(TrashCategoriesQuery)
+	if len(reparented) != 1 || reparented[0].Args[0] != &parentID || db.Commits != 1 {
+		t.Fatalf("children reparented by %+v", reparented)
+	}
+
+	if len(trashed) != 1 || !reflect.DeepEqual(trashed[0].Args[0], []uuid.UUID{categoryID}) {
+		t.Fatalf("trashed %+v, want only the category", trashed)
+	}
+
+	results[ReparentConflictQuery] = [][]any{{true}}
+	svc, db = newTestService(results)
+	if err := svc.DeleteCategory(ctx, categoryID, userID, DeleteReparent); !isConflict(err) {
+		t.Fatalf("DeleteCategory() error = %v, want a conflict", err)
+	}
+
+	if len(db.Executed(TrashCategoriesQuery)) != 0 || db.Commits != 0 {
+		t.Fatal("DeleteCategory() trashed a category whose children clash at the parent level")
+	}
+}
+
+func Test_RestoreCategory(t *testing.T) {
+	ctx, userID, categoryID, childID, parentID := context.Background(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	deletedAt := time.Now().Truncate(time.Microsecond)
+	results := map[string][][]any{
+		GetTrashedCategoryQuery: {{categoryID, userID, &parentID, "Work", "", &deletedAt}},
+		SiblingNameExistsQuery:  {{false}},
+		GetDescendantIDsQuery:   {{categoryID}, {childID}},
+	}
+
+	// the parent was purged meanwhile, the category comes back at the root
+	svc, db := newTestService(results)
+	category, err := svc.RestoreCategory(ctx, userID, categoryID)
+	if err != nil {
+		t.Fatalf("RestoreCategory() error: %v", err)
+	}
+
+	if category.ParentID != nil || category.DeletedAt != nil {
+		t.Fatalf("restored category %+v, want it at the root and out of the trash", category)
+	}
+
+	if moved := db.Executed(MoveCategoryQuery); len(moved) != 1 || moved[0].Args[0] != (*uuid.UUID)(nil) {
+		t.Fatalf("category moved by %+v, want a move to the root", moved)
+	}
+
+	// only what was trashed by the same delete is restored
+	for _, sql := range []string{RestoreCategoriesQuery, RestoreCategoriesPasswordsQuery} {
+		restored := db.Executed(sql)
+		if len(restored) != 1 || !reflect.DeepEqual(restored[0].Args[0], []uuid.UUID{categoryID, childID}) || restored[0].Args[2] != deletedAt {
+			t.Fatalf("restored %+v", restored)
+		}
+	}
+
+	if db.Commits != 1 {
+		t.Fatalf("RestoreCategory() committed %d times", db.Commits)
+	}
+
+	// a sibling took the name while the category was in the trash
+	results[GetAncestorsQuery] = [][]any{{parentID}}
+	results[SiblingNameExistsQuery] = [][]any{{true}}
+	svc, db = newTestService(results)
+	if _, err := svc.RestoreCategory(ctx, userID, categoryID); !isConflict(err) {
+		t.Fatalf("RestoreCategory() error = %v, want a conflict", err)
+	}
+
+	if db.Commits != 0 {
+		t.Fatal("RestoreCategory() restored a category clashing with a sibling")
+	}
+}
+
+func Test_PurgeExpiredContinuesPastFailures(t *testing.T) {
+	ctx, failing, other := context.Background(), uuid.New(), uuid.New()
+	svc, db := newTestService(map[string][][]any{
+		GetExpiredTrashUsersQuery:  {{failing}, {other}},
+		GetExpiredCategoryIDsQuery: {{uuid.New()}},
+	})
+
+	db.Fail = func(sql string, args []any) error {
+		if sql == DeleteCategoriesQuery && args[1] == failing {
+			return errors.New("connection reset")
+		}
+
+		return nil
+	}
+
+	written := []uuid.UUID{}
+	svc.OnWrite(func(ctx context.Context, ownerID uuid.UUID, categoryIDs []uuid.UUID) {
+		written = append(written, ownerID)
+	})
+	if err := svc.PurgeExpired(ctx, time.Now()); err == nil {
+		t.Fatal("PurgeExpired() hid the failed user")
+	}
+
+	// the user after the failing one is still purged
+	purged := db.Executed(DeleteCategoriesQuery)
+	if len(purged) != 1 || purged[0].Args[1] != other || db.Commits != 1 {
+		t.Fatalf("purged %+v in %d commits, want the other user", purged, db.Commits)
+	}
+
+	// share copies are rebuilt only for the user whose purge committed
+	if len(written) != 1 || written[0] != other {
+		t.Fatalf("write hooks ran for %v, want the other user", written)
+	}
+}
+
+func isConflict(err error) bool {
+	_, ok := err.(apiutils.ErrConflict)
+	return ok
+}
@@ -0,0 +1,237 @@
+package emergency
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/dependencies"
+	"nestpass/internal/users/categories"
+	"nestpass/internal/users/passwords"
+	"nestpass/pkg/auth"
+	"nestpass/pkg/pagination"
+)
+
+type Handler struct {
+	svc   *service
+	pager *pagination.Pager
+}
+
+func NewHandler(deps *dependencies.Dependencies, vault vault) *Handler {
+	repo := NewRepository(deps.Databases.Postgres)
+	svc := NewService(repo, vault, categories.NewRepository(deps.Databases.Postgres), deps.Email.Client)
+	return &Handler{svc: svc, pager: deps.Pager}
+}
+
+func (h *Handler) GetContacts(w http.ResponseWriter, r *http.Request) {
+	params, err := h.pager.Parse(r)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	contacts, err := h.svc.GetContacts(r.Context(), userID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", contacts)
+	resp.SendRes(w)
+}
+
+func (h *Handler) AddContact(w http.ResponseWriter, r *http.Request) {
+	req := &ContactRequest{}
+	if err := req.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	contact, err := h.svc.AddContact(r.Context(), userID, req)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusCreated, "", contact)
+	resp.SendRes(w)
+}
+
+func (h *Handler) RemoveContact(w http.ResponseWriter, r *http.Request) {
+	contactID, err := queryUUID(r, "contact_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.RemoveContact(r.Context(), userID, contactID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) ApproveAccess(w http.ResponseWriter, r *http.Request) {
+	contactID, err := queryUUID(r, "contact_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	contact, err := h.svc.ApproveAccess(r.Context(), userID, contactID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", contact)
+	resp.SendRes(w)
+}
+
+func (h *Handler) VetoAccess(w http.ResponseWriter, r *http.Request) {
+	contactID, err := queryUUID(r, "contact_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	contact, err := h.svc.VetoAccess(r.Context(), userID, contactID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", contact)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetGrantors(w http.ResponseWriter, r *http.Request) {
+	params, err := h.pager.Parse(r)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	grantors, err := h.svc.GetGrantors(r.Context(), userID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", grantors)
+	resp.SendRes(w)
+}
+
+func (h *Handler) RequestAccess(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := queryUUID(r, "owner_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	contact, err := h.svc.RequestAccess(r.Context(), userID, ownerID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", contact)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetVault(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := queryUUID(r, "owner_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	params, err := h.pager.Parse(r, passwords.SortWebsite, passwords.SortCreated, passwords.SortUpdated, passwords.SortLastUsed)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	entries, err := h.svc.GetVault(r.Context(), userID, ownerID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", entries)
+	resp.AddHeader(w, map[string]string{"Cache-Control": "no-store"})
+	resp.SendRes(w)
+}
+
+// Grants and expires emergency access whose timers ran out.
+func (h *Handler) ProcessTimers(ctx context.Context, now time.Time) (int, error) {
+	return h.svc.ProcessTimers(ctx, now)
+}
+
+// helper: queryUUID parses a required id query parameter.
+func queryUUID(r *http.Request, name string) (uuid.UUID, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return uuid.Nil, apiutils.NewErrBadRequest("missing " + name)
+	}
+
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, apiutils.NewErrBadRequest("invalid " + name)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,72 @@
+package emergency
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Emergency access states, a request is granted once the wait passes without a veto and the
+// access expires after its window.
+const (
+	StatusIdle      = "idle"
+	StatusRequested = "requested"
+	StatusGranted   = "granted"
+	StatusVetoed    = "vetoed"
+	StatusExpired   = "expired"
+)
+
+const defaultAccessDays = 30
+
+// Trusted contact who can request emergency access to the owner's vault.
+type Contact struct {
+	OwnerID     uuid.UUID   `json:"owner_id"`
+	ContactID   uuid.UUID   `json:"contact_id"`
+	Email       string      `json:"email"` // of the contact
+	OwnerEmail  string      `json:"owner_email"`
+	CategoryIDs []uuid.UUID `json:"category_ids"` // categories the contact can read, empty for the whole vault
+	WaitDays    int         `json:"wait_days"`
+	AccessDays  int         `json:"access_days"`
+	Status      string      `json:"status"`
+	RequestedAt *time.Time  `json:"requested_at,omitempty"`
+	GrantedAt   *time.Time  `json:"granted_at,omitempty"`
+	SealedRing  []byte      `json:"-"` // owner's data keys sealed to the contact while access is granted
+	RingVersion int         `json:"-"`
+	Created     time.Time   `json:"created"`
+}
+
+func (c *Contact) Scan(row pgx.Row) error {
+	return row.Scan(&c.OwnerID, &c.ContactID, &c.Email, &c.OwnerEmail, &c.CategoryIDs, &c.WaitDays, &c.AccessDays,
+		&c.Status, &c.RequestedAt, &c.GrantedAt, &c.SealedRing, &c.RingVersion, &c.Created)
+}
+
+// Request data for naming a trusted contact, naming the contact again updates the settings.
+type ContactRequest struct {
+	Email       string      `json:"email" validate:"required,email"`
+	CategoryIDs []uuid.UUID `json:"category_ids" validate:"max=64"`
+	WaitDays    int         `json:"wait_days" validate:"required,min=1,max=90"`
+	AccessDays  int         `json:"access_days" validate:"omitempty,min=1,max=365"`
+}
+
+func (c *ContactRequest) Deserialize(data io.ReadCloser) error {
+	if err := json.NewDecoder(data).Decode(c); err != nil {
+		log.Error().Str("location", "ContactRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	if err := validator.New().Struct(c); err != nil {
+		log.Error().Str("location", "ContactRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	if c.AccessDays == 0 {
+		c.AccessDays = defaultAccessDays
+	}
+
+	return nil
+}
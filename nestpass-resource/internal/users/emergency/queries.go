@@ -0,0 +1,73 @@
+package emergency
+
+const (
+	GetUserIDByEmailQuery = `
+	SELECT user_id FROM users WHERE email = $1`
+
+	contactColumns = `
+	e.owner_id, e.contact_id, c.email, o.email, e.category_ids, e.wait_days, e.access_days,
+	e.status, e.requested_at, e.granted_at, e.sealed_ring, e.ring_version, e.created`
+
+	UpsertContactQuery = `
+	INSERT INTO emergency_contacts (owner_id, contact_id, category_ids, wait_days, access_days, status, ring_version, created)
+	VALUES ($1, $2, $3, $4, $5, 'idle', 0, $6)
+	ON CONFLICT (owner_id, contact_id) DO UPDATE
+	SET category_ids = EXCLUDED.category_ids, wait_days = EXCLUDED.wait_days, access_days = EXCLUDED.access_days`
+
+	// contacts are paged by when they were named, ties broken by the id of the other user
+	GetContactsQuery = `
+	SELECT` + contactColumns + ` FROM emergency_contacts e
+	JOIN users c ON c.user_id = e.contact_id
+	JOIN users o ON o.user_id = e.owner_id
+	WHERE e.owner_id = $1 AND ($2::timestamptz IS NULL OR (e.created, e.contact_id) > ($2, $3::uuid))
+	ORDER BY e.created ASC, e.contact_id ASC
+	LIMIT $4`
+
+	GetContactsDescQuery = `
+	SELECT` + contactColumns + ` FROM emergency_contacts e
+	JOIN users c ON c.user_id = e.contact_id
+	JOIN users o ON o.user_id = e.owner_id
+	WHERE e.owner_id = $1 AND ($2::timestamptz IS NULL OR (e.created, e.contact_id) < ($2, $3::uuid))
+	ORDER BY e.created DESC, e.contact_id DESC
+	LIMIT $4`
+
+	GetGrantorsQuery = `
+	SELECT` + contactColumns + ` FROM emergency_contacts e
+	JOIN users c ON c.user_id = e.contact_id
+	JOIN users o ON o.user_id = e.owner_id
+	WHERE e.contact_id = $1 AND ($2::timestamptz IS NULL OR (e.created, e.owner_id) > ($2, $3::uuid))
+	ORDER BY e.created ASC, e.owner_id ASC
+	LIMIT $4`
+
+	GetGrantorsDescQuery = `
+	SELECT` + contactColumns + ` FROM emergency_contacts e
+	JOIN users c ON c.user_id = e.contact_id
+	JOIN users o ON o.user_id = e.owner_id
+	WHERE e.contact_id = $1 AND ($2::timestamptz IS NULL OR (e.created, e.owner_id) < ($2, $3::uuid))
+	ORDER BY e.created DESC, e.owner_id DESC
+	LIMIT $4`
+
+	GetContactQuery = `
+	SELECT` + contactColumns + ` FROM emergency_contacts e
+	JOIN users c ON c.user_id = e.contact_id
+	JOIN users o ON o.user_id = e.owner_id
+	WHERE e.owner_id = $1 AND e.contact_id = $2`
+
+	LockContactQuery = GetContactQuery + `
+	FOR UPDATE OF e`
+
+	UpdateContactQuery = `
+	UPDATE emergency_contacts
+	SET status = $3, requested_at = $4, granted_at = $5, sealed_ring = $6, ring_version = $7
+	WHERE owner_id = $1 AND contact_id = $2`
+
+	DeleteContactQuery = `
+	DELETE FROM emergency_contacts
+	WHERE owner_id = $1 AND contact_id = $2`
+
+	// requests whose wait has passed and grants whose window has closed
+	GetDueContactsQuery = `
+	SELECT owner_id, contact_id FROM emergency_contacts
+	WHERE (status = 'requested' AND requested_at + wait_days * interval '1 day' <= $1)
+		OR (status = 'granted' AND granted_at + access_days * interval '1 day' <= $1)`
+)
@@ -0,0 +1,164 @@
+package emergency
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/pkg/pagination"
+)
+
+type repository struct {
+	postgres *pgxpool.Pool
+}
+
+func NewRepository(pg *pgxpool.Pool) *repository {
+	return &repository{postgres: pg}
+}
+
+func (r *repository) GetUserIDByEmail(ctx context.Context, email string) (uuid.UUID, error) {
+	userID := uuid.Nil
+	if err := r.postgres.QueryRow(ctx, GetUserIDByEmailQuery, email).Scan(&userID); err != nil {
+		if err == pgx.ErrNoRows {
+			return uuid.Nil, apiutils.NewErrNotFound("user not found")
+		}
+
+		log.Error().Str("location", "GetUserIDByEmail").Msg(err.Error())
+		return uuid.Nil, err
+	}
+
+	return userID, nil
+}
+
+func (r *repository) UpsertContact(ctx context.Context, tx pgx.Tx, contact *Contact) error {
+	_, err := tx.Exec(ctx, UpsertContactQuery,
+		contact.OwnerID,
+		contact.ContactID,
+		contact.CategoryIDs,
+		contact.WaitDays,
+		contact.AccessDays,
+		contact.Created,
+	)
+	if err != nil {
+		log.Error().Str("location", "UpsertContact").Msgf("%v: %v", contact.OwnerID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Lists a page of the trusted contacts the user named, or of the owners who named the user when
+// asContact is set.
+func (r *repository) GetContacts(ctx context.Context, userID uuid.UUID, asContact bool, params *pagination.Params) ([]*Contact, error) {
+	query := GetContactsQuery
+	switch {
+	case asContact && params.Descending():
+		query = GetGrantorsDescQuery
+	case asContact:
+		query = GetGrantorsQuery
+	case params.Descending():
+		query = GetContactsDescQuery
+	}
+
+	rows, err := r.postgres.Query(ctx, query, userID, params.BoundaryValue(), params.Boundary(), params.Fetch())
+	if err != nil {
+		log.Error().Str("location", "GetContacts").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := []*Contact{}
+	for rows.Next() {
+		contact := &Contact{}
+		if err := contact.Scan(rows); err != nil {
+			log.Error().Str("location", "GetContacts").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		contacts = append(contacts, contact)
+	}
+
+	return contacts, rows.Err()
+}
+
+// Retrieves the contact, locked for the rest of the transaction when a transaction is given.
+func (r *repository) GetContact(ctx context.Context, tx pgx.Tx, ownerID, contactID uuid.UUID) (*Contact, error) {
+	var row pgx.Row
+	if tx != nil {
+		row = tx.QueryRow(ctx, LockContactQuery, ownerID, contactID)
+	} else {
+		row = r.postgres.QueryRow(ctx, GetContactQuery, ownerID, contactID)
+	}
+
+	contact := &Contact{}
+	if err := contact.Scan(row); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("emergency contact not found")
+		}
+
+		log.Error().Str("location", "GetContact").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+
+	return contact, nil
+}
+
+func (r *repository) UpdateContact(ctx context.Context, tx pgx.Tx, contact *Contact) error {
+	_, err := tx.Exec(ctx, UpdateContactQuery,
+		contact.OwnerID,
+		contact.ContactID,
+		contact.Status,
+		contact.RequestedAt,
+		contact.GrantedAt,
+		contact.SealedRing,
+		contact.RingVersion,
+	)
+	if err != nil {
+		log.Error().Str("location", "UpdateContact").Msgf("%v: %v", contact.OwnerID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteContact(ctx context.Context, tx pgx.Tx, ownerID, contactID uuid.UUID) error {
+	tag, err := tx.Exec(ctx, DeleteContactQuery, ownerID, contactID)
+	if err != nil {
+		log.Error().Str("location", "DeleteContact").Msgf("%v: %v", ownerID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrNotFound("emergency contact not found")
+	}
+
+	return nil
+}
+
+// Lists the owner and contact ids of requests and grants with a timer that ran out by now.
+func (r *repository) GetDueContacts(ctx context.Context, now time.Time) ([][2]uuid.UUID, error) {
+	rows, err := r.postgres.Query(ctx, GetDueContactsQuery, now)
+	if err != nil {
+		log.Error().Str("location", "GetDueContacts").Msg(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := [][2]uuid.UUID{}
+	for rows.Next() {
+		ids := [2]uuid.UUID{}
+		if err := rows.Scan(&ids[0], &ids[1]); err != nil {
+			log.Error().Str("location", "GetDueContacts").Msg(err.Error())
+			return nil, err
+		}
+
+		due = append(due, ids)
+	}
+
+	return due, rows.Err()
+}
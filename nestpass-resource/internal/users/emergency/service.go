@@ -0,0 +1,486 @@
+package emergency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/email"
+	"nestpass/internal/proto/pb/notificationpb"
+	"nestpass/internal/users/categories"
+	"nestpass/internal/users/passwords"
+	"nestpass/pkg/pagination"
+)
+
+// Emergency access lets a trusted contact read the owner's vault, or some of its categories,
+// when the owner can not. The contact requests access, which the owner can approve or veto
+// until the wait passes and the access is granted on its own. While access is granted the
+// owner's data keys are sealed to the contact's public key, they are dropped again on a veto
+// or once the access window closes.
+
+// Events moving a contact between the emergency access states.
+const (
+	eventRequest = "request" // the contact asks for access
+	eventApprove = "approve" // the owner grants access before the wait passes
+	eventVeto    = "veto"    // the owner denies or ends access
+	eventElapse  = "elapse"  // the wait passed without a veto
+	eventExpire  = "expire"  // the access window closed
+)
+
+var transitions = map[string]map[string]string{
+	eventRequest: {StatusIdle: StatusRequested, StatusVetoed: StatusRequested, StatusExpired: StatusRequested},
+	eventApprove: {StatusRequested: StatusGranted},
+	eventVeto:    {StatusRequested: StatusVetoed, StatusGranted: StatusVetoed},
+	eventElapse:  {StatusRequested: StatusGranted},
+	eventExpire:  {StatusGranted: StatusExpired},
+}
+
+// vault seals the owner's data keys to contacts and opens them again, implemented by the passwords package.
+type vault interface {
+	EnsureKeyPair(ctx context.Context, userID uuid.UUID) error
+	LockVault(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID) (*passwords.Vault, error)
+	SealVaultKeys(ctx context.Context, ownerID, userID uuid.UUID, aad []byte) ([]byte, int, error)
+	OpenSealedVault(ctx context.Context, ownerID, userID uuid.UUID, sealed, aad []byte, filter *passwords.ListFilter, params *pagination.Params) (*pagination.Page[*passwords.Password], error)
+}
+
+// Category tree the categories a contact can read are resolved in.
+type categoryStore interface {
+	GetSubtree(ctx context.Context, userID uuid.UUID, categoryID *uuid.UUID, depth int) ([]*categories.Category, error)
+}
+
+type service struct {
+	repo          *repository
+	vault         vault
+	categories    categoryStore
+	notifications notificationpb.NotificationServiceClient // email service, nil when nothing is sent
+}
+
+func NewService(repo *repository, vault vault, categories categoryStore, notifications notificationpb.NotificationServiceClient) *service {
+	return &service{repo: repo, vault: vault, categories: categories, notifications: notifications}
+}
+
+// helper: nextStatus returns the state the event moves the contact to.
+func nextStatus(status, event string) (string, error) {
+	next, ok := transitions[event][status]
+	if !ok {
+		return "", apiutils.NewErrConflict("can not " + event + " emergency access that is " + status)
+	}
+
+	return next, nil
+}
+
+// helper: dueEvent returns the timer event that is due for the contact, empty when none is.
+func dueEvent(contact *Contact, now time.Time) string {
+	switch {
+	case contact.Status == StatusRequested && contact.RequestedAt != nil &&
+		!contact.RequestedAt.AddDate(0, 0, contact.WaitDays).After(now):
+		return eventElapse
+	case contact.Status == StatusGranted && contact.GrantedAt != nil &&
+		!contact.GrantedAt.AddDate(0, 0, contact.AccessDays).After(now):
+		return eventExpire
+	}
+
+	return ""
+}
+
+// helper: contactAAD binds a sealed key ring to the owner and the contact it is sealed to.
+func contactAAD(ownerID, contactID uuid.UUID) []byte {
+	return append(ownerID[:], contactID[:]...)
+}
+
+// helper: notify sends a notification email, nothing is sent when no email service is configured.
+func (s *service) notify(ctx context.Context, userID uuid.UUID, to, kind, contactEmail string, days int) error {
+	if s.notifications == nil {
+		return nil
+	}
+
+	_, err := s.notifications.SendNotification(ctx, &notificationpb.NotificationPayload{
+		UserId:       userID.String(),
+		Email:        to,
+		Type:         kind,
+		ContactEmail: contactEmail,
+		Days:         int32(days),
+	})
+	if err != nil {
+		log.Error().Str("location", "notify").Msgf("%v: failed to send %v: %v", userID, kind, err)
+		return err
+	}
+
+	return nil
+}
+
+// Names the user registered under the email as a trusted contact of the owner.
+func (s *service) AddContact(ctx context.Context, ownerID uuid.UUID, req *ContactRequest) (*Contact, error) {
+	contactID, err := s.repo.GetUserIDByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if contactID == ownerID {
+		return nil, apiutils.NewErrBadRequest("owners can not be their own emergency contact")
+	}
+
+	// keypairs are created behind a vault lock of their own, before the owner's vault is locked
+	if err := s.vault.EnsureKeyPair(ctx, contactID); err != nil {
+		return nil, err
+	}
+
+	for _, categoryID := range req.CategoryIDs {
+		tree, err := s.categories.GetSubtree(ctx, ownerID, &categoryID, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tree) == 0 {
+			return nil, apiutils.NewErrNotFound("category not found")
+		}
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "AddContact").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// the mode can not change while the contact is added
+	owner, err := s.vault.LockVault(ctx, tx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the server can not hand out keys it does not hold
+	if owner.Mode == passwords.ClientMode {
+		return nil, apiutils.NewErrConflict("client side encrypted vaults do not support emergency access")
+	}
+
+	contact := &Contact{
+		OwnerID:     ownerID,
+		ContactID:   contactID,
+		CategoryIDs: req.CategoryIDs,
+		WaitDays:    req.WaitDays,
+		AccessDays:  req.AccessDays,
+		Created:     time.Now(),
+	}
+	if contact.CategoryIDs == nil {
+		contact.CategoryIDs = []uuid.UUID{}
+	}
+
+	if err := s.repo.UpsertContact(ctx, tx, contact); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "AddContact").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+
+	log.Info().Str("location", "AddContact").Msgf("%v: named %v as emergency contact", ownerID, contactID)
+	return s.repo.GetContact(ctx, nil, ownerID, contactID)
+}
+
+// Lists a page of the trusted contacts the owner named.
+func (s *service) GetContacts(ctx context.Context, ownerID uuid.UUID, params *pagination.Params) (*pagination.Page[*Contact], error) {
+	contacts, err := s.repo.GetContacts(ctx, ownerID, false, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, contacts, func(contact *Contact) (string, uuid.UUID) {
+		return contact.Created.Format(time.RFC3339Nano), contact.ContactID
+	})
+}
+
+// Lists a page of the owners who named the user as a trusted contact.
+func (s *service) GetGrantors(ctx context.Context, contactID uuid.UUID, params *pagination.Params) (*pagination.Page[*Contact], error) {
+	grantors, err := s.repo.GetContacts(ctx, contactID, true, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, grantors, func(contact *Contact) (string, uuid.UUID) {
+		return contact.Created.Format(time.RFC3339Nano), contact.OwnerID
+	})
+}
+
+// Removes the trusted contact, any access it was granted ends with it.
+func (s *service) RemoveContact(ctx context.Context, ownerID, contactID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "RemoveContact").Msgf("%v: %v", ownerID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.repo.DeleteContact(ctx, tx, ownerID, contactID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "RemoveContact").Msgf("%v: %v", ownerID, err)
+		return err
+	}
+
+	log.Info().Str("location", "RemoveContact").Msgf("%v: removed emergency contact %v", ownerID, contactID)
+	return nil
+}
+
+// Requests access to the owner's vault, the owner is notified and access is granted once the
+// wait passes without a veto. The request fails if the owner can not be notified.
+func (s *service) RequestAccess(ctx context.Context, contactID, ownerID uuid.UUID) (*Contact, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "RequestAccess").Msgf("%v: %v", contactID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	contact, err := s.repo.GetContact(ctx, tx, ownerID, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	if contact.Status, err = nextStatus(contact.Status, eventRequest); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	contact.RequestedAt, contact.GrantedAt, contact.SealedRing, contact.RingVersion = &now, nil, nil, 0
+	if err := s.repo.UpdateContact(ctx, tx, contact); err != nil {
+		return nil, err
+	}
+
+	if err := s.notify(ctx, ownerID, contact.OwnerEmail, email.EmergencyRequested, contact.Email, contact.WaitDays); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "RequestAccess").Msgf("%v: %v", contactID, err)
+		return nil, err
+	}
+
+	log.Info().Str("location", "RequestAccess").Msgf("%v: requested emergency access to %v", contactID, ownerID)
+	return contact, nil
+}
+
+// Grants the pending request of the contact without waiting.
+func (s *service) ApproveAccess(ctx context.Context, ownerID, contactID uuid.UUID) (*Contact, error) {
+	// the keys are sealed before the contact is locked, sealing migrates the vault first
+	sealed, version, err := s.vault.SealVaultKeys(ctx, ownerID, contactID, contactAAD(ownerID, contactID))
+	if err != nil {
+		return nil, err
+	}
+
+	contact, err := s.transition(ctx, ownerID, contactID, eventApprove, sealed, version)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("location", "ApproveAccess").Msgf("%v: approved emergency access of %v", ownerID, contactID)
+	return contact, nil
+}
+
+// Denies the pending request of the contact or ends the access it was granted.
+func (s *service) VetoAccess(ctx context.Context, ownerID, contactID uuid.UUID) (*Contact, error) {
+	contact, err := s.transition(ctx, ownerID, contactID, eventVeto, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("location", "VetoAccess").Msgf("%v: vetoed emergency access of %v", ownerID, contactID)
+	return contact, nil
+}
+
+// Grants the requests whose wait passed and expires the grants whose window closed, returns the
+// number of contacts moved.
+func (s *service) ProcessTimers(ctx context.Context, now time.Time) (int, error) {
+	due, err := s.repo.GetDueContacts(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, ids := range due {
+		contact, err := s.repo.GetContact(ctx, nil, ids[0], ids[1])
+		if err != nil {
+			continue
+		}
+
+		event := dueEvent(contact, now)
+		if event == "" {
+			continue
+		}
+
+		var sealed []byte
+		var version int
+		if event == eventElapse {
+			sealed, version, err = s.vault.SealVaultKeys(ctx, contact.OwnerID, contact.ContactID, contactAAD(contact.OwnerID, contact.ContactID))
+			if err != nil {
+				log.Error().Str("location", "ProcessTimers").Msgf("%v: %v", contact.OwnerID, err)
+				continue
+			}
+		}
+
+		if _, err := s.transition(ctx, contact.OwnerID, contact.ContactID, event, sealed, version); err != nil {
+			log.Error().Str("location", "ProcessTimers").Msgf("%v: %v", contact.OwnerID, err)
+			continue
+		}
+
+		processed++
+	}
+
+	return processed, nil
+}
+
+// helper: transition applies the event to the contact under its lock, granting events store the
+// ring sealed to the contact and the others drop the sealed ring. The contact is notified
+// afterwards, a failed notification does not undo the transition.
+func (s *service) transition(ctx context.Context, ownerID, contactID uuid.UUID, event string, sealed []byte, version int) (*Contact, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "transition").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	contact, err := s.repo.GetContact(ctx, tx, ownerID, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	// timers are checked again, the owner may have acted since they were listed
+	if (event == eventElapse || event == eventExpire) && dueEvent(contact, time.Now()) != event {
+		return nil, apiutils.NewErrConflict("emergency access timer is not due")
+	}
+
+	if contact.Status, err = nextStatus(contact.Status, event); err != nil {
+		return nil, err
+	}
+
+	kind := email.EmergencyVetoed
+	if contact.Status == StatusGranted {
+		now := time.Now()
+		contact.SealedRing, contact.RingVersion = sealed, version
+		contact.GrantedAt, kind = &now, email.EmergencyGranted
+	} else {
+		contact.SealedRing, contact.RingVersion = nil, 0
+	}
+
+	if err := s.repo.UpdateContact(ctx, tx, contact); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "transition").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+
+	// expiring is the expected end of the access, the contact is only told about decisions
+	if event != eventExpire {
+		s.notify(ctx, contactID, contact.Email, kind, contact.OwnerEmail, contact.AccessDays)
+	}
+
+	return contact, nil
+}
+
+// Retrieves the owner's entries the contact was granted access to, decrypted with the key ring
+// sealed to the contact.
+func (s *service) GetVault(ctx context.Context, contactID, ownerID uuid.UUID, params *pagination.Params) (*pagination.Page[*passwords.Password], error) {
+	contact, err := s.repo.GetContact(ctx, nil, ownerID, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	if contact.Status != StatusGranted || dueEvent(contact, time.Now()) == eventExpire {
+		return nil, apiutils.NewErrForbidden("emergency access is not granted")
+	}
+
+	filter, err := s.readableFilter(ctx, contact)
+	if err != nil {
+		return nil, err
+	}
+
+	aad := contactAAD(ownerID, contactID)
+	page, err := s.vault.OpenSealedVault(ctx, ownerID, contactID, contact.SealedRing, aad, filter, params)
+
+	// the owner's vault was rekeyed since access was granted
+	if errors.Is(err, passwords.ErrRingOutdated) {
+		if contact, err = s.resealRing(ctx, contact); err != nil {
+			return nil, err
+		}
+
+		page, err = s.vault.OpenSealedVault(ctx, ownerID, contactID, contact.SealedRing, aad, filter, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("location", "GetVault").Msgf("%v: read %v entries of %v", contactID, len(page.Items), ownerID)
+	return page, nil
+}
+
+// helper: readableFilter limits a listing to the categories the contact can read, access limited
+// to categories takes their whole subtrees along. A category in the trash or purged is skipped, it
+// is readable again once restored, and a contact left with none reads nothing.
+func (s *service) readableFilter(ctx context.Context, contact *Contact) (*passwords.ListFilter, error) {
+	filter := &passwords.ListFilter{}
+	if len(contact.CategoryIDs) != 0 {
+		filter.CategoryIDs = []uuid.UUID{}
+	}
+
+	for _, categoryID := range contact.CategoryIDs {
+		tree, err := s.categories.GetSubtree(ctx, contact.OwnerID, &categoryID, categories.MaxDepth)
+		if _, ok := err.(apiutils.ErrNotFound); ok {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, category := range categories.Flatten(tree) {
+			filter.CategoryIDs = append(filter.CategoryIDs, category.CategoryID)
+		}
+	}
+
+	return filter, nil
+}
+
+// helper: resealRing seals the owner's current data keys to the contact while access is granted.
+func (s *service) resealRing(ctx context.Context, contact *Contact) (*Contact, error) {
+	sealed, version, err := s.vault.SealVaultKeys(ctx, contact.OwnerID, contact.ContactID, contactAAD(contact.OwnerID, contact.ContactID))
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "resealRing").Msgf("%v: %v", contact.OwnerID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if contact, err = s.repo.GetContact(ctx, tx, contact.OwnerID, contact.ContactID); err != nil {
+		return nil, err
+	}
+
+	if contact.Status != StatusGranted {
+		return nil, apiutils.NewErrForbidden("emergency access is not granted")
+	}
+
+	contact.SealedRing, contact.RingVersion = sealed, version
+	if err := s.repo.UpdateContact(ctx, tx, contact); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "resealRing").Msgf("%v: %v", contact.OwnerID, err)
+		return nil, err
+	}
+
+	return contact, nil
+}
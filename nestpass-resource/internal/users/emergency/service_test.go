@@ -0,0 +1,124 @@
+package emergency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/users/categories"
+)
+
+// fakeCategories serves the subtree below a category nested the way the category service lists it.
+type fakeCategories struct {
+	nodes []*categories.Category
+}
+
+func (f *fakeCategories) GetSubtree(ctx context.Context, userID uuid.UUID, categoryID *uuid.UUID, depth int) ([]*categories.Category, error) {
+	below := map[uuid.UUID]bool{*categoryID: true}
+	subtree := []*categories.Category{}
+	for _, node := range f.nodes {
+		if below[node.CategoryID] || (node.ParentID != nil && below[*node.ParentID]) {
+			below[node.CategoryID] = true
+			subtree = append(subtree, node)
+		}
+	}
+
+	if len(subtree) == 0 {
+		return nil, apiutils.NewErrNotFound("category not found")
+	}
+
+	return categories.BuildTree(subtree), nil
+}
+
+func Test_NextStatus(t *testing.T) {
+	cases := []struct {
+		status, event, want string
+		ok                  bool
+	}{
+		{StatusIdle, eventRequest, StatusRequested, true},
+		{StatusVetoed, eventRequest, StatusRequested, true},
+		{StatusExpired, eventRequest, StatusRequested, true},
+		{StatusRequested, eventRequest, "", false},
+		{StatusRequested, eventApprove, StatusGranted, true},
+		{StatusIdle, eventApprove, "", false},
+		{StatusRequested, eventVeto, StatusVetoed, true},
+		{StatusGranted, eventVeto, StatusVetoed, true},
+		{StatusIdle, eventVeto, "", false},
+		{StatusRequested, eventElapse, StatusGranted, true},
+		{StatusVetoed, eventElapse, "", false},
+		{StatusGranted, eventExpire, StatusExpired, true},
+		{StatusRequested, eventExpire, "", false},
+	}
+
+	for _, c := range cases {
+		got, err := nextStatus(c.status, c.event)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("nextStatus(%v, %v) = %q, %v", c.status, c.event, got, err)
+		}
+	}
+}
+
+func Test_DueEvent(t *testing.T) {
+	now := time.Now()
+	past, recent := now.AddDate(0, 0, -10), now.AddDate(0, 0, -1)
+
+	cases := []struct {
+		contact *Contact
+		want    string
+	}{
+		{&Contact{Status: StatusRequested, RequestedAt: &past, WaitDays: 7}, eventElapse},
+		{&Contact{Status: StatusRequested, RequestedAt: &recent, WaitDays: 7}, ""},
+		{&Contact{Status: StatusGranted, GrantedAt: &past, AccessDays: 7}, eventExpire},
+		{&Contact{Status: StatusGranted, GrantedAt: &recent, AccessDays: 7}, ""},
+		{&Contact{Status: StatusVetoed, RequestedAt: &past, WaitDays: 7}, ""},
+		{&Contact{Status: StatusIdle}, ""},
+	}
+
+	for i, c := range cases {
+		if got := dueEvent(c.contact, now); got != c.want {
+			t.Errorf("case %d: got %q, want %q", i, got, c.want)
+		}
+	}
+}
+
+func Test_ReadableFilter(t *testing.T) {
+	ownerID := uuid.New()
+	root := &categories.Category{CategoryID: uuid.New(), UserID: ownerID}
+	child := &categories.Category{CategoryID: uuid.New(), UserID: ownerID, ParentID: &root.CategoryID, Depth: 1}
+	grandchild := &categories.Category{CategoryID: uuid.New(), UserID: ownerID, ParentID: &child.CategoryID, Depth: 2}
+	other := &categories.Category{CategoryID: uuid.New(), UserID: ownerID}
+	svc := &service{categories: &fakeCategories{nodes: []*categories.Category{root, other, child, grandchild}}}
+
+	// a readable category takes every level below it along, nothing beside it
+	contact := &Contact{OwnerID: ownerID, CategoryIDs: []uuid.UUID{root.CategoryID}}
+	filter, err := svc.readableFilter(context.Background(), contact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := filter.CategoryIDs
+	if len(ids) != 3 || ids[0] != root.CategoryID || ids[1] != child.CategoryID || ids[2] != grandchild.CategoryID {
+		t.Fatalf("readableFilter() = %v, want the category and both levels below it", ids)
+	}
+
+	// a trashed category is skipped, the others stay readable
+	trashed := uuid.New()
+	contact.CategoryIDs = []uuid.UUID{trashed, other.CategoryID}
+	if filter, err = svc.readableFilter(context.Background(), contact); err != nil || len(filter.CategoryIDs) != 1 || filter.CategoryIDs[0] != other.CategoryID {
+		t.Fatalf("readableFilter() with a trashed category = %v, %v, want the other category", filter, err)
+	}
+
+	// with every category trashed nothing is readable, rather than the whole vault
+	contact.CategoryIDs = []uuid.UUID{trashed}
+	if filter, err = svc.readableFilter(context.Background(), contact); err != nil || filter.CategoryIDs == nil || len(filter.CategoryIDs) != 0 {
+		t.Fatalf("readableFilter() with every category trashed = %v, %v, want an empty filter", filter, err)
+	}
+
+	// contacts without categories read the whole vault
+	if filter, err := svc.readableFilter(context.Background(), &Contact{OwnerID: ownerID}); err != nil || filter.CategoryIDs != nil {
+		t.Fatalf("readableFilter() for the whole vault = %v, %v", filter, err)
+	}
+}
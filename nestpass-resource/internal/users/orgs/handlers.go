@@ -0,0 +1,323 @@
+package orgs
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/dependencies"
+	"nestpass/pkg/auth"
+	"nestpass/pkg/pagination"
+)
+
+type Handler struct {
+	svc   *service
+	pager *pagination.Pager
+}
+
+func NewHandler(deps *dependencies.Dependencies, keys vaultKeys) *Handler {
+	repo := NewRepository(deps.Databases.Postgres)
+	svc := NewService(repo, keys)
+	return &Handler{svc: svc, pager: deps.Pager}
+}
+
+// Loads the organizations the user is a member of, used by the authorization middleware.
+func (h *Handler) GetMemberships(ctx context.Context, userID uuid.UUID) (auth.Memberships, error) {
+	return h.svc.GetMemberships(ctx, userID)
+}
+
+func (h *Handler) GetOrgs(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	orgs, err := h.svc.GetOrgs(r.Context(), userID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", orgs)
+	resp.SendRes(w)
+}
+
+func (h *Handler) CreateOrg(w http.ResponseWriter, r *http.Request) {
+	req := &OrgRequest{}
+	if err := req.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	org, err := h.svc.CreateOrg(r.Context(), userID, req)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusCreated, "", org)
+	resp.SendRes(w)
+}
+
+func (h *Handler) DeleteOrg(w http.ResponseWriter, r *http.Request) {
+	orgID, err := auth.OwnerFromRequest(r, auth.ActionOwn)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.DeleteOrg(r.Context(), userID, orgID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	orgID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	params, err := h.pager.Parse(r)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	members, err := h.svc.GetMembers(r.Context(), orgID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", members)
+	resp.SendRes(w)
+}
+
+func (h *Handler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	req := &RoleRequest{}
+	if err := req.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	orgID, memberID, userID, err := memberParams(r, auth.ActionManage)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.UpdateRole(r.Context(), userID, orgID, memberID, req.Role); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	orgID, memberID, userID, err := memberParams(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.RemoveMember(r.Context(), userID, orgID, memberID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) Invite(w http.ResponseWriter, r *http.Request) {
+	req := &InviteRequest{}
+	if err := req.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	orgID, err := auth.OwnerFromRequest(r, auth.ActionManage)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	invite, err := h.svc.Invite(r.Context(), userID, orgID, req)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusCreated, "", invite)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetInvites(w http.ResponseWriter, r *http.Request) {
+	orgID, err := auth.OwnerFromRequest(r, auth.ActionManage)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	params, err := h.pager.ParseOrder(r, pagination.Desc)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	invites, err := h.svc.GetInvites(r.Context(), orgID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", invites)
+	resp.SendRes(w)
+}
+
+func (h *Handler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	orgID, err := auth.OwnerFromRequest(r, auth.ActionManage)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	inviteID, err := queryUUID(r, "invite_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.RevokeInvite(r.Context(), userID, orgID, inviteID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetReceivedInvites(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	invites, err := h.svc.GetReceivedInvites(r.Context(), userID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", invites)
+	resp.SendRes(w)
+}
+
+func (h *Handler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	inviteID, err := queryUUID(r, "invite_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.AcceptInvite(r.Context(), userID, inviteID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) DeclineInvite(w http.ResponseWriter, r *http.Request) {
+	inviteID, err := queryUUID(r, "invite_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.DeclineInvite(r.Context(), userID, inviteID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+// helper: memberParams resolves the organization, the member the request targets and the
+// requesting user.
+func memberParams(r *http.Request, action auth.Action) (orgID, memberID, userID uuid.UUID, err error) {
+	if orgID, err = auth.OwnerFromRequest(r, action); err != nil {
+		return
+	}
+
+	if memberID, err = queryUUID(r, "user_id"); err != nil {
+		return
+	}
+
+	userID, err = auth.UidFromCtx(r.Context())
+	return
+}
+
+// helper: queryUUID parses a required id query parameter.
+func queryUUID(r *http.Request, name string) (uuid.UUID, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return uuid.Nil, apiutils.NewErrBadRequest("missing " + name)
+	}
+
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, apiutils.NewErrBadRequest("invalid " + name)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,109 @@
+package orgs
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"nestpass/pkg/auth"
+)
+
+// days an invite can be accepted for
+const inviteExpiryDays = 7
+
+// Org is an organization, its collections are category trees owned by the organization.
+type Org struct {
+	OrgID   uuid.UUID `json:"org_id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Role    string    `json:"role,omitempty"` // role of the requesting user
+}
+
+func (o *Org) Scan(row pgx.Row) error {
+	return row.Scan(&o.OrgID, &o.Name, &o.Created, &o.Role)
+}
+
+type Member struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	SealedKey []byte    `json:"-"` // organization key sealed to the member's keypair
+	Joined    time.Time `json:"joined"`
+}
+
+func (m *Member) Scan(row pgx.Row) error {
+	return row.Scan(&m.UserID, &m.Email, &m.Role, &m.Joined)
+}
+
+// Invite of an email address to an organization, accepted by the user registered under it.
+type Invite struct {
+	InviteID  uuid.UUID `json:"invite_id"`
+	OrgID     uuid.UUID `json:"org_id"`
+	OrgName   string    `json:"org_name,omitempty"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy uuid.UUID `json:"invited_by"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+func (i *Invite) Scan(row pgx.Row) error {
+	return row.Scan(&i.InviteID, &i.OrgID, &i.OrgName, &i.Email, &i.Role, &i.InvitedBy, &i.Created, &i.Expires)
+}
+
+type OrgRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
+
+func (o *OrgRequest) Deserialize(data io.ReadCloser) error {
+	return deserialize("OrgRequest.Deserialize", data, o)
+}
+
+type InviteRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner admin member read_only"`
+}
+
+func (i *InviteRequest) Deserialize(data io.ReadCloser) error {
+	return deserialize("InviteRequest.Deserialize", data, i)
+}
+
+type RoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner admin member read_only"`
+}
+
+func (r *RoleRequest) Deserialize(data io.ReadCloser) error {
+	return deserialize("RoleRequest.Deserialize", data, r)
+}
+
+// helper: deserialize decodes and validates a request body.
+func deserialize(location string, data io.ReadCloser, v any) error {
+	if err := json.NewDecoder(data).Decode(v); err != nil {
+		log.Error().Str("location", location).Msg(err.Error())
+		return err
+	}
+
+	if err := validator.New().Struct(v); err != nil {
+		log.Error().Str("location", location).Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// helper: canAssign checks if a member with the actor role may give the role to a member who
+// currently holds the target role, an empty target is a new member. Owners manage everyone,
+// admins manage the roles below owner.
+func canAssign(actor, target, role string) bool {
+	required := auth.ActionManage
+	if target == auth.RoleOwner || role == auth.RoleOwner {
+		required = auth.ActionOwn
+	}
+
+	return auth.RoleAllows(actor, required)
+}
@@ -0,0 +1,29 @@
+package orgs
+
+import (
+	"testing"
+
+	"nestpass/pkg/auth"
+)
+
+func Test_CanAssign(t *testing.T) {
+	cases := []struct {
+		actor, target, role string
+		allowed             bool
+	}{
+		{auth.RoleOwner, auth.RoleOwner, auth.RoleAdmin, true},
+		{auth.RoleOwner, "", auth.RoleOwner, true},
+		{auth.RoleAdmin, auth.RoleMember, auth.RoleAdmin, true},
+		{auth.RoleAdmin, "", auth.RoleReadOnly, true},
+		{auth.RoleAdmin, "", auth.RoleOwner, false},
+		{auth.RoleAdmin, auth.RoleOwner, auth.RoleMember, false},
+		{auth.RoleMember, auth.RoleReadOnly, auth.RoleMember, false},
+		{auth.RoleReadOnly, "", auth.RoleReadOnly, false},
+	}
+
+	for _, c := range cases {
+		if got := canAssign(c.actor, c.target, c.role); got != c.allowed {
+			t.Errorf("%s giving %s to %q: got %v, want %v", c.actor, c.role, c.target, got, c.allowed)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package orgs
+
+const (
+	CreateOrgQuery = `
+	INSERT INTO orgs (org_id, name, created)
+	VALUES ($1, $2, $3)`
+
+	GetUserOrgsQuery = `
+	SELECT o.org_id, o.name, o.created, m.role FROM orgs o
+	JOIN org_members m ON m.org_id = o.org_id
+	WHERE m.user_id = $1
+	ORDER BY o.name ASC`
+
+	GetMembershipsQuery = `
+	SELECT org_id, role FROM org_members
+	WHERE user_id = $1`
+
+	LockOrgQuery = `
+	SELECT org_id FROM orgs
+	WHERE org_id = $1
+	FOR UPDATE`
+
+	AddMemberQuery = `
+	INSERT INTO org_members (org_id, user_id, role, sealed_key, joined)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	GetMembersQuery = `
+	SELECT m.user_id, u.email, m.role, m.joined FROM org_members m
+	JOIN users u ON u.user_id = m.user_id
+	WHERE m.org_id = $1 AND ($2::timestamptz IS NULL OR (m.joined, m.user_id) > ($2, $3::uuid))
+	ORDER BY m.joined ASC, m.user_id ASC
+	LIMIT $4`
+
+	GetMembersDescQuery = `
+	SELECT m.user_id, u.email, m.role, m.joined FROM org_members m
+	JOIN users u ON u.user_id = m.user_id
+	WHERE m.org_id = $1 AND ($2::timestamptz IS NULL OR (m.joined, m.user_id) < ($2, $3::uuid))
+	ORDER BY m.joined DESC, m.user_id DESC
+	LIMIT $4`
+
+	GetMemberRoleQuery = `
+	SELECT role FROM org_members
+	WHERE org_id = $1 AND user_id = $2`
+
+	GetOwnerIDQuery = `
+	SELECT user_id FROM org_members
+	WHERE org_id = $1 AND role = 'owner'
+	ORDER BY joined ASC
+	LIMIT 1`
+
+	CountOwnersQuery = `
+	SELECT count(*) FROM org_members
+	WHERE org_id = $1 AND role = 'owner'`
+
+	UpdateMemberRoleQuery = `
+	UPDATE org_members SET role = $3
+	WHERE org_id = $1 AND user_id = $2`
+
+	DeleteMemberQuery = `
+	DELETE FROM org_members
+	WHERE org_id = $1 AND user_id = $2`
+
+	CreateInviteQuery = `
+	INSERT INTO org_invites (invite_id, org_id, email, role, invited_by, created, expires)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (org_id, email) DO UPDATE
+	SET invite_id = EXCLUDED.invite_id, role = EXCLUDED.role, invited_by = EXCLUDED.invited_by,
+		created = EXCLUDED.created, expires = EXCLUDED.expires`
+
+	GetOrgInvitesQuery = `
+	SELECT i.invite_id, i.org_id, o.name, i.email, i.role, i.invited_by, i.created, i.expires FROM org_invites i
+	JOIN orgs o ON o.org_id = i.org_id
+	WHERE i.org_id = $1 AND i.expires > now() AND ($2::timestamptz IS NULL OR (i.created, i.invite_id) > ($2, $3::uuid))
+	ORDER BY i.created ASC, i.invite_id ASC
+	LIMIT $4`
+
+	GetOrgInvitesDescQuery = `
+	SELECT i.invite_id, i.org_id, o.name, i.email, i.role, i.invited_by, i.created, i.expires FROM org_invites i
+	JOIN orgs o ON o.org_id = i.org_id
+	WHERE i.org_id = $1 AND i.expires > now() AND ($2::timestamptz IS NULL OR (i.created, i.invite_id) < ($2, $3::uuid))
+	ORDER BY i.created DESC, i.invite_id DESC
+	LIMIT $4`
+
+	GetReceivedInvitesQuery = `
+	SELECT i.invite_id, i.org_id, o.name, i.email, i.role, i.invited_by, i.created, i.expires FROM org_invites i
+	JOIN orgs o ON o.org_id = i.org_id
+	JOIN users u ON u.email = i.email
+	WHERE u.user_id = $1 AND i.expires > now()
+	ORDER BY i.created DESC`
+
+	GetReceivedInviteQuery = `
+	SELECT i.invite_id, i.org_id, o.name, i.email, i.role, i.invited_by, i.created, i.expires FROM org_invites i
+	JOIN orgs o ON o.org_id = i.org_id
+	JOIN users u ON u.email = i.email
+	WHERE i.invite_id = $1 AND u.user_id = $2 AND i.expires > now()`
+
+	DeleteInviteQuery = `
+	DELETE FROM org_invites
+	WHERE invite_id = $1 AND org_id = $2`
+
+	IsMemberEmailQuery = `
+	SELECT EXISTS (
+		SELECT 1 FROM org_members m
+		JOIN users u ON u.user_id = m.user_id
+		WHERE m.org_id = $1 AND u.email = $2
+	)`
+
+	// the organization's entries and collections are stored under its id
+	DeleteOrgRevisionsQuery = `
+	DELETE FROM password_history
+	WHERE user_id = $1`
+
+	DeleteOrgAttachmentsQuery = `
+	WITH deleted AS (
+		DELETE FROM attachments
+		WHERE user_id = $1
+		RETURNING attachment_id
+	)
+	INSERT INTO attachment_deletions (attachment_id, queued)
+	SELECT attachment_id, now() FROM deleted`
+
+	DeleteOrgPasswordTagsQuery = `
+	DELETE FROM password_tags
+	WHERE user_id = $1`
+
+	DeleteOrgTagsQuery = `
+	DELETE FROM tags
+	WHERE user_id = $1`
+
+	DeleteOrgPasswordsQuery = `
+	DELETE FROM passwords
+	WHERE user_id = $1`
+
+	DeleteOrgCategoriesQuery = `
+	DELETE FROM categories
+	WHERE user_id = $1`
+
+	DeleteOrgVaultQuery = `
+	DELETE FROM vaults
+	WHERE user_id = $1`
+
+	DeleteOrgInvitesQuery = `
+	DELETE FROM org_invites
+	WHERE org_id = $1`
+
+	DeleteOrgMembersQuery = `
+	DELETE FROM org_members
+	WHERE org_id = $1`
+
+	DeleteOrgQuery = `
+	DELETE FROM orgs
+	WHERE org_id = $1`
+)
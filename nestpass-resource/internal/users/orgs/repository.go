@@ -0,0 +1,302 @@
+package orgs
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/pkg/auth"
+	"nestpass/pkg/pagination"
+)
+
+type repository struct {
+	postgres *pgxpool.Pool
+}
+
+func NewRepository(pg *pgxpool.Pool) *repository {
+	return &repository{postgres: pg}
+}
+
+func (r *repository) CreateOrg(ctx context.Context, tx pgx.Tx, org *Org) error {
+	if _, err := tx.Exec(ctx, CreateOrgQuery, org.OrgID, org.Name, org.Created); err != nil {
+		log.Error().Str("location", "CreateOrg").Msgf("%v: %v", org.OrgID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) GetUserOrgs(ctx context.Context, userID uuid.UUID) ([]*Org, error) {
+	rows, err := r.postgres.Query(ctx, GetUserOrgsQuery, userID)
+	if err != nil {
+		log.Error().Str("location", "GetUserOrgs").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Org{}
+	for rows.Next() {
+		org := &Org{}
+		if err := org.Scan(rows); err != nil {
+			log.Error().Str("location", "GetUserOrgs").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		orgs = append(orgs, org)
+	}
+
+	return orgs, rows.Err()
+}
+
+func (r *repository) GetMemberships(ctx context.Context, userID uuid.UUID) (auth.Memberships, error) {
+	rows, err := r.postgres.Query(ctx, GetMembershipsQuery, userID)
+	if err != nil {
+		log.Error().Str("location", "GetMemberships").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := auth.Memberships{}
+	for rows.Next() {
+		orgID, role := uuid.Nil, ""
+		if err := rows.Scan(&orgID, &role); err != nil {
+			log.Error().Str("location", "GetMemberships").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		memberships[orgID] = role
+	}
+
+	return memberships, rows.Err()
+}
+
+// Locks the organization so its members and owners can not change concurrently.
+func (r *repository) LockOrg(ctx context.Context, tx pgx.Tx, orgID uuid.UUID) error {
+	if err := tx.QueryRow(ctx, LockOrgQuery, orgID).Scan(&orgID); err != nil {
+		if err == pgx.ErrNoRows {
+			return apiutils.NewErrNotFound("organization not found")
+		}
+
+		log.Error().Str("location", "LockOrg").Msgf("%v: %v", orgID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) AddMember(ctx context.Context, tx pgx.Tx, orgID uuid.UUID, member *Member) error {
+	_, err := tx.Exec(ctx, AddMemberQuery, orgID, member.UserID, member.Role, member.SealedKey, member.Joined)
+	if err != nil {
+		log.Error().Str("location", "AddMember").Msgf("%v: %v", orgID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) GetMembers(ctx context.Context, orgID uuid.UUID, params *pagination.Params) ([]*Member, error) {
+	query := GetMembersQuery
+	if params.Descending() {
+		query = GetMembersDescQuery
+	}
+
+	rows, err := r.postgres.Query(ctx, query, orgID, params.BoundaryValue(), params.Boundary(), params.Fetch())
+	if err != nil {
+		log.Error().Str("location", "GetMembers").Msgf("%v: %v", orgID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+	for rows.Next() {
+		member := &Member{}
+		if err := member.Scan(rows); err != nil {
+			log.Error().Str("location", "GetMembers").Msgf("%v: %v", orgID, err)
+			return nil, err
+		}
+
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// Retrieves the role of the member, the role read in the transaction is authoritative over the
+// one the request carries.
+func (r *repository) GetMemberRole(ctx context.Context, tx pgx.Tx, orgID, userID uuid.UUID) (string, error) {
+	role := ""
+	if err := tx.QueryRow(ctx, GetMemberRoleQuery, orgID, userID).Scan(&role); err != nil {
+		if err == pgx.ErrNoRows {
+			return "", apiutils.NewErrNotFound("member not found")
+		}
+
+		log.Error().Str("location", "GetMemberRole").Msgf("%v: %v", orgID, err)
+		return "", err
+	}
+
+	return role, nil
+}
+
+// Retrieves the longest standing owner, owners always hold the organization key.
+func (r *repository) GetOwnerID(ctx context.Context, tx pgx.Tx, orgID uuid.UUID) (uuid.UUID, error) {
+	ownerID := uuid.Nil
+	if err := tx.QueryRow(ctx, GetOwnerIDQuery, orgID).Scan(&ownerID); err != nil {
+		log.Error().Str("location", "GetOwnerID").Msgf("%v: %v", orgID, err)
+		return uuid.Nil, err
+	}
+
+	return ownerID, nil
+}
+
+func (r *repository) CountOwners(ctx context.Context, tx pgx.Tx, orgID uuid.UUID) (int, error) {
+	count := 0
+	if err := tx.QueryRow(ctx, CountOwnersQuery, orgID).Scan(&count); err != nil {
+		log.Error().Str("location", "CountOwners").Msgf("%v: %v", orgID, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *repository) UpdateMemberRole(ctx context.Context, tx pgx.Tx, orgID, userID uuid.UUID, role string) error {
+	if _, err := tx.Exec(ctx, UpdateMemberRoleQuery, orgID, userID, role); err != nil {
+		log.Error().Str("location", "UpdateMemberRole").Msgf("%v: %v", orgID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteMember(ctx context.Context, tx pgx.Tx, orgID, userID uuid.UUID) error {
+	if _, err := tx.Exec(ctx, DeleteMemberQuery, orgID, userID); err != nil {
+		log.Error().Str("location", "DeleteMember").Msgf("%v: %v", orgID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Creates the invite, inviting the same email again replaces the pending invite.
+func (r *repository) CreateInvite(ctx context.Context, tx pgx.Tx, invite *Invite) error {
+	_, err := tx.Exec(ctx, CreateInviteQuery,
+		invite.InviteID,
+		invite.OrgID,
+		invite.Email,
+		invite.Role,
+		invite.InvitedBy,
+		invite.Created,
+		invite.Expires,
+	)
+	if err != nil {
+		log.Error().Str("location", "CreateInvite").Msgf("%v: %v", invite.OrgID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Lists a page of the pending invites of the organization, newest first.
+func (r *repository) GetInvites(ctx context.Context, orgID uuid.UUID, params *pagination.Params) ([]*Invite, error) {
+	query := GetOrgInvitesQuery
+	if params.Descending() {
+		query = GetOrgInvitesDescQuery
+	}
+
+	return r.queryInvites(ctx, "GetInvites", orgID, query, orgID, params.BoundaryValue(), params.Boundary(), params.Fetch())
+}
+
+// Lists the pending invites sent to the user.
+func (r *repository) GetReceivedInvites(ctx context.Context, userID uuid.UUID) ([]*Invite, error) {
+	return r.queryInvites(ctx, "GetReceivedInvites", userID, GetReceivedInvitesQuery, userID)
+}
+
+// helper: queryInvites runs a query returning invites.
+func (r *repository) queryInvites(ctx context.Context, location string, id uuid.UUID, query string, args ...any) ([]*Invite, error) {
+	rows, err := r.postgres.Query(ctx, query, args...)
+	if err != nil {
+		log.Error().Str("location", location).Msgf("%v: %v", id, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*Invite{}
+	for rows.Next() {
+		invite := &Invite{}
+		if err := invite.Scan(rows); err != nil {
+			log.Error().Str("location", location).Msgf("%v: %v", id, err)
+			return nil, err
+		}
+
+		invites = append(invites, invite)
+	}
+
+	return invites, rows.Err()
+}
+
+// Retrieves a pending invite sent to the user's email.
+func (r *repository) GetReceivedInvite(ctx context.Context, tx pgx.Tx, inviteID, userID uuid.UUID) (*Invite, error) {
+	invite := &Invite{}
+	if err := invite.Scan(tx.QueryRow(ctx, GetReceivedInviteQuery, inviteID, userID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("invite not found")
+		}
+
+		log.Error().Str("location", "GetReceivedInvite").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+func (r *repository) DeleteInvite(ctx context.Context, tx pgx.Tx, orgID, inviteID uuid.UUID) error {
+	tag, err := tx.Exec(ctx, DeleteInviteQuery, inviteID, orgID)
+	if err != nil {
+		log.Error().Str("location", "DeleteInvite").Msgf("%v: %v", orgID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrNotFound("invite not found")
+	}
+
+	return nil
+}
+
+func (r *repository) IsMemberEmail(ctx context.Context, tx pgx.Tx, orgID uuid.UUID, email string) (bool, error) {
+	exists := false
+	if err := tx.QueryRow(ctx, IsMemberEmailQuery, orgID, email).Scan(&exists); err != nil {
+		log.Error().Str("location", "IsMemberEmail").Msgf("%v: %v", orgID, err)
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Deletes the organization with its entries, attachments, tags, collections, vault, members and invites.
+func (r *repository) DeleteOrg(ctx context.Context, tx pgx.Tx, orgID uuid.UUID) error {
+	queries := []string{
+		DeleteOrgRevisionsQuery,
+		DeleteOrgAttachmentsQuery,
+		DeleteOrgPasswordTagsQuery,
+		DeleteOrgTagsQuery,
+		DeleteOrgPasswordsQuery,
+		DeleteOrgCategoriesQuery,
+		DeleteOrgVaultQuery,
+		DeleteOrgInvitesQuery,
+		DeleteOrgMembersQuery,
+		DeleteOrgQuery,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(ctx, query, orgID); err != nil {
+			log.Error().Str("location", "DeleteOrg").Msgf("%v: %v", orgID, err)
+			return err
+		}
+	}
+
+	return nil
+}
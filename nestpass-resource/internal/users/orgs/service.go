@@ -0,0 +1,397 @@
+package orgs
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/pkg/auth"
+	"nestpass/pkg/pagination"
+)
+
+// vaultKeys creates organization vaults and hands their key to members, implemented by the passwords package.
+type vaultKeys interface {
+	CreateOrgVault(ctx context.Context, tx pgx.Tx, orgID, ownerID uuid.UUID) ([]byte, error)
+	GrantOrgKey(ctx context.Context, orgID, granterID, memberID uuid.UUID) ([]byte, error)
+}
+
+type service struct {
+	repo *repository
+	keys vaultKeys
+}
+
+func NewService(repo *repository, keys vaultKeys) *service {
+	return &service{repo: repo, keys: keys}
+}
+
+func (s *service) GetMemberships(ctx context.Context, userID uuid.UUID) (auth.Memberships, error) {
+	return s.repo.GetMemberships(ctx, userID)
+}
+
+func (s *service) GetOrgs(ctx context.Context, userID uuid.UUID) ([]*Org, error) {
+	return s.repo.GetUserOrgs(ctx, userID)
+}
+
+// Creates an organization with an empty vault, the user becomes its first owner.
+func (s *service) CreateOrg(ctx context.Context, userID uuid.UUID, req *OrgRequest) (*Org, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "CreateOrg").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	org := &Org{OrgID: uuid.New(), Name: req.Name, Created: time.Now(), Role: auth.RoleOwner}
+	if err := s.repo.CreateOrg(ctx, tx, org); err != nil {
+		return nil, err
+	}
+
+	sealed, err := s.keys.CreateOrgVault(ctx, tx, org.OrgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := &Member{UserID: userID, Role: auth.RoleOwner, SealedKey: sealed, Joined: org.Created}
+	if err := s.repo.AddMember(ctx, tx, org.OrgID, owner); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "CreateOrg").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	log.Info().Str("location", "CreateOrg").Msgf("%v: organization %v created", userID, org.OrgID)
+	return org, nil
+}
+
+// Deletes the organization along with everything it owns, only owners can.
+func (s *service) DeleteOrg(ctx context.Context, userID, orgID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "DeleteOrg").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := s.lockRole(ctx, tx, orgID, userID, auth.ActionOwn); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteOrg(ctx, tx, orgID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "DeleteOrg").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	log.Info().Str("location", "DeleteOrg").Msgf("%v: organization %v deleted", userID, orgID)
+	return nil
+}
+
+// helper: lockRole locks the organization and checks the user's role allows the action.
+func (s *service) lockRole(ctx context.Context, tx pgx.Tx, orgID, userID uuid.UUID, action auth.Action) (string, error) {
+	if err := s.repo.LockOrg(ctx, tx, orgID); err != nil {
+		return "", err
+	}
+
+	role, err := s.repo.GetMemberRole(ctx, tx, orgID, userID)
+	if err != nil {
+		return "", apiutils.NewErrNotFound("organization not found")
+	}
+
+	if !auth.RoleAllows(role, action) {
+		return "", apiutils.NewErrForbidden("role " + role + " does not allow this")
+	}
+
+	return role, nil
+}
+
+func (s *service) GetMembers(ctx context.Context, orgID uuid.UUID, params *pagination.Params) (*pagination.Page[*Member], error) {
+	members, err := s.repo.GetMembers(ctx, orgID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, members, func(member *Member) (string, uuid.UUID) {
+		return member.Joined.Format(time.RFC3339Nano), member.UserID
+	})
+}
+
+// Changes the role of a member, an organization always keeps at least one owner.
+func (s *service) UpdateRole(ctx context.Context, userID, orgID, memberID uuid.UUID, role string) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "UpdateRole").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	actor, err := s.lockRole(ctx, tx, orgID, userID, auth.ActionManage)
+	if err != nil {
+		return err
+	}
+
+	target, err := s.repo.GetMemberRole(ctx, tx, orgID, memberID)
+	if err != nil {
+		return err
+	}
+
+	if !canAssign(actor, target, role) {
+		return apiutils.NewErrForbidden("role " + actor + " can not assign this role")
+	}
+
+	if err := s.keepOwner(ctx, tx, orgID, target, role); err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdateMemberRole(ctx, tx, orgID, memberID, role); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "UpdateRole").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	log.Info().Str("location", "UpdateRole").Msgf("%v: %v is now %v of %v", userID, memberID, role, orgID)
+	return nil
+}
+
+// Removes a member from the organization, every member can leave on their own.
+func (s *service) RemoveMember(ctx context.Context, userID, orgID, memberID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "RemoveMember").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	actor, err := s.lockRole(ctx, tx, orgID, userID, auth.ActionView)
+	if err != nil {
+		return err
+	}
+
+	target, err := s.repo.GetMemberRole(ctx, tx, orgID, memberID)
+	if err != nil {
+		return err
+	}
+
+	if userID != memberID && !canAssign(actor, target, target) {
+		return apiutils.NewErrForbidden("role " + actor + " can not remove this member")
+	}
+
+	if err := s.keepOwner(ctx, tx, orgID, target, ""); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteMember(ctx, tx, orgID, memberID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "RemoveMember").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	log.Info().Str("location", "RemoveMember").Msgf("%v: %v removed from %v", userID, memberID, orgID)
+	return nil
+}
+
+// helper: keepOwner rejects taking the owner role from the last owner.
+func (s *service) keepOwner(ctx context.Context, tx pgx.Tx, orgID uuid.UUID, target, role string) error {
+	if target != auth.RoleOwner || role == auth.RoleOwner {
+		return nil
+	}
+
+	owners, err := s.repo.CountOwners(ctx, tx, orgID)
+	if err != nil {
+		return err
+	}
+
+	if owners <= 1 {
+		return apiutils.NewErrConflict("organization needs at least one owner")
+	}
+
+	return nil
+}
+
+// Invites the email to the organization with the role, the user registered under it sees the
+// invite among the received ones until it expires.
+func (s *service) Invite(ctx context.Context, userID, orgID uuid.UUID, req *InviteRequest) (*Invite, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "Invite").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	actor, err := s.lockRole(ctx, tx, orgID, userID, auth.ActionManage)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canAssign(actor, "", req.Role) {
+		return nil, apiutils.NewErrForbidden("role " + actor + " can not invite with this role")
+	}
+
+	member, err := s.repo.IsMemberEmail(ctx, tx, orgID, req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if member {
+		return nil, apiutils.NewErrConflict("user is already a member")
+	}
+
+	now := time.Now()
+	invite := &Invite{
+		InviteID:  uuid.New(),
+		OrgID:     orgID,
+		Email:     req.Email,
+		Role:      req.Role,
+		InvitedBy: userID,
+		Created:   now,
+		Expires:   now.AddDate(0, 0, inviteExpiryDays),
+	}
+
+	if err := s.repo.CreateInvite(ctx, tx, invite); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "Invite").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	log.Info().Str("location", "Invite").Msgf("%v: invited %v to %v as %v", userID, req.Email, orgID, req.Role)
+	return invite, nil
+}
+
+func (s *service) GetInvites(ctx context.Context, orgID uuid.UUID, params *pagination.Params) (*pagination.Page[*Invite], error) {
+	invites, err := s.repo.GetInvites(ctx, orgID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, invites, func(invite *Invite) (string, uuid.UUID) {
+		return invite.Created.Format(time.RFC3339Nano), invite.InviteID
+	})
+}
+
+func (s *service) GetReceivedInvites(ctx context.Context, userID uuid.UUID) ([]*Invite, error) {
+	return s.repo.GetReceivedInvites(ctx, userID)
+}
+
+// Withdraws a pending invite of the organization.
+func (s *service) RevokeInvite(ctx context.Context, userID, orgID, inviteID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "RevokeInvite").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := s.lockRole(ctx, tx, orgID, userID, auth.ActionManage); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteInvite(ctx, tx, orgID, inviteID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "RevokeInvite").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Accepts an invite sent to the user, the organization key is sealed to the user's keypair by
+// opening it with the key of an owner.
+func (s *service) AcceptInvite(ctx context.Context, userID, inviteID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "AcceptInvite").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	invite, err := s.repo.GetReceivedInvite(ctx, tx, inviteID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.LockOrg(ctx, tx, invite.OrgID); err != nil {
+		return err
+	}
+
+	member, err := s.repo.IsMemberEmail(ctx, tx, invite.OrgID, invite.Email)
+	if err != nil {
+		return err
+	}
+
+	if member {
+		return apiutils.NewErrConflict("user is already a member")
+	}
+
+	ownerID, err := s.repo.GetOwnerID(ctx, tx, invite.OrgID)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := s.keys.GrantOrgKey(ctx, invite.OrgID, ownerID, userID)
+	if err != nil {
+		return err
+	}
+
+	joined := &Member{UserID: userID, Email: invite.Email, Role: invite.Role, SealedKey: sealed, Joined: time.Now()}
+	if err := s.repo.AddMember(ctx, tx, invite.OrgID, joined); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteInvite(ctx, tx, invite.OrgID, invite.InviteID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "AcceptInvite").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	log.Info().Str("location", "AcceptInvite").Msgf("%v: joined %v as %v", userID, invite.OrgID, invite.Role)
+	return nil
+}
+
+// Declines an invite sent to the user.
+func (s *service) DeclineInvite(ctx context.Context, userID, inviteID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "DeclineInvite").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	invite, err := s.repo.GetReceivedInvite(ctx, tx, inviteID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteInvite(ctx, tx, invite.OrgID, invite.InviteID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "DeclineInvite").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package passwords
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/pkg/pagination"
+)
+
+// Shares and emergency access live in packages of their own and reach the owner's entries only
+// through the methods below, the data keys and private keys never leave this package. Keys they
+// hand in are sealed to the keypair of a user, keys they get back were sealed by them.
+
+// ErrRingOutdated reports a sealed key ring older than the owner's data key, it has to be sealed again.
+var ErrRingOutdated = errors.New("sealed key ring is outdated")
+
+// WriteHook runs after a write to the owner's entries committed, with the entries written and the
+// categories they are filed in.
+type WriteHook func(ctx context.Context, ownerID uuid.UUID, passwordIDs, categoryIDs []uuid.UUID)
+
+// Registers a hook run after every write to an owner's entries, hooks are registered at startup.
+func (s *service) OnWrite(hook WriteHook) {
+	s.writeHooks = append(s.writeHooks, hook)
+}
+
+// helper: afterWrite runs the write hooks once a write to the owner's entries committed.
+func (s *service) afterWrite(ctx context.Context, ownerID uuid.UUID, passwordIDs, categoryIDs []uuid.UUID) {
+	for _, hook := range s.writeHooks {
+		hook(ctx, ownerID, passwordIDs, categoryIDs)
+	}
+}
+
+// Creates the user's keypair if it has none yet.
+func (s *service) EnsureKeyPair(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.ensureKeyPair(ctx, userID)
+	return err
+}
+
+// Seals the key to the keypair of the user, who has to hold one already.
+func (s *service) SealToUser(ctx context.Context, userID uuid.UUID, key, aad []byte) ([]byte, error) {
+	vault, err := s.loadVault(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vault.PublicKey) == 0 {
+		return nil, apiutils.NewErrConflict("user has no keypair")
+	}
+
+	sealed, err := sealKey(vault.PublicKey, key, aad)
+	if err != nil {
+		log.Error().Str("location", "SealToUser").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return sealed, nil
+}
+
+// Opens a key sealed to the keypair of the user.
+func (s *service) OpenAsUser(ctx context.Context, userID uuid.UUID, sealed, aad []byte) ([]byte, error) {
+	_, ring, err := s.vaultKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ring == nil || ring.private == nil {
+		return nil, apiutils.NewErrConflict("user has no keypair")
+	}
+
+	key, err := openKey(ring.private, sealed, aad)
+	if err != nil {
+		log.Error().Str("location", "OpenAsUser").Msgf("%v: failed to open sealed key: %v", userID, err)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Locks the owner's vault for the rest of the transaction, its mode can not change until it ends.
+func (s *service) LockVault(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID) (*Vault, error) {
+	return s.repo.LockVault(ctx, tx, ownerID, false)
+}
+
+// Migrates the owner's vault before a WriteShared, which can not migrate it behind the vault lock.
+func (s *service) PrepareVault(ctx context.Context, ownerID uuid.UUID) error {
+	_, err := s.prepareVault(ctx, ownerID)
+	return err
+}
+
+// Decrypts the owner's active entries filed in the categories, only the entry when one is given.
+func (s *service) SharedEntries(ctx context.Context, ownerID uuid.UUID, passwordID *uuid.UUID, categoryIDs []uuid.UUID) ([]*Password, error) {
+	vault, ring, err := s.vaultKey(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Mode == ClientMode {
+		return nil, apiutils.NewErrConflict("client side encrypted vaults can not be shared")
+	}
+
+	// only the rows of the share are read and decrypted
+	passwords, err := s.repo.GetFiledPasswords(ctx, ownerID, passwordID, categoryIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return openAll(vault, ring, passwords)
+}
+
+// Writes an edit of the owner's entry made by someone else in the transaction, which holds the
+// vault lock. The entry keeps a revision and stays in the category the owner filed it in.
+func (s *service) WriteShared(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID, psw *Password) error {
+	vault, ring, err := s.vaultKey(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+
+	if vault.Mode == ClientMode || ring.legacy {
+		return apiutils.NewErrConflict("vault is not prepared for shared writes")
+	}
+
+	current, err := s.repo.GetPasswordForUpdate(ctx, tx, ownerID, psw.PasswordID, psw.CategoryID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.addRevision(ctx, tx, current); err != nil {
+		return err
+	}
+
+	// shared copies are served without the otp secret, updates leaving it out keep the stored one
+	if psw.OTP != nil && psw.OTP.Secret == "" {
+		if err := keepOTPSecret(vault, ring, current, psw); err != nil {
+			return err
+		}
+	}
+
+	psw.UserID, psw.CategoryID = ownerID, current.CategoryID
+	data, err := seal(vault, ring, psw)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.UpdatePassword(ctx, tx, data)
+}
+
+// Seals the owner's data keys to the keypair of the user, returning the sealed ring and its version.
+func (s *service) SealVaultKeys(ctx context.Context, ownerID, userID uuid.UUID, aad []byte) ([]byte, int, error) {
+	_, ring, err := s.prepareVaultKey(ctx, ownerID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the server can not hand out keys it does not hold
+	if ring == nil {
+		return nil, 0, apiutils.NewErrConflict("client side encrypted vaults can not be opened by the server")
+	}
+
+	sealed, err := s.SealToUser(ctx, userID, encodeRing(ring), aad)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return sealed, ring.version, nil
+}
+
+// Lists the owner's entries matching the filter with the data keys sealed to the user by
+// SealVaultKeys, ErrRingOutdated is returned once the owner's vault was rekeyed since.
+func (s *service) OpenSealedVault(ctx context.Context, ownerID, userID uuid.UUID, sealed, aad []byte, filter *ListFilter, params *pagination.Params) (*pagination.Page[*Password], error) {
+	vault, err := s.repo.GetVault(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Mode == ClientMode {
+		return nil, apiutils.NewErrConflict("client side encrypted vaults can not be opened by the server")
+	}
+
+	data, err := s.OpenAsUser(ctx, userID, sealed, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	ring, err := decodeRing(data)
+	if err != nil {
+		log.Error().Str("location", "OpenSealedVault").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	if ring.version != vault.KeyVersion {
+		return nil, ErrRingOutdated
+	}
+
+	query, args, err := buildListQuery(ownerID, filter, params)
+	if err != nil {
+		return nil, err
+	}
+
+	passwords, err := s.repo.ListPasswords(ctx, ownerID, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	opened, err := openAll(vault, ring, passwords)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, opened, func(psw *Password) (string, uuid.UUID) {
+		return sortValue(psw, params.Sort), psw.PasswordID
+	})
+}
+
+// helper: encodeRing serializes the data keys of the ring as a 4 byte version followed by the key
+// for each version, the private key is never handed out.
+func encodeRing(ring *keyRing) []byte {
+	versions := make([]int, 0, len(ring.keys))
+	for version := range ring.keys {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	data := []byte{}
+	for _, version := range versions {
+		data = binary.BigEndian.AppendUint32(data, uint32(version))
+		data = append(data, ring.keys[version]...)
+	}
+
+	return data
+}
+
+// helper: decodeRing parses a ring serialized by encodeRing, the newest key is the current one.
+func decodeRing(data []byte) (*keyRing, error) {
+	if len(data) == 0 || len(data)%(4+keySize) != 0 {
+		return nil, errors.New("malformed key ring")
+	}
+
+	ring := &keyRing{keys: map[int][]byte{}}
+	for ; len(data) > 0; data = data[4+keySize:] {
+		version := int(binary.BigEndian.Uint32(data))
+		ring.keys[version] = append([]byte{}, data[4:4+keySize]...)
+		if version > ring.version {
+			ring.version = version
+		}
+	}
+
+	return ring, nil
+}
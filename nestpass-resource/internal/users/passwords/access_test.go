@@ -0,0 +1,28 @@
+package passwords
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_EncodeRing(t *testing.T) {
+	prev, curr := bytes.Repeat([]byte{1}, keySize), bytes.Repeat([]byte{2}, keySize)
+	ring := &keyRing{version: 3, keys: map[int][]byte{2: prev, 3: curr}, private: bytes.Repeat([]byte{9}, 32)}
+
+	decoded, err := decodeRing(encodeRing(ring))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.version != 3 || !bytes.Equal(decoded.keys[2], prev) || !bytes.Equal(decoded.keys[3], curr) {
+		t.Errorf("ring did not survive encoding: %+v", decoded)
+	}
+
+	if decoded.private != nil {
+		t.Error("private key must not be encoded")
+	}
+
+	if _, err := decodeRing(encodeRing(ring)[:10]); err == nil {
+		t.Error("expected truncated ring to fail")
+	}
+}
@@ -0,0 +1,276 @@
+package passwords
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Archive format of vault exports, protected by a passphrase the user picks on export:
+//
+//	magic "NPEX" (4 bytes) | version (1 byte) | header length (2 bytes) | header json
+//	chunk length (4 bytes) | ciphertext and tag
+//	...
+//
+// The header holds the key derivation parameters of the passphrase and a random nonce prefix.
+// The payload is split into chunks sealed with AES-256-GCM, the nonce of a chunk is the prefix,
+// the chunk counter (4 bytes) and a flag set on the last chunk (1 byte). Every chunk
+// authenticates the raw header, so reordered, truncated or tampered archives fail to open.
+// The payload is the json described by vaultArchive.
+const (
+	ArchiveV1 byte = 1
+
+	archiveMagic         = "NPEX"
+	archiveNoncePrefix   = 7
+	archiveChunkSize     = 64 * 1024
+	archiveMaxHeaderSize = 4 * 1024
+)
+
+// bounds of the key derivation parameters an archive may ask for, a few times the default policy
+// since imports derive in the same slots as vault keys
+const (
+	archiveMaxMemory           = 256 * 1024 // KiB
+	archiveMaxArgon2Iterations = 10
+	archiveMaxParallelism      = 8
+	archiveMaxPBKDF2Iterations = 2000000
+)
+
+type archiveHeader struct {
+	KDF         *KDFParams `json:"kdf"`
+	NoncePrefix []byte     `json:"nonce_prefix"`
+}
+
+// helper: archiveCipher derives the archive key from the passphrase.
+func archiveCipher(ctx context.Context, passphrase string, params *KDFParams) (cipher.AEAD, error) {
+	key, err := kdfSlots.Derive(ctx, params, []byte(passphrase))
+	if err != nil {
+		return nil, err
+	}
+
+	return newGCMBlock(key)
+}
+
+// helper: checkArchiveKDF rejects parameters below the policy minimums or costly enough to stall the server.
+func checkArchiveKDF(params *KDFParams) error {
+	if params == nil {
+		return errors.New("missing kdf parameters")
+	}
+
+	if _, err := NewKDFPolicy(params.Algorithm, params.Memory, params.Iterations, params.Parallelism); err != nil {
+		return err
+	}
+
+	switch params.Algorithm {
+	case KDFArgon2id:
+		if params.Memory > archiveMaxMemory || params.Iterations > archiveMaxArgon2Iterations || params.Parallelism > archiveMaxParallelism {
+			return errors.New("kdf parameters exceed the supported limits")
+		}
+	case KDFPBKDF2:
+		if params.Iterations > archiveMaxPBKDF2Iterations {
+			return errors.New("kdf parameters exceed the supported limits")
+		}
+	}
+
+	return nil
+}
+
+// helper: chunkNonce builds the nonce of the chunk.
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 0, archiveNoncePrefix+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if last {
+		return append(nonce, 1)
+	}
+
+	return append(nonce, 0)
+}
+
+// Encrypts everything written to it into an archive, Close seals the last chunk.
+type archiveWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	buf     []byte
+	counter uint32
+}
+
+// Writes the archive header and returns a writer for the payload.
+func newArchiveWriter(ctx context.Context, w io.Writer, passphrase string, policy *KDFParams) (*archiveWriter, error) {
+	params, err := policy.withSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, archiveNoncePrefix)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		log.Error().Str("location", "newArchiveWriter").Msg(err.Error())
+		return nil, err
+	}
+
+	aead, err := archiveCipher(ctx, passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+
+	rawHeader, err := json.Marshal(&archiveHeader{KDF: params, NoncePrefix: prefix})
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(archiveMagic), ArchiveV1)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(rawHeader)))
+	header = append(header, rawHeader...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &archiveWriter{w: w, aead: aead, header: header, prefix: prefix}, nil
+}
+
+func (a *archiveWriter) Write(p []byte) (int, error) {
+	a.buf = append(a.buf, p...)
+	for len(a.buf) > archiveChunkSize {
+		if err := a.seal(a.buf[:archiveChunkSize], false); err != nil {
+			return 0, err
+		}
+
+		a.buf = a.buf[archiveChunkSize:]
+	}
+
+	return len(p), nil
+}
+
+func (a *archiveWriter) Close() error {
+	return a.seal(a.buf, true)
+}
+
+// helper: seal encrypts and writes one chunk.
+func (a *archiveWriter) seal(chunk []byte, last bool) error {
+	sealed := a.aead.Seal(nil, chunkNonce(a.prefix, a.counter, last), chunk, a.header)
+	a.counter++
+
+	if err := binary.Write(a.w, binary.BigEndian, uint32(len(sealed))); err != nil {
+		return err
+	}
+
+	_, err := a.w.Write(sealed)
+	return err
+}
+
+// Decrypts the payload of an archive chunk by chunk.
+type archiveReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	buf     []byte
+	counter uint32
+	done    bool
+}
+
+var errArchivePassphrase = errors.New("wrong passphrase or corrupted archive")
+
+// Reads the archive header and derives the key from the passphrase.
+func newArchiveReader(ctx context.Context, r io.Reader, passphrase string) (*archiveReader, error) {
+	prefix := make([]byte, len(archiveMagic)+3)
+	if _, err := io.ReadFull(r, prefix); err != nil || string(prefix[:len(archiveMagic)]) != archiveMagic {
+		return nil, errors.New("not a nestpass archive")
+	}
+
+	if prefix[len(archiveMagic)] != ArchiveV1 {
+		return nil, errors.New("unsupported archive version")
+	}
+
+	size := binary.BigEndian.Uint16(prefix[len(archiveMagic)+1:])
+	if size > archiveMaxHeaderSize {
+		return nil, errors.New("archive header is too large")
+	}
+
+	rawHeader := make([]byte, size)
+	if _, err := io.ReadFull(r, rawHeader); err != nil {
+		return nil, errors.New("archive header is truncated")
+	}
+
+	header := &archiveHeader{}
+	if err := json.Unmarshal(rawHeader, header); err != nil {
+		return nil, errors.New("invalid archive header")
+	}
+
+	if len(header.NoncePrefix) != archiveNoncePrefix {
+		return nil, errors.New("invalid archive nonce")
+	}
+
+	if err := checkArchiveKDF(header.KDF); err != nil {
+		return nil, err
+	}
+
+	aead, err := archiveCipher(ctx, passphrase, header.KDF)
+	if err != nil {
+		return nil, err
+	}
+
+	return &archiveReader{
+		r:      r,
+		aead:   aead,
+		header: append(prefix, rawHeader...),
+		prefix: header.NoncePrefix,
+	}, nil
+}
+
+func (a *archiveReader) Read(p []byte) (int, error) {
+	for len(a.buf) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+
+		if err := a.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, a.buf)
+	a.buf = a.buf[n:]
+	return n, nil
+}
+
+// helper: open reads and decrypts the next chunk.
+func (a *archiveReader) open() error {
+	var size uint32
+	if err := binary.Read(a.r, binary.BigEndian, &size); err != nil {
+		return errors.New("archive is truncated")
+	}
+
+	if size > archiveChunkSize+uint32(a.aead.Overhead()) {
+		return errors.New("archive chunk is too large")
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(a.r, sealed); err != nil {
+		return errors.New("archive is truncated")
+	}
+
+	// the chunk is either the last one or not, only one of the nonces can open it
+	chunk, err := a.aead.Open(nil, chunkNonce(a.prefix, a.counter, false), sealed, a.header)
+	if err != nil {
+		if chunk, err = a.aead.Open(nil, chunkNonce(a.prefix, a.counter, true), sealed, a.header); err != nil {
+			return errArchivePassphrase
+		}
+
+		a.done = true
+		if n, _ := a.r.Read(make([]byte, 1)); n != 0 {
+			return errors.New("unexpected data after the archive")
+		}
+	}
+
+	a.counter++
+	a.buf = chunk
+	return nil
+}
@@ -0,0 +1,503 @@
+package passwords
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/storage"
+	"nestpass/pkg/pagination"
+)
+
+// Attachment blobs hold the file split into chunks sealed with AES-256-GCM under the attachment's
+// file key. Chunks hold attachmentChunkSize bytes except the last one, the nonce of a chunk is
+// the attachment's random prefix, the chunk counter and a flag set on the last chunk, as in
+// export archives. Every chunk authenticates the attachment id, so blobs can not be swapped,
+// reordered or truncated without failing to open.
+const (
+	attachmentChunkSize  = 64 * 1024
+	attachmentNameSize   = 255
+	attachmentSweepBatch = 100
+)
+
+var errAttachmentTooLarge = errors.New("attachment is too large")
+
+// Blob storage of attachments and its limits in bytes.
+type attachmentStore struct {
+	blobs   storage.BlobStore
+	maxSize int64 // of a single attachment
+	quota   int64 // of all attachments of an owner
+}
+
+func NewAttachmentStore(blobs storage.BlobStore, maxSizeMB, quotaMB int) *attachmentStore {
+	return &attachmentStore{blobs: blobs, maxSize: int64(maxSizeMB) << 20, quota: int64(quotaMB) << 20}
+}
+
+// Encrypts everything written to it into attachment chunks, Close seals the last chunk.
+type attachmentWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	buf     []byte
+	counter uint32
+	size    int64
+	limit   int64
+}
+
+func newAttachmentWriter(w io.Writer, key []byte, attachment *Attachment, limit int64) (*attachmentWriter, error) {
+	aead, err := newGCMBlock(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachmentWriter{w: w, aead: aead, aad: attachment.AttachmentID[:], prefix: attachment.NoncePrefix, limit: limit}, nil
+}
+
+func (a *attachmentWriter) Write(p []byte) (int, error) {
+	if a.size += int64(len(p)); a.size > a.limit {
+		return 0, errAttachmentTooLarge
+	}
+
+	// a full chunk is kept back until more data shows it is not the last one
+	a.buf = append(a.buf, p...)
+	for len(a.buf) > attachmentChunkSize {
+		if err := a.seal(a.buf[:attachmentChunkSize], false); err != nil {
+			return 0, err
+		}
+
+		a.buf = a.buf[attachmentChunkSize:]
+	}
+
+	return len(p), nil
+}
+
+func (a *attachmentWriter) Close() error {
+	return a.seal(a.buf, true)
+}
+
+// helper: seal encrypts and writes one chunk.
+func (a *attachmentWriter) seal(chunk []byte, last bool) error {
+	sealed := a.aead.Seal(nil, chunkNonce(a.prefix, a.counter, last), chunk, a.aad)
+	a.counter++
+
+	_, err := a.w.Write(sealed)
+	return err
+}
+
+// Decrypts an attachment blob chunk by chunk, the chunk layout follows from the plaintext size.
+type attachmentReader struct {
+	blob      io.ReadCloser
+	aead      cipher.AEAD
+	aad       []byte
+	prefix    []byte
+	remaining int64 // plaintext bytes still to be read from the blob
+	buf       []byte
+	counter   uint32
+	done      bool
+}
+
+var errAttachmentCorrupted = errors.New("attachment is corrupted")
+
+func newAttachmentReader(blob io.ReadCloser, key []byte, attachment *Attachment) (*attachmentReader, error) {
+	aead, err := newGCMBlock(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachmentReader{
+		blob:      blob,
+		aead:      aead,
+		aad:       attachment.AttachmentID[:],
+		prefix:    attachment.NoncePrefix,
+		remaining: attachment.Size,
+	}, nil
+}
+
+func (a *attachmentReader) Read(p []byte) (int, error) {
+	for len(a.buf) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+
+		if err := a.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, a.buf)
+	a.buf = a.buf[n:]
+	return n, nil
+}
+
+func (a *attachmentReader) Close() error {
+	return a.blob.Close()
+}
+
+// helper: open reads and decrypts the next chunk.
+func (a *attachmentReader) open() error {
+	size, last := int64(attachmentChunkSize), a.remaining <= attachmentChunkSize
+	if last {
+		size = a.remaining
+	}
+
+	sealed := make([]byte, size+int64(a.aead.Overhead()))
+	if _, err := io.ReadFull(a.blob, sealed); err != nil {
+		return errAttachmentCorrupted
+	}
+
+	chunk, err := a.aead.Open(nil, chunkNonce(a.prefix, a.counter, last), sealed, a.aad)
+	if err != nil {
+		return errAttachmentCorrupted
+	}
+
+	a.counter++
+	a.remaining -= size
+	a.buf = chunk
+
+	if last {
+		a.done = true
+		if n, _ := a.blob.Read(make([]byte, 1)); n != 0 {
+			return errAttachmentCorrupted
+		}
+	}
+
+	return nil
+}
+
+// helper: attachmentName keeps the base name of an uploaded file.
+func attachmentName(name string) (string, error) {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "" || name == "." || name == "/" {
+		return "", apiutils.NewErrBadRequest("missing attachment name")
+	}
+
+	if len(name) > attachmentNameSize {
+		return "", apiutils.NewErrBadRequest("attachment name is too long")
+	}
+
+	return name, nil
+}
+
+// Lists the attachments of the entry.
+func (s *service) GetAttachments(ctx context.Context, ownerID, passwordID, categoryID uuid.UUID, params *pagination.Params) (*pagination.Page[*Attachment], error) {
+	attachments, err := s.repo.GetAttachments(ctx, passwordID, categoryID, ownerID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, attachments, func(attachment *Attachment) (string, uuid.UUID) {
+		return attachment.Created.Format(time.RFC3339Nano), attachment.AttachmentID
+	})
+}
+
+// Retrieves the storage used by the owner's attachments.
+func (s *service) GetAttachmentUsage(ctx context.Context, ownerID uuid.UUID) (*AttachmentUsage, error) {
+	used, err := s.repo.GetAttachmentUsage(ctx, nil, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttachmentUsage{Used: used, Quota: s.attachments.quota}, nil
+}
+
+// Encrypts the content into a new blob and attaches it to the entry. The blob is written before
+// the attachment is recorded and removed again when recording it fails.
+func (s *service) UploadAttachment(ctx context.Context, ownerID, passwordID, categoryID uuid.UUID, name, contentType string, content io.Reader) (*Attachment, error) {
+	name, err := attachmentName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	vault, ring, err := s.prepareVaultKey(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Mode == ClientMode {
+		return nil, apiutils.NewErrConflict("client side encrypted vaults do not support attachments")
+	}
+
+	if _, err := s.repo.GetPassword(ctx, passwordID, categoryID, ownerID); err != nil {
+		return nil, err
+	}
+
+	used, err := s.repo.GetAttachmentUsage(ctx, nil, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := min(s.attachments.maxSize, s.attachments.quota-used)
+	if limit <= 0 {
+		return nil, apiutils.NewErrConflict("attachment quota exceeded")
+	}
+
+	attachment := &Attachment{
+		AttachmentID: uuid.New(),
+		PasswordID:   passwordID,
+		UserID:       ownerID,
+		Name:         name,
+		ContentType:  contentType,
+		KeyVersion:   ring.version,
+		NoncePrefix:  make([]byte, archiveNoncePrefix),
+		Created:      time.Now(),
+	}
+
+	if _, err := io.ReadFull(rand.Reader, attachment.NoncePrefix); err != nil {
+		log.Error().Str("location", "UploadAttachment").Msg(err.Error())
+		return nil, err
+	}
+
+	key, err := newDEK()
+	if err != nil {
+		return nil, err
+	}
+
+	if attachment.WrappedKey, err = wrapKey(ring.current(), key, attachment.AttachmentID); err != nil {
+		return nil, err
+	}
+
+	if attachment.Size, err = s.putBlob(ctx, attachment, key, content, limit); err != nil {
+		if err == errAttachmentTooLarge {
+			if limit < s.attachments.maxSize {
+				return nil, apiutils.NewErrConflict("attachment quota exceeded")
+			}
+
+			return nil, apiutils.NewErrBadRequest("attachment exceeds the maximum size")
+		}
+
+		return nil, err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			s.removeBlob(context.Background(), attachment.AttachmentID)
+		}
+	}()
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "UploadAttachment").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// uploads of the owner are serialized so the quota holds
+	locked, err := s.repo.LockVault(ctx, tx, ownerID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if locked.Mode != vault.Mode || locked.KeyVersion != ring.version {
+		return nil, apiutils.NewErrConflict("vault changed during the upload, retry the upload")
+	}
+
+	// the entry may have been trashed or purged during the upload
+	if _, err := s.repo.GetPasswordForUpdate(ctx, tx, ownerID, passwordID, categoryID); err != nil {
+		return nil, err
+	}
+
+	if used, err = s.repo.GetAttachmentUsage(ctx, tx, ownerID); err != nil {
+		return nil, err
+	}
+
+	if used+attachment.Size > s.attachments.quota {
+		return nil, apiutils.NewErrConflict("attachment quota exceeded")
+	}
+
+	if err := s.repo.CreateAttachment(ctx, tx, attachment); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "UploadAttachment").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+	committed = true
+
+	log.Info().Str("location", "UploadAttachment").Msgf("%v: attached %v bytes to %v", ownerID, attachment.Size, passwordID)
+	return attachment, nil
+}
+
+// helper: putBlob streams the content through the encrypting writer into the blob store and
+// returns the plaintext size.
+func (s *service) putBlob(ctx context.Context, attachment *Attachment, key []byte, content io.Reader, limit int64) (int64, error) {
+	pr, pw := io.Pipe()
+	writer, err := newAttachmentWriter(pw, key, attachment, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(writer, content)
+		if err == nil {
+			err = writer.Close()
+		}
+
+		pw.CloseWithError(err)
+		written <- err
+	}()
+
+	_, err = s.attachments.blobs.Put(ctx, attachment.AttachmentID.String(), pr)
+	pr.Close()
+
+	// the writer's error explains why the store stopped reading
+	if writeErr := <-written; writeErr != nil {
+		return 0, writeErr
+	}
+
+	if err != nil {
+		log.Error().Str("location", "putBlob").Msgf("%v: %v", attachment.UserID, err)
+		return 0, err
+	}
+
+	return writer.size, nil
+}
+
+// Opens the attachment for a streaming download, each chunk is authenticated as it is read.
+func (s *service) OpenAttachment(ctx context.Context, ownerID, attachmentID uuid.UUID) (*Attachment, io.ReadCloser, error) {
+	attachment, err := s.repo.GetAttachment(ctx, attachmentID, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, ring, err := s.vaultKey(ctx, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dek, err := ring.get(attachment.KeyVersion)
+	if err != nil {
+		log.Error().Str("location", "OpenAttachment").Msgf("%v: %v: %v", ownerID, attachmentID, err)
+		return nil, nil, err
+	}
+
+	key, err := unwrapKey(dek, attachment.WrappedKey, attachment.AttachmentID)
+	if err != nil {
+		log.Error().Str("location", "OpenAttachment").Msgf("%v: failed to unwrap key of %v: %v", ownerID, attachmentID, err)
+		return nil, nil, err
+	}
+
+	blob, err := s.attachments.blobs.Get(ctx, attachment.AttachmentID.String())
+	if err != nil {
+		if err == storage.ErrBlobNotFound {
+			log.Error().Str("location", "OpenAttachment").Msgf("%v: blob of %v is missing", ownerID, attachmentID)
+			return nil, nil, apiutils.NewErrNotFound("attachment content not found")
+		}
+
+		return nil, nil, err
+	}
+
+	reader, err := newAttachmentReader(blob, key, attachment)
+	if err != nil {
+		blob.Close()
+		return nil, nil, err
+	}
+
+	return attachment, reader, nil
+}
+
+// Deletes the attachment and removes its blob.
+func (s *service) DeleteAttachment(ctx context.Context, ownerID, attachmentID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "DeleteAttachment").Msgf("%v: %v", ownerID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.repo.DeleteAttachment(ctx, tx, attachmentID, ownerID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "DeleteAttachment").Msgf("%v: %v", ownerID, err)
+		return err
+	}
+
+	// left queued for the sweeper when the store is unavailable
+	s.removeBlob(ctx, attachmentID)
+	return nil
+}
+
+// Removes the blobs of attachments deleted with their entries, categories or organizations,
+// returns the number of blobs removed.
+func (s *service) SweepBlobs(ctx context.Context) (int, error) {
+	removed := 0
+	for {
+		queued, err := s.repo.GetQueuedBlobs(ctx, attachmentSweepBatch)
+		if err != nil {
+			return removed, err
+		}
+
+		failed := false
+		for _, attachmentID := range queued {
+			if err := s.removeBlob(ctx, attachmentID); err != nil {
+				failed = true
+				continue
+			}
+
+			removed++
+		}
+
+		// failed blobs stay queued for the next sweep
+		if failed || len(queued) < attachmentSweepBatch {
+			return removed, nil
+		}
+	}
+}
+
+// helper: removeBlob removes the blob and takes it off the deletion queue.
+func (s *service) removeBlob(ctx context.Context, attachmentID uuid.UUID) error {
+	if err := s.attachments.blobs.Delete(ctx, attachmentID.String()); err != nil {
+		log.Error().Str("location", "removeBlob").Msgf("%v: %v", attachmentID, err)
+		return err
+	}
+
+	return s.repo.DeleteQueuedBlob(ctx, attachmentID)
+}
+
+// helper: rekeyAttachments rewraps the file keys of a batch of attachments not wrapped with the
+// job's data key, returning how many it rewrapped. The blobs are left as they are.
+func (s *service) rekeyAttachments(ctx context.Context, tx pgx.Tx, job *RekeyJob, ring *keyRing, limit int) (int, error) {
+	attachments, err := s.repo.GetStaleAttachments(ctx, tx, job.UserID, job.ToVersion, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, attachment := range attachments {
+		oldKey, err := ring.get(attachment.KeyVersion)
+		if err != nil {
+			return 0, err
+		}
+
+		key, err := unwrapKey(oldKey, attachment.WrappedKey, attachment.AttachmentID)
+		if err != nil {
+			log.Error().Str("location", "rekeyAttachments").Msgf("%v: failed to unwrap key of %v: %v", job.UserID, attachment.AttachmentID, err)
+			return 0, err
+		}
+
+		if attachment.WrappedKey, err = wrapKey(ring.current(), key, attachment.AttachmentID); err != nil {
+			return 0, err
+		}
+
+		attachment.KeyVersion = ring.version
+		if err := s.repo.UpdateAttachmentKey(ctx, tx, attachment); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(attachments), nil
+}
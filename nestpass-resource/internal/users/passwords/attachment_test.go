@@ -0,0 +1,144 @@
+package passwords
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// helper: sealAttachment encrypts the content as an attachment blob.
+func sealAttachment(t *testing.T, key []byte, attachment *Attachment, content []byte) []byte {
+	t.Helper()
+
+	blob := &bytes.Buffer{}
+	writer, err := newAttachmentWriter(blob, key, attachment, int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := writer.Write(content); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	attachment.Size = writer.size
+	return blob.Bytes()
+}
+
+// helper: openAttachment decrypts an attachment blob.
+func openAttachment(key []byte, attachment *Attachment, blob []byte) ([]byte, error) {
+	reader, err := newAttachmentReader(io.NopCloser(bytes.NewReader(blob)), key, attachment)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+func newTestAttachment(t *testing.T) ([]byte, *Attachment) {
+	t.Helper()
+
+	key, err := newDEK()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := make([]byte, archiveNoncePrefix)
+	rand.Read(prefix)
+	return key, &Attachment{AttachmentID: uuid.New(), NoncePrefix: prefix}
+}
+
+func Test_AttachmentRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, attachmentChunkSize - 1, attachmentChunkSize, attachmentChunkSize + 1, 3*attachmentChunkSize + 17}
+
+	for _, size := range sizes {
+		key, attachment := newTestAttachment(t)
+		content := make([]byte, size)
+		rand.Read(content)
+
+		blob := sealAttachment(t, key, attachment, content)
+		got, err := openAttachment(key, attachment, blob)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+
+		if !bytes.Equal(got, content) {
+			t.Errorf("size %d: content does not match", size)
+		}
+	}
+}
+
+func Test_AttachmentIntegrity(t *testing.T) {
+	key, attachment := newTestAttachment(t)
+	content := make([]byte, 2*attachmentChunkSize+100)
+	rand.Read(content)
+	blob := sealAttachment(t, key, attachment, content)
+
+	tampered := bytes.Clone(blob)
+	tampered[attachmentChunkSize+40] ^= 1
+
+	chunk := attachmentChunkSize + 16
+	reordered := append(append(bytes.Clone(blob[chunk:2*chunk]), blob[:chunk]...), blob[2*chunk:]...)
+
+	swapped := *attachment
+	swapped.AttachmentID = uuid.New()
+
+	cases := map[string]struct {
+		attachment *Attachment
+		blob       []byte
+	}{
+		"tampered":  {attachment, tampered},
+		"reordered": {attachment, reordered},
+		"truncated": {attachment, blob[:2*chunk]},
+		"trailing":  {attachment, append(bytes.Clone(blob), 0)},
+		"swapped":   {&swapped, blob},
+	}
+
+	for name, c := range cases {
+		if _, err := openAttachment(key, c.attachment, c.blob); err != errAttachmentCorrupted {
+			t.Errorf("%s: got %v, want %v", name, err, errAttachmentCorrupted)
+		}
+	}
+}
+
+func Test_AttachmentLimit(t *testing.T) {
+	key, attachment := newTestAttachment(t)
+	writer, err := newAttachmentWriter(io.Discard, key, attachment, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := writer.Write(make([]byte, 11)); err != errAttachmentTooLarge {
+		t.Errorf("got %v, want %v", err, errAttachmentTooLarge)
+	}
+}
+
+func Test_AttachmentName(t *testing.T) {
+	cases := map[string]string{
+		"report.pdf":             "report.pdf",
+		"../../etc/passwd":       "passwd",
+		`C:\Users\me\scan.png`:   "scan.png",
+		"  spaced name.txt ":     "spaced name.txt",
+		"dir/sub/archive.tar.gz": "archive.tar.gz",
+	}
+
+	for raw, want := range cases {
+		got, err := attachmentName(raw)
+		if err != nil || got != want {
+			t.Errorf("%q: got %q, %v, want %q", raw, got, err, want)
+		}
+	}
+
+	for _, raw := range []string{"", "/", ".", "  "} {
+		if _, err := attachmentName(raw); err == nil {
+			t.Errorf("%q: expected an error", raw)
+		}
+	}
+}
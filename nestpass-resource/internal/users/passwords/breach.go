@@ -0,0 +1,98 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// length of the sha1 prefix naming a range file, as in the pwned passwords range api
+const breachPrefixSize = 5
+
+// Local copy of a breached password corpus split into range files the way the pwned passwords
+// range api serves it: the file of a prefix (ABCDE.txt or ABCDE) lists the remaining hex digits
+// of every breached sha1 hash starting with it as SUFFIX:COUNT lines. Passwords are only looked
+// up by the prefix of their hash, so the corpus can be shared without knowing what is checked.
+type breachCorpus struct {
+	dir string
+}
+
+func NewBreachCorpus(dir string) *breachCorpus {
+	return &breachCorpus{dir: dir}
+}
+
+// helper: breachHash returns the uppercase hex sha1 of the password.
+func breachHash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Returns how often each of the hashes appears in the corpus, hashes that are not breached are left out.
+// Hashes sharing a prefix are resolved with one read of its range file.
+func (b *breachCorpus) counts(hashes []string) (map[string]int, error) {
+	ranges := map[string]map[string]bool{}
+	for _, hash := range hashes {
+		prefix := hash[:breachPrefixSize]
+		if ranges[prefix] == nil {
+			ranges[prefix] = map[string]bool{}
+		}
+		ranges[prefix][hash[breachPrefixSize:]] = true
+	}
+
+	counts := map[string]int{}
+	for prefix, suffixes := range ranges {
+		if err := b.scanRange(prefix, suffixes, counts); err != nil {
+			log.Error().Str("location", "breachCorpus.counts").Msgf("%v: %v", prefix, err)
+			return nil, err
+		}
+	}
+
+	return counts, nil
+}
+
+// helper: scanRange reads the range file of the prefix and records the counts of the wanted suffixes.
+func (b *breachCorpus) scanRange(prefix string, suffixes map[string]bool, counts map[string]int) error {
+	file, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err = os.Open(filepath.Join(b.dir, prefix))
+	}
+
+	// prefixes without a file have no breached hashes
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		suffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		suffix = strings.ToUpper(suffix)
+		if !ok || !suffixes[suffix] {
+			continue
+		}
+
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return err
+		}
+
+		// padded responses list fake suffixes with a zero count
+		if n > 0 {
+			counts[prefix+suffix] = n
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,142 @@
+package passwords
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Envelope format for entries sealed by clients in client side encryption mode. The whole entry,
+// website included, is sealed. The server only checks the header and never holds the key:
+//
+//	version (1 byte) | algorithm (1 byte) | nonce | ciphertext and tag
+const (
+	EnvelopeV1 byte = 1
+
+	EnvelopeAES256GCM         byte = 1
+	EnvelopeXChaCha20Poly1305 byte = 2
+
+	envelopeHeaderSize = 2
+	envelopeTagSize    = 16
+	envelopeMaxSize    = 64 * 1024
+)
+
+// Parsed client side encryption envelope.
+type Envelope struct {
+	Version    byte
+	Algorithm  byte
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// helper: nonceSize returns the nonce size of the envelope algorithm.
+func nonceSize(algorithm byte) (int, error) {
+	switch algorithm {
+	case EnvelopeAES256GCM:
+		return 12, nil
+	case EnvelopeXChaCha20Poly1305:
+		return chacha20poly1305.NonceSizeX, nil
+	}
+
+	return 0, errors.New("unsupported envelope algorithm")
+}
+
+// Parses and validates the envelope header without decrypting it.
+func ParseEnvelope(data []byte) (*Envelope, error) {
+	if len(data) < envelopeHeaderSize {
+		return nil, errors.New("envelope is too short")
+	}
+
+	if len(data) > envelopeMaxSize {
+		return nil, errors.New("envelope is too large")
+	}
+
+	if data[0] != EnvelopeV1 {
+		return nil, errors.New("unsupported envelope version")
+	}
+
+	size, err := nonceSize(data[1])
+	if err != nil {
+		return nil, err
+	}
+
+	body := data[envelopeHeaderSize:]
+	if len(body) < size+envelopeTagSize {
+		return nil, errors.New("envelope is too short")
+	}
+
+	return &Envelope{
+		Version:    data[0],
+		Algorithm:  data[1],
+		Nonce:      body[:size],
+		Ciphertext: body[size:],
+	}, nil
+}
+
+// Serializes the envelope.
+func (e *Envelope) Bytes() []byte {
+	data := make([]byte, 0, envelopeHeaderSize+len(e.Nonce)+len(e.Ciphertext))
+	data = append(data, e.Version, e.Algorithm)
+	data = append(data, e.Nonce...)
+	return append(data, e.Ciphertext...)
+}
+
+// helper: newEnvelopeAEAD creates the cipher for the envelope algorithm.
+func newEnvelopeAEAD(algorithm byte, key []byte) (cipher.AEAD, error) {
+	var aead cipher.AEAD
+	switch algorithm {
+	case EnvelopeAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	case EnvelopeXChaCha20Poly1305:
+		var err error
+		if aead, err = chacha20poly1305.NewX(key); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported envelope algorithm")
+	}
+
+	return aead, nil
+}
+
+// Seals the plaintext into a new envelope. Reference implementation for clients,
+// the server never holds the key of a client side encrypted vault.
+func SealEnvelope(algorithm byte, key, plaintext, additionalData []byte) (*Envelope, error) {
+	aead, err := newEnvelopeAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		Version:    EnvelopeV1,
+		Algorithm:  algorithm,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, additionalData),
+	}, nil
+}
+
+// Opens the envelope with the given key. Reference implementation for clients.
+func (e *Envelope) Open(key, additionalData []byte) ([]byte, error) {
+	aead, err := newEnvelopeAEAD(e.Algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, e.Nonce, e.Ciphertext, additionalData)
+}
@@ -0,0 +1,105 @@
+package passwords
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/databases/pgtest"
+)
+
+func Test_EnvelopeRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	ad := []byte("password-id")
+
+	for _, algorithm := range []byte{EnvelopeAES256GCM, EnvelopeXChaCha20Poly1305} {
+		sealed, err := SealEnvelope(algorithm, key, []byte("secret"), ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := ParseEnvelope(sealed.Bytes())
+		if err != nil {
+			t.Fatalf("algorithm %d: %v", algorithm, err)
+		}
+
+		plaintext, err := parsed.Open(key, ad)
+		if err != nil || !bytes.Equal(plaintext, []byte("secret")) {
+			t.Fatalf("algorithm %d: failed to open envelope: %v", algorithm, err)
+		}
+
+		if _, err := parsed.Open(key, []byte("other-id")); err == nil {
+			t.Fatalf("algorithm %d: envelope opened with wrong additional data", algorithm)
+		}
+	}
+}
+
+func Test_ParseEnvelopeRejectsMalformed(t *testing.T) {
+	valid, err := SealEnvelope(EnvelopeAES256GCM, make([]byte, 32), []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := valid.Bytes()
+
+	cases := map[string][]byte{
+		"empty":             {},
+		"unknown version":   append([]byte{2}, data[1:]...),
+		"unknown algorithm": append([]byte{EnvelopeV1, 9}, data[2:]...),
+		"truncated":         data[:envelopeHeaderSize+12+envelopeTagSize-1],
+		"too large":         make([]byte, envelopeMaxSize+1),
+	}
+	for name, input := range cases {
+		if _, err := ParseEnvelope(input); err == nil {
+			t.Errorf("%s: malformed envelope accepted", name)
+		}
+	}
+}
+
+func Test_SealSelectsMode(t *testing.T) {
+	envelope, _ := SealEnvelope(EnvelopeXChaCha20Poly1305, make([]byte, 32), []byte("secret"), nil)
+	sealedInput := &Password{Sealed: envelope.Bytes()}
+	plainInput := &Password{Website: "example.com", Type: ItemLogin, Login: &Login{Username: "user", Password: "psw"}}
+
+	client := &Vault{Mode: ClientMode}
+	stored, err := seal(client, nil, sealedInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored.Encrypted, sealedInput.Sealed) {
+		t.Fatal("sealed entry was not stored as is")
+	}
+	if _, err := seal(client, nil, plainInput); err == nil {
+		t.Fatal("plaintext accepted by client side encrypted vault")
+	}
+	if _, err := seal(client, nil, &Password{Website: "example.com", Sealed: envelope.Bytes()}); err == nil {
+		t.Fatal("plaintext website accepted by client side encrypted vault")
+	}
+
+	server := &Vault{Mode: ServerMode}
+	if _, err := seal(server, &keyRing{version: 1, keys: map[int][]byte{1: make([]byte, 32)}}, sealedInput); err == nil {
+		t.Fatal("sealed entry accepted by server side encrypted vault")
+	}
+}
+
+func Test_EnableClientModeRefusesOrgMembers(t *testing.T) {
+	db := &pgtest.DB{Results: map[string][][]any{
+		CountUserSharesQuery:     {{0}},
+		CountOrgMembershipsQuery: {{1}},
+	}}
+	svc := &service{repo: &repository{postgres: db}}
+
+	err := svc.EnableClientMode(context.Background(), uuid.New(), &ClientMigration{})
+	if _, ok := err.(apiutils.ErrConflict); !ok {
+		t.Fatalf("EnableClientMode() = %v, want a conflict", err)
+	}
+
+	// the keypair org keys are sealed to is left alone
+	if len(db.Executed(UpsertVaultQuery)) != 0 || db.Commits != 0 {
+		t.Fatal("vault switched to client side encryption while in an organization")
+	}
+}
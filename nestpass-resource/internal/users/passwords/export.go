@@ -0,0 +1,140 @@
+package passwords
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/users/categories"
+)
+
+// version of the archive payload
+const archivePayloadVersion = 1
+
+// Payload of an archive, the items keep their typed content in the encrypted item schema.
+//
+//	{"version": 1, "exported": "...", "categories": [...], "items": [...]}
+type vaultArchive struct {
+	Version    int                `json:"version"`
+	Exported   time.Time          `json:"exported"`
+	Categories []*archiveCategory `json:"categories"`
+	Items      []*archiveItem     `json:"items"`
+}
+
+type archiveCategory struct {
+	CategoryID  uuid.UUID  `json:"category_id"`
+	ParentID    *uuid.UUID `json:"parent_id,omitempty"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+}
+
+type archiveItem struct {
+	CategoryID uuid.UUID `json:"category_id"`
+	Website    string    `json:"website"`
+	Item       *itemData `json:"item"`
+}
+
+// Export of a vault, the entries are only decrypted while the archive is written.
+type Export struct {
+	vault      *Vault
+	ring       *keyRing
+	policy     *KDFParams
+	categories []*categories.Category
+	passwords  []*PasswordEncrypt
+}
+
+// Loads the categories and entries of a server side encrypted vault for an export.
+func (s *service) Export(ctx context.Context, userID uuid.UUID) (*Export, error) {
+	vault, ring, err := s.vaultKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Mode == ClientMode {
+		return nil, apiutils.NewErrConflict("client side encrypted vaults are exported by the client")
+	}
+
+	tree, err := s.categories.GetSubtree(ctx, userID, nil, categories.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	passwords, err := s.repo.GetAllPasswordsNonPaged(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{vault: vault, ring: ring, policy: s.kdfPolicy, categories: tree, passwords: passwords}, nil
+}
+
+// Streams the export as an archive protected by the passphrase.
+func (e *Export) WriteArchive(ctx context.Context, w io.Writer, passphrase string) error {
+	archive, err := newArchiveWriter(ctx, w, passphrase, e.policy)
+	if err != nil {
+		return err
+	}
+
+	// parents are listed before their children
+	folders := []*archiveCategory{}
+	for _, category := range categories.Flatten(e.categories) {
+		folders = append(folders, &archiveCategory{
+			CategoryID:  category.CategoryID,
+			ParentID:    category.ParentID,
+			Name:        category.Name,
+			Description: category.Description,
+		})
+	}
+
+	exported, err := json.Marshal(time.Now())
+	if err != nil {
+		return err
+	}
+
+	rawCategories, err := json.Marshal(folders)
+	if err != nil {
+		return err
+	}
+
+	// the items are written one at a time so only one of them is held decrypted
+	_, err = fmt.Fprintf(archive, `{"version":%d,"exported":%s,"categories":%s,"items":[`, archivePayloadVersion, exported, rawCategories)
+	if err != nil {
+		return err
+	}
+
+	for i, password := range e.passwords {
+		psw, err := open(e.vault, e.ring, password)
+		if err != nil {
+			return err
+		}
+
+		item, err := json.Marshal(&archiveItem{CategoryID: psw.CategoryID, Website: psw.Website, Item: newItemData(psw)})
+		if err != nil {
+			return err
+		}
+
+		if i != 0 {
+			item = append([]byte(","), item...)
+		}
+
+		if _, err := archive.Write(item); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(archive, "]}"); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Error().Str("location", "WriteArchive").Msgf("%v: %v", e.vault.UserID, err)
+		return err
+	}
+
+	return nil
+}
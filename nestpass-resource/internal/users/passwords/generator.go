@@ -0,0 +1,282 @@
+package passwords
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+)
+
+// Kinds of generated values.
+const (
+	GeneratePassword   = "password"
+	GeneratePassphrase = "passphrase"
+)
+
+// Character classes of generated passwords.
+const (
+	ClassLower   = "lower"
+	ClassUpper   = "upper"
+	ClassDigits  = "digits"
+	ClassSymbols = "symbols"
+)
+
+var generatorClasses = map[string]string{
+	ClassLower:   "abcdefghijklmnopqrstuvwxyz",
+	ClassUpper:   "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	ClassDigits:  "0123456789",
+	ClassSymbols: "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+}
+
+// characters that are easily confused when a password is read or typed by hand
+const ambiguousChars = "Il1|O0o`'\""
+
+// EFF large wordlist (CC BY 3.0 US, https://www.eff.org/dice), one "roll<TAB>word" per line.
+//
+//go:embed eff_large_wordlist.txt
+var rawWordlist string
+
+var wordlist = sync.OnceValue(func() []string {
+	words := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(rawWordlist), "\n") {
+		if _, word, ok := strings.Cut(line, "\t"); ok {
+			words = append(words, word)
+		}
+	}
+
+	return words
+})
+
+const (
+	defaultGenerateLength = 20
+	defaultGenerateWords  = 6
+	defaultSeparator      = "-"
+)
+
+// Policy a password or passphrase is generated with, unset fields take the defaults.
+type GeneratorPolicy struct {
+	Kind   string `json:"kind" validate:"omitempty,oneof=password passphrase"`
+	Length int    `json:"length" validate:"omitempty,min=8,max=128"`
+	// classes drawn from, each with the number of characters it has to contribute at least
+	Classes          map[string]int `json:"classes" validate:"omitempty,dive,keys,oneof=lower upper digits symbols,endkeys,min=0,max=128"`
+	ExcludeAmbiguous bool           `json:"exclude_ambiguous"`
+	Exclude          string         `json:"exclude" validate:"max=64"`
+	Words            int            `json:"words" validate:"omitempty,min=3,max=20"`
+	Separator        *string        `json:"separator" validate:"omitempty,max=3"`
+	Capitalize       bool           `json:"capitalize"`
+	Number           bool           `json:"number"` // appends a digit to one of the words
+}
+
+// helper: withDefaults fills the unset fields of the policy.
+func (p *GeneratorPolicy) withDefaults() {
+	if p.Kind == "" {
+		p.Kind = GeneratePassword
+	}
+
+	if p.Length == 0 {
+		p.Length = defaultGenerateLength
+	}
+
+	if len(p.Classes) == 0 {
+		p.Classes = map[string]int{ClassLower: 1, ClassUpper: 1, ClassDigits: 1, ClassSymbols: 1}
+	}
+
+	if p.Words == 0 {
+		p.Words = defaultGenerateWords
+	}
+
+	if p.Separator == nil {
+		separator := defaultSeparator
+		p.Separator = &separator
+	}
+}
+
+// helper: charsets returns the characters of each enabled class once the exclusions are removed.
+func (p *GeneratorPolicy) charsets() (map[string]string, error) {
+	excluded := p.Exclude
+	if p.ExcludeAmbiguous {
+		excluded += ambiguousChars
+	}
+
+	sets := map[string]string{}
+	required := 0
+	for class, count := range p.Classes {
+		chars := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(excluded, r) {
+				return -1
+			}
+			return r
+		}, generatorClasses[class])
+
+		if chars == "" {
+			return nil, apiutils.NewErrBadRequest("no characters of class " + class + " left after exclusions")
+		}
+
+		sets[class] = chars
+		required += count
+	}
+
+	if required > p.Length {
+		return nil, apiutils.NewErrBadRequest("required characters exceed the length")
+	}
+
+	return sets, nil
+}
+
+// A generated value with its entropy in bits.
+type Generated struct {
+	Value      string     `json:"value"`
+	Entropy    float64    `json:"entropy"`
+	PasswordID *uuid.UUID `json:"password_id,omitempty"` // entry the value is stored in
+}
+
+// helper: randIndex returns a uniform random index below n.
+func randIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		log.Error().Str("location", "randIndex").Msg(err.Error())
+		return 0, err
+	}
+
+	return int(i.Int64()), nil
+}
+
+// helper: randRune picks a random character of the set.
+func randRune(set []rune) (rune, error) {
+	i, err := randIndex(len(set))
+	if err != nil {
+		return 0, err
+	}
+
+	return set[i], nil
+}
+
+// Generates a value following the policy.
+func Generate(policy *GeneratorPolicy) (*Generated, error) {
+	policy.withDefaults()
+	if policy.Kind == GeneratePassphrase {
+		return generatePassphrase(policy)
+	}
+
+	return generatePassword(policy)
+}
+
+// helper: generatePassword draws the required characters of each class, fills the rest from
+// every enabled class and shuffles the result.
+func generatePassword(policy *GeneratorPolicy) (*Generated, error) {
+	sets, err := policy.charsets()
+	if err != nil {
+		return nil, err
+	}
+
+	pool := []rune{}
+	password := []rune{}
+	for class, chars := range sets {
+		set := []rune(chars)
+		pool = append(pool, set...)
+
+		for i := 0; i < policy.Classes[class]; i++ {
+			r, err := randRune(set)
+			if err != nil {
+				return nil, err
+			}
+			password = append(password, r)
+		}
+	}
+
+	for len(password) < policy.Length {
+		r, err := randRune(pool)
+		if err != nil {
+			return nil, err
+		}
+		password = append(password, r)
+	}
+
+	// fisher-yates, so the required characters do not sit at the start
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randIndex(i + 1)
+		if err != nil {
+			return nil, err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+
+	// estimated as a uniform draw from the pool, the required counts cost a fraction of a bit
+	entropy := float64(policy.Length) * math.Log2(float64(len(pool)))
+	return &Generated{Value: string(password), Entropy: math.Round(entropy*10) / 10}, nil
+}
+
+// helper: generatePassphrase picks words of the wordlist, optionally capitalized and with a
+// digit appended to one of them.
+func generatePassphrase(policy *GeneratorPolicy) (*Generated, error) {
+	words := wordlist()
+	if len(words) == 0 {
+		return nil, errors.New("empty wordlist")
+	}
+
+	phrase := make([]string, policy.Words)
+	for i := range phrase {
+		n, err := randIndex(len(words))
+		if err != nil {
+			return nil, err
+		}
+
+		phrase[i] = words[n]
+		if policy.Capitalize {
+			phrase[i] = strings.ToUpper(phrase[i][:1]) + phrase[i][1:]
+		}
+	}
+
+	entropy := float64(policy.Words) * math.Log2(float64(len(words)))
+	if policy.Number {
+		word, err := randIndex(len(phrase))
+		if err != nil {
+			return nil, err
+		}
+
+		digit, err := randIndex(10)
+		if err != nil {
+			return nil, err
+		}
+
+		phrase[word] += string(rune('0' + digit))
+		entropy += math.Log2(10) + math.Log2(float64(len(phrase)))
+	}
+
+	return &Generated{Value: strings.Join(phrase, *policy.Separator), Entropy: math.Round(entropy*10) / 10}, nil
+}
+
+// Generates a password and stores it as a new login entry, the value only leaves the server in
+// the response.
+func (s *service) GenerateAndStore(ctx context.Context, psw *Password, policy *GeneratorPolicy) (*Generated, error) {
+	generated, err := Generate(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	psw.Type = ItemLogin
+	if psw.Login == nil {
+		psw.Login = &Login{}
+	}
+	psw.Login.Password = generated.Value
+
+	if err := psw.Validate(); err != nil {
+		return nil, err
+	}
+
+	passwordID, err := s.CreatePassword(ctx, psw)
+	if err != nil {
+		return nil, err
+	}
+
+	generated.PasswordID = &passwordID
+	return generated, nil
+}
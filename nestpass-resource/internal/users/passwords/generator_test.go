@@ -0,0 +1,72 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func Test_GeneratePassword(t *testing.T) {
+	policy := &GeneratorPolicy{
+		Length:           16,
+		Classes:          map[string]int{ClassLower: 2, ClassDigits: 6},
+		ExcludeAmbiguous: true,
+	}
+
+	for i := 0; i < 50; i++ {
+		generated, err := Generate(policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		digits := 0
+		for _, r := range generated.Value {
+			if strings.ContainsRune(ambiguousChars, r) || unicode.IsUpper(r) || unicode.IsPunct(r) {
+				t.Fatalf("unexpected character %q in %q", r, generated.Value)
+			}
+
+			if unicode.IsDigit(r) {
+				digits++
+			}
+		}
+
+		if len(generated.Value) != 16 || digits < 6 {
+			t.Fatalf("policy not followed: %q", generated.Value)
+		}
+	}
+
+	// 24 lowercase and 8 digits left after the exclusions
+	if generated, _ := Generate(policy); generated.Entropy != 80 {
+		t.Fatalf("unexpected entropy %v", generated.Entropy)
+	}
+
+	if _, err := Generate(&GeneratorPolicy{Length: 8, Classes: map[string]int{ClassLower: 5, ClassUpper: 5}}); err == nil {
+		t.Fatal("required counts above the length accepted")
+	}
+
+	if _, err := Generate(&GeneratorPolicy{Classes: map[string]int{ClassDigits: 0}, Exclude: "0123456789"}); err == nil {
+		t.Fatal("class without characters accepted")
+	}
+}
+
+func Test_GeneratePassphrase(t *testing.T) {
+	if len(wordlist()) != 7776 {
+		t.Fatalf("wordlist has %d words", len(wordlist()))
+	}
+
+	separator := " "
+	generated, err := Generate(&GeneratorPolicy{Kind: GeneratePassphrase, Words: 5, Separator: &separator, Capitalize: true, Number: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	words := strings.Split(generated.Value, " ")
+	if len(words) != 5 || !unicode.IsUpper(rune(words[0][0])) || !strings.ContainsAny(generated.Value, "0123456789") {
+		t.Fatalf("unexpected passphrase %q", generated.Value)
+	}
+
+	// 5 words of 12.9 bits, a digit and its position
+	if generated.Entropy < 70 || generated.Entropy > 70.3 {
+		t.Fatalf("unexpected entropy %v", generated.Entropy)
+	}
+}
@@ -1,76 +1,153 @@
 package passwords
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
 	"github.com/tuan882612/apiutils"
 
 	"nestpass/internal/dependencies"
+	"nestpass/internal/users/categories"
 	"nestpass/pkg/auth"
-	"nestpass/pkg/httputils"
+	"nestpass/pkg/pagination"
 )
 
 type Handler struct {
-	svc *service
+	svc   *service
+	pager *pagination.Pager
 }
 
-func NewHandler(deps *dependencies.Dependencies) *Handler {
-	repo := NewRepository(deps.Databases.Postgres, deps.Databases.Redis)
-	svc := NewService(repo)
-	return &Handler{svc: svc}
+func NewHandler(deps *dependencies.Dependencies) (*Handler, error) {
+	cfg := deps.Cfg
+	kdfPolicy, err := NewKDFPolicy(cfg.KDFAlgorithm, cfg.KDFMemory, cfg.KDFIterations, cfg.KDFParallelism)
+	if err != nil {
+		log.Error().Str("location", "passwords.NewHandler").Msgf("invalid kdf policy: %v", err)
+		return nil, err
+	}
+
+	var breaches *breachCorpus
+	if cfg.BreachCorpusDir != "" {
+		breaches = NewBreachCorpus(cfg.BreachCorpusDir)
+	}
+
+	repo := NewRepository(deps.Databases.Postgres)
+	svc := NewService(repo, categories.NewRepository(deps.Databases.Postgres), kdfPolicy, cfg.HistoryRetention, breaches,
+		NewAttachmentStore(deps.Blobs, cfg.AttachmentMaxSize, cfg.AttachmentQuota))
+	return &Handler{svc: svc, pager: deps.Pager}, nil
 }
 
-func (h *Handler) RehashAllPasswords(w http.ResponseWriter, r *http.Request) {
-	uidStr := r.Header.Get("X-Uid")
-	if uidStr == "" {
-		apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("missing X-Uid header"))
+// Lists entries, optionally of a category, carrying a tag or marked as favorites, sorted by id or
+// one of the sort keys.
+func (h *Handler) GetAllPasswords(w http.ResponseWriter, r *http.Request) {
+	params, err := h.pager.Parse(r, SortWebsite, SortCreated, SortUpdated, SortLastUsed)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
-	userID, err := uuid.Parse(uidStr)
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
 	if err != nil {
-		apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("invalid X-Uid header"))
+		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
-	if err := h.svc.ReUpdateAllPasswords(r.Context(), userID); err != nil {
+	filter := &ListFilter{
+		// include the passwords of nested categories
+		Descendants: r.URL.Query().Get("descendants") == "true",
+		Favorite:    r.URL.Query().Get("favorite") == "true",
+	}
+
+	if categoryID, err := uuid.Parse(r.URL.Query().Get("category_id")); err == nil {
+		filter.CategoryID = &categoryID
+	}
+
+	if raw := r.URL.Query().Get("tag_id"); raw != "" {
+		tagID, err := uuid.Parse(raw)
+		if err != nil {
+			apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("invalid tag_id"))
+			return
+		}
+		filter.TagID = &tagID
+	}
+
+	passwords, err := h.svc.ListPasswords(r.Context(), ownerID, filter, params)
+	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
-	resp := apiutils.NewRes(http.StatusOK, "passwords rehashed", nil)
+	resp := apiutils.NewRes(http.StatusOK, "", passwords)
 	resp.SendRes(w)
 }
 
-func (h *Handler) GetAllPasswords(w http.ResponseWriter, r *http.Request) {
-	pageParams := httputils.GetPaginationParams(r)
+func (h *Handler) SearchPasswords(w http.ResponseWriter, r *http.Request) {
+	params, err := h.pager.Parse(r)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
 
-	userID, err := auth.UidFromCtx(r.Context())
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("missing q"))
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
-	isGetCategory := true
-	categoryID, err := uuid.Parse(r.URL.Query().Get("category_id"))
+	passwords, err := h.svc.Search(r.Context(), ownerID, query, params)
 	if err != nil {
-		isGetCategory = false
+		apiutils.HandleHttpErrors(w, err)
+		return
 	}
 
-	var passwords []*Password
-	if isGetCategory {
-		passwords, err = h.svc.GetAllPasswordsByCategory(r.Context(), userID, categoryID, pageParams)
-	} else {
-		passwords, err = h.svc.GetAllPasswords(r.Context(), userID, pageParams)
+	resp := apiutils.NewRes(http.StatusOK, "", passwords)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	opts := &HealthOptions{StaleDays: defaultStaleDays}
+	if days := r.URL.Query().Get("stale_days"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("invalid stale_days"))
+			return
+		}
+		opts.StaleDays = n
+	}
+
+	if err := opts.Validate(); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
 	}
 
+	userID, err := auth.UidFromCtx(r.Context())
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
-	resp := apiutils.NewRes(http.StatusOK, "", passwords)
+	report, err := h.svc.Health(r.Context(), userID, opts)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", report)
 	resp.SendRes(w)
 }
 
@@ -93,19 +170,87 @@ func (h *Handler) GetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := auth.UidFromCtx(r.Context())
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
-	password, err := h.svc.GetPassword(r.Context(), passwordID, categoryID, userID)
+	password, err := h.svc.GetPassword(r.Context(), passwordID, categoryID, ownerID)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
+	// the otp secret is only included when asked for
+	if password.OTP != nil && r.URL.Query().Get("reveal_otp") == "true" {
+		password.OTP.Reveal()
+	}
+
 	resp := apiutils.NewRes(http.StatusOK, "", password)
+	resp.AddHeader(w, map[string]string{"Cache-Control": "no-store"})
+	resp.SendRes(w)
+}
+
+// Reads the current code of a time based one time password.
+func (h *Handler) GetOTPCode(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := queryUUID(r, "category_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	code, err := h.svc.GetOTPCode(r.Context(), passwordID, categoryID, ownerID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", code)
+	resp.AddHeader(w, map[string]string{"Cache-Control": "no-store"})
+	resp.SendRes(w)
+}
+
+// Issues the next code of a counter based one time password, which advances the stored counter.
+func (h *Handler) IssueHOTPCode(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := queryUUID(r, "category_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	code, err := h.svc.IssueHOTPCode(r.Context(), passwordID, categoryID, ownerID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", code)
+	resp.AddHeader(w, map[string]string{"Cache-Control": "no-store"})
 	resp.SendRes(w)
 }
 
@@ -116,6 +261,13 @@ func (h *Handler) CreatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+	psw.UserID = ownerID
+
 	pswID, err := h.svc.CreatePassword(r.Context(), psw)
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
@@ -134,6 +286,13 @@ func (h *Handler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+	psw.UserID = ownerID
+
 	if err := h.svc.UpdatePassword(r.Context(), psw); err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
@@ -158,13 +317,74 @@ func (h *Handler) DeletePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.DeletePassword(r.Context(), ownerID, passwordID, categoryID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetVault(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	vault, err := h.svc.GetVault(r.Context(), userID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", vault)
+	resp.SendRes(w)
+}
+
+func (h *Handler) EnableClientMode(w http.ResponseWriter, r *http.Request) {
+	migration := &ClientMigration{}
+	if err := migration.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.EnableClientMode(r.Context(), userID, migration); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "vault migrated to client side encryption", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) UpdateWrappedKey(w http.ResponseWriter, r *http.Request) {
+	input := &WrappedKey{}
+	if err := input.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
 	userID, err := auth.UidFromCtx(r.Context())
 	if err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
 
-	if err := h.svc.DeletePassword(r.Context(), userID, passwordID, categoryID); err != nil {
+	if err := h.svc.UpdateWrappedKey(r.Context(), userID, input.WrappedKey); err != nil {
 		apiutils.HandleHttpErrors(w, err)
 		return
 	}
@@ -172,3 +392,815 @@ func (h *Handler) DeletePassword(w http.ResponseWriter, r *http.Request) {
 	resp := apiutils.NewRes(http.StatusOK, "", nil)
 	resp.SendRes(w)
 }
+
+func (h *Handler) Rekey(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	job, err := h.svc.Rekey(r.Context(), userID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusAccepted, "vault rekey started", job)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetRekeyStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	status, err := h.svc.GetRekeyStatus(r.Context(), userID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", status)
+	resp.SendRes(w)
+}
+
+// Resumes rekey jobs interrupted by a previous shutdown.
+func (h *Handler) ResumeRekeyJobs(ctx context.Context) {
+	h.svc.ResumeRekeyJobs(ctx)
+}
+
+// Retries the vault rewraps of password resets until the context ends.
+func (h *Handler) RunRewraps(ctx context.Context) {
+	h.svc.RunRewraps(ctx)
+}
+
+// Indexes the entries of vaults stored before search existed.
+func (h *Handler) IndexVaults(ctx context.Context) {
+	h.svc.IndexVaults(ctx)
+}
+
+func (h *Handler) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	params, err := h.pager.ParseOrder(r, pagination.Desc)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	revisions, err := h.svc.GetRevisions(r.Context(), ownerID, passwordID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", revisions)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	revisionID, err := queryUUID(r, "revision_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	password, err := h.svc.GetRevision(r.Context(), ownerID, passwordID, revisionID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", password)
+	resp.SendRes(w)
+}
+
+func (h *Handler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := queryUUID(r, "category_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	revisionID, err := queryUUID(r, "revision_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.RestoreRevision(r.Context(), ownerID, passwordID, categoryID, revisionID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "revision restored", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	params, err := h.pager.ParseOrder(r, pagination.Desc)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	trash, err := h.svc.GetTrash(r.Context(), ownerID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", trash)
+	resp.SendRes(w)
+}
+
+func (h *Handler) RestorePassword(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.RestorePassword(r.Context(), ownerID, passwordID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "password restored", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) PurgePassword(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.PurgeTrash(r.Context(), ownerID, &passwordID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.PurgeTrash(r.Context(), ownerID, nil); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+// Creates the vault of a new organization and returns its key sealed to the owner.
+func (h *Handler) CreateOrgVault(ctx context.Context, tx pgx.Tx, orgID, ownerID uuid.UUID) ([]byte, error) {
+	return h.svc.CreateOrgVault(ctx, tx, orgID, ownerID)
+}
+
+// Seals the organization key the granting member holds to a new member.
+func (h *Handler) GrantOrgKey(ctx context.Context, orgID, granterID, memberID uuid.UUID) ([]byte, error) {
+	return h.svc.GrantOrgKey(ctx, orgID, granterID, memberID)
+}
+
+// Registers a hook run after every write to an owner's entries.
+func (h *Handler) OnWrite(hook WriteHook) {
+	h.svc.OnWrite(hook)
+}
+
+// Creates the user's keypair if it has none yet.
+func (h *Handler) EnsureKeyPair(ctx context.Context, userID uuid.UUID) error {
+	return h.svc.EnsureKeyPair(ctx, userID)
+}
+
+// Seals the key to the keypair of the user.
+func (h *Handler) SealToUser(ctx context.Context, userID uuid.UUID, key, aad []byte) ([]byte, error) {
+	return h.svc.SealToUser(ctx, userID, key, aad)
+}
+
+// Opens a key sealed to the keypair of the user.
+func (h *Handler) OpenAsUser(ctx context.Context, userID uuid.UUID, sealed, aad []byte) ([]byte, error) {
+	return h.svc.OpenAsUser(ctx, userID, sealed, aad)
+}
+
+// Locks the owner's vault for the rest of the transaction.
+func (h *Handler) LockVault(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID) (*Vault, error) {
+	return h.svc.LockVault(ctx, tx, ownerID)
+}
+
+// Migrates the owner's vault ahead of a shared write.
+func (h *Handler) PrepareVault(ctx context.Context, ownerID uuid.UUID) error {
+	return h.svc.PrepareVault(ctx, ownerID)
+}
+
+// Decrypts the owner's active entries filed in the categories.
+func (h *Handler) SharedEntries(ctx context.Context, ownerID uuid.UUID, passwordID *uuid.UUID, categoryIDs []uuid.UUID) ([]*Password, error) {
+	return h.svc.SharedEntries(ctx, ownerID, passwordID, categoryIDs)
+}
+
+// Writes an edit of the owner's entry made by a share member.
+func (h *Handler) WriteShared(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID, psw *Password) error {
+	return h.svc.WriteShared(ctx, tx, ownerID, psw)
+}
+
+// Seals the owner's data keys to the user.
+func (h *Handler) SealVaultKeys(ctx context.Context, ownerID, userID uuid.UUID, aad []byte) ([]byte, int, error) {
+	return h.svc.SealVaultKeys(ctx, ownerID, userID, aad)
+}
+
+// Lists the owner's entries with the data keys sealed to the user.
+func (h *Handler) OpenSealedVault(ctx context.Context, ownerID, userID uuid.UUID, sealed, aad []byte, filter *ListFilter, params *pagination.Params) (*pagination.Page[*Password], error) {
+	return h.svc.OpenSealedVault(ctx, ownerID, userID, sealed, aad, filter, params)
+}
+
+// Permanently deletes the passwords trashed before the cutoff.
+func (h *Handler) PurgeExpired(ctx context.Context, cutoff time.Time) error {
+	return h.svc.PurgeExpired(ctx, cutoff)
+}
+
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	input := &ExportRequest{}
+	if err := input.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	export, err := h.svc.Export(r.Context(), userID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	// the archive is streamed, failures past this point can only end the response early
+	filename := "nestpass-" + time.Now().Format("20060102") + ".npex"
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	if err := export.WriteArchive(r.Context(), w, input.Passphrase); err != nil {
+		log.Error().Str("location", "Export").Msgf("%v: %v", userID, err)
+	}
+}
+
+func (h *Handler) Generate(w http.ResponseWriter, r *http.Request) {
+	input := &GenerateRequest{}
+	if err := input.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	var generated *Generated
+	status := http.StatusOK
+
+	if input.Store == nil {
+		var err error
+		if generated, err = Generate(&input.Policy); err != nil {
+			apiutils.HandleHttpErrors(w, err)
+			return
+		}
+	} else {
+		userID, err := auth.UidFromCtx(r.Context())
+		if err != nil {
+			apiutils.HandleHttpErrors(w, err)
+			return
+		}
+
+		psw := &Password{
+			UserID:     userID,
+			CategoryID: input.Store.CategoryID,
+			Website:    input.Store.Website,
+			Notes:      input.Store.Notes,
+			Login:      &Login{Username: input.Store.Username},
+		}
+
+		if generated, err = h.svc.GenerateAndStore(r.Context(), psw, &input.Policy); err != nil {
+			apiutils.HandleHttpErrors(w, err)
+			return
+		}
+		status = http.StatusCreated
+	}
+
+	resp := apiutils.NewRes(status, "", generated)
+	resp.AddHeader(w, map[string]string{"Cache-Control": "no-store"})
+	resp.SendRes(w)
+}
+
+// largest import file accepted
+const maxImportSize = 32 << 20
+
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize+1<<20)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("invalid import form"))
+		return
+	}
+
+	opts, err := importOptions(r)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("missing import file"))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("failed to read import file"))
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	report, err := h.svc.Import(r.Context(), userID, data, opts)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", report)
+	resp.SendRes(w)
+}
+
+// helper: importOptions reads the import options from the form.
+func importOptions(r *http.Request) (*ImportOptions, error) {
+	opts := &ImportOptions{
+		Format:     r.FormValue("format"),
+		Passphrase: r.FormValue("passphrase"),
+		DryRun:     r.FormValue("dry_run") == "true",
+		Duplicates: r.FormValue("duplicates"),
+	}
+
+	if opts.Duplicates == "" {
+		opts.Duplicates = DuplicatesSkip
+	}
+
+	if raw := r.FormValue("category_map"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &opts.CategoryMap); err != nil {
+			return nil, apiutils.NewErrBadRequest("invalid category_map")
+		}
+	}
+
+	if raw := r.FormValue("target_id"); raw != "" {
+		targetID, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, apiutils.NewErrBadRequest("invalid target_id")
+		}
+		opts.TargetID = &targetID
+	}
+
+	return opts, opts.Validate()
+}
+
+func (h *Handler) GetAttachments(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := queryUUID(r, "category_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	params, err := h.pager.Parse(r)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	attachments, err := h.svc.GetAttachments(r.Context(), ownerID, passwordID, categoryID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", attachments)
+	resp.SendRes(w)
+}
+
+// Streams the "file" part of a multipart form into the attachment without buffering it.
+func (h *Handler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := queryUUID(r, "category_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.svc.attachments.maxSize+1<<20)
+	form, err := r.MultipartReader()
+	if err != nil {
+		apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("invalid attachment form"))
+		return
+	}
+
+	var part *multipart.Part
+	for {
+		if part, err = form.NextPart(); err != nil {
+			apiutils.HandleHttpErrors(w, apiutils.NewErrBadRequest("missing attachment file"))
+			return
+		}
+
+		if part.FormName() == "file" {
+			break
+		}
+		part.Close()
+	}
+	defer part.Close()
+
+	contentType := part.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	attachment, err := h.svc.UploadAttachment(r.Context(), ownerID, passwordID, categoryID, part.FileName(), contentType, part)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = apiutils.NewErrBadRequest("attachment exceeds the maximum size")
+		}
+
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusCreated, "", attachment)
+	resp.SendRes(w)
+}
+
+func (h *Handler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	attachmentID, err := queryUUID(r, "attachment_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	attachment, content, err := h.svc.OpenAttachment(r.Context(), ownerID, attachmentID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+	defer content.Close()
+
+	// the content is streamed, a chunk failing its check can only end the response early
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, content); err != nil {
+		log.Error().Str("location", "DownloadAttachment").Msgf("%v: %v: %v", ownerID, attachmentID, err)
+	}
+}
+
+func (h *Handler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	attachmentID, err := queryUUID(r, "attachment_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.DeleteAttachment(r.Context(), ownerID, attachmentID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetAttachmentUsage(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	usage, err := h.svc.GetAttachmentUsage(r.Context(), ownerID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", usage)
+	resp.SendRes(w)
+}
+
+func (h *Handler) SweepBlobs(ctx context.Context) (int, error) {
+	return h.svc.SweepBlobs(ctx)
+}
+
+func (h *Handler) GetTags(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	tags, err := h.svc.GetTags(r.Context(), ownerID)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", tags)
+	resp.SendRes(w)
+}
+
+func (h *Handler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	input := &Tag{}
+	if err := input.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	tag, err := h.svc.CreateTag(r.Context(), ownerID, input.Name)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusCreated, "", tag)
+	resp.SendRes(w)
+}
+
+func (h *Handler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	tagID, err := queryUUID(r, "tag_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	input := &Tag{}
+	if err := input.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.RenameTag(r.Context(), ownerID, tagID, input.Name); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	tagID, err := queryUUID(r, "tag_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.DeleteTag(r.Context(), ownerID, tagID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) SetEntryTags(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := queryUUID(r, "category_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	input := &EntryTagsRequest{}
+	if err := input.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	tags, err := h.svc.SetEntryTags(r.Context(), ownerID, passwordID, categoryID, input.TagIDs)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", tags)
+	resp.SendRes(w)
+}
+
+func (h *Handler) SetFavorite(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := queryUUID(r, "category_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	input := &FavoriteRequest{}
+	if err := input.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionWrite)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.SetFavorite(r.Context(), ownerID, passwordID, categoryID, input.Favorite); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+// Records a use of the entry, members who can view an organization's entries may record uses.
+func (h *Handler) TouchPassword(w http.ResponseWriter, r *http.Request) {
+	passwordID, err := queryUUID(r, "password_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	categoryID, err := queryUUID(r, "category_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	ownerID, err := auth.OwnerFromRequest(r, auth.ActionView)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.TouchPassword(r.Context(), ownerID, passwordID, categoryID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+// helper: queryUUID parses a required id query parameter.
+func queryUUID(r *http.Request, name string) (uuid.UUID, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return uuid.Nil, apiutils.NewErrBadRequest("missing " + name)
+	}
+
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, apiutils.NewErrBadRequest("invalid " + name)
+	}
+
+	return id, nil
+}
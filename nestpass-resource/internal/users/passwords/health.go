@@ -0,0 +1,187 @@
+package passwords
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+)
+
+// Findings of the health report.
+const (
+	FindingReused   = "reused"
+	FindingWeak     = "weak"
+	FindingBreached = "breached"
+	FindingStale    = "stale"
+)
+
+// days after which unchanged entries are reported when the request does not say otherwise
+const defaultStaleDays = 365
+
+// points taken from an entry's score per finding, breached passwords score zero and weak ones
+// score by their entropy
+const (
+	reusedPenalty = 30
+	stalePenalty  = 10
+)
+
+type HealthOptions struct {
+	StaleDays int `validate:"min=1,max=3650"`
+}
+
+func (o *HealthOptions) Validate() error {
+	if err := validator.New().Struct(o); err != nil {
+		log.Error().Str("location", "HealthOptions.Validate").Msg(err.Error())
+		return apiutils.NewErrBadRequest(err.Error())
+	}
+
+	return nil
+}
+
+// Health of a vault, the score is the mean of the entries' scores out of 100.
+type HealthReport struct {
+	Score         int            `json:"score"`
+	Total         int            `json:"total"`
+	Reused        int            `json:"reused"`
+	Weak          int            `json:"weak"`
+	Breached      int            `json:"breached"`
+	Stale         int            `json:"stale"`
+	BreachChecked bool           `json:"breach_checked"` // false when no breach corpus is configured
+	Entries       []*EntryHealth `json:"entries"`
+}
+
+type EntryHealth struct {
+	PasswordID    uuid.UUID   `json:"password_id"`
+	CategoryID    uuid.UUID   `json:"category_id"`
+	Website       string      `json:"website"`
+	Username      string      `json:"username,omitempty"`
+	Score         int         `json:"score"`
+	Findings      []string    `json:"findings"`
+	Strength      *Strength   `json:"strength,omitempty"`    // set for entries holding a password
+	ReusedWith    []uuid.UUID `json:"reused_with,omitempty"` // other entries with the same password
+	BreachCount   int         `json:"breach_count,omitempty"`
+	UnchangedDays int         `json:"unchanged_days"`
+}
+
+// Decrypts the entries of a server side encrypted vault and reports reused, weak, breached and
+// stale credentials.
+func (s *service) Health(ctx context.Context, userID uuid.UUID, opts *HealthOptions) (*HealthReport, error) {
+	vault, ring, err := s.vaultKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Mode == ClientMode {
+		return nil, apiutils.NewErrConflict("client side encrypted vaults are analyzed by the client")
+	}
+
+	passwords, err := s.repo.GetAllPasswordsNonPaged(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := openAll(vault, ring, passwords)
+	if err != nil {
+		return nil, err
+	}
+
+	var breached map[string]int
+	if s.breaches != nil {
+		hashes := []string{}
+		for _, psw := range entries {
+			if password := loginPassword(psw); password != "" {
+				hashes = append(hashes, breachHash(password))
+			}
+		}
+
+		if breached, err = s.breaches.counts(hashes); err != nil {
+			return nil, err
+		}
+	}
+
+	return analyzeHealth(entries, breached, opts.StaleDays, time.Now()), nil
+}
+
+// helper: loginPassword returns the password of login entries.
+func loginPassword(psw *Password) string {
+	if psw.Login == nil {
+		return ""
+	}
+
+	return psw.Login.Password
+}
+
+// helper: analyzeHealth builds the report from the decrypted entries, breached holds the breach
+// counts by hash and is nil when breaches are not checked.
+func analyzeHealth(entries []*Password, breached map[string]int, staleDays int, now time.Time) *HealthReport {
+	report := &HealthReport{Score: 100, Total: len(entries), BreachChecked: breached != nil, Entries: []*EntryHealth{}}
+
+	reuse := map[string][]uuid.UUID{}
+	for _, psw := range entries {
+		if password := loginPassword(psw); password != "" {
+			reuse[password] = append(reuse[password], psw.PasswordID)
+		}
+	}
+
+	total := 0
+	for _, psw := range entries {
+		entry := &EntryHealth{
+			PasswordID:    psw.PasswordID,
+			CategoryID:    psw.CategoryID,
+			Website:       psw.Website,
+			Score:         100,
+			Findings:      []string{},
+			UnchangedDays: int(now.Sub(psw.Updated).Hours() / 24),
+		}
+
+		if password := loginPassword(psw); password != "" {
+			entry.Username = psw.Login.Username
+			entry.Strength = estimateStrength(password, psw.Login.Username, psw.Website)
+
+			if entry.Strength.Weak() {
+				entry.Findings = append(entry.Findings, FindingWeak)
+				entry.Score = min(entry.Score, int(100*entry.Strength.Entropy/strongEntropy))
+				report.Weak++
+			}
+
+			if shared := reuse[password]; len(shared) > 1 {
+				for _, id := range shared {
+					if id != psw.PasswordID {
+						entry.ReusedWith = append(entry.ReusedWith, id)
+					}
+				}
+
+				entry.Findings = append(entry.Findings, FindingReused)
+				entry.Score -= reusedPenalty
+				report.Reused++
+			}
+
+			if count := breached[breachHash(password)]; count > 0 {
+				entry.BreachCount = count
+				entry.Findings = append(entry.Findings, FindingBreached)
+				entry.Score = 0
+				report.Breached++
+			}
+		}
+
+		if entry.UnchangedDays >= staleDays {
+			entry.Findings = append(entry.Findings, FindingStale)
+			entry.Score -= stalePenalty
+			report.Stale++
+		}
+
+		entry.Score = max(entry.Score, 0)
+		total += entry.Score
+		report.Entries = append(report.Entries, entry)
+	}
+
+	if len(entries) != 0 {
+		report.Score = int(math.Round(float64(total) / float64(len(entries))))
+	}
+
+	return report
+}
@@ -0,0 +1,94 @@
+package passwords
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func Test_EstimateStrength(t *testing.T) {
+	strong := estimateStrength("vR7#qLz!9pWm@2Kd")
+	if strong.Weak() || len(strong.Weaknesses) != 0 {
+		t.Fatalf("random password reported weak: %+v", strong)
+	}
+
+	cases := map[string]string{
+		"P@ssw0rd2024!":    WeaknessCommon,
+		"aaaaaaaaaaaaaaaa": WeaknessRepeated,
+		"abcdefgh12345678": WeaknessSequence,
+		"qwertyuiasdfghjk": WeaknessKeyboard,
+		"Xk9!":             WeaknessShort,
+	}
+
+	for password, weakness := range cases {
+		strength := estimateStrength(password)
+		if !strength.Weak() || !slices.Contains(strength.Weaknesses, weakness) {
+			t.Fatalf("%q: expected %v, got %+v", password, weakness, strength)
+		}
+	}
+
+	personal := estimateStrength("Examplecorp2024", "jane.doe", "examplecorp.com")
+	if !slices.Contains(personal.Weaknesses, WeaknessPersonal) || !personal.Weak() {
+		t.Fatalf("personal words not detected: %+v", personal)
+	}
+}
+
+func Test_BreachCorpus(t *testing.T) {
+	dir := t.TempDir()
+	hash := breachHash("hunter2")
+	data := hash[breachPrefixSize:] + ":42\n" + "0000000000000000000000000000000000A:0\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:breachPrefixSize]+".txt"), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	safe := breachHash("not in the corpus")
+	counts, err := NewBreachCorpus(dir).counts([]string{hash, safe})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if counts[hash] != 42 || len(counts) != 1 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+}
+
+func Test_AnalyzeHealth(t *testing.T) {
+	now := time.Now()
+	login := func(website, password string, updated time.Time) *Password {
+		return &Password{PasswordID: uuid.New(), Website: website, Type: ItemLogin, Updated: updated,
+			Login: &Login{Username: "user", Password: password}}
+	}
+
+	good := login("a.com", "vR7#qLz!9pWm@2Kd", now)
+	reusedA := login("b.com", "Tq8$wZ1!mK4@xP7r", now)
+	reusedB := login("c.com", "Tq8$wZ1!mK4@xP7r", now)
+	breached := login("d.com", "hunter2", now)
+	stale := &Password{PasswordID: uuid.New(), Website: "memo", Type: ItemNote, Note: &Note{Text: "x"}, Updated: now.AddDate(-2, 0, 0)}
+
+	report := analyzeHealth([]*Password{good, reusedA, reusedB, breached, stale}, map[string]int{breachHash("hunter2"): 3}, 365, now)
+
+	if report.Reused != 2 || report.Breached != 1 || report.Weak != 1 || report.Stale != 1 || !report.BreachChecked {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+
+	byID := map[uuid.UUID]*EntryHealth{}
+	for _, entry := range report.Entries {
+		byID[entry.PasswordID] = entry
+	}
+
+	if byID[good.PasswordID].Score != 100 || byID[breached.PasswordID].Score != 0 || byID[stale.PasswordID].Score != 90 {
+		t.Fatalf("unexpected scores: %+v", report.Entries)
+	}
+
+	if ids := byID[reusedA.PasswordID].ReusedWith; len(ids) != 1 || ids[0] != reusedB.PasswordID {
+		t.Fatalf("unexpected reuse: %v", ids)
+	}
+
+	if report.Score != (100+70+70+0+90)/5 {
+		t.Fatalf("unexpected vault score %d", report.Score)
+	}
+}
@@ -0,0 +1,132 @@
+package passwords
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"nestpass/pkg/pagination"
+)
+
+// helper: addRevision snapshots the stored entry before it is overwritten.
+func (s *service) addRevision(ctx context.Context, tx pgx.Tx, current *PasswordEncrypt) error {
+	if s.retention <= 0 {
+		return nil
+	}
+
+	return s.repo.CreateRevision(ctx, tx, NewRevisionEncrypt(current), s.retention)
+}
+
+// Lists the entry's revisions, newest first, without their content.
+func (s *service) GetRevisions(ctx context.Context, userID, passwordID uuid.UUID, params *pagination.Params) (*pagination.Page[*Revision], error) {
+	revisions, err := s.repo.GetRevisions(ctx, userID, passwordID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, revisions, func(r *Revision) (string, uuid.UUID) {
+		return r.Created.Format(time.RFC3339Nano), r.RevisionID
+	})
+}
+
+// Retrieves a revision of the entry decrypted, or sealed for client side encrypted vaults.
+func (s *service) GetRevision(ctx context.Context, userID, passwordID, revisionID uuid.UUID) (*Password, error) {
+	vault, ring, err := s.vaultKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, err := s.repo.GetRevision(ctx, userID, passwordID, revisionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(vault, ring, &revision.PasswordEncrypt)
+}
+
+// Makes the revision the entry's current value, the replaced value becomes a revision itself.
+func (s *service) RestoreRevision(ctx context.Context, userID, passwordID, categoryID, revisionID uuid.UUID) error {
+	// migrate legacy vaults before writing
+	if _, err := s.prepareVault(ctx, userID); err != nil {
+		return err
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "RestoreRevision").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// the mode can not change while the entry is written
+	vault, err := s.repo.LockVault(ctx, tx, userID, false)
+	if err != nil {
+		return err
+	}
+
+	current, err := s.repo.GetPasswordForUpdate(ctx, tx, userID, passwordID, categoryID)
+	if err != nil {
+		return err
+	}
+
+	revision, err := s.repo.GetRevision(ctx, userID, passwordID, revisionID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.restoreRevision(ctx, tx, vault, current, revision); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "RestoreRevision").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	s.afterWrite(ctx, userID, []uuid.UUID{passwordID}, []uuid.UUID{categoryID})
+	return nil
+}
+
+// helper: restoreRevision keeps the current value as a revision and writes the revision over it.
+func (s *service) restoreRevision(ctx context.Context, tx pgx.Tx, vault *Vault, current *PasswordEncrypt, revision *RevisionEncrypt) error {
+	if err := s.addRevision(ctx, tx, current); err != nil {
+		return err
+	}
+
+	// the content is restored as stored, it stays readable with the key version it carries
+	var err error
+	restored := revision.PasswordEncrypt
+	restored.CategoryID, restored.Updated = current.CategoryID, time.Now()
+	if restored.SearchTokens, err = s.revisionTokens(ctx, vault, &restored); err != nil {
+		return err
+	}
+
+	return s.repo.UpdatePassword(ctx, tx, &restored)
+}
+
+// helper: revisionTokens computes the blind index of a restored revision, revisions do not keep one.
+func (s *service) revisionTokens(ctx context.Context, vault *Vault, revision *PasswordEncrypt) ([][]byte, error) {
+	if vault.Mode == ClientMode {
+		return nil, nil
+	}
+
+	ring, err := s.keyRing(ctx, vault)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ring.get(revision.KeyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	psw, err := revision.Decrypt(revision.UserID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return searchTokens(key, psw), nil
+}
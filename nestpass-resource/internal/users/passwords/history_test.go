@@ -0,0 +1,122 @@
+package passwords
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"nestpass/internal/databases/pgtest"
+	"nestpass/pkg/pagination"
+)
+
+func newRevisionFixture() *PasswordEncrypt {
+	return &PasswordEncrypt{PasswordID: uuid.New(), UserID: uuid.New(), CategoryID: uuid.New(), Website: "example.com", Nonce: []byte("current nonce"), Encrypted: []byte("current"), KeyVersion: 2}
+}
+
+func Test_AddRevisionPrunesPastRetention(t *testing.T) {
+	ctx, db, current := context.Background(), &pgtest.DB{}, newRevisionFixture()
+	svc := &service{repo: &repository{postgres: db}, retention: 3}
+
+	tx, _ := db.Begin(ctx)
+	if err := svc.addRevision(ctx, tx, current); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.Execs) != 2 || db.Execs[0].SQL != CreateRevisionQuery || db.Execs[1].SQL != PruneRevisionsQuery {
+		t.Fatalf("ran %+v, want the revision stored then the history pruned", db.Execs)
+	}
+
+	if !bytes.Equal(db.Execs[0].Args[6].([]byte), current.Encrypted) {
+		t.Fatal("revision does not keep the stored value")
+	}
+
+	// only the retention count of the entry's newest revisions is kept
+	if prune := db.Execs[1].Args; prune[0] != current.PasswordID || prune[1] != current.UserID || prune[2] != 3 {
+		t.Fatalf("pruned with %v, want the entry's history past 3 revisions", prune)
+	}
+
+	// a zero retention disables the history
+	db, svc.retention = &pgtest.DB{}, 0
+	tx, _ = db.Begin(ctx)
+	if err := svc.addRevision(ctx, tx, current); err != nil || len(db.Execs) != 0 {
+		t.Fatalf("addRevision() ran %+v, %v with the history disabled", db.Execs, err)
+	}
+}
+
+func Test_RestoreRevision(t *testing.T) {
+	ctx, db, current := context.Background(), &pgtest.DB{}, newRevisionFixture()
+	svc := &service{repo: &repository{postgres: db}, retention: 10}
+
+	// the revision was taken before the entry moved to its current category
+	revision := &RevisionEncrypt{RevisionID: uuid.New(), Created: time.Now().Add(-time.Hour), PasswordEncrypt: *current}
+	revision.CategoryID, revision.Nonce, revision.Encrypted, revision.KeyVersion = uuid.New(), []byte("older nonce"), []byte("older"), 1
+
+	vault := &Vault{UserID: current.UserID, Mode: ClientMode}
+	tx, _ := db.Begin(ctx)
+	if err := svc.restoreRevision(ctx, tx, vault, current, revision); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.Execs) != 3 || db.Execs[0].SQL != CreateRevisionQuery || db.Execs[2].SQL != UpdatePasswordQuery {
+		t.Fatalf("ran %+v, want the replaced value kept before the revision is written", db.Execs)
+	}
+
+	// the replaced value becomes a revision itself
+	kept := db.Execs[0].Args
+	if kept[1] != current.PasswordID || !bytes.Equal(kept[6].([]byte), current.Encrypted) || kept[7] != current.KeyVersion {
+		t.Fatalf("kept %v, want the replaced value", kept)
+	}
+
+	// the revision is written as stored, in the category the entry is in now
+	written := db.Execs[2].Args
+	if !bytes.Equal(*written[2].(*[]byte), revision.Encrypted) || *written[3].(*int) != 1 || *written[5].(*uuid.UUID) != current.CategoryID {
+		t.Fatalf("wrote %v, want the revision's content with its key version in the current category", written)
+	}
+}
+
+func Test_GetRevisionsNewestFirst(t *testing.T) {
+	ctx, userID, passwordID := context.Background(), uuid.New(), uuid.New()
+	newer := &Revision{RevisionID: uuid.New(), PasswordID: passwordID, Created: time.Now().Truncate(time.Microsecond)}
+	older := &Revision{RevisionID: uuid.New(), PasswordID: passwordID, Created: newer.Created.Add(-time.Minute)}
+
+	db := &pgtest.DB{Results: map[string][][]any{
+		GetRevisionsDescQuery: {{newer.RevisionID, passwordID, newer.Created}, {older.RevisionID, passwordID, older.Created}},
+	}}
+	svc := &service{repo: &repository{postgres: db}}
+	pager := pagination.NewPager("secret")
+
+	// a request without an order lists the newest revision first
+	params, err := pager.ParseOrder(httptest.NewRequest("GET", "/?limit=1", nil), pagination.Desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := svc.GetRevisions(ctx, userID, passwordID, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Queries[0].SQL != GetRevisionsDescQuery || len(page.Items) != 1 || page.Items[0].RevisionID != newer.RevisionID || page.Next == "" {
+		t.Fatalf("GetRevisions() = %+v, want the newest revision and a next page", page)
+	}
+
+	// the next page continues after the creation time of the last revision listed
+	params, err = pager.ParseOrder(httptest.NewRequest("GET", "/?limit=1&cursor="+url.QueryEscape(page.Next), nil), pagination.Desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.GetRevisions(ctx, userID, passwordID, params); err != nil {
+		t.Fatal(err)
+	}
+
+	next := db.Queries[1]
+	if next.SQL != GetRevisionsDescQuery || *next.Args[2].(*string) != newer.Created.Format(time.RFC3339Nano) || *next.Args[3].(*uuid.UUID) != newer.RevisionID {
+		t.Fatalf("next page queried with %v, want it keyed on the newest revision", next.Args)
+	}
+}
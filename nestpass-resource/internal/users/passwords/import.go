@@ -0,0 +1,377 @@
+package passwords
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/users/categories"
+)
+
+// how entries matching an existing website and username pair are handled
+const (
+	DuplicatesSkip      = "skip"
+	DuplicatesOverwrite = "overwrite" // the existing entry takes the imported content and keeps its category
+	DuplicatesKeep      = "keep"      // the entry is imported next to the existing one
+)
+
+// what an import does with an entry
+const (
+	ImportCreate    = "create"
+	ImportOverwrite = "overwrite"
+	ImportSkip      = "skip"
+	ImportInvalid   = "invalid"
+)
+
+// root category unfiled entries go to when no target category is given
+const importCategory = "Imported"
+
+type ImportOptions struct {
+	Format     string `validate:"oneof=nestpass bitwarden csv keepass"`
+	Passphrase string `validate:"required_if=Format nestpass"`
+	DryRun     bool
+	Duplicates string `validate:"oneof=skip overwrite keep"`
+	// folder paths of the file mapped to existing categories, other folders are matched
+	// by name below the target or created
+	CategoryMap map[string]uuid.UUID
+	TargetID    *uuid.UUID // category folders are created under, the root when nil
+}
+
+func (o *ImportOptions) Validate() error {
+	if err := validator.New().Struct(o); err != nil {
+		log.Error().Str("location", "ImportOptions.Validate").Msg(err.Error())
+		return apiutils.NewErrBadRequest(err.Error())
+	}
+
+	return nil
+}
+
+// Outcome of an import, or of what it would do for dry runs.
+type ImportReport struct {
+	DryRun        bool            `json:"dry_run"`
+	Total         int             `json:"total"`
+	Created       int             `json:"created"`
+	Overwritten   int             `json:"overwritten"`
+	Skipped       int             `json:"skipped"`
+	Invalid       int             `json:"invalid"`
+	NewCategories []string        `json:"new_categories"`
+	Items         []*ImportResult `json:"items"`
+}
+
+type ImportResult struct {
+	Index      int        `json:"index"`
+	Website    string     `json:"website"`
+	Username   string     `json:"username,omitempty"`
+	Folder     string     `json:"folder,omitempty"`
+	Action     string     `json:"action"`
+	PasswordID *uuid.UUID `json:"password_id,omitempty"` // entry created, overwritten or duplicated
+	Error      string     `json:"error,omitempty"`
+}
+
+// Changes an import makes to the vault.
+type importPlan struct {
+	report     *ImportReport
+	categories []*categories.Category // parents come before their children
+	creates    []*Password
+	overwrites []*Password
+}
+
+// helper: written returns the entries the plan creates or overwrites and the categories they are filed in.
+func (p *importPlan) written() ([]uuid.UUID, []uuid.UUID) {
+	passwordIDs, categoryIDs := []uuid.UUID{}, []uuid.UUID{}
+	for _, psw := range append(append([]*Password{}, p.creates...), p.overwrites...) {
+		passwordIDs = append(passwordIDs, psw.PasswordID)
+		categoryIDs = append(categoryIDs, psw.CategoryID)
+	}
+
+	return passwordIDs, categoryIDs
+}
+
+// helper: duplicateKey identifies an entry by its website and username.
+func duplicateKey(psw *Password) string {
+	username := ""
+	if psw.Login != nil {
+		username = psw.Login.Username
+	}
+
+	return strings.ToLower(strings.TrimSpace(psw.Website)) + "\x00" + username
+}
+
+// Imports the entries of the file into a server side encrypted vault, dry runs only report
+// what would change.
+func (s *service) Import(ctx context.Context, userID uuid.UUID, data []byte, opts *ImportOptions) (*ImportReport, error) {
+	items, err := parseImport(ctx, opts.Format, data, opts.Passphrase)
+	if err != nil {
+		return nil, apiutils.NewErrBadRequest(err.Error())
+	}
+
+	// migrate legacy vaults before writing
+	if _, err := s.prepareVault(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "Import").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// the mode can not change and the tree stays as planned while the entries are written
+	vault, err := s.repo.LockVault(ctx, tx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Mode == ClientMode {
+		return nil, apiutils.NewErrConflict("client side encrypted vaults are imported by the client")
+	}
+
+	if err := s.categories.LockTree(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	ring, err := s.keyRing(ctx, vault)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.planImport(ctx, userID, vault, ring, items, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return plan.report, nil
+	}
+
+	for _, category := range plan.categories {
+		if err := s.categories.CreateCategory(ctx, tx, category); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, psw := range plan.creates {
+		data, err := seal(vault, ring, psw)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.repo.CreatePassword(ctx, tx, data); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, psw := range plan.overwrites {
+		current, err := s.repo.GetPasswordForUpdate(ctx, tx, userID, psw.PasswordID, psw.CategoryID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.addRevision(ctx, tx, current); err != nil {
+			return nil, err
+		}
+
+		data, err := seal(vault, ring, psw)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.repo.UpdatePassword(ctx, tx, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "Import").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	log.Info().Str("location", "Import").Msgf("%v: %v entries created, %v overwritten from %v", userID, plan.report.Created, plan.report.Overwritten, opts.Format)
+	passwordIDs, categoryIDs := plan.written()
+	s.afterWrite(ctx, userID, passwordIDs, categoryIDs)
+	return plan.report, nil
+}
+
+// helper: planImport validates the entries, detects duplicates and maps their folders onto
+// the category tree.
+func (s *service) planImport(ctx context.Context, userID uuid.UUID, vault *Vault, ring *keyRing, items []*importItem, opts *ImportOptions) (*importPlan, error) {
+	tree, err := s.categories.GetSubtree(ctx, userID, nil, categories.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	folders, err := newFolderMapper(userID, tree, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.repo.GetAllPasswordsNonPaged(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]*Password{}
+	for _, password := range stored {
+		psw, err := open(vault, ring, password)
+		if err != nil {
+			return nil, err
+		}
+
+		existing[duplicateKey(psw)] = psw
+	}
+
+	plan := &importPlan{report: &ImportReport{DryRun: opts.DryRun, Total: len(items), Items: []*ImportResult{}}}
+	validate := validator.New()
+	seen := map[string]bool{}
+
+	for i, item := range items {
+		psw := item.Password
+		psw.UserID = userID
+
+		result := &ImportResult{Index: i, Website: psw.Website, Folder: folderPath(item.Folder)}
+		if psw.Login != nil {
+			result.Username = psw.Login.Username
+		}
+		plan.report.Items = append(plan.report.Items, result)
+
+		err := validate.StructExcept(psw, "UserID", "CategoryID")
+		if err == nil {
+			err = psw.Validate()
+		}
+
+		if err != nil {
+			result.Action, result.Error = ImportInvalid, err.Error()
+			plan.report.Invalid++
+			continue
+		}
+
+		key := duplicateKey(psw)
+		duplicate, isDuplicate := existing[key]
+
+		switch {
+		case opts.Duplicates != DuplicatesKeep && seen[key]:
+			result.Action = ImportSkip
+			plan.report.Skipped++
+		case isDuplicate && opts.Duplicates == DuplicatesSkip:
+			result.Action, result.PasswordID = ImportSkip, &duplicate.PasswordID
+			plan.report.Skipped++
+		case isDuplicate && opts.Duplicates == DuplicatesOverwrite:
+			psw.PasswordID, psw.CategoryID = duplicate.PasswordID, duplicate.CategoryID
+			result.Action, result.PasswordID = ImportOverwrite, &psw.PasswordID
+			plan.overwrites = append(plan.overwrites, psw)
+			plan.report.Overwritten++
+		default:
+			psw.PasswordID, psw.CategoryID = uuid.New(), folders.resolve(item.Folder)
+			result.Action, result.PasswordID = ImportCreate, &psw.PasswordID
+			plan.creates = append(plan.creates, psw)
+			plan.report.Created++
+		}
+
+		seen[key] = true
+	}
+
+	plan.categories = folders.created
+	plan.report.NewCategories = folders.paths
+	return plan, nil
+}
+
+// Maps the folder paths of an import file onto the user's categories.
+type folderMapper struct {
+	userID   uuid.UUID
+	targetID *uuid.UUID
+	byID     map[uuid.UUID]*categories.Category
+	children map[uuid.UUID]map[string]uuid.UUID // names below a category, uuid.Nil for the root
+	resolved map[string]uuid.UUID
+	created  []*categories.Category
+	paths    []string
+}
+
+func newFolderMapper(userID uuid.UUID, tree []*categories.Category, opts *ImportOptions) (*folderMapper, error) {
+	m := &folderMapper{
+		userID:   userID,
+		targetID: opts.TargetID,
+		byID:     map[uuid.UUID]*categories.Category{},
+		children: map[uuid.UUID]map[string]uuid.UUID{},
+		resolved: map[string]uuid.UUID{},
+		paths:    []string{},
+	}
+
+	for _, category := range categories.Flatten(tree) {
+		m.add(category)
+	}
+
+	if opts.TargetID != nil {
+		if _, ok := m.byID[*opts.TargetID]; !ok {
+			return nil, apiutils.NewErrNotFound("target category not found")
+		}
+	}
+
+	// mapped folders resolve to their category directly
+	for path, categoryID := range opts.CategoryMap {
+		if _, ok := m.byID[categoryID]; !ok {
+			return nil, apiutils.NewErrNotFound("category mapped from " + path + " not found")
+		}
+
+		m.resolved[folderPath(path)] = categoryID
+	}
+
+	return m, nil
+}
+
+// helper: add registers the category under its parent.
+func (m *folderMapper) add(category *categories.Category) {
+	parentID := uuid.Nil
+	if category.ParentID != nil {
+		parentID = *category.ParentID
+	}
+
+	if m.children[parentID] == nil {
+		m.children[parentID] = map[string]uuid.UUID{}
+	}
+
+	m.byID[category.CategoryID] = category
+	m.children[parentID][category.Name] = category.CategoryID
+}
+
+// helper: resolve returns the category of the folder, planning the missing part of its path.
+func (m *folderMapper) resolve(folder string) uuid.UUID {
+	path := folderPath(folder)
+	if categoryID, ok := m.resolved[path]; ok {
+		return categoryID
+	}
+
+	parentID := m.targetID
+	if path == "" {
+		if parentID != nil {
+			return *parentID
+		}
+		path = importCategory
+	}
+
+	names := strings.Split(path, "/")
+	for i, name := range names {
+		key := uuid.Nil
+		if parentID != nil {
+			key = *parentID
+		}
+
+		categoryID, ok := m.children[key][name]
+		if !ok {
+			category := categories.New(name, "", m.userID, parentID)
+			m.add(category)
+			m.created = append(m.created, category)
+			m.paths = append(m.paths, strings.Join(names[:i+1], "/"))
+			categoryID = category.CategoryID
+		}
+
+		parentID = &categoryID
+	}
+
+	m.resolved[folderPath(folder)] = *parentID
+	return *parentID
+}
@@ -0,0 +1,476 @@
+package passwords
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// supported import formats
+const (
+	ImportNestpass  = "nestpass"  // archive written by an export
+	ImportBitwarden = "bitwarden" // unencrypted bitwarden json export
+	ImportCSV       = "csv"       // csv with a header row, as written by most password managers
+	ImportKeePass   = "keepass"   // keepass 2 xml export
+)
+
+// Entry read from an import file along with the path of the folder it was filed in.
+type importItem struct {
+	Folder   string
+	Password *Password
+}
+
+// helper: parseImport reads the entries of an import file in the given format.
+func parseImport(ctx context.Context, format string, data []byte, passphrase string) ([]*importItem, error) {
+	switch format {
+	case ImportNestpass:
+		return parseArchive(ctx, data, passphrase)
+	case ImportBitwarden:
+		return parseBitwarden(data)
+	case ImportCSV:
+		return parseCSV(data)
+	case ImportKeePass:
+		return parseKeePass(data)
+	}
+
+	return nil, errors.New("unsupported import format")
+}
+
+// helper: folderPath normalizes a folder path to names joined by slashes, nested folders of
+// every format are separated by a slash or a backslash.
+func folderPath(path string) string {
+	names := []string{}
+	for _, name := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, "/")
+}
+
+// helper: itemTitle falls back to the host of the item's uri when it has no name.
+func itemTitle(name, uri string) string {
+	if name = strings.TrimSpace(name); name != "" || uri == "" {
+		return name
+	}
+
+	if u, err := url.Parse(uri); err == nil && u.Host != "" {
+		return u.Host
+	}
+
+	return uri
+}
+
+// helper: loginOrNote creates a login, or a note when the entry only has notes.
+func loginOrNote(title, username, password, uri, notes string) *Password {
+	psw := &Password{Website: itemTitle(title, uri), Type: ItemLogin, Notes: notes}
+	if username == "" && password == "" && uri == "" && notes != "" {
+		psw.Type, psw.Notes, psw.Note = ItemNote, "", &Note{Text: notes}
+		return psw
+	}
+
+	psw.Login = &Login{Username: username, Password: password}
+	if uri != "" {
+		psw.Login.URIs = []string{uri}
+	}
+
+	return psw
+}
+
+// helper: parseArchive decrypts an archive and files its items under their category paths.
+func parseArchive(ctx context.Context, data []byte, passphrase string) ([]*importItem, error) {
+	reader, err := newArchiveReader(ctx, bytes.NewReader(data), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &vaultArchive{}
+	if err := json.NewDecoder(reader).Decode(archive); err != nil {
+		if errors.Is(err, errArchivePassphrase) {
+			return nil, err
+		}
+
+		return nil, errors.New("invalid archive payload")
+	}
+
+	if archive.Version != archivePayloadVersion {
+		return nil, errors.New("unsupported archive payload version")
+	}
+
+	byID := map[uuid.UUID]*archiveCategory{}
+	for _, category := range archive.Categories {
+		byID[category.CategoryID] = category
+	}
+
+	// paths are built from the parents up, a cycle in a tampered archive ends the path
+	path := func(categoryID uuid.UUID) string {
+		names := []string{}
+		for category, ok := byID[categoryID]; ok && len(names) <= len(byID); {
+			names = append([]string{strings.ReplaceAll(category.Name, "/", "-")}, names...)
+			if category.ParentID == nil {
+				break
+			}
+			category, ok = byID[*category.ParentID]
+		}
+
+		return strings.Join(names, "/")
+	}
+
+	items := []*importItem{}
+	for _, item := range archive.Items {
+		psw := &Password{Website: item.Website}
+		if item.Item != nil {
+			item.Item.apply(psw)
+		}
+
+		items = append(items, &importItem{Folder: path(item.CategoryID), Password: psw})
+	}
+
+	return items, nil
+}
+
+// Unencrypted bitwarden json export.
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []*bitwardenItem `json:"items"`
+}
+
+type bitwardenItem struct {
+	Type     int     `json:"type"`
+	Name     string  `json:"name"`
+	Notes    *string `json:"notes"`
+	FolderID *string `json:"folderId"`
+	Login    *struct {
+		Username *string `json:"username"`
+		Password *string `json:"password"`
+		TOTP     *string `json:"totp"`
+		URIs     []struct {
+			URI *string `json:"uri"`
+		} `json:"uris"`
+	} `json:"login"`
+	Card *struct {
+		Holder   *string `json:"cardholderName"`
+		Brand    *string `json:"brand"`
+		Number   *string `json:"number"`
+		ExpMonth *string `json:"expMonth"`
+		ExpYear  *string `json:"expYear"`
+		Code     *string `json:"code"`
+	} `json:"card"`
+	Identity map[string]*string `json:"identity"`
+	SSHKey   *struct {
+		PrivateKey  *string `json:"privateKey"`
+		PublicKey   *string `json:"publicKey"`
+		Fingerprint *string `json:"keyFingerprint"`
+	} `json:"sshKey"`
+	Fields []struct {
+		Name  *string `json:"name"`
+		Value *string `json:"value"`
+		Type  int     `json:"type"`
+	} `json:"fields"`
+}
+
+// bitwarden item and field types
+const (
+	bitwardenLogin    = 1
+	bitwardenNote     = 2
+	bitwardenCard     = 3
+	bitwardenIdentity = 4
+	bitwardenSSHKey   = 5
+
+	bitwardenHidden = 1
+	bitwardenLinked = 3
+)
+
+// helper: str dereferences the optional strings of a bitwarden export.
+func str(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+// helper: parseBitwarden maps the items of a bitwarden export onto the item types.
+func parseBitwarden(data []byte) ([]*importItem, error) {
+	export := &bitwardenExport{}
+	if err := json.Unmarshal(data, export); err != nil {
+		return nil, errors.New("invalid bitwarden export")
+	}
+
+	if export.Encrypted {
+		return nil, errors.New("encrypted bitwarden exports are not supported, export the vault unencrypted")
+	}
+
+	folders := map[string]string{}
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+
+	items := []*importItem{}
+	for _, item := range export.Items {
+		psw := &Password{Website: item.Name, Notes: str(item.Notes)}
+
+		switch item.Type {
+		case bitwardenLogin:
+			psw.Type, psw.Login = ItemLogin, &Login{}
+			if item.Login != nil {
+				psw.Login.Username, psw.Login.Password = str(item.Login.Username), str(item.Login.Password)
+				for _, uri := range item.Login.URIs {
+					if str(uri.URI) != "" {
+						psw.Login.URIs = append(psw.Login.URIs, str(uri.URI))
+					}
+				}
+
+				if totp := str(item.Login.TOTP); totp != "" {
+					psw.Fields = append(psw.Fields, &CustomField{Name: "totp", Type: FieldTOTP, Value: totp})
+				}
+
+				if len(psw.Login.URIs) != 0 {
+					psw.Website = itemTitle(item.Name, psw.Login.URIs[0])
+				}
+			}
+		case bitwardenNote:
+			psw.Type, psw.Notes, psw.Note = ItemNote, "", &Note{Text: str(item.Notes)}
+		case bitwardenCard:
+			psw.Type, psw.Card = ItemCard, &Card{}
+			if item.Card != nil {
+				month, _ := strconv.Atoi(str(item.Card.ExpMonth))
+				year, _ := strconv.Atoi(str(item.Card.ExpYear))
+				psw.Card = &Card{
+					Holder:   str(item.Card.Holder),
+					Brand:    str(item.Card.Brand),
+					Number:   str(item.Card.Number),
+					ExpMonth: month,
+					ExpYear:  year,
+					CVV:      str(item.Card.Code),
+				}
+			}
+		case bitwardenIdentity:
+			id := func(key string) string { return str(item.Identity[key]) }
+			psw.Type, psw.Identity = ItemIdentity, &Identity{
+				Title:      id("title"),
+				FirstName:  id("firstName"),
+				MiddleName: id("middleName"),
+				LastName:   id("lastName"),
+				Company:    id("company"),
+				Email:      id("email"),
+				Phone:      id("phone"),
+				Address1:   id("address1"),
+				Address2:   strings.TrimSpace(id("address2") + " " + id("address3")),
+				City:       id("city"),
+				State:      id("state"),
+				PostalCode: id("postalCode"),
+				Country:    id("country"),
+				SSN:        id("ssn"),
+				Passport:   id("passportNumber"),
+				License:    id("licenseNumber"),
+			}
+		case bitwardenSSHKey:
+			psw.Type, psw.SSHKey = ItemSSHKey, &SSHKey{}
+			if item.SSHKey != nil {
+				psw.SSHKey.PrivateKey, psw.SSHKey.PublicKey = str(item.SSHKey.PrivateKey), str(item.SSHKey.PublicKey)
+			}
+		default:
+			psw.Type = "unsupported bitwarden type " + strconv.Itoa(item.Type)
+		}
+
+		for _, field := range item.Fields {
+			// linked fields only point at another field of the item
+			if field.Type == bitwardenLinked {
+				continue
+			}
+
+			fieldType := FieldText
+			if field.Type == bitwardenHidden {
+				fieldType = FieldHidden
+			}
+
+			psw.Fields = append(psw.Fields, &CustomField{Name: str(field.Name), Type: fieldType, Value: str(field.Value)})
+		}
+
+		items = append(items, &importItem{Folder: folders[str(item.FolderID)], Password: psw})
+	}
+
+	return items, nil
+}
+
+// csv column names of the exports of common password managers, matched case insensitively
+var csvColumns = map[string][]string{
+	"title":    {"name", "title", "account"},
+	"url":      {"url", "uri", "login_uri", "website", "web site"},
+	"username": {"username", "login_username", "user name", "login", "email"},
+	"password": {"password", "login_password"},
+	"notes":    {"notes", "note", "extra", "comments"},
+	"folder":   {"folder", "grouping", "group", "category"},
+	"totp":     {"totp", "login_totp", "otpauth"},
+	"type":     {"type"},
+}
+
+// lastpass marks secure notes with this url
+const lastpassNoteURL = "http://sn"
+
+// helper: parseCSV reads a csv export with a header row naming its columns.
+func parseCSV(data []byte) ([]*importItem, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("invalid csv file")
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for column, aliases := range csvColumns {
+			for _, alias := range aliases {
+				if _, taken := columns[column]; !taken && name == alias {
+					columns[column] = i
+				}
+			}
+		}
+	}
+
+	_, hasTitle := columns["title"]
+	_, hasURL := columns["url"]
+	if !hasTitle && !hasURL {
+		return nil, errors.New("csv file needs a name or url column")
+	}
+
+	items := []*importItem{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("invalid csv file: " + err.Error())
+		}
+
+		get := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		uri, notes := get("url"), get("notes")
+		var psw *Password
+		if itemType := strings.ToLower(get("type")); itemType == "note" || itemType == "securenote" || uri == lastpassNoteURL {
+			psw = &Password{Website: get("title"), Type: ItemNote, Note: &Note{Text: notes}}
+		} else {
+			psw = loginOrNote(get("title"), get("username"), get("password"), uri, notes)
+		}
+
+		if totp := get("totp"); totp != "" {
+			psw.Fields = append(psw.Fields, &CustomField{Name: "totp", Type: FieldTOTP, Value: totp})
+		}
+
+		items = append(items, &importItem{Folder: get("folder"), Password: psw})
+	}
+
+	return items, nil
+}
+
+// KeePass 2 xml export.
+type keepassFile struct {
+	Meta struct {
+		RecycleBinUUID string `xml:"RecycleBinUUID"`
+	} `xml:"Meta"`
+	Root struct {
+		Groups []*keepassGroup `xml:"Group"`
+	} `xml:"Root"`
+}
+
+type keepassGroup struct {
+	UUID    string          `xml:"UUID"`
+	Name    string          `xml:"Name"`
+	Entries []*keepassEntry `xml:"Entry"`
+	Groups  []*keepassGroup `xml:"Group"`
+}
+
+type keepassEntry struct {
+	Strings []struct {
+		Key   string `xml:"Key"`
+		Value struct {
+			Text            string `xml:",chardata"`
+			Protected       string `xml:"Protected,attr"`
+			ProtectInMemory string `xml:"ProtectInMemory,attr"`
+		} `xml:"Value"`
+	} `xml:"String"`
+}
+
+// helper: parseKeePass reads the entries of a keepass xml export, the root group is the
+// database itself and the recycle bin is left out.
+func parseKeePass(data []byte) ([]*importItem, error) {
+	file := &keepassFile{}
+	if err := xml.Unmarshal(data, file); err != nil {
+		return nil, errors.New("invalid keepass xml file")
+	}
+
+	items := []*importItem{}
+	var walk func(group *keepassGroup, path string) error
+	walk = func(group *keepassGroup, path string) error {
+		if file.Meta.RecycleBinUUID != "" && group.UUID == file.Meta.RecycleBinUUID {
+			return nil
+		}
+
+		for _, entry := range group.Entries {
+			values, fields := map[string]string{}, []*CustomField{}
+			for _, field := range entry.Strings {
+				// values of kdbx files are encrypted with the database's inner stream
+				if strings.EqualFold(field.Value.Protected, "true") {
+					return errors.New("protected keepass values are not supported, export the database as xml")
+				}
+
+				switch field.Key {
+				case "Title", "UserName", "Password", "URL", "Notes":
+					values[field.Key] = field.Value.Text
+				case "otp", "TOTP Seed":
+					fields = append(fields, &CustomField{Name: "totp", Type: FieldTOTP, Value: field.Value.Text})
+				default:
+					fieldType := FieldText
+					if strings.EqualFold(field.Value.ProtectInMemory, "true") {
+						fieldType = FieldHidden
+					}
+					fields = append(fields, &CustomField{Name: field.Key, Type: fieldType, Value: field.Value.Text})
+				}
+			}
+
+			psw := loginOrNote(values["Title"], values["UserName"], values["Password"], values["URL"], values["Notes"])
+			psw.Fields = fields
+			items = append(items, &importItem{Folder: path, Password: psw})
+		}
+
+		for _, child := range group.Groups {
+			if err := walk(child, path+"/"+strings.ReplaceAll(child.Name, "/", "-")); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, root := range file.Root.Groups {
+		if err := walk(root, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
@@ -0,0 +1,304 @@
+package passwords
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+	"golang.org/x/crypto/ssh"
+)
+
+// vault item types
+const (
+	ItemLogin    = "login"
+	ItemNote     = "note"
+	ItemCard     = "card"
+	ItemIdentity = "identity"
+	ItemSSHKey   = "ssh_key"
+	ItemAPIToken = "api_token"
+)
+
+// custom field types
+const (
+	FieldText   = "text"
+	FieldHidden = "hidden" // masked by clients
+	FieldURL    = "url"
+	FieldTOTP   = "totp" // base32 seed or otpauth uri
+)
+
+// version of the encrypted item payload, version 1 payloads only held a username, password and description
+const itemSchemaVersion = 2
+
+type Login struct {
+	Username string   `json:"username" validate:"required"`
+	Password string   `json:"password" validate:"required"`
+	URIs     []string `json:"uris,omitempty" validate:"dive,url"`
+}
+
+type Note struct {
+	Text string `json:"text" validate:"required"`
+}
+
+type Card struct {
+	Holder   string `json:"holder,omitempty"`
+	Brand    string `json:"brand,omitempty"`
+	Number   string `json:"number" validate:"required,credit_card"`
+	ExpMonth int    `json:"exp_month" validate:"required,min=1,max=12"`
+	ExpYear  int    `json:"exp_year" validate:"required,min=2000,max=2999"`
+	CVV      string `json:"cvv,omitempty" validate:"omitempty,numeric,min=3,max=4"`
+}
+
+type Identity struct {
+	Title      string `json:"title,omitempty"`
+	FirstName  string `json:"first_name,omitempty" validate:"required_without_all=LastName Company Email"`
+	MiddleName string `json:"middle_name,omitempty"`
+	LastName   string `json:"last_name,omitempty"`
+	Company    string `json:"company,omitempty"`
+	Email      string `json:"email,omitempty" validate:"omitempty,email"`
+	Phone      string `json:"phone,omitempty"`
+	Address1   string `json:"address1,omitempty"`
+	Address2   string `json:"address2,omitempty"`
+	City       string `json:"city,omitempty"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty"`
+	SSN        string `json:"ssn,omitempty"`
+	Passport   string `json:"passport,omitempty"`
+	License    string `json:"license,omitempty"`
+}
+
+type SSHKey struct {
+	PrivateKey  string `json:"private_key" validate:"required"`
+	PublicKey   string `json:"public_key,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"` // derived from the key, set by the server
+	Passphrase  string `json:"passphrase,omitempty"`
+}
+
+type APIToken struct {
+	Token   string     `json:"token" validate:"required"`
+	Host    string     `json:"host,omitempty" validate:"omitempty,url"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// User defined field attached to an item of any type.
+type CustomField struct {
+	Name  string `json:"name" validate:"required,max=128"`
+	Type  string `json:"type" validate:"required,oneof=text hidden url totp"`
+	Value string `json:"value"`
+}
+
+// Encrypted payload of a server side encrypted item.
+type itemData struct {
+	Version  int            `json:"v"`
+	Type     string         `json:"type"`
+	Notes    string         `json:"notes,omitempty"`
+	Login    *Login         `json:"login,omitempty"`
+	Note     *Note          `json:"note,omitempty"`
+	Card     *Card          `json:"card,omitempty"`
+	Identity *Identity      `json:"identity,omitempty"`
+	SSHKey   *SSHKey        `json:"ssh_key,omitempty"`
+	APIToken *APIToken      `json:"api_token,omitempty"`
+	Fields   []*CustomField `json:"fields,omitempty"`
+	OTP      *otpData       `json:"otp,omitempty"`
+}
+
+// helper: newItemData pulls the encrypted content out of the item.
+func newItemData(psw *Password) *itemData {
+	return &itemData{
+		Version:  itemSchemaVersion,
+		Type:     psw.Type,
+		Notes:    psw.Notes,
+		Login:    psw.Login,
+		Note:     psw.Note,
+		Card:     psw.Card,
+		Identity: psw.Identity,
+		SSHKey:   psw.SSHKey,
+		APIToken: psw.APIToken,
+		Fields:   psw.Fields,
+		OTP:      (*otpData)(psw.OTP),
+	}
+}
+
+// helper: decodeItem deserializes a decrypted payload, version 1 payloads are read as logins.
+func decodeItem(raw []byte) (*itemData, error) {
+	data := &itemData{}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, err
+	}
+
+	if data.Version >= itemSchemaVersion {
+		return data, nil
+	}
+
+	legacy := &pswData{}
+	if err := json.Unmarshal(raw, legacy); err != nil {
+		return nil, err
+	}
+
+	return &itemData{
+		Version: itemSchemaVersion,
+		Type:    ItemLogin,
+		Notes:   legacy.Description,
+		Login:   &Login{Username: legacy.Username, Password: legacy.Password},
+	}, nil
+}
+
+// helper: apply sets the decrypted content on the item.
+func (d *itemData) apply(psw *Password) {
+	psw.Type, psw.Notes, psw.Fields = d.Type, d.Notes, d.Fields
+	psw.Login, psw.Note, psw.Card = d.Login, d.Note, d.Card
+	psw.Identity, psw.SSHKey, psw.APIToken = d.Identity, d.SSHKey, d.APIToken
+	psw.OTP = (*OTP)(d.OTP)
+}
+
+// helper: hasContent checks if any plaintext content is set on the item.
+func (p *Password) hasContent() bool {
+	return p.Type != "" || p.Notes != "" || len(p.Fields) != 0 || p.Login != nil || p.Note != nil ||
+		p.Card != nil || p.Identity != nil || p.SSHKey != nil || p.APIToken != nil || p.OTP != nil
+}
+
+// Validates the item for its type, only the section matching the type may be set.
+// Sealed items of client side encrypted vaults carry no plaintext content.
+func (p *Password) Validate() error {
+	if len(p.Sealed) != 0 {
+		if p.hasContent() {
+			return apiutils.NewErrBadRequest("sealed entries can not carry plaintext fields")
+		}
+
+		return nil
+	}
+
+	sections := map[string]any{
+		ItemLogin:    p.Login,
+		ItemNote:     p.Note,
+		ItemCard:     p.Card,
+		ItemIdentity: p.Identity,
+		ItemSSHKey:   p.SSHKey,
+		ItemAPIToken: p.APIToken,
+	}
+
+	section, ok := sections[p.Type]
+	if !ok {
+		return apiutils.NewErrBadRequest("invalid item type " + p.Type)
+	}
+
+	for itemType, other := range sections {
+		if itemType != p.Type && !isNil(other) {
+			return apiutils.NewErrBadRequest(itemType + " fields are not allowed on a " + p.Type + " item")
+		}
+	}
+
+	if isNil(section) {
+		return apiutils.NewErrBadRequest("missing " + p.Type + " fields")
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(section); err != nil {
+		log.Error().Str("location", "Password.Validate").Msg(err.Error())
+		return apiutils.NewErrBadRequest(err.Error())
+	}
+
+	if p.SSHKey != nil {
+		if err := p.SSHKey.normalize(); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range p.Fields {
+		if err := field.validate(validate); err != nil {
+			return err
+		}
+	}
+
+	if p.OTP != nil {
+		if err := p.OTP.normalize(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// helper: isNil checks if a typed section pointer stored in an interface is nil.
+func isNil(section any) bool {
+	switch s := section.(type) {
+	case *Login:
+		return s == nil
+	case *Note:
+		return s == nil
+	case *Card:
+		return s == nil
+	case *Identity:
+		return s == nil
+	case *SSHKey:
+		return s == nil
+	case *APIToken:
+		return s == nil
+	}
+
+	return section == nil
+}
+
+// helper: normalize checks the key parses and derives its public key and fingerprint.
+// Keys protected by a passphrase can not be parsed, their public key is kept as given.
+func (k *SSHKey) normalize() error {
+	signer, err := ssh.ParsePrivateKey([]byte(k.PrivateKey))
+	if err != nil {
+		if _, ok := err.(*ssh.PassphraseMissingError); !ok {
+			return apiutils.NewErrBadRequest("invalid ssh private key")
+		}
+
+		if k.PublicKey == "" {
+			return nil
+		}
+
+		public, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k.PublicKey))
+		if err != nil {
+			return apiutils.NewErrBadRequest("invalid ssh public key")
+		}
+
+		k.Fingerprint = ssh.FingerprintSHA256(public)
+		return nil
+	}
+
+	k.PublicKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	k.Fingerprint = ssh.FingerprintSHA256(signer.PublicKey())
+	return nil
+}
+
+// helper: validate checks the field and its value for the field type.
+func (f *CustomField) validate(validate *validator.Validate) error {
+	if err := validate.Struct(f); err != nil {
+		return apiutils.NewErrBadRequest(err.Error())
+	}
+
+	switch f.Type {
+	case FieldURL:
+		if _, err := url.ParseRequestURI(f.Value); err != nil {
+			return apiutils.NewErrBadRequest("field " + f.Name + " is not a valid url")
+		}
+	case FieldTOTP:
+		if !isTOTPSeed(f.Value) {
+			return apiutils.NewErrBadRequest("field " + f.Name + " is not a valid totp seed")
+		}
+	}
+
+	return nil
+}
+
+// helper: isTOTPSeed checks for an otpauth uri or a base32 encoded seed.
+func isTOTPSeed(value string) bool {
+	if strings.HasPrefix(value, "otpauth://") {
+		u, err := url.Parse(value)
+		return err == nil && u.Host == "totp" && isTOTPSeed(u.Query().Get("secret"))
+	}
+
+	seed := strings.ToUpper(strings.ReplaceAll(value, " ", ""))
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(seed, "="))
+	return err == nil && len(decoded) >= 10
+}
@@ -0,0 +1,106 @@
+package passwords
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+func Test_DecodeLegacyItem(t *testing.T) {
+	raw, _ := json.Marshal(&pswData{Username: "user", Password: "psw", Description: "desc"})
+
+	data, err := decodeItem(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.Version != itemSchemaVersion || data.Type != ItemLogin || data.Notes != "desc" {
+		t.Fatalf("legacy payload not upgraded: %+v", data)
+	}
+	if data.Login == nil || data.Login.Username != "user" || data.Login.Password != "psw" {
+		t.Fatal("legacy credentials lost")
+	}
+}
+
+func Test_ItemRoundTrip(t *testing.T) {
+	key, _ := newDEK()
+	item := &Password{
+		UserID:  uuid.New(),
+		Website: "bank",
+		Type:    ItemCard,
+		Card:    &Card{Number: "4111111111111111", ExpMonth: 12, ExpYear: 2030, CVV: "123"},
+		Fields:  []*CustomField{{Name: "pin", Type: FieldHidden, Value: "0000"}},
+	}
+
+	encrypted, err := NewPasswordEncrypt(item, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := encrypted.Decrypt(item.UserID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decrypted.Type != ItemCard || decrypted.Card.Number != item.Card.Number || decrypted.Fields[0].Value != "0000" {
+		t.Fatalf("item changed in round trip: %+v", decrypted)
+	}
+}
+
+func Test_ValidateItems(t *testing.T) {
+	valid := map[string]*Password{
+		"login":     {Type: ItemLogin, Login: &Login{Username: "user", Password: "psw", URIs: []string{"https://example.com"}}},
+		"note":      {Type: ItemNote, Note: &Note{Text: "text"}},
+		"card":      {Type: ItemCard, Card: &Card{Number: "4111111111111111", ExpMonth: 1, ExpYear: 2030}},
+		"identity":  {Type: ItemIdentity, Identity: &Identity{Email: "user@example.com"}},
+		"api token": {Type: ItemAPIToken, APIToken: &APIToken{Token: "token", Host: "https://api.example.com"}},
+		"totp field": {Type: ItemNote, Note: &Note{Text: "text"}, Fields: []*CustomField{
+			{Name: "otp", Type: FieldTOTP, Value: "otpauth://totp/example?secret=JBSWY3DPEHPK3PXP"},
+		}},
+	}
+	for name, item := range valid {
+		if err := item.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	invalid := map[string]*Password{
+		"unknown type":    {Type: "wifi"},
+		"missing section": {Type: ItemLogin},
+		"wrong section":   {Type: ItemLogin, Login: &Login{Username: "user", Password: "psw"}, Note: &Note{Text: "text"}},
+		"bad card number": {Type: ItemCard, Card: &Card{Number: "4111111111111112", ExpMonth: 1, ExpYear: 2030}},
+		"empty identity":  {Type: ItemIdentity, Identity: &Identity{Phone: "555"}},
+		"bad ssh key":     {Type: ItemSSHKey, SSHKey: &SSHKey{PrivateKey: "not a key"}},
+		"bad url field":   {Type: ItemNote, Note: &Note{Text: "text"}, Fields: []*CustomField{{Name: "site", Type: FieldURL, Value: "nope"}}},
+		"bad totp field":  {Type: ItemNote, Note: &Note{Text: "text"}, Fields: []*CustomField{{Name: "otp", Type: FieldTOTP, Value: "123"}}},
+		"sealed content":  {Sealed: []byte{1}, Note: &Note{Text: "text"}},
+	}
+	for name, item := range invalid {
+		if err := item.Validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func Test_SSHKeyFingerprint(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(private, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := &Password{Type: ItemSSHKey, SSHKey: &SSHKey{PrivateKey: string(pem.EncodeToMemory(block))}}
+	if err := item.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	public, _ := ssh.NewPublicKey(private.Public())
+	if item.SSHKey.Fingerprint != ssh.FingerprintSHA256(public) || item.SSHKey.PublicKey == "" {
+		t.Fatalf("public key not derived: %+v", item.SSHKey)
+	}
+}
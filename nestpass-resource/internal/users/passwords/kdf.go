@@ -0,0 +1,233 @@
+package passwords
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/sync/singleflight"
+)
+
+// supported key derivation functions
+const (
+	KDFArgon2id = "argon2id"
+	KDFPBKDF2   = "pbkdf2-sha256"
+)
+
+const (
+	kdfSaltSize = 16
+	// iterations of the pbkdf2 scheme used before parameters were stored
+	legacyIterations = 4096
+)
+
+// key derivations allowed to run at once, argon2id allocates its whole memory cost per derivation
+const kdfConcurrency = 4
+
+// how long a derived key encryption key is reused, a password change derives a different key
+const kekCacheTTL = 5 * time.Minute
+
+// cached keys kept before expired entries are pruned, after a prune the threshold is twice
+// the entries left so pruning stays amortized constant per derivation
+const kekPruneThreshold = 1024
+
+// Key derivation parameters, stored per user so the work factor can be raised over time.
+type KDFParams struct {
+	Algorithm   string `json:"algorithm"`
+	Memory      uint32 `json:"memory,omitempty"` // KiB, argon2id only
+	Iterations  uint32 `json:"iterations"`
+	Parallelism uint8  `json:"parallelism,omitempty"` // argon2id only
+	Salt        []byte `json:"salt"`
+}
+
+// Creates the policy new vaults are derived with, rejecting settings below current guidance.
+func NewKDFPolicy(algorithm string, memory, iterations uint32, parallelism uint8) (*KDFParams, error) {
+	policy := &KDFParams{Algorithm: algorithm, Iterations: iterations}
+	switch algorithm {
+	case KDFArgon2id:
+		if memory < 19*1024 || iterations < 2 || parallelism < 1 {
+			return nil, errors.New("argon2id requires at least 19 MiB of memory, 2 iterations and 1 thread")
+		}
+		policy.Memory, policy.Parallelism = memory, parallelism
+	case KDFPBKDF2:
+		if iterations < 600000 {
+			return nil, errors.New("pbkdf2-sha256 requires at least 600000 iterations")
+		}
+	default:
+		return nil, errors.New("unsupported kdf algorithm")
+	}
+
+	return policy, nil
+}
+
+// Parameters of the pbkdf2 scheme every vault was derived with before parameters were stored.
+func legacyKDFParams(salt []byte) *KDFParams {
+	return &KDFParams{Algorithm: KDFPBKDF2, Iterations: legacyIterations, Salt: salt}
+}
+
+// Creates parameters following the policy with a fresh salt.
+func (p *KDFParams) withSalt() (*KDFParams, error) {
+	salt := make([]byte, kdfSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		log.Error().Str("location", "KDFParams.withSalt").Msg(err.Error())
+		return nil, err
+	}
+
+	params := *p
+	params.Salt = salt
+	return &params, nil
+}
+
+// Derives a key from the secret.
+func (p *KDFParams) Derive(secret []byte) ([]byte, error) {
+	if len(p.Salt) == 0 {
+		return nil, errors.New("missing kdf salt")
+	}
+
+	switch p.Algorithm {
+	case KDFArgon2id:
+		if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+
+		return argon2.IDKey(secret, p.Salt, p.Iterations, p.Memory, p.Parallelism, keySize), nil
+	case KDFPBKDF2:
+		if p.Iterations == 0 {
+			return nil, errors.New("invalid pbkdf2 parameters")
+		}
+
+		return pbkdf2.Key(secret, p.Salt, int(p.Iterations), keySize, sha256.New), nil
+	}
+
+	return nil, errors.New("unsupported kdf algorithm")
+}
+
+// Checks if the parameters are weaker than the policy and the key should be derived again.
+func (p *KDFParams) NeedsUpgrade(policy *KDFParams) bool {
+	if p.Algorithm != policy.Algorithm {
+		return true
+	}
+
+	return p.Iterations < policy.Iterations || p.Memory < policy.Memory || p.Parallelism < policy.Parallelism
+}
+
+// kdfLimiter bounds the key derivations running at once so concurrent requests cannot exhaust
+// the memory and cpu of the server.
+type kdfLimiter struct {
+	slots  chan struct{}
+	derive func(params *KDFParams, secret []byte) ([]byte, error)
+}
+
+// shared by every key derivation in the process
+var kdfSlots = newKDFLimiter(kdfConcurrency)
+
+// Creates a limiter allowing n derivations at once.
+func newKDFLimiter(n int) *kdfLimiter {
+	return &kdfLimiter{slots: make(chan struct{}, n), derive: (*KDFParams).Derive}
+}
+
+// Derives a key from the secret once a slot is free, giving up when the context ends first.
+func (l *kdfLimiter) Derive(ctx context.Context, params *KDFParams, secret []byte) ([]byte, error) {
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-l.slots }()
+
+	return l.derive(params, secret)
+}
+
+// derived key and when it stops being reused
+type cachedKey struct {
+	key     []byte
+	expires time.Time
+}
+
+// kekCache keeps derived key encryption keys for a short time so reading a vault does not run
+// the kdf on every request, concurrent derivations of the same key are shared.
+type kekCache struct {
+	limiter *kdfLimiter
+	ttl     time.Duration
+	group   singleflight.Group
+	mu      sync.Mutex
+	keys    map[string]cachedKey
+	pruneAt int // cache size that triggers the next prune
+}
+
+// Creates a cache deriving through the limiter.
+func newKEKCache(limiter *kdfLimiter, ttl time.Duration) *kekCache {
+	return &kekCache{limiter: limiter, ttl: ttl, keys: map[string]cachedKey{}, pruneAt: kekPruneThreshold}
+}
+
+// Derives a key from the secret or returns the key derived with the same parameters and secret,
+// a caller waiting on a shared derivation stops waiting when its own context ends.
+func (c *kekCache) Derive(ctx context.Context, params *KDFParams, secret []byte) ([]byte, error) {
+	id := kdfCacheKey(params, secret)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.keys[id]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return append([]byte(nil), entry.key...), nil
+	}
+
+	flight := c.group.DoChan(id, func() (interface{}, error) {
+		key, err := c.limiter.Derive(ctx, params, secret)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if len(c.keys) >= c.pruneAt {
+			c.prune(now)
+			c.pruneAt = max(kekPruneThreshold, 2*len(c.keys))
+		}
+		c.keys[id] = cachedKey{key: key, expires: time.Now().Add(c.ttl)}
+		c.mu.Unlock()
+
+		return key, nil
+	})
+
+	select {
+	case res := <-flight:
+		// the derivation was led by a caller whose context ended, derive again under this one
+		if res.Err != nil && res.Shared && ctx.Err() == nil && (errors.Is(res.Err, context.Canceled) || errors.Is(res.Err, context.DeadlineExceeded)) {
+			return c.Derive(ctx, params, secret)
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		return append([]byte(nil), res.Val.([]byte)...), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// helper: prune removes expired keys, must be called with the lock held.
+func (c *kekCache) prune(now time.Time) {
+	for id, entry := range c.keys {
+		if !now.Before(entry.expires) {
+			delete(c.keys, id)
+		}
+	}
+}
+
+// helper: kdfCacheKey hashes the parameters and secret so the cache holds no secret in the clear.
+func kdfCacheKey(params *KDFParams, secret []byte) string {
+	h := sha256.New()
+	h.Write([]byte(params.Algorithm))
+	binary.Write(h, binary.BigEndian, []uint32{params.Memory, params.Iterations, uint32(params.Parallelism), uint32(len(params.Salt))})
+	h.Write(params.Salt)
+	h.Write(secret)
+	return string(h.Sum(nil))
+}
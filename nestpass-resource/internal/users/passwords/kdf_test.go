@@ -0,0 +1,191 @@
+package passwords
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func Test_KDFKnownAnswers(t *testing.T) {
+	cases := []struct {
+		name   string
+		params *KDFParams
+		secret string
+		want   string
+	}{
+		{
+			// reference implementation test vector (argon2id, v=19)
+			name:   "argon2id",
+			params: &KDFParams{Algorithm: KDFArgon2id, Memory: 65536, Iterations: 2, Parallelism: 1, Salt: []byte("somesalt")},
+			secret: "password",
+			want:   "09316115d5cf24ed5a15a31a3ba326e5cf32edc24702987c02b6566f61913cf7",
+		},
+		{
+			// RFC 7914 section 11, first 32 bytes
+			name:   "pbkdf2-sha256 c=1",
+			params: &KDFParams{Algorithm: KDFPBKDF2, Iterations: 1, Salt: []byte("salt")},
+			secret: "passwd",
+			want:   "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc",
+		},
+		{
+			// RFC 7914 section 11, first 32 bytes
+			name:   "pbkdf2-sha256 c=80000",
+			params: &KDFParams{Algorithm: KDFPBKDF2, Iterations: 80000, Salt: []byte("NaCl")},
+			secret: "Password",
+			want:   "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := tc.params.Derive([]byte(tc.secret))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(key, mustHex(t, tc.want)) {
+				t.Fatalf("got %x, want %s", key, tc.want)
+			}
+		})
+	}
+}
+
+func Test_LegacyKDFMatchesPreviousScheme(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	secret := []byte("$2a$10$hash:3f2b0e8e-0000-4000-8000-000000000000")
+
+	key, err := legacyKDFParams(salt).Derive(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(key, pbkdf2.Key(secret, salt, 4096, 32, sha256.New)) {
+		t.Fatal("legacy parameters do not reproduce the previous key")
+	}
+}
+
+func Test_KDFNeedsUpgrade(t *testing.T) {
+	policy, err := NewKDFPolicy(KDFArgon2id, 64*1024, 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !legacyKDFParams([]byte("salt")).NeedsUpgrade(policy) {
+		t.Fatal("legacy pbkdf2 parameters should be upgraded")
+	}
+
+	current, _ := policy.withSalt()
+	if current.NeedsUpgrade(policy) {
+		t.Fatal("parameters matching the policy should not be upgraded")
+	}
+
+	raised, _ := NewKDFPolicy(KDFArgon2id, 128*1024, 3, 4)
+	if !current.NeedsUpgrade(raised) {
+		t.Fatal("raising the memory cost should upgrade the parameters")
+	}
+
+	if _, err := NewKDFPolicy(KDFPBKDF2, 4096, 0, 0); err == nil {
+		t.Fatal("weak pbkdf2 policy accepted")
+	}
+}
+
+func Test_KDFLimiterBoundsConcurrency(t *testing.T) {
+	var running, peak, calls atomic.Int32
+	limiter := newKDFLimiter(2)
+	limiter.derive = func(params *KDFParams, secret []byte) ([]byte, error) {
+		calls.Add(1)
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return append([]byte("key:"), secret...), nil
+	}
+
+	cache := newKEKCache(limiter, time.Minute)
+	params := &KDFParams{Algorithm: KDFArgon2id, Memory: 19 * 1024, Iterations: 2, Parallelism: 1, Salt: []byte("salt")}
+
+	// distinct secrets queue for a slot, identical ones share a single derivation
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			secret := []byte(fmt.Sprint(i % 8))
+			key, err := cache.Derive(context.Background(), params, secret)
+			if err != nil || !bytes.Equal(key, append([]byte("key:"), secret...)) {
+				t.Errorf("Derive() = %q, %v", key, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if peak.Load() > 2 {
+		t.Fatalf("%d derivations ran at once, want at most 2", peak.Load())
+	}
+
+	// cached keys are reused until they expire
+	before := calls.Load()
+	if _, err := cache.Derive(context.Background(), params, []byte("0")); err != nil || calls.Load() != before {
+		t.Fatalf("Derive() derived a cached key again: %v", err)
+	}
+
+	cache.ttl = 0
+	cache.keys = map[string]cachedKey{}
+	cache.Derive(context.Background(), params, []byte("0"))
+	cache.Derive(context.Background(), params, []byte("0"))
+	if calls.Load() != before+2 {
+		t.Fatal("Derive() reused an expired key")
+	}
+}
+
+func Test_KDFLimiterStopsWaitingWhenContextEnds(t *testing.T) {
+	release := make(chan struct{})
+	limiter := newKDFLimiter(1)
+	limiter.derive = func(params *KDFParams, secret []byte) ([]byte, error) {
+		<-release
+		return secret, nil
+	}
+	defer close(release)
+
+	params := &KDFParams{Algorithm: KDFArgon2id, Memory: 19 * 1024, Iterations: 2, Parallelism: 1, Salt: []byte("salt")}
+	go limiter.Derive(context.Background(), params, []byte("busy"))
+	for len(limiter.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the only slot is held, a queued derivation returns once its context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Derive(ctx, params, []byte("queued")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Derive() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// so does a caller sharing a cached derivation that is still waiting for the slot
+	cache := newKEKCache(limiter, time.Minute)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := cache.Derive(ctx, params, []byte("queued")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("kekCache.Derive() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
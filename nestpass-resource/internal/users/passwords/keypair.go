@@ -0,0 +1,176 @@
+package passwords
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Keys are sealed to a user's x25519 public key with an ephemeral key agreement:
+//
+//	ephemeral public key (32) | nonce (12) | AES-256-GCM(hkdf(shared secret), key)
+//
+// The hkdf salt binds the ephemeral and recipient public keys, the associated data binds the
+// sealed key to what it protects.
+const sealInfo = "nestpass sealed key v1"
+
+// Generates an x25519 keypair.
+func newKeyPair() (private, public []byte, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		log.Error().Str("location", "newKeyPair").Msg(err.Error())
+		return nil, nil, err
+	}
+
+	return key.Bytes(), key.PublicKey().Bytes(), nil
+}
+
+// helper: sealingKey derives the key encrypting a sealed key from the shared secret.
+func sealingKey(secret, ephemeral, recipient []byte) ([]byte, error) {
+	key := make([]byte, keySize)
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(sealInfo)), key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Seals the key to the public key, only the matching private key opens it.
+func sealKey(publicKey, key, aad []byte) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapping, err := sealingKey(secret, ephemeral.PublicKey().Bytes(), publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aesgcm, err := newGCMBlock(wrapping)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(ephemeral.PublicKey().Bytes(), nonce...)
+	return aesgcm.Seal(sealed, nonce, key, aad), nil
+}
+
+// Opens a key sealed by sealKey with the private key.
+func openKey(privateKey, sealed, aad []byte) ([]byte, error) {
+	private, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < 32+12 {
+		return nil, errors.New("sealed key is too short")
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(sealed[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := private.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapping, err := sealingKey(secret, sealed[:32], private.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	aesgcm, err := newGCMBlock(wrapping)
+	if err != nil {
+		return nil, err
+	}
+
+	return aesgcm.Open(nil, sealed[32:32+aesgcm.NonceSize()], sealed[32+aesgcm.NonceSize():], aad)
+}
+
+// helper: ensureKeyPair creates the user's keypair if it has none yet and returns the vault
+// with its public key, only server side encrypted vaults hold one.
+func (s *service) ensureKeyPair(ctx context.Context, userID uuid.UUID) (*Vault, error) {
+	vault, err := s.prepareVault(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Mode == ClientMode {
+		return nil, apiutils.NewErrConflict("client side encrypted vaults have no keypair")
+	}
+
+	if len(vault.PublicKey) != 0 {
+		return vault, nil
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "ensureKeyPair").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if vault, err = s.repo.LockVault(ctx, tx, userID, true); err != nil {
+		return nil, err
+	}
+
+	// created by a concurrent request
+	if len(vault.PublicKey) != 0 {
+		return vault, nil
+	}
+
+	kek, err := s.getKDFKey(ctx, userID, currKDF, vault.KDF)
+	if err != nil {
+		return nil, err
+	}
+
+	private, public, err := newKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.WrappedPrivate, err = wrapKey(kek, private, userID); err != nil {
+		return nil, err
+	}
+	vault.PublicKey, vault.Updated = public, time.Now()
+
+	if err := s.repo.UpsertVault(ctx, tx, vault); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "ensureKeyPair").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	log.Info().Str("location", "ensureKeyPair").Msgf("%v: keypair created", userID)
+	return vault, nil
+}
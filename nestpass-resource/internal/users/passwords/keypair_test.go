@@ -0,0 +1,65 @@
+package passwords
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func Test_SealKey(t *testing.T) {
+	private, public, err := newKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := newDEK()
+	aad := orgAAD(uuid.New(), uuid.New())
+	sealed, err := sealKey(public, key, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := openKey(private, sealed, aad)
+	if err != nil || !bytes.Equal(opened, key) {
+		t.Fatalf("failed to open sealed key: %v", err)
+	}
+
+	if _, err := openKey(private, sealed, orgAAD(uuid.New(), uuid.New())); err == nil {
+		t.Fatal("key opened for another share")
+	}
+
+	other, _, _ := newKeyPair()
+	if _, err := openKey(other, sealed, aad); err == nil {
+		t.Fatal("key opened with the wrong private key")
+	}
+
+	if _, err := openKey(private, sealed[:40], aad); err == nil {
+		t.Fatal("truncated key opened")
+	}
+}
+
+func Test_UnwrapRingPrivateKey(t *testing.T) {
+	userID := uuid.New()
+	kek, _ := newDEK()
+	dek, _ := newDEK()
+	private, _, _ := newKeyPair()
+
+	wrappedDEK, _ := wrapKey(kek, dek, userID)
+	wrappedPrivate, _ := wrapKey(kek, private, userID)
+	vault := &Vault{UserID: userID, KeyVersion: 1, WrappedDEK: wrappedDEK, WrappedPrivate: wrappedPrivate}
+
+	ring, err := unwrapRing(vault, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(ring.private, private) {
+		t.Fatal("private key not unwrapped")
+	}
+
+	vault.WrappedPrivate = nil
+	if ring, err = unwrapRing(vault, kek); err != nil || ring.private != nil {
+		t.Fatalf("vault without keypair: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// size of data and key encryption keys
+const keySize = 32
+
+// Generates a random data encryption key.
+func newDEK() ([]byte, error) {
+	dek := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		log.Error().Str("location", "newDEK").Msg(err.Error())
+		return nil, err
+	}
+
+	return dek, nil
+}
+
+// Wraps the data encryption key with the key encryption key, bound to the user id.
+// The wrapped key is stored as nonce | ciphertext.
+func wrapKey(kek, dek []byte, userID uuid.UUID) ([]byte, error) {
+	aesgcm, err := newGCMBlock(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		log.Error().Str("location", "wrapKey").Msg(err.Error())
+		return nil, err
+	}
+
+	return aesgcm.Seal(nonce, nonce, dek, userID[:]), nil
+}
+
+// Unwraps a data encryption key wrapped by wrapKey.
+func unwrapKey(kek, wrapped []byte, userID uuid.UUID) ([]byte, error) {
+	aesgcm, err := newGCMBlock(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aesgcm.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+
+	nonce, ciphertext := wrapped[:aesgcm.NonceSize()], wrapped[aesgcm.NonceSize():]
+	return aesgcm.Open(nil, nonce, ciphertext, userID[:])
+}
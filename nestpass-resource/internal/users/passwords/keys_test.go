@@ -0,0 +1,151 @@
+package passwords
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func Test_WrapKey(t *testing.T) {
+	kek, _ := newDEK()
+	dek, err := newDEK()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+	wrapped, err := wrapKey(kek, dek, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unwrapped, err := unwrapKey(kek, wrapped, userID)
+	if err != nil || !bytes.Equal(unwrapped, dek) {
+		t.Fatalf("failed to unwrap key: %v", err)
+	}
+
+	otherKEK, _ := newDEK()
+	if _, err := unwrapKey(otherKEK, wrapped, userID); err == nil {
+		t.Fatal("key unwrapped with the wrong kek")
+	}
+
+	if _, err := unwrapKey(kek, wrapped, uuid.New()); err == nil {
+		t.Fatal("key unwrapped for another user")
+	}
+}
+
+func Test_RewrapKeepsEntriesReadable(t *testing.T) {
+	userID := uuid.New()
+	prevKEK, _ := newDEK()
+	currKEK, _ := newDEK()
+	dek, _ := newDEK()
+
+	entry, err := NewPasswordEncrypt(&Password{UserID: userID, Website: "example.com", Type: ItemLogin, Login: &Login{Username: "user", Password: "psw"}}, dek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a password reset only rewraps the data key
+	wrapped, _ := wrapKey(prevKEK, dek, userID)
+	unwrapped, err := unwrapKey(prevKEK, wrapped, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewrapped, _ := wrapKey(currKEK, unwrapped, userID)
+
+	key, err := unwrapKey(currKEK, rewrapped, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	psw, err := entry.Decrypt(userID, key)
+	if err != nil || psw.Login.Password != "psw" {
+		t.Fatalf("entry unreadable after rewrap: %v", err)
+	}
+}
+
+func Test_KeyRingOpensEntriesByVersion(t *testing.T) {
+	userID := uuid.New()
+	kek, _ := newDEK()
+	prev, _ := newDEK()
+	curr, _ := newDEK()
+
+	vault := &Vault{UserID: userID, Mode: ServerMode, KeyVersion: 2}
+	vault.WrappedDEK, _ = wrapKey(kek, curr, userID)
+	vault.PrevDEK, _ = wrapKey(kek, prev, userID)
+
+	ring, err := unwrapRing(vault, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// entries not rekeyed yet stay readable with the previous key
+	stale, _ := NewPasswordEncrypt(&Password{UserID: userID, Website: "example.com", Type: ItemLogin, Login: &Login{Username: "user", Password: "old"}}, prev)
+	stale.KeyVersion = 1
+	if psw, err := open(vault, ring, stale); err != nil || psw.Login.Password != "old" {
+		t.Fatalf("stale entry unreadable: %v", err)
+	}
+
+	fresh, err := seal(vault, ring, &Password{UserID: userID, Website: "example.com", Type: ItemLogin, Login: &Login{Username: "user", Password: "new"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.KeyVersion != 2 {
+		t.Fatalf("entry sealed with key version %d", fresh.KeyVersion)
+	}
+	if psw, err := open(vault, ring, fresh); err != nil || psw.Login.Password != "new" {
+		t.Fatalf("entry unreadable: %v", err)
+	}
+
+	// versions the vault no longer holds are rejected instead of decrypted with the wrong key
+	stale.KeyVersion = 0
+	if _, err := open(vault, ring, stale); err == nil {
+		t.Fatal("entry opened with an unknown key version")
+	}
+}
+
+func Test_LegacyRingOpensEveryVersion(t *testing.T) {
+	userID := uuid.New()
+	legacyKey, _ := newDEK()
+	vault := &Vault{UserID: userID, Mode: ServerMode, KeyVersion: 1}
+	ring := &keyRing{version: 1, keys: map[int][]byte{1: legacyKey}, legacy: true}
+
+	// entries of a vault read before its migration may carry any version
+	entry, _ := NewPasswordEncrypt(&Password{UserID: userID, Website: "example.com", Type: ItemLogin, Login: &Login{Username: "user", Password: "psw"}}, legacyKey)
+	for _, version := range []int{0, 1} {
+		entry.KeyVersion = version
+		if psw, err := open(vault, ring, entry); err != nil || psw.Login.Password != "psw" {
+			t.Fatalf("version %d unreadable: %v", version, err)
+		}
+	}
+}
+
+func Test_ReencryptKeepsRevision(t *testing.T) {
+	userID := uuid.New()
+	prev, _ := newDEK()
+	curr, _ := newDEK()
+	ring := &keyRing{version: 2, keys: map[int][]byte{1: prev, 2: curr}}
+
+	entry, err := NewPasswordEncrypt(&Password{UserID: userID, Website: "example.com", Type: ItemLogin, Login: &Login{Username: "user", Password: "old"}}, prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.KeyVersion = 1
+
+	revision := NewRevisionEncrypt(entry)
+	newData, err := reencrypt(&revision.PasswordEncrypt, prev, ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revision.PasswordEncrypt = *newData
+
+	if revision.KeyVersion != 2 || revision.PasswordID != entry.PasswordID {
+		t.Fatalf("revision rekeyed to version %d for %v", revision.KeyVersion, revision.PasswordID)
+	}
+
+	psw, err := revision.Decrypt(userID, curr)
+	if err != nil || psw.Login.Password != "old" {
+		t.Fatalf("revision unreadable after rekey: %v", err)
+	}
+}
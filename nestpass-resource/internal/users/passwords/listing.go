@@ -0,0 +1,199 @@
+package passwords
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/pkg/pagination"
+)
+
+// sort keys of entry listings
+const (
+	SortWebsite  = "website"
+	SortCreated  = "created"
+	SortUpdated  = "updated"
+	SortLastUsed = "last_used"
+)
+
+// Column an entry listing is ordered by and the type its cursor value is read as. Entries never
+// used sort as if used at -infinity, so the column has no NULLs and the keyset stays total.
+type sortKey struct {
+	expr string
+	cast string
+}
+
+var sortKeys = map[string]sortKey{
+	SortWebsite:  {expr: "p.website", cast: "text"},
+	SortCreated:  {expr: "p.created", cast: "timestamptz"},
+	SortUpdated:  {expr: "p.updated", cast: "timestamptz"},
+	SortLastUsed: {expr: "coalesce(p.last_used, '-infinity')", cast: "timestamptz"},
+}
+
+// Narrows an entry listing, unset fields do not filter.
+type ListFilter struct {
+	CategoryID  *uuid.UUID
+	Descendants bool // include the entries of nested categories
+	TagID       *uuid.UUID
+	Favorite    bool
+	CategoryIDs []uuid.UUID // only the entries of these categories when not nil, their subtrees are not expanded
+}
+
+// Entry listing query built from the filter and pagination, only whitelisted fragments are written
+// into the sql, every value is passed as an argument.
+type listQuery struct {
+	sql  strings.Builder
+	args []any
+}
+
+// helper: arg adds an argument and returns its placeholder.
+func (q *listQuery) arg(value any) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// helper: buildListQuery builds the keyset paginated listing of the owner's active entries.
+// Without a sort key entries are ordered by id and the cursor's id alone is the boundary, with
+// one the boundary is the cursor's sort value paired with its id.
+func buildListQuery(ownerID uuid.UUID, filter *ListFilter, params *pagination.Params) (string, []any, error) {
+	q := &listQuery{}
+	owner := q.arg(ownerID)
+
+	if filter.CategoryID != nil && filter.Descendants {
+		q.sql.WriteString(`
+	WITH RECURSIVE tree AS (
+		SELECT category_id FROM categories
+		WHERE user_id = ` + owner + ` AND category_id = ` + q.arg(*filter.CategoryID) + `
+		UNION ALL
+		SELECT c.category_id FROM categories c
+		JOIN tree t ON c.parent_id = t.category_id
+		WHERE c.user_id = ` + owner + `
+	)`)
+	}
+
+	q.sql.WriteString(`
+	SELECT ` + listedColumns + ` FROM passwords p
+	WHERE p.user_id = ` + owner + ` AND p.deleted_at IS NULL`)
+
+	if filter.CategoryID != nil {
+		if filter.Descendants {
+			q.sql.WriteString(` AND p.category_id IN (SELECT category_id FROM tree)`)
+		} else {
+			q.sql.WriteString(` AND p.category_id = ` + q.arg(*filter.CategoryID))
+		}
+	}
+
+	if filter.CategoryIDs != nil {
+		q.sql.WriteString(` AND p.category_id = ANY(` + q.arg(filter.CategoryIDs) + `)`)
+	}
+
+	if filter.Favorite {
+		q.sql.WriteString(` AND p.favorite`)
+	}
+
+	if filter.TagID != nil {
+		q.sql.WriteString(`
+	AND EXISTS (
+		SELECT 1 FROM password_tags pt
+		WHERE pt.password_id = p.password_id AND pt.user_id = p.user_id AND pt.tag_id = ` + q.arg(*filter.TagID) + `
+	)`)
+	}
+
+	dir, cmp := "ASC", ">"
+	if params.Descending() {
+		dir, cmp = "DESC", "<"
+	}
+
+	boundary := params.Cursor
+	if params.Sort == "" {
+		if boundary != nil {
+			q.sql.WriteString(` AND p.password_id ` + cmp + ` ` + q.arg(boundary.ID))
+		}
+
+		q.sql.WriteString(`
+	ORDER BY p.password_id ` + dir)
+	} else {
+		key, ok := sortKeys[params.Sort]
+		if !ok {
+			return "", nil, apiutils.NewErrBadRequest("invalid sort " + params.Sort)
+		}
+
+		if boundary != nil {
+			q.sql.WriteString(`
+	AND (` + key.expr + `, p.password_id) ` + cmp + ` (` + q.arg(boundary.Value) + `::` + key.cast + `, ` + q.arg(boundary.ID) + `::uuid)`)
+		}
+
+		q.sql.WriteString(`
+	ORDER BY ` + key.expr + ` ` + dir + `, p.password_id ` + dir)
+	}
+
+	q.sql.WriteString(`
+	LIMIT ` + q.arg(params.Fetch()))
+
+	return q.sql.String(), q.args, nil
+}
+
+// helper: sortValue returns the value the entry is sorted by, as the listing compares it.
+func sortValue(psw *Password, sort string) string {
+	timestamp := func(t *time.Time) string {
+		if t == nil {
+			return "-infinity"
+		}
+
+		return t.Format(time.RFC3339Nano)
+	}
+
+	switch sort {
+	case SortWebsite:
+		return psw.Website
+	case SortCreated:
+		return timestamp(psw.Created)
+	case SortUpdated:
+		return timestamp(&psw.Updated)
+	case SortLastUsed:
+		return timestamp(psw.LastUsed)
+	}
+
+	return ""
+}
+
+// Lists the owner's active entries matching the filter, one page at a time.
+func (s *service) ListPasswords(ctx context.Context, ownerID uuid.UUID, filter *ListFilter, params *pagination.Params) (*pagination.Page[*Password], error) {
+	query, args, err := buildListQuery(ownerID, filter, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// retrieve the entry keys
+	vault, ring, err := s.vaultKey(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Mode == ClientMode && params.Sort == SortWebsite {
+		return nil, apiutils.NewErrBadRequest("websites of client side encrypted vaults are sorted by the client")
+	}
+
+	// retrieve encrypted passwords
+	passwords, err := s.repo.ListPasswords(ctx, ownerID, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	opened, err := openAll(vault, ring, passwords)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attachTags(ctx, ownerID, opened); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, opened, func(psw *Password) (string, uuid.UUID) {
+		return sortValue(psw, params.Sort), psw.PasswordID
+	})
+}
@@ -0,0 +1,139 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"nestpass/pkg/pagination"
+)
+
+func Test_BuildListQuery(t *testing.T) {
+	ownerID, categoryID, tagID, index := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	cases := []struct {
+		name    string
+		filter  *ListFilter
+		params  *pagination.Params
+		args    int
+		want    []string
+		exclude []string
+	}{
+		{
+			name:    "first page by id",
+			filter:  &ListFilter{},
+			params:  &pagination.Params{Limit: 10, Order: pagination.Asc},
+			args:    2,
+			want:    []string{"ORDER BY p.password_id ASC", "LIMIT $2"},
+			exclude: []string{"p.password_id >", "WITH RECURSIVE"},
+		},
+		{
+			name:   "next page by id descending",
+			filter: &ListFilter{},
+			params: &pagination.Params{Limit: 10, Order: pagination.Desc, Cursor: &pagination.Cursor{Order: pagination.Desc, ID: index}},
+			args:   3,
+			want:   []string{"p.password_id < $2", "ORDER BY p.password_id DESC"},
+		},
+		{
+			name:   "category subtree with tag and favorites",
+			filter: &ListFilter{CategoryID: &categoryID, Descendants: true, TagID: &tagID, Favorite: true},
+			params: &pagination.Params{Limit: 10, Order: pagination.Asc},
+			args:   4,
+			want:   []string{"WITH RECURSIVE tree", "IN (SELECT category_id FROM tree)", "AND p.favorite", "pt.tag_id = $3"},
+		},
+		{
+			name:   "granted categories",
+			filter: &ListFilter{CategoryIDs: []uuid.UUID{categoryID, tagID}},
+			params: &pagination.Params{Limit: 10, Order: pagination.Asc},
+			args:   3,
+			want:   []string{"p.category_id = ANY($2)", "LIMIT $3"},
+		},
+		{
+			name:   "no granted category left",
+			filter: &ListFilter{CategoryIDs: []uuid.UUID{}},
+			params: &pagination.Params{Limit: 10, Order: pagination.Asc},
+			args:   3,
+			want:   []string{"p.category_id = ANY($2)", "LIMIT $3"},
+		},
+		{
+			name:    "first page by website",
+			filter:  &ListFilter{CategoryID: &categoryID},
+			params:  &pagination.Params{Limit: 10, Sort: SortWebsite, Order: pagination.Asc},
+			args:    3,
+			want:    []string{"p.category_id = $2", "ORDER BY p.website ASC, p.password_id ASC"},
+			exclude: []string{"(p.website, p.password_id) >"},
+		},
+		{
+			name:   "previous page by website",
+			filter: &ListFilter{},
+			params: &pagination.Params{Limit: 10, Sort: SortWebsite, Order: pagination.Asc, Cursor: &pagination.Cursor{
+				Sort: SortWebsite, Order: pagination.Asc, Value: "example.com", ID: index, Backward: true,
+			}},
+			args: 4,
+			want: []string{"(p.website, p.password_id) < ($2::text, $3::uuid)", "ORDER BY p.website DESC, p.password_id DESC", "LIMIT $4"},
+		},
+		{
+			name:   "next page by last use",
+			filter: &ListFilter{},
+			params: &pagination.Params{Limit: 10, Sort: SortLastUsed, Order: pagination.Desc, Cursor: &pagination.Cursor{
+				Sort: SortLastUsed, Order: pagination.Desc, Value: "-infinity", ID: index,
+			}},
+			args: 4,
+			want: []string{
+				"(coalesce(p.last_used, '-infinity'), p.password_id) < ($2::timestamptz, $3::uuid)",
+				"ORDER BY coalesce(p.last_used, '-infinity') DESC, p.password_id DESC",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		query, args, err := buildListQuery(ownerID, c.filter, c.params)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if len(args) != c.args {
+			t.Errorf("%s: got %d args, want %d", c.name, len(args), c.args)
+		}
+
+		for _, fragment := range c.want {
+			if !strings.Contains(query, fragment) {
+				t.Errorf("%s: missing %q in %s", c.name, fragment, query)
+			}
+		}
+
+		for _, fragment := range c.exclude {
+			if strings.Contains(query, fragment) {
+				t.Errorf("%s: unexpected %q in %s", c.name, fragment, query)
+			}
+		}
+	}
+}
+
+func Test_BuildListQueryRejectsSort(t *testing.T) {
+	params := &pagination.Params{Limit: 10, Sort: "encrypted", Order: pagination.Asc}
+	if _, _, err := buildListQuery(uuid.New(), &ListFilter{}, params); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func Test_SortValue(t *testing.T) {
+	used := time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC)
+	psw := &Password{Website: "example.com", Updated: used, LastUsed: &used}
+
+	cases := map[string]string{
+		"":           "",
+		SortWebsite:  "example.com",
+		SortCreated:  "-infinity",
+		SortUpdated:  "2024-05-01T12:30:00.123456Z",
+		SortLastUsed: "2024-05-01T12:30:00.123456Z",
+	}
+
+	for sort, want := range cases {
+		if got := sortValue(psw, sort); got != want {
+			t.Errorf("%q: got %q, want %q", sort, got, want)
+		}
+	}
+}
@@ -6,11 +6,20 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"io"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+)
+
+// vault encryption modes
+const (
+	ServerMode = "server" // entries are encrypted by the server with a key derived from the login password
+	ClientMode = "client" // entries are sealed by the client, the server stores opaque envelopes
+	OrgMode    = "org"    // entries of an organization, encrypted with a key sealed to each member
 )
 
 type kdfType string
@@ -37,11 +46,6 @@ func newGCMBlock(key []byte) (cipher.AEAD, error) {
 	return aesgcm, nil
 }
 
-type kdfKeyRes struct {
-	Key []byte
-	Err error
-}
-
 type kdfData struct {
 	PswHash string `json:"password"`
 	Salt    []byte `json:"salt"`
@@ -51,6 +55,7 @@ func (k *kdfData) Scan(row pgx.Row) error {
 	return row.Scan(&k.PswHash, &k.Salt)
 }
 
+// Encrypted payload of schema version 1, which only held logins.
 type pswData struct {
 	Username    string `json:"username"`
 	Password    string `json:"password"`
@@ -64,6 +69,14 @@ type PasswordEncrypt struct {
 	Website    string    `json:"website"`
 	Nonce      []byte    `json:"nonce"`
 	Encrypted  []byte    `json:"encrypted"`
+	KeyVersion int       `json:"key_version"` // version of the data encryption key the entry is encrypted with
+	Updated    time.Time `json:"updated"`     // last time the content changed, kept by rekeys and migrations
+	// blind index of the entry, nil for sealed entries and entries read back from the database
+	SearchTokens [][]byte `json:"-"`
+	// kept apart from the encrypted content, only read by ScanListed
+	Favorite bool       `json:"favorite"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
 }
 
 func (p *PasswordEncrypt) Scan(row pgx.Row) error {
@@ -74,6 +87,25 @@ func (p *PasswordEncrypt) Scan(row pgx.Row) error {
 		&p.Website,
 		&p.Nonce,
 		&p.Encrypted,
+		&p.KeyVersion,
+		&p.Updated,
+	)
+}
+
+// Scans a row of listedColumns, the entry along with its favorite flag, last use and creation.
+func (p *PasswordEncrypt) ScanListed(row pgx.Row) error {
+	return row.Scan(
+		&p.PasswordID,
+		&p.UserID,
+		&p.CategoryID,
+		&p.Website,
+		&p.Nonce,
+		&p.Encrypted,
+		&p.KeyVersion,
+		&p.Updated,
+		&p.Favorite,
+		&p.LastUsed,
+		&p.Created,
 	)
 }
 
@@ -92,31 +124,72 @@ func (p *PasswordEncrypt) Decrypt(userID uuid.UUID, key []byte) (*Password, erro
 	}
 
 	// deserialize decrypted data
-	data := &pswData{}
-	if err := json.Unmarshal(decrypted, data); err != nil {
+	data, err := decodeItem(decrypted)
+	if err != nil {
 		log.Error().Str("location", "decrypt").Msg(err.Error())
 		return nil, err
 	}
 
 	// create Password
+	psw := &Password{
+		PasswordID: p.PasswordID,
+		UserID:     p.UserID,
+		CategoryID: p.CategoryID,
+		Website:    p.Website,
+		Updated:    p.Updated,
+		Favorite:   p.Favorite,
+		LastUsed:   p.LastUsed,
+		Created:    p.Created,
+	}
+	data.apply(psw)
+
+	return psw, nil
+}
+
+// Returns the sealed entry of a client side encrypted vault as is, its title is inside the envelope.
+func (p *PasswordEncrypt) Sealed() *Password {
 	return &Password{
-		PasswordID:  p.PasswordID,
-		UserID:      p.UserID,
-		CategoryID:  p.CategoryID,
-		Website:     p.Website,
-		Username:    data.Username,
-		Password:    data.Password,
-		Description: data.Description,
+		PasswordID: p.PasswordID,
+		UserID:     p.UserID,
+		CategoryID: p.CategoryID,
+		Sealed:     p.Encrypted,
+		Updated:    p.Updated,
+		Favorite:   p.Favorite,
+		LastUsed:   p.LastUsed,
+		Created:    p.Created,
+	}
+}
+
+// Creates a client side encrypted entry, the envelope is stored without being opened. The title
+// is sealed along with the rest of the entry, the server never stores it in plaintext.
+func NewSealedPasswordEncrypt(psw *Password) (*PasswordEncrypt, error) {
+	if _, err := ParseEnvelope(psw.Sealed); err != nil {
+		return nil, apiutils.NewErrBadRequest("invalid sealed entry: " + err.Error())
+	}
+
+	if psw.Website != "" {
+		return nil, apiutils.NewErrBadRequest("the website of a sealed entry belongs in its envelope")
+	}
+
+	passwordID := psw.PasswordID
+	if passwordID == uuid.Nil {
+		passwordID = uuid.New()
+	}
+
+	return &PasswordEncrypt{
+		PasswordID: passwordID,
+		UserID:     psw.UserID,
+		CategoryID: psw.CategoryID,
+		Nonce:      []byte{},
+		Encrypted:  psw.Sealed,
+		Updated:    time.Now(),
+		Favorite:   psw.Favorite,
 	}, nil
 }
 
 func NewPasswordEncrypt(psw *Password, dKey []byte) (*PasswordEncrypt, error) {
 	// pull out data from Password
-	data := &pswData{
-		Username:    psw.Username,
-		Password:    psw.Password,
-		Description: psw.Description,
-	}
+	data := newItemData(psw)
 
 	// serialize the data
 	rawData, err := json.Marshal(data)
@@ -149,23 +222,41 @@ func NewPasswordEncrypt(psw *Password, dKey []byte) (*PasswordEncrypt, error) {
 	}
 
 	return &PasswordEncrypt{
-		PasswordID: passwordID,
-		UserID:     psw.UserID,
-		CategoryID: psw.CategoryID,
-		Website:    psw.Website,
-		Nonce:      nonce,
-		Encrypted:  encrypted,
+		PasswordID:   passwordID,
+		UserID:       psw.UserID,
+		CategoryID:   psw.CategoryID,
+		Website:      psw.Website,
+		Nonce:        nonce,
+		Encrypted:    encrypted,
+		Updated:      time.Now(),
+		SearchTokens: searchTokens(dKey, psw),
+		Favorite:     psw.Favorite,
 	}, nil
 }
 
+// Password is a vault item, the section matching its type holds the typed content.
 type Password struct {
-	PasswordID  uuid.UUID `json:"password_id,omitempty"`
-	UserID      uuid.UUID `json:"user_id" validate:"required"`
-	CategoryID  uuid.UUID `json:"category_id" validate:"required"`
-	Website     string    `json:"website" validate:"required"`
-	Username    string    `json:"username" validate:"required"`
-	Password    string    `json:"password" validate:"required"`
-	Description string    `json:"description"`
+	PasswordID uuid.UUID      `json:"password_id,omitempty"`
+	UserID     uuid.UUID      `json:"user_id" validate:"required"`
+	CategoryID uuid.UUID      `json:"category_id" validate:"required"`
+	Website    string         `json:"website,omitempty" validate:"required_without=Sealed"` // title of the item, the site for logins, sealed entries carry it in the envelope
+	Type       string         `json:"type,omitempty" validate:"required_without=Sealed"`
+	Notes      string         `json:"notes,omitempty"`
+	Login      *Login         `json:"login,omitempty"`
+	Note       *Note          `json:"note,omitempty"`
+	Card       *Card          `json:"card,omitempty"`
+	Identity   *Identity      `json:"identity,omitempty"`
+	SSHKey     *SSHKey        `json:"ssh_key,omitempty"`
+	APIToken   *APIToken      `json:"api_token,omitempty"`
+	Fields     []*CustomField `json:"fields,omitempty"`
+	OTP        *OTP           `json:"otp,omitempty"`    // one time password generator of any item type
+	Sealed     []byte         `json:"sealed,omitempty"` // envelope of a client side encrypted entry
+	Favorite   bool           `json:"favorite"`
+	Tags       []*Tag         `json:"tags,omitempty"`       // set through the entry's tags, ignored on writes
+	DeletedAt  *time.Time     `json:"deleted_at,omitempty"` // set while the entry is in the trash
+	LastUsed   *time.Time     `json:"last_used,omitempty"`  // last time a client used the entry
+	Created    *time.Time     `json:"created,omitempty"`
+	Updated    time.Time      `json:"updated"` // set by the server when the content changes
 }
 
 func (p *Password) Deserialize(data io.ReadCloser) error {
@@ -179,16 +270,286 @@ func (p *Password) Deserialize(data io.ReadCloser) error {
 		return err
 	}
 
+	return p.Validate()
+}
+
+// Revision is a previous value of an entry, listed without its content.
+type Revision struct {
+	RevisionID uuid.UUID `json:"revision_id"`
+	PasswordID uuid.UUID `json:"password_id"`
+	Created    time.Time `json:"created"`
+}
+
+func (r *Revision) Scan(row pgx.Row) error {
+	return row.Scan(&r.RevisionID, &r.PasswordID, &r.Created)
+}
+
+// Encrypted previous value of an entry, kept as it was stored.
+type RevisionEncrypt struct {
+	RevisionID uuid.UUID `json:"revision_id"`
+	Created    time.Time `json:"created"`
+	PasswordEncrypt
+}
+
+func (r *RevisionEncrypt) Scan(row pgx.Row) error {
+	return row.Scan(
+		&r.RevisionID,
+		&r.Created,
+		&r.PasswordID,
+		&r.UserID,
+		&r.CategoryID,
+		&r.Website,
+		&r.Nonce,
+		&r.Encrypted,
+		&r.KeyVersion,
+	)
+}
+
+// Snapshots the entry as a new revision.
+func NewRevisionEncrypt(data *PasswordEncrypt) *RevisionEncrypt {
+	return &RevisionEncrypt{RevisionID: uuid.New(), Created: time.Now(), PasswordEncrypt: *data}
+}
+
+// Encryption settings of the user's vault, a user without a vault row uses server side encryption.
+type Vault struct {
+	UserID     uuid.UUID  `json:"user_id"`
+	Mode       string     `json:"mode"`
+	WrappedKey []byte     `json:"wrapped_key,omitempty"` // vault key sealed by the client, opaque to the server
+	WrappedDEK []byte     `json:"-"`                     // data encryption key wrapped by the password derived key
+	PrevDEK    []byte     `json:"-"`                     // wrapped key being rotated out while a rekey job runs
+	KeyVersion int        `json:"key_version"`           // version of WrappedDEK, PrevDEK is the version before
+	KDF        *KDFParams `json:"kdf,omitempty"`         // derivation of the wrapping key, nil for the legacy scheme
+	Updated    time.Time  `json:"updated"`
+	// keypair shares are sealed to, created when the user first shares or receives a share
+	PublicKey      []byte `json:"public_key,omitempty"`
+	WrappedPrivate []byte `json:"-"` // private key wrapped like the data encryption key
+}
+
+func (v *Vault) Scan(row pgx.Row) error {
+	return row.Scan(&v.UserID, &v.Mode, &v.WrappedKey, &v.WrappedDEK, &v.PrevDEK, &v.KeyVersion, &v.KDF, &v.Updated, &v.PublicKey, &v.WrappedPrivate)
+}
+
+// Checks if a server side encrypted vault still encrypts entries directly with the password derived key.
+func (v *Vault) IsLegacy() bool {
+	return v.Mode == ServerMode && len(v.WrappedDEK) == 0
+}
+
+// rekey job statuses
+const (
+	RekeyRunning = "running"
+	RekeyFailed  = "failed"
+	RekeyDone    = "done"
+)
+
+// Tracked rotation of a vault's data encryption key, progress is persisted so failed jobs can be resumed.
+type RekeyJob struct {
+	JobID       uuid.UUID `json:"job_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	FromVersion int       `json:"from_version"`
+	ToVersion   int       `json:"to_version"`
+	Status      string    `json:"status"`
+	Total       int       `json:"total"`
+	Done        int       `json:"done"`
+	Error       string    `json:"error,omitempty"`
+	Started     time.Time `json:"started"`
+	Updated     time.Time `json:"updated"`
+}
+
+func (j *RekeyJob) Scan(row pgx.Row) error {
+	return row.Scan(
+		&j.JobID,
+		&j.UserID,
+		&j.FromVersion,
+		&j.ToVersion,
+		&j.Status,
+		&j.Total,
+		&j.Done,
+		&j.Error,
+		&j.Started,
+		&j.Updated,
+	)
+}
+
+// Password reset whose vault is still wrapped with the key derived from the previous password,
+// recorded by the auth server in the transaction changing the password.
+type Rewrap struct {
+	RewrapID uuid.UUID
+	UserID   uuid.UUID
+	PrevHash string
+	Queued   time.Time
+	Attempts int       // rewraps that failed so far
+	RetryAt  time.Time // when the worker tries again
+}
+
+func (r *Rewrap) Scan(row pgx.Row) error {
+	return row.Scan(&r.RewrapID, &r.UserID, &r.PrevHash, &r.Queued, &r.Attempts, &r.RetryAt)
+}
+
+// Rekey state of a vault, entries not on the current key version still need to be rekeyed.
+type RekeyStatus struct {
+	Mode       string    `json:"mode"`
+	KeyVersion int       `json:"key_version"`
+	Stale      int       `json:"stale"`
+	Rekeyed    bool      `json:"rekeyed"`
+	Job        *RekeyJob `json:"job,omitempty"`
+}
+
+// Request data for switching a vault to client side encryption.
+// Clients read the decrypted vault, seal every entry including its website and upload them together
+// with the wrapped vault key, the stored websites are cleared.
+type ClientMigration struct {
+	WrappedKey []byte         `json:"wrapped_key" validate:"required"`
+	Entries    []*SealedEntry `json:"entries" validate:"dive"`
+}
+
+// Sealed replacement for an existing entry.
+type SealedEntry struct {
+	PasswordID uuid.UUID `json:"password_id" validate:"required"`
+	Sealed     []byte    `json:"sealed" validate:"required"`
+}
+
+func (c *ClientMigration) Deserialize(data io.ReadCloser) error {
+	if err := json.NewDecoder(data).Decode(c); err != nil {
+		log.Error().Str("location", "ClientMigration.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	if err := validator.New().Struct(c); err != nil {
+		log.Error().Str("location", "ClientMigration.Deserialize").Msg(err.Error())
+		return err
+	}
+
 	return nil
 }
 
-func NewPassword(data *pswData, website string, userID, categoryID uuid.UUID) *Password {
-	return &Password{
-		UserID:      userID,
-		CategoryID:  categoryID,
-		Website:     website,
-		Username:    data.Username,
-		Password:    data.Password,
-		Description: data.Description,
+// Request data for replacing the wrapped vault key after the client changed its master password.
+type WrappedKey struct {
+	WrappedKey []byte `json:"wrapped_key" validate:"required"`
+}
+
+func (w *WrappedKey) Deserialize(data io.ReadCloser) error {
+	if err := json.NewDecoder(data).Decode(w); err != nil {
+		log.Error().Str("location", "WrappedKey.Deserialize").Msg(err.Error())
+		return err
 	}
+
+	if err := validator.New().Struct(w); err != nil {
+		log.Error().Str("location", "WrappedKey.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func NewPassword(data *itemData, website string, userID, categoryID uuid.UUID) *Password {
+	psw := &Password{
+		UserID:     userID,
+		CategoryID: categoryID,
+		Website:    website,
+	}
+	data.apply(psw)
+
+	return psw
+}
+
+// Encrypted entry in the trash along with the time it was deleted.
+type TrashedEncrypt struct {
+	DeletedAt time.Time `json:"deleted_at"`
+	PasswordEncrypt
+}
+
+func (t *TrashedEncrypt) Scan(row pgx.Row) error {
+	return row.Scan(
+		&t.DeletedAt,
+		&t.PasswordID,
+		&t.UserID,
+		&t.CategoryID,
+		&t.Website,
+		&t.Nonce,
+		&t.Encrypted,
+		&t.KeyVersion,
+		&t.Updated,
+	)
+}
+
+// Request data for exporting the vault, the passphrase protects the archive.
+type ExportRequest struct {
+	Passphrase string `json:"passphrase" validate:"required,min=12"`
+}
+
+func (e *ExportRequest) Deserialize(data io.ReadCloser) error {
+	if err := json.NewDecoder(data).Decode(e); err != nil {
+		log.Error().Str("location", "ExportRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	if err := validator.New().Struct(e); err != nil {
+		log.Error().Str("location", "ExportRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Request data for generating a value, stored as a new login entry when store is set.
+type GenerateRequest struct {
+	Policy GeneratorPolicy `json:"policy"`
+	Store  *GenerateStore  `json:"store"`
+}
+
+type GenerateStore struct {
+	CategoryID uuid.UUID `json:"category_id" validate:"required"`
+	Website    string    `json:"website" validate:"required"`
+	Username   string    `json:"username"`
+	Notes      string    `json:"notes"`
+}
+
+func (g *GenerateRequest) Deserialize(data io.ReadCloser) error {
+	if err := json.NewDecoder(data).Decode(g); err != nil {
+		log.Error().Str("location", "GenerateRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	if err := validator.New().Struct(g); err != nil {
+		log.Error().Str("location", "GenerateRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// File attached to an entry. The content is encrypted in chunks with a key of its own, which is
+// wrapped with the vault's data encryption key so rekeys only rewrap it.
+type Attachment struct {
+	AttachmentID uuid.UUID `json:"attachment_id"`
+	PasswordID   uuid.UUID `json:"password_id"`
+	UserID       uuid.UUID `json:"user_id"`
+	Name         string    `json:"name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`        // of the plaintext
+	WrappedKey   []byte    `json:"-"`           // file key wrapped with the data encryption key
+	KeyVersion   int       `json:"key_version"` // version of the data encryption key the file key is wrapped with
+	NoncePrefix  []byte    `json:"-"`
+	Created      time.Time `json:"created"`
+}
+
+func (a *Attachment) Scan(row pgx.Row) error {
+	return row.Scan(
+		&a.AttachmentID,
+		&a.PasswordID,
+		&a.UserID,
+		&a.Name,
+		&a.ContentType,
+		&a.Size,
+		&a.WrappedKey,
+		&a.KeyVersion,
+		&a.NoncePrefix,
+		&a.Created,
+	)
+}
+
+// Storage used by the owner's attachments against the quota, in bytes.
+type AttachmentUsage struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
 }
@@ -0,0 +1,97 @@
+package passwords
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/pkg/auth"
+)
+
+// Organization vaults hold the entries of an organization's collections under the organization's
+// id. They have no password to derive a key from, their data key is sealed to the keypair of
+// each member instead and opened with the keypair of the member making the request.
+
+// helper: orgAAD binds a sealed organization key to the organization and the member.
+func orgAAD(orgID, userID uuid.UUID) []byte {
+	return append(orgID[:], userID[:]...)
+}
+
+// helper: orgRing opens the organization key with the keypair of the member in the context.
+func (s *service) orgRing(ctx context.Context, vault *Vault) (*keyRing, error) {
+	userID, err := auth.UidFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.openOrgKey(ctx, vault.UserID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyRing{version: vault.KeyVersion, keys: map[int][]byte{vault.KeyVersion: key}}, nil
+}
+
+// helper: openOrgKey opens the organization key sealed to the member.
+func (s *service) openOrgKey(ctx context.Context, orgID, userID uuid.UUID) ([]byte, error) {
+	sealed, err := s.repo.GetOrgKey(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, ring, err := s.vaultKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ring == nil || ring.private == nil {
+		return nil, apiutils.NewErrConflict("member has no keypair")
+	}
+
+	key, err := openKey(ring.private, sealed, orgAAD(orgID, userID))
+	if err != nil {
+		log.Error().Str("location", "openOrgKey").Msgf("%v: failed to open key of %v: %v", userID, orgID, err)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Creates the vault of a new organization in the transaction and returns its key sealed to the owner.
+func (s *service) CreateOrgVault(ctx context.Context, tx pgx.Tx, orgID, ownerID uuid.UUID) ([]byte, error) {
+	owner, err := s.ensureKeyPair(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newDEK()
+	if err != nil {
+		return nil, err
+	}
+
+	vault := &Vault{UserID: orgID, Mode: OrgMode, KeyVersion: 1, Updated: time.Now()}
+	if err := s.repo.UpsertVault(ctx, tx, vault); err != nil {
+		return nil, err
+	}
+
+	return sealKey(owner.PublicKey, key, orgAAD(orgID, ownerID))
+}
+
+// Seals the organization key the granting member holds to a new member.
+func (s *service) GrantOrgKey(ctx context.Context, orgID, granterID, memberID uuid.UUID) ([]byte, error) {
+	member, err := s.ensureKeyPair(ctx, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.openOrgKey(ctx, orgID, granterID)
+	if err != nil {
+		return nil, err
+	}
+
+	return sealKey(member.PublicKey, key, orgAAD(orgID, memberID))
+}
@@ -0,0 +1,358 @@
+package passwords
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+)
+
+// one time password types
+const (
+	OTPTypeTOTP = "totp" // time based, RFC 6238
+	OTPTypeHOTP = "hotp" // counter based, RFC 4226
+)
+
+const (
+	defaultOTPAlgorithm = "SHA1"
+	defaultOTPDigits    = 6
+	defaultOTPPeriod    = 30
+	minOTPSecretSize    = 10 // bytes of a decoded secret, 80 bits as the RFC 4226 minimum
+)
+
+// One time password generator attached to an entry. The secret is write only, responses leave it
+// out unless it is revealed on request.
+type OTP struct {
+	URI       string `json:"uri,omitempty"` // otpauth uri, parsed into the fields below when written
+	Type      string `json:"type,omitempty" validate:"omitempty,oneof=totp hotp"`
+	Secret    string `json:"secret,omitempty"` // base32 encoded seed
+	Issuer    string `json:"issuer,omitempty" validate:"max=128"`
+	Account   string `json:"account,omitempty" validate:"max=128"`
+	Algorithm string `json:"algorithm,omitempty" validate:"omitempty,oneof=SHA1 SHA256 SHA512"`
+	Digits    int    `json:"digits,omitempty" validate:"omitempty,min=6,max=8"`
+	Period    int    `json:"period,omitempty" validate:"omitempty,min=1,max=300"` // seconds a totp code is valid for
+	Counter   uint64 `json:"counter,omitempty"`                                   // moving factor of a hotp
+	reveal    bool
+}
+
+// Stored form of the generator, encrypted with the entry so the secret is kept.
+type otpData OTP
+
+// Serializes the generator without its secret unless it was revealed.
+func (o *OTP) MarshalJSON() ([]byte, error) {
+	data := otpData(*o)
+	if !o.reveal {
+		data.Secret = ""
+	}
+
+	return json.Marshal(&data)
+}
+
+// Includes the secret when the generator is serialized.
+func (o *OTP) Reveal() {
+	o.reveal = true
+}
+
+// Current code of a generator.
+type OTPCode struct {
+	Code      string `json:"code"`
+	Type      string `json:"type"`
+	Period    int    `json:"period,omitempty"`    // seconds a totp code is valid for
+	Remaining int    `json:"remaining,omitempty"` // seconds until the totp code changes
+	Counter   uint64 `json:"counter,omitempty"`   // counter a hotp code was generated for
+}
+
+// helper: normalize parses the uri and checks the generator, filling in the defaults. Writes may
+// leave the secret out to keep the stored one, it is checked once it is known.
+func (o *OTP) normalize() error {
+	if o.URI != "" {
+		parsed, err := parseOTPURI(o.URI)
+		if err != nil {
+			return err
+		}
+		*o = *parsed
+	}
+
+	if o.Type == "" {
+		o.Type = OTPTypeTOTP
+	}
+
+	if o.Algorithm == "" {
+		o.Algorithm = defaultOTPAlgorithm
+	}
+
+	if o.Digits == 0 {
+		o.Digits = defaultOTPDigits
+	}
+
+	if o.Period == 0 && o.Type == OTPTypeTOTP {
+		o.Period = defaultOTPPeriod
+	}
+
+	if err := validator.New().Struct(o); err != nil {
+		return apiutils.NewErrBadRequest(err.Error())
+	}
+
+	if o.Secret == "" {
+		return nil
+	}
+
+	o.Secret = strings.TrimRight(strings.ToUpper(strings.ReplaceAll(o.Secret, " ", "")), "=")
+	if _, err := o.key(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// helper: parseOTPURI parses an otpauth uri:
+//
+//	otpauth://totp/Issuer:account?secret=BASE32&issuer=Issuer&algorithm=SHA1&digits=6&period=30
+//	otpauth://hotp/Issuer:account?secret=BASE32&counter=0
+func parseOTPURI(raw string) (*OTP, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "otpauth" {
+		return nil, apiutils.NewErrBadRequest("invalid otpauth uri")
+	}
+
+	otp := &OTP{Type: strings.ToLower(u.Host)}
+	if otp.Type != OTPTypeTOTP && otp.Type != OTPTypeHOTP {
+		return nil, apiutils.NewErrBadRequest("unsupported otpauth type " + u.Host)
+	}
+
+	// the label is the account, optionally prefixed by the issuer
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		otp.Issuer, otp.Account = strings.TrimSpace(issuer), strings.TrimSpace(account)
+	} else {
+		otp.Account = label
+	}
+
+	query := u.Query()
+	if issuer := query.Get("issuer"); issuer != "" {
+		otp.Issuer = issuer
+	}
+
+	otp.Secret = query.Get("secret")
+	if otp.Secret == "" {
+		return nil, apiutils.NewErrBadRequest("otpauth uri has no secret")
+	}
+
+	otp.Algorithm = strings.ToUpper(query.Get("algorithm"))
+
+	numbers := map[string]*int{"digits": &otp.Digits, "period": &otp.Period}
+	for name, field := range numbers {
+		if value := query.Get(name); value != "" {
+			if *field, err = strconv.Atoi(value); err != nil {
+				return nil, apiutils.NewErrBadRequest("invalid otpauth " + name)
+			}
+		}
+	}
+
+	if otp.Type == OTPTypeHOTP {
+		if otp.Counter, err = strconv.ParseUint(query.Get("counter"), 10, 64); err != nil {
+			return nil, apiutils.NewErrBadRequest("invalid otpauth counter")
+		}
+		otp.Period = 0
+	}
+
+	return otp, nil
+}
+
+// helper: key decodes the secret.
+func (o *OTP) key() ([]byte, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(o.Secret)
+	if err != nil || len(key) < minOTPSecretSize {
+		return nil, apiutils.NewErrBadRequest("invalid otp secret")
+	}
+
+	return key, nil
+}
+
+// helper: generate computes the code at the given time, or at the counter for a hotp.
+func (o *OTP) generate(now time.Time) (*OTPCode, error) {
+	key, err := o.key()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Type == OTPTypeHOTP {
+		return &OTPCode{Code: hotp(key, o.Counter, o.Algorithm, o.Digits), Type: o.Type, Counter: o.Counter}, nil
+	}
+
+	step := uint64(now.Unix()) / uint64(o.Period)
+	return &OTPCode{
+		Code:      hotp(key, step, o.Algorithm, o.Digits),
+		Type:      o.Type,
+		Period:    o.Period,
+		Remaining: o.Period - int(uint64(now.Unix())%uint64(o.Period)),
+	}, nil
+}
+
+// helper: hotp computes the code for the counter with dynamic truncation.
+func hotp(key []byte, counter uint64, algorithm string, digits int) string {
+	hashes := map[string]func() hash.Hash{"SHA1": sha1.New, "SHA256": sha256.New, "SHA512": sha512.New}
+	newHash, ok := hashes[algorithm]
+	if !ok {
+		newHash = sha1.New
+	}
+
+	mac := hmac.New(newHash, key)
+	mac.Write(binary.BigEndian.AppendUint64(nil, counter))
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+
+	code := strconv.FormatUint(uint64(value%modulo), 10)
+	return strings.Repeat("0", digits-len(code)) + code
+}
+
+// helper: keepOTPSecret copies the stored otp secret to an update that left it out.
+func keepOTPSecret(vault *Vault, ring *keyRing, current *PasswordEncrypt, psw *Password) error {
+	stored, err := open(vault, ring, current)
+	if err != nil {
+		return err
+	}
+
+	if stored.OTP == nil || stored.OTP.Secret == "" {
+		return apiutils.NewErrBadRequest("missing otp secret")
+	}
+
+	psw.OTP.Secret = stored.OTP.Secret
+	return nil
+}
+
+// helper: otpOf returns the generator of the entry, failing when there is none the server can run.
+func otpOf(psw *Password) (*OTP, error) {
+	if len(psw.Sealed) != 0 {
+		return nil, apiutils.NewErrConflict("codes of client side encrypted entries are generated by the client")
+	}
+
+	if psw.OTP == nil || psw.OTP.Secret == "" {
+		return nil, apiutils.NewErrNotFound("entry has no one time password")
+	}
+
+	return psw.OTP, nil
+}
+
+// helper: issueHOTP computes the code at the entry's counter and re-seals the entry with the
+// counter advanced, so the code is never issued again.
+func issueHOTP(vault *Vault, ring *keyRing, current *PasswordEncrypt) (*OTPCode, *PasswordEncrypt, error) {
+	psw, err := open(vault, ring, current)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	otp, err := otpOf(psw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if otp.Type != OTPTypeHOTP {
+		return nil, nil, apiutils.NewErrConflict("only hotp codes are issued, totp codes are read with a get")
+	}
+
+	code, err := otp.generate(time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	otp.Counter++
+	data, err := seal(vault, ring, psw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// advancing the counter is not an edit of the entry
+	data.Updated = current.Updated
+	return code, data, nil
+}
+
+// Computes the current code of the entry's time based one time password. Hotp codes change the
+// stored counter and are issued with IssueHOTPCode instead.
+func (s *service) GetOTPCode(ctx context.Context, passwordID, categoryID, ownerID uuid.UUID) (*OTPCode, error) {
+	psw, err := s.GetPassword(ctx, passwordID, categoryID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	otp, err := otpOf(psw)
+	if err != nil {
+		return nil, err
+	}
+
+	if otp.Type == OTPTypeHOTP {
+		return nil, apiutils.NewErrConflict("hotp codes are issued with a post")
+	}
+
+	return otp.generate(time.Now())
+}
+
+// Issues the next code of the entry's counter based one time password, advancing the counter
+// under the vault lock.
+func (s *service) IssueHOTPCode(ctx context.Context, passwordID, categoryID, ownerID uuid.UUID) (*OTPCode, error) {
+	// migrate legacy vaults before writing
+	if _, err := s.prepareVault(ctx, ownerID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "IssueHOTPCode").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	vault, err := s.repo.LockVault(ctx, tx, ownerID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ring, err := s.keyRing(ctx, vault)
+	if err != nil {
+		return nil, err
+	}
+
+	// the row lock keeps concurrent requests from issuing the same counter
+	current, err := s.repo.GetPasswordForUpdate(ctx, tx, ownerID, passwordID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	code, data, err := issueHOTP(vault, ring, current)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdatePassword(ctx, tx, data); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "IssueHOTPCode").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+
+	s.afterWrite(ctx, ownerID, []uuid.UUID{passwordID}, []uuid.UUID{categoryID})
+	return code, nil
+}
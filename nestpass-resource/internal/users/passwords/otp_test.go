@@ -0,0 +1,178 @@
+package passwords
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func Test_HOTP(t *testing.T) {
+	// RFC 4226 appendix D
+	key := []byte("12345678901234567890")
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, code := range want {
+		if got := hotp(key, uint64(counter), "SHA1", 6); got != code {
+			t.Errorf("counter %d: got %v, want %v", counter, got, code)
+		}
+	}
+}
+
+func Test_TOTP(t *testing.T) {
+	// RFC 6238 appendix B
+	keys := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	cases := []struct {
+		unix      int64
+		algorithm string
+		code      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{2000000000, "SHA256", "90698825"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, c := range cases {
+		secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(keys[c.algorithm]))
+		otp := &OTP{Type: OTPTypeTOTP, Secret: secret, Algorithm: c.algorithm, Digits: 8, Period: 30}
+
+		code, err := otp.generate(time.Unix(c.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code.Code != c.code {
+			t.Errorf("%v at %v: got %v, want %v", c.algorithm, c.unix, code.Code, c.code)
+		}
+
+		if code.Remaining != 30-int(c.unix%30) {
+			t.Errorf("%v at %v: got %v seconds remaining", c.algorithm, c.unix, code.Remaining)
+		}
+	}
+}
+
+func Test_OTPNormalize(t *testing.T) {
+	otp := &OTP{URI: "otpauth://totp/Example:alice@example.com?secret=jbsw y3dp ehpk 3pxp&algorithm=sha256&digits=8"}
+	if err := otp.normalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := OTP{Type: OTPTypeTOTP, Secret: "JBSWY3DPEHPK3PXP", Issuer: "Example", Account: "alice@example.com", Algorithm: "SHA256", Digits: 8, Period: 30}
+	if *otp != want {
+		t.Errorf("got %+v, want %+v", *otp, want)
+	}
+
+	hotp := &OTP{URI: "otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP&issuer=Example&counter=7"}
+	if err := hotp.normalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if hotp.Type != OTPTypeHOTP || hotp.Counter != 7 || hotp.Period != 0 || hotp.Issuer != "Example" {
+		t.Errorf("unexpected hotp %+v", *hotp)
+	}
+
+	invalid := []*OTP{
+		{URI: "https://example.com"},
+		{URI: "otpauth://push/alice?secret=JBSWY3DPEHPK3PXP"},
+		{URI: "otpauth://totp/alice"},
+		{URI: "otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP"},
+		{URI: "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=4"},
+		{Secret: "JBSWY3DP"},
+		{Secret: "not base32!"},
+		{Secret: "JBSWY3DPEHPK3PXP", Algorithm: "MD5"},
+	}
+
+	for _, otp := range invalid {
+		if err := otp.normalize(); err == nil {
+			t.Errorf("expected %+v to be rejected", *otp)
+		}
+	}
+}
+
+func Test_OTPSecretRedacted(t *testing.T) {
+	psw := &Password{Website: "example", Type: ItemNote, Note: &Note{Text: "x"}, OTP: &OTP{Type: OTPTypeTOTP, Secret: "JBSWY3DPEHPK3PXP"}}
+
+	raw, err := json.Marshal(psw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(raw), "JBSWY3DPEHPK3PXP") {
+		t.Error("secret must not be serialized unless revealed")
+	}
+
+	// the encrypted payload keeps the secret
+	stored, err := json.Marshal(newItemData(psw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(stored), "JBSWY3DPEHPK3PXP") {
+		t.Error("secret must be kept in the encrypted payload")
+	}
+
+	psw.OTP.Reveal()
+	if raw, _ = json.Marshal(psw); !strings.Contains(string(raw), "JBSWY3DPEHPK3PXP") {
+		t.Error("revealed secret must be serialized")
+	}
+}
+
+func Test_IssueHOTPAdvancesCounter(t *testing.T) {
+	dek, _ := newDEK()
+	vault := &Vault{UserID: uuid.New(), Mode: ServerMode, KeyVersion: 1}
+	ring := &keyRing{version: 1, keys: map[int][]byte{1: dek}}
+	key := []byte("12345678901234567890")
+	psw := &Password{PasswordID: uuid.New(), UserID: vault.UserID, CategoryID: uuid.New(), Website: "example", Type: ItemNote, Note: &Note{Text: "x"},
+		OTP: &OTP{Type: OTPTypeHOTP, Secret: base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key), Algorithm: "SHA1", Digits: 6}}
+	data, err := seal(vault, ring, psw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each code is issued from the counter the previous one left behind
+	first, data, err := issueHOTP(vault, ring, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, data, err := issueHOTP(vault, ring, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Counter != 0 || second.Counter != 1 || first.Code != "755224" || second.Code != "287082" {
+		t.Fatalf("issued %+v then %+v, want consecutive counters", first, second)
+	}
+
+	stored, err := open(vault, ring, data)
+	if err != nil || stored.OTP.Counter != 2 || stored.OTP.Secret == "" {
+		t.Fatalf("stored generator = %+v, %v", stored.OTP, err)
+	}
+}
+
+func Test_IssueHOTPRefusesTOTP(t *testing.T) {
+	dek, _ := newDEK()
+	vault := &Vault{UserID: uuid.New(), Mode: ServerMode, KeyVersion: 1}
+	ring := &keyRing{version: 1, keys: map[int][]byte{1: dek}}
+	psw := &Password{PasswordID: uuid.New(), UserID: vault.UserID, CategoryID: uuid.New(), Website: "example", Type: ItemNote, Note: &Note{Text: "x"},
+		OTP: &OTP{Type: OTPTypeTOTP, Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30}}
+	data, err := seal(vault, ring, psw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// totp codes never change the entry, so they are not issued through a write
+	if _, _, err := issueHOTP(vault, ring, data); err == nil {
+		t.Fatal("issueHOTP() issued a totp code")
+	}
+}
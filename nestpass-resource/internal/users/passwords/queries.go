@@ -8,35 +8,457 @@ const (
 	FROM users WHERE user_id = $1`
 
 	GetAllPasswordsNonPagedQuery = `
-	SELECT * FROM passwords
-	WHERE user_id = $1`
+	SELECT password_id, user_id, category_id, website, nonce, encrypted, key_version, updated FROM passwords
+	WHERE user_id = $1 AND deleted_at IS NULL`
 
-	GetAllPasswordsQuery = `
-	SELECT * FROM passwords
-	WHERE user_id = $1 AND password_id > $2
-	ORDER BY password_id ASC
-	LIMIT $3`
+	// active entries filed in the categories ($3), only the entry ($2) when one is given
+	GetFiledPasswordsQuery = `
+	SELECT password_id, user_id, category_id, website, nonce, encrypted, key_version, updated FROM passwords
+	WHERE user_id = $1 AND ($2::uuid IS NULL OR password_id = $2) AND category_id = ANY($3::uuid[]) AND deleted_at IS NULL`
 
-	GetAllPasswordsByCategoryQuery = `
-	SELECT * FROM passwords
-	WHERE user_id = $1 AND category_id = $2 AND password_id > $3
-	ORDER BY password_id ASC
-	LIMIT $4`
+	// every entry of the vault, including the ones in the trash
+	GetVaultPasswordsQuery = `
+	SELECT password_id, user_id, category_id, website, nonce, encrypted, key_version, updated FROM passwords
+	WHERE user_id = $1`
+
+	// columns of listed entries, read with PasswordEncrypt.ScanListed
+	listedColumns = `p.password_id, p.user_id, p.category_id, p.website, p.nonce, p.encrypted, p.key_version, p.updated,
+	p.favorite, p.last_used, p.created`
 
 	GetPasswordQuery = `
-	SELECT * FROM passwords
-	WHERE user_id = $1 AND password_id = $2 AND category_id = $3`
+	SELECT ` + listedColumns + ` FROM passwords p
+	WHERE p.user_id = $1 AND p.password_id = $2 AND p.category_id = $3 AND p.deleted_at IS NULL`
 
 	CreatePasswordQuery = `
 	INSERT INTO passwords (
-		password_id, user_id, category_id, website, nonce, encrypted
-	) VALUES ($1, $2, $3, $4, $5, $6)`
+		password_id, user_id, category_id, website, nonce, encrypted, key_version, search_tokens, updated, favorite, created
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $9)`
 
 	UpdatePasswordQuery = `
-	UPDATE passwords SET website = $1, nonce = $2, encrypted = $3
-	WHERE password_id = $4 AND category_id = $5 AND user_id = $6`
+	UPDATE passwords SET website = $1, nonce = $2, encrypted = $3, key_version = $4, search_tokens = $8, updated = $9
+	WHERE password_id = $5 AND category_id = $6 AND user_id = $7`
+
+	// entries not on the key version, trashed entries are rekeyed as well so they stay restorable
+	GetStalePasswordsQuery = `
+	SELECT password_id, user_id, category_id, website, nonce, encrypted, key_version, updated FROM passwords
+	WHERE user_id = $1 AND key_version <> $2
+	ORDER BY password_id ASC
+	LIMIT $3
+	FOR UPDATE`
+
+	// entries, their revisions and attachments not on the key version
+	CountStalePasswordsQuery = `
+	SELECT
+		(SELECT count(*) FROM passwords WHERE user_id = $1 AND key_version <> $2) +
+		(SELECT count(*) FROM password_history WHERE user_id = $1 AND key_version <> $2) +
+		(SELECT count(*) FROM attachments WHERE user_id = $1 AND key_version <> $2)`
+
+	GetPasswordForUpdateQuery = `
+	SELECT password_id, user_id, category_id, website, nonce, encrypted, key_version, updated FROM passwords
+	WHERE user_id = $1 AND password_id = $2 AND category_id = $3 AND deleted_at IS NULL
+	FOR UPDATE`
+
+	CreateRevisionQuery = `
+	INSERT INTO password_history (
+		revision_id, password_id, user_id, category_id, website, nonce, encrypted, key_version, created
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	// drops every revision of the entry past the newest ones kept
+	PruneRevisionsQuery = `
+	DELETE FROM password_history
+	WHERE password_id = $1 AND user_id = $2 AND revision_id NOT IN (
+		SELECT revision_id FROM password_history
+		WHERE password_id = $1 AND user_id = $2
+		ORDER BY created DESC
+		LIMIT $3
+	)`
+
+	GetRevisionsQuery = `
+	SELECT revision_id, password_id, created FROM password_history
+	WHERE password_id = $1 AND user_id = $2 AND ($3::timestamptz IS NULL OR (created, revision_id) > ($3, $4::uuid))
+	ORDER BY created ASC, revision_id ASC
+	LIMIT $5`
+
+	GetRevisionsDescQuery = `
+	SELECT revision_id, password_id, created FROM password_history
+	WHERE password_id = $1 AND user_id = $2 AND ($3::timestamptz IS NULL OR (created, revision_id) < ($3, $4::uuid))
+	ORDER BY created DESC, revision_id DESC
+	LIMIT $5`
+
+	GetRevisionQuery = `
+	SELECT revision_id, created, password_id, user_id, category_id, website, nonce, encrypted, key_version FROM password_history
+	WHERE revision_id = $1 AND password_id = $2 AND user_id = $3`
+
+	GetVaultRevisionsQuery = `
+	SELECT revision_id, created, password_id, user_id, category_id, website, nonce, encrypted, key_version FROM password_history
+	WHERE user_id = $1
+	FOR UPDATE`
+
+	GetStaleRevisionsQuery = `
+	SELECT revision_id, created, password_id, user_id, category_id, website, nonce, encrypted, key_version FROM password_history
+	WHERE user_id = $1 AND key_version <> $2
+	ORDER BY revision_id ASC
+	LIMIT $3
+	FOR UPDATE`
+
+	UpdateRevisionQuery = `
+	UPDATE password_history SET nonce = $1, encrypted = $2, key_version = $3
+	WHERE revision_id = $4 AND user_id = $5`
+
+	DeleteVaultRevisionsQuery = `
+	DELETE FROM password_history
+	WHERE user_id = $1`
+
+	GetVaultQuery = `
+	SELECT user_id, mode, wrapped_key, wrapped_dek, prev_wrapped_dek, key_version, kdf_params, updated, public_key, wrapped_private_key FROM vaults
+	WHERE user_id = $1`
+
+	EnsureVaultQuery = `
+	INSERT INTO vaults (user_id, mode, key_version, updated)
+	VALUES ($1, 'server', 1, now())
+	ON CONFLICT (user_id) DO NOTHING`
+
+	LockVaultQuery = `
+	SELECT user_id, mode, wrapped_key, wrapped_dek, prev_wrapped_dek, key_version, kdf_params, updated, public_key, wrapped_private_key FROM vaults
+	WHERE user_id = $1
+	FOR UPDATE`
+
+	ShareVaultQuery = `
+	SELECT user_id, mode, wrapped_key, wrapped_dek, prev_wrapped_dek, key_version, kdf_params, updated, public_key, wrapped_private_key FROM vaults
+	WHERE user_id = $1
+	FOR SHARE`
+
+	UpsertVaultQuery = `
+	INSERT INTO vaults (user_id, mode, wrapped_key, wrapped_dek, prev_wrapped_dek, key_version, kdf_params, updated, public_key, wrapped_private_key)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	ON CONFLICT (user_id) DO UPDATE
+	SET mode = EXCLUDED.mode, wrapped_key = EXCLUDED.wrapped_key,
+		wrapped_dek = EXCLUDED.wrapped_dek, prev_wrapped_dek = EXCLUDED.prev_wrapped_dek,
+		key_version = EXCLUDED.key_version, kdf_params = EXCLUDED.kdf_params, updated = EXCLUDED.updated,
+		public_key = EXCLUDED.public_key, wrapped_private_key = EXCLUDED.wrapped_private_key`
+
+	CreateRekeyJobQuery = `
+	INSERT INTO rekey_jobs (job_id, user_id, from_version, to_version, status, total, done, error, started, updated)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	UpdateRekeyJobQuery = `
+	UPDATE rekey_jobs SET status = $1, done = $2, error = $3, updated = $4
+	WHERE job_id = $5`
+
+	GetLatestRekeyJobQuery = `
+	SELECT job_id, user_id, from_version, to_version, status, total, done, error, started, updated FROM rekey_jobs
+	WHERE user_id = $1
+	ORDER BY started DESC
+	LIMIT 1`
+
+	GetUnfinishedRekeyJobsQuery = `
+	SELECT job_id, user_id, from_version, to_version, status, total, done, error, started, updated FROM rekey_jobs
+	WHERE status <> 'done'`
+
+	// the oldest pending reset holds the hash the vault is still wrapped with
+	GetRewrapQuery = `
+	SELECT rewrap_id, user_id, prev_hash, queued, attempts, retry_at FROM vault_rewraps
+	WHERE user_id = $1
+	ORDER BY queued ASC
+	LIMIT 1`
+
+	// the oldest pending reset of each user whose retry is due
+	GetDueRewrapsQuery = `
+	SELECT rewrap_id, user_id, prev_hash, queued, attempts, retry_at FROM (
+		SELECT DISTINCT ON (user_id) rewrap_id, user_id, prev_hash, queued, attempts, retry_at FROM vault_rewraps
+		ORDER BY user_id, queued ASC
+	) oldest
+	WHERE retry_at <= now()
+	ORDER BY queued ASC
+	LIMIT $1`
+
+	RetryRewrapQuery = `
+	UPDATE vault_rewraps SET attempts = $2, retry_at = $3
+	WHERE rewrap_id = $1`
+
+	// resets queued later are kept, the vault may have been rewrapped before their password changed
+	DeleteRewrapsQuery = `
+	DELETE FROM vault_rewraps
+	WHERE user_id = $1 AND queued <= $2`
+
+	TrashPasswordQuery = `
+	UPDATE passwords SET deleted_at = $4
+	WHERE password_id = $1 AND category_id = $2 AND user_id = $3 AND deleted_at IS NULL`
+
+	GetTrashQuery = `
+	SELECT deleted_at, password_id, user_id, category_id, website, nonce, encrypted, key_version, updated FROM passwords
+	WHERE user_id = $1 AND deleted_at IS NOT NULL AND ($2::timestamptz IS NULL OR (deleted_at, password_id) > ($2, $3::uuid))
+	ORDER BY deleted_at ASC, password_id ASC
+	LIMIT $4`
+
+	GetTrashDescQuery = `
+	SELECT deleted_at, password_id, user_id, category_id, website, nonce, encrypted, key_version, updated FROM passwords
+	WHERE user_id = $1 AND deleted_at IS NOT NULL AND ($2::timestamptz IS NULL OR (deleted_at, password_id) < ($2, $3::uuid))
+	ORDER BY deleted_at DESC, password_id DESC
+	LIMIT $4`
+
+	GetTrashedPasswordQuery = `
+	SELECT deleted_at, password_id, user_id, category_id, website, nonce, encrypted, key_version, updated FROM passwords
+	WHERE password_id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+	FOR UPDATE`
+
+	// entries can only be restored into a category that is not in the trash itself
+	CategoryActiveQuery = `
+	SELECT EXISTS (
+		SELECT 1 FROM categories
+		WHERE category_id = $1 AND user_id = $2 AND deleted_at IS NULL
+	)`
+
+	RestorePasswordQuery = `
+	UPDATE passwords SET deleted_at = NULL
+	WHERE password_id = $1 AND user_id = $2`
+
+	PurgePasswordsQuery = `
+	DELETE FROM passwords
+	WHERE password_id = ANY($1) AND user_id = $2 AND deleted_at IS NOT NULL`
+
+	PurgeRevisionsQuery = `
+	DELETE FROM password_history
+	WHERE password_id = ANY($1) AND user_id = $2`
 
-	DeletePasswordQuery = `
+	GetTrashIDsQuery = `
+	SELECT password_id FROM passwords
+	WHERE user_id = $1 AND deleted_at IS NOT NULL
+	FOR UPDATE`
+
+	// history of every entry trashed before the cutoff, across all users
+	GetExpiredTrashUsersQuery = `
+	SELECT DISTINCT user_id FROM passwords
+	WHERE deleted_at < $1`
+
+	PurgeExpiredRevisionsQuery = `
+	DELETE FROM password_history
+	WHERE password_id IN (
+		SELECT password_id FROM passwords
+		WHERE user_id = $2 AND deleted_at < $1
+	)`
+
+	PurgeExpiredPasswordsQuery = `
 	DELETE FROM passwords
-	WHERE password_id = $1 AND category_id = $2 AND user_id = $3`
+	WHERE user_id = $2 AND deleted_at < $1`
+
+	// entries stored before they were indexed, NULL is kept apart from entries without any token
+	GetUnindexedPasswordsQuery = `
+	SELECT password_id, user_id, category_id, website, nonce, encrypted, key_version, updated FROM passwords
+	WHERE user_id = $1 AND search_tokens IS NULL
+	ORDER BY password_id ASC
+	LIMIT $2
+	FOR UPDATE`
+
+	// owners of entries stored before they were indexed, client side encrypted vaults have no index
+	GetUnindexedVaultsQuery = `
+	SELECT DISTINCT p.user_id FROM passwords p
+	LEFT JOIN vaults v ON v.user_id = p.user_id
+	WHERE p.search_tokens IS NULL AND v.mode IS DISTINCT FROM 'client'`
+
+	UpdateSearchTokensQuery = `
+	UPDATE passwords SET search_tokens = $3
+	WHERE user_id = $1 AND password_id = $2`
+
+	// every term of the query ($4) has to match a token of the entry or its category, tokens
+	// ($6) and categories ($8) come with the number of the term they match ($5, $7)
+	// an entry matches when every term matches one of its tokens or its category, pages start
+	// after the boundary id
+	searchPasswordsWhere = `
+	WHERE p.user_id = $1 AND p.deleted_at IS NULL
+	AND (p.search_tokens && $6::bytea[] OR p.category_id = ANY($8::uuid[]))
+	AND NOT EXISTS (
+		SELECT 1 FROM generate_series(1, $4::int) t(n)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM unnest($5::int[], $6::bytea[]) k(n, token)
+			WHERE k.n = t.n AND p.search_tokens @> ARRAY[k.token]
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM unnest($7::int[], $8::uuid[]) c(n, category_id)
+			WHERE c.n = t.n AND c.category_id = p.category_id
+		)
+	)`
+
+	SearchPasswordsQuery = `
+	SELECT ` + listedColumns + ` FROM passwords p` + searchPasswordsWhere + `
+	AND ($2::uuid IS NULL OR p.password_id > $2)
+	ORDER BY p.password_id ASC
+	LIMIT $3`
+
+	SearchPasswordsDescQuery = `
+	SELECT ` + listedColumns + ` FROM passwords p` + searchPasswordsWhere + `
+	AND ($2::uuid IS NULL OR p.password_id < $2)
+	ORDER BY p.password_id DESC
+	LIMIT $3`
+
+	GetOrgKeyQuery = `
+	SELECT sealed_key FROM org_members
+	WHERE org_id = $1 AND user_id = $2`
+
+	// shares the user owns or is a member of
+	CountUserSharesQuery = `
+	SELECT count(*) FROM shares s
+	WHERE s.owner_id = $1 OR EXISTS (
+		SELECT 1 FROM share_members m WHERE m.share_id = s.share_id AND m.recipient_id = $1
+	)`
+
+	CountOrgMembershipsQuery = `
+	SELECT count(*) FROM org_members
+	WHERE user_id = $1`
+
+	CountEmergencyContactsQuery = `
+	SELECT count(*) FROM emergency_contacts
+	WHERE owner_id = $1 OR contact_id = $1`
+
+	attachmentColumns = `
+	a.attachment_id, a.password_id, a.user_id, a.name, a.content_type, a.size, a.wrapped_key,
+	a.key_version, a.nonce_prefix, a.created`
+
+	CreateAttachmentQuery = `
+	INSERT INTO attachments (attachment_id, password_id, user_id, name, content_type, size, wrapped_key, key_version, nonce_prefix, created)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	// attachments are only reachable through active entries
+	GetAttachmentsQuery = `
+	SELECT` + attachmentColumns + ` FROM attachments a
+	JOIN passwords p ON p.password_id = a.password_id AND p.user_id = a.user_id
+	WHERE a.password_id = $1 AND p.category_id = $2 AND a.user_id = $3 AND p.deleted_at IS NULL
+	AND ($4::timestamptz IS NULL OR (a.created, a.attachment_id) > ($4, $5::uuid))
+	ORDER BY a.created ASC, a.attachment_id ASC
+	LIMIT $6`
+
+	GetAttachmentsDescQuery = `
+	SELECT` + attachmentColumns + ` FROM attachments a
+	JOIN passwords p ON p.password_id = a.password_id AND p.user_id = a.user_id
+	WHERE a.password_id = $1 AND p.category_id = $2 AND a.user_id = $3 AND p.deleted_at IS NULL
+	AND ($4::timestamptz IS NULL OR (a.created, a.attachment_id) < ($4, $5::uuid))
+	ORDER BY a.created DESC, a.attachment_id DESC
+	LIMIT $6`
+
+	GetAttachmentQuery = `
+	SELECT` + attachmentColumns + ` FROM attachments a
+	JOIN passwords p ON p.password_id = a.password_id AND p.user_id = a.user_id
+	WHERE a.attachment_id = $1 AND a.user_id = $2 AND p.deleted_at IS NULL`
+
+	// bytes stored by the owner, trashed entries included until they are purged
+	GetAttachmentUsageQuery = `
+	SELECT coalesce(sum(size), 0) FROM attachments
+	WHERE user_id = $1`
+
+	CountAttachmentsQuery = `
+	SELECT count(*) FROM attachments
+	WHERE user_id = $1`
+
+	// trashed entries are rekeyed as well so their attachments stay readable
+	GetStaleAttachmentsQuery = `
+	SELECT` + attachmentColumns + ` FROM attachments a
+	WHERE a.user_id = $1 AND a.key_version <> $2
+	ORDER BY a.attachment_id ASC
+	LIMIT $3
+	FOR UPDATE`
+
+	UpdateAttachmentKeyQuery = `
+	UPDATE attachments SET wrapped_key = $2, key_version = $3
+	WHERE attachment_id = $1`
+
+	// deleted attachments queue their blob for removal, blobs are removed once the deletion committed
+	queueDeletedAttachments = `
+	INSERT INTO attachment_deletions (attachment_id, queued)
+	SELECT attachment_id, now() FROM deleted`
+
+	DeleteAttachmentQuery = `
+	WITH deleted AS (
+		DELETE FROM attachments
+		WHERE attachment_id = $1 AND user_id = $2
+		RETURNING attachment_id
+	)` + queueDeletedAttachments
+
+	PurgeAttachmentsQuery = `
+	WITH deleted AS (
+		DELETE FROM attachments
+		WHERE password_id = ANY($1) AND user_id = $2
+		RETURNING attachment_id
+	)` + queueDeletedAttachments
+
+	PurgeExpiredAttachmentsQuery = `
+	WITH deleted AS (
+		DELETE FROM attachments
+		WHERE password_id IN (
+			SELECT password_id FROM passwords
+			WHERE user_id = $2 AND deleted_at < $1
+		)
+		RETURNING attachment_id
+	)` + queueDeletedAttachments
+
+	GetQueuedBlobsQuery = `
+	SELECT attachment_id FROM attachment_deletions
+	ORDER BY queued ASC
+	LIMIT $1`
+
+	DeleteQueuedBlobQuery = `
+	DELETE FROM attachment_deletions
+	WHERE attachment_id = $1`
+
+	// tag names are unique per owner regardless of case
+	CreateTagQuery = `
+	INSERT INTO tags (tag_id, user_id, name, created)
+	VALUES ($1, $2, $3, $4)`
+
+	GetTagsQuery = `
+	SELECT t.tag_id, t.user_id, t.name, t.created, count(p.password_id) FROM tags t
+	LEFT JOIN password_tags pt ON pt.tag_id = t.tag_id
+	LEFT JOIN passwords p ON p.password_id = pt.password_id AND p.user_id = t.user_id AND p.deleted_at IS NULL
+	WHERE t.user_id = $1
+	GROUP BY t.tag_id
+	ORDER BY lower(t.name) ASC`
+
+	RenameTagQuery = `
+	UPDATE tags SET name = $3
+	WHERE tag_id = $1 AND user_id = $2`
+
+	DeleteTagEntriesQuery = `
+	DELETE FROM password_tags
+	WHERE tag_id = $1 AND user_id = $2`
+
+	DeleteTagQuery = `
+	DELETE FROM tags
+	WHERE tag_id = $1 AND user_id = $2`
+
+	CountOwnedTagsQuery = `
+	SELECT count(*) FROM tags
+	WHERE user_id = $1 AND tag_id = ANY($2)`
+
+	ClearPasswordTagsQuery = `
+	DELETE FROM password_tags
+	WHERE password_id = $1 AND user_id = $2`
+
+	AddPasswordTagsQuery = `
+	INSERT INTO password_tags (password_id, tag_id, user_id)
+	SELECT $1, tag_id, $3 FROM unnest($2::uuid[]) AS tag_id`
+
+	GetPasswordTagsQuery = `
+	SELECT pt.password_id, t.tag_id, t.user_id, t.name, t.created FROM password_tags pt
+	JOIN tags t ON t.tag_id = pt.tag_id
+	WHERE pt.user_id = $1 AND pt.password_id = ANY($2)
+	ORDER BY lower(t.name) ASC`
+
+	PurgePasswordTagsQuery = `
+	DELETE FROM password_tags
+	WHERE password_id = ANY($1) AND user_id = $2`
+
+	PurgeExpiredPasswordTagsQuery = `
+	DELETE FROM password_tags
+	WHERE password_id IN (
+		SELECT password_id FROM passwords
+		WHERE user_id = $2 AND deleted_at < $1
+	)`
+
+	// favorites and use are kept apart from the content, they leave updated as it is
+	SetFavoriteQuery = `
+	UPDATE passwords SET favorite = $4
+	WHERE user_id = $1 AND password_id = $2 AND category_id = $3 AND deleted_at IS NULL`
+
+	TouchPasswordQuery = `
+	UPDATE passwords SET last_used = $4
+	WHERE user_id = $1 AND password_id = $2 AND category_id = $3 AND deleted_at IS NULL`
 )
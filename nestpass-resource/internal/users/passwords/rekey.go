@@ -0,0 +1,414 @@
+package passwords
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+)
+
+// number of entries rekeyed per transaction
+const rekeyBatchSize = 50
+
+// how often pending rewraps are looked for, a reset normally rewraps the vault right away and the
+// worker only picks up the ones whose call from the auth server failed
+const rewrapInterval = time.Minute
+
+// longest a vault whose rewrap keeps failing waits before it is tried again
+const rewrapMaxBackoff = time.Hour
+
+// pending rewraps retried per run
+const rewrapBatchSize = 50
+
+// Rotates the vault's data encryption key and records a job that moves the entries onto it.
+// Rotating is idempotent, while a vault still holds a previous key its pending job is returned instead.
+func (s *service) StartRekey(ctx context.Context, userID uuid.UUID) (*RekeyJob, error) {
+	if _, err := s.prepareVault(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "StartRekey").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	vault, err := s.repo.LockVault(ctx, tx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Mode == ClientMode {
+		return nil, apiutils.NewErrBadRequest("client side encrypted vaults are rekeyed by the client")
+	}
+
+	// a previous rotation has not finished yet
+	if len(vault.PrevDEK) != 0 {
+		job, err := s.repo.GetLatestRekeyJob(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		if job != nil && job.ToVersion == vault.KeyVersion {
+			return job, nil
+		}
+	}
+
+	ring, err := s.keyRing(ctx, vault)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vault.PrevDEK) == 0 {
+		dek, err := newDEK()
+		if err != nil {
+			return nil, err
+		}
+
+		ring = &keyRing{
+			version: ring.version + 1,
+			keys:    map[int][]byte{ring.version: ring.current(), ring.version + 1: dek},
+			private: ring.private,
+		}
+
+		if err := s.wrapRing(ctx, vault, ring); err != nil {
+			return nil, err
+		}
+
+		if err := s.repo.UpsertVault(ctx, tx, vault); err != nil {
+			return nil, err
+		}
+	}
+
+	total, err := s.repo.CountStalePasswords(ctx, tx, userID, vault.KeyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &RekeyJob{
+		JobID:       uuid.New(),
+		UserID:      userID,
+		FromVersion: vault.KeyVersion - 1,
+		ToVersion:   vault.KeyVersion,
+		Status:      RekeyRunning,
+		Total:       total,
+		Started:     now,
+		Updated:     now,
+	}
+
+	if err := s.repo.CreateRekeyJob(ctx, tx, job); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "StartRekey").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	log.Info().Str("location", "StartRekey").Msgf("%v: rekeying %v entries to version %v", userID, total, job.ToVersion)
+	return job, nil
+}
+
+// Starts or resumes the vault's rekey job in the background and returns it.
+func (s *service) Rekey(ctx context.Context, userID uuid.UUID) (*RekeyJob, error) {
+	job, err := s.StartRekey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status != RekeyDone {
+		go s.runRekey(context.Background(), job)
+	}
+
+	return job, nil
+}
+
+// Resumes every job left unfinished by a crash or a failed batch, meant to run once at startup.
+func (s *service) ResumeRekeyJobs(ctx context.Context) {
+	jobs, err := s.repo.GetUnfinishedRekeyJobs(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, job := range jobs {
+		s.runRekey(ctx, job)
+	}
+
+	if len(jobs) != 0 {
+		log.Info().Str("location", "ResumeRekeyJobs").Msgf("%v rekey jobs resumed", len(jobs))
+	}
+}
+
+// Retries the vault rewraps of password resets the auth server could not finish until the context
+// ends, each rewrap failing again waits twice as long.
+func (s *service) RunRewraps(ctx context.Context) {
+	ticker := time.NewTicker(rewrapInterval)
+	defer ticker.Stop()
+
+	for {
+		if rewrapped, err := s.ProcessRewraps(ctx); err != nil {
+			log.Error().Str("location", "RunRewraps").Msgf("failed to process pending rewraps: %v", err)
+		} else if rewrapped > 0 {
+			log.Info().Str("location", "RunRewraps").Msgf("%v vaults rewrapped after a password reset", rewrapped)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Rewraps the vaults whose pending rewrap is due, returning how many were rewrapped. A failed
+// rewrap stays pending and is retried after a backoff.
+func (s *service) ProcessRewraps(ctx context.Context) (int, error) {
+	rewraps, err := s.repo.GetDueRewraps(ctx, rewrapBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	rewrapped := 0
+	for _, rewrap := range rewraps {
+		if err := s.ReUpdateAllPasswords(ctx, rewrap.UserID); err != nil {
+			log.Error().Str("location", "ProcessRewraps").Msgf("%v: failed to rewrap vault: %v", rewrap.UserID, err)
+
+			rewrap.Attempts++
+			rewrap.RetryAt = time.Now().Add(rewrapBackoff(rewrap.Attempts))
+			if err := s.repo.RetryRewrap(ctx, rewrap); err != nil {
+				return rewrapped, err
+			}
+
+			continue
+		}
+
+		rewrapped++
+	}
+
+	return rewrapped, nil
+}
+
+// helper: rewrapBackoff returns how long a rewrap waits after failing attempts times.
+func rewrapBackoff(attempts int) time.Duration {
+	backoff := rewrapInterval
+	for i := 1; i < attempts && backoff < rewrapMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, rewrapMaxBackoff)
+}
+
+// helper: runRekey moves the job's entries onto the new data key in batches. Every batch commits
+// its entries with their new key version, so a crash only repeats the batch in flight. The
+// previous key is dropped once no entry uses it anymore.
+func (s *service) runRekey(ctx context.Context, job *RekeyJob) {
+	// one runner per job in this process
+	if _, running := s.rekeys.LoadOrStore(job.JobID, struct{}{}); running {
+		return
+	}
+	defer s.rekeys.Delete(job.JobID)
+
+	if err := s.rekey(ctx, job); err != nil {
+		log.Error().Str("location", "runRekey").Msgf("%v: job %v failed: %v", job.UserID, job.JobID, err)
+		job.Status, job.Error, job.Updated = RekeyFailed, err.Error(), time.Now()
+		if err := s.repo.UpdateRekeyJob(ctx, nil, job); err != nil {
+			log.Error().Str("location", "runRekey").Msgf("%v: failed to record failure of job %v: %v", job.UserID, job.JobID, err)
+		}
+	}
+}
+
+// helper: rekey runs the job's batches and finalizes it.
+func (s *service) rekey(ctx context.Context, job *RekeyJob) error {
+	vault, err := s.repo.GetVault(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	// the vault moved on, e.g. to client side encryption
+	if vault.Mode == ClientMode || vault.KeyVersion != job.ToVersion {
+		return apiutils.NewErrConflict("vault no longer matches the job")
+	}
+
+	ring, err := s.keyRing(ctx, vault)
+	if err != nil {
+		return err
+	}
+
+	return s.rekeyBatches(ctx, job, ring)
+}
+
+// helper: rekeyBatches runs batches until no row is left on a previous key version, a resumed
+// job picks up with the rows its committed batches did not reach.
+func (s *service) rekeyBatches(ctx context.Context, job *RekeyJob, ring *keyRing) error {
+	if job.Status == RekeyFailed {
+		job.Status, job.Error = RekeyRunning, ""
+	}
+
+	for {
+		rekeyed, err := s.rekeyBatch(ctx, job, ring)
+		if err != nil {
+			return err
+		}
+
+		if rekeyed == 0 {
+			break
+		}
+	}
+
+	return s.finishRekey(ctx, job)
+}
+
+// helper: rekeyBatch re-encrypts one batch of entries and revisions not on the job's key version,
+// returning how many it rekeyed.
+func (s *service) rekeyBatch(ctx context.Context, job *RekeyJob, ring *keyRing) (int, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "rekeyBatch").Msgf("%v: %v", job.UserID, err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// stale rows are selected like they are counted, each opened with the key it was sealed with
+	passwords, err := s.repo.GetStalePasswords(ctx, tx, job.UserID, job.ToVersion, rekeyBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, password := range passwords {
+		oldKey, err := ring.get(password.KeyVersion)
+		if err != nil {
+			return 0, err
+		}
+
+		newData, err := reencrypt(password, oldKey, ring)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := s.repo.UpdatePassword(ctx, tx, newData); err != nil {
+			return 0, err
+		}
+	}
+
+	revisions, err := s.repo.GetStaleRevisions(ctx, tx, job.UserID, job.ToVersion, rekeyBatchSize-len(passwords))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, revision := range revisions {
+		oldKey, err := ring.get(revision.KeyVersion)
+		if err != nil {
+			return 0, err
+		}
+
+		newData, err := reencrypt(&revision.PasswordEncrypt, oldKey, ring)
+		if err != nil {
+			return 0, err
+		}
+
+		revision.PasswordEncrypt = *newData
+		if err := s.repo.UpdateRevision(ctx, tx, revision); err != nil {
+			return 0, err
+		}
+	}
+
+	attachments, err := s.rekeyAttachments(ctx, tx, job, ring, rekeyBatchSize-len(passwords)-len(revisions))
+	if err != nil {
+		return 0, err
+	}
+
+	rekeyed := len(passwords) + len(revisions) + attachments
+	if rekeyed == 0 {
+		return 0, nil
+	}
+
+	stale, err := s.repo.CountStalePasswords(ctx, tx, job.UserID, job.ToVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	// entries created or deleted meanwhile shift the total
+	job.Done, job.Updated = max(job.Total-stale, 0), time.Now()
+	if job.Total < job.Done+stale {
+		job.Total = job.Done + stale
+	}
+
+	if err := s.repo.UpdateRekeyJob(ctx, tx, job); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "rekeyBatch").Msgf("%v: %v", job.UserID, err)
+		return 0, err
+	}
+
+	return rekeyed, nil
+}
+
+// helper: finishRekey drops the previous key and marks the job done once no entry uses it.
+func (s *service) finishRekey(ctx context.Context, job *RekeyJob) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "finishRekey").Msgf("%v: %v", job.UserID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	vault, err := s.repo.LockVault(ctx, tx, job.UserID, true)
+	if err != nil {
+		return err
+	}
+
+	stale, err := s.repo.CountStalePasswords(ctx, tx, job.UserID, job.ToVersion)
+	if err != nil {
+		return err
+	}
+
+	if stale != 0 {
+		return apiutils.NewErrConflict("entries left on a previous key version")
+	}
+
+	vault.PrevDEK, vault.Updated = nil, time.Now()
+	if err := s.repo.UpsertVault(ctx, tx, vault); err != nil {
+		return err
+	}
+
+	job.Status, job.Done, job.Error, job.Updated = RekeyDone, job.Total, "", time.Now()
+	if err := s.repo.UpdateRekeyJob(ctx, tx, job); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "finishRekey").Msgf("%v: %v", job.UserID, err)
+		return err
+	}
+
+	log.Info().Str("location", "finishRekey").Msgf("%v: %v entries rekeyed to version %v", job.UserID, job.Total, job.ToVersion)
+	return nil
+}
+
+// Reports the vault's key version, the entries not on it and the latest rekey job.
+func (s *service) GetRekeyStatus(ctx context.Context, userID uuid.UUID) (*RekeyStatus, error) {
+	vault, err := s.repo.GetVault(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &RekeyStatus{Mode: vault.Mode, KeyVersion: vault.KeyVersion}
+	if vault.Mode == ServerMode {
+		if status.Stale, err = s.repo.CountStalePasswords(ctx, nil, userID, vault.KeyVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	if status.Job, err = s.repo.GetLatestRekeyJob(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	status.Rekeyed = status.Stale == 0 && len(vault.PrevDEK) == 0
+	return status, nil
+}
@@ -0,0 +1,215 @@
+package passwords
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"nestpass/internal/databases/pgtest"
+)
+
+// helper: newStaleRow seals an entry with the key version of the ring and returns it as a stale row.
+func newStaleRow(t *testing.T, userID uuid.UUID, ring *keyRing, version int, secret string) []any {
+	t.Helper()
+
+	psw, err := NewPasswordEncrypt(&Password{UserID: userID, Website: "example.com", Type: ItemLogin, Login: &Login{Username: "user", Password: secret}}, ring.keys[version])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []any{psw.PasswordID, psw.UserID, psw.CategoryID, psw.Website, psw.Nonce, psw.Encrypted, version, psw.Updated}
+}
+
+// helper: newRekeyRing builds a ring holding the keys of every version up to the current one.
+func newRekeyRing(current int) *keyRing {
+	ring := &keyRing{version: current, keys: map[int][]byte{}}
+	for version := 1; version <= current; version++ {
+		ring.keys[version], _ = newDEK()
+	}
+
+	return ring
+}
+
+// helper: rekeyedSecrets opens the entries the batches wrote with the current key of the ring.
+func rekeyedSecrets(t *testing.T, db *pgtest.DB, userID uuid.UUID, ring *keyRing) []string {
+	t.Helper()
+
+	secrets := []string{}
+	for _, exec := range db.Execs {
+		if exec.SQL != UpdatePasswordQuery {
+			continue
+		}
+
+		if version := *exec.Args[3].(*int); version != ring.version {
+			t.Fatalf("entry rekeyed to version %d, want %d", version, ring.version)
+		}
+
+		written := &PasswordEncrypt{Nonce: *exec.Args[1].(*[]byte), Encrypted: *exec.Args[2].(*[]byte)}
+		psw, err := written.Decrypt(userID, ring.current())
+		if err != nil {
+			t.Fatalf("rekeyed entry unreadable with the current key: %v", err)
+		}
+
+		secrets = append(secrets, psw.Login.Password)
+	}
+
+	return secrets
+}
+
+func Test_RekeyBatchOpensRowsWithTheirKeyVersion(t *testing.T) {
+	ctx, userID, ring := context.Background(), uuid.New(), newRekeyRing(3)
+
+	// the vault was rotated twice before the first job finished, entries sit on both old keys
+	db := &pgtest.DB{Results: map[string][][]any{
+		GetStalePasswordsQuery:   {newStaleRow(t, userID, ring, 1, "first"), newStaleRow(t, userID, ring, 2, "second")},
+		CountStalePasswordsQuery: {{1}},
+		GetStaleRevisionsQuery:   {},
+		GetStaleAttachmentsQuery: {},
+	}}
+	svc := &service{repo: &repository{postgres: db}}
+	job := &RekeyJob{JobID: uuid.New(), UserID: userID, FromVersion: 2, ToVersion: 3, Status: RekeyRunning, Total: 2}
+
+	rekeyed, err := svc.rekeyBatch(ctx, job, ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secrets := rekeyedSecrets(t, db, userID, ring); rekeyed != 2 || len(secrets) != 2 || secrets[0] != "first" || secrets[1] != "second" {
+		t.Fatalf("rekeyBatch() rekeyed %d entries %v, want both", rekeyed, secrets)
+	}
+
+	// rows are selected off the job's version, revisions and attachments fill what is left of the batch
+	limits := map[string]any{}
+	for _, query := range db.Queries {
+		if query.Args[1] != 3 {
+			t.Fatalf("stale rows selected against version %v, want 3", query.Args[1])
+		}
+
+		if len(query.Args) == 3 {
+			limits[query.SQL] = query.Args[2]
+		}
+	}
+
+	if limits[GetStalePasswordsQuery] != rekeyBatchSize || limits[GetStaleRevisionsQuery] != rekeyBatchSize-2 || limits[GetStaleAttachmentsQuery] != rekeyBatchSize-2 {
+		t.Fatalf("batch limits %v, want the batch size shared across rows", limits)
+	}
+
+	// an entry left stale, e.g. created meanwhile, keeps the job from counting it as done
+	if job.Done != 1 || job.Total != 2 || db.Commits != 1 {
+		t.Fatalf("job at %d of %d after %d commits, want 1 of 2 after one", job.Done, job.Total, db.Commits)
+	}
+}
+
+func Test_RekeyBatchRejectsUnknownKeyVersion(t *testing.T) {
+	ctx, userID, ring := context.Background(), uuid.New(), newRekeyRing(2)
+
+	// a row claims a key version past the vault's current one
+	db := &pgtest.DB{Results: map[string][][]any{
+		GetStalePasswordsQuery: {newStaleRow(t, userID, newRekeyRing(3), 3, "unknown")},
+	}}
+	svc := &service{repo: &repository{postgres: db}}
+	job := &RekeyJob{JobID: uuid.New(), UserID: userID, FromVersion: 1, ToVersion: 2, Status: RekeyRunning, Total: 1}
+
+	if _, err := svc.rekeyBatch(ctx, job, ring); err == nil {
+		t.Fatal("rekeyBatch() opened a row sealed with a key the vault does not hold")
+	}
+
+	if db.Commits != 0 || len(db.Execs) != 0 {
+		t.Fatalf("rekeyBatch() wrote %+v after failing", db.Execs)
+	}
+}
+
+func Test_RekeyBatchesResumeFailedJob(t *testing.T) {
+	ctx, userID, ring := context.Background(), uuid.New(), newRekeyRing(2)
+
+	// the first run rekeyed one entry before failing, two are left
+	db := &pgtest.DB{
+		Once: map[string][][]any{
+			GetStalePasswordsQuery: {newStaleRow(t, userID, ring, 1, "second"), newStaleRow(t, userID, ring, 1, "third")},
+		},
+		Results: map[string][][]any{CountStalePasswordsQuery: {{0}}},
+	}
+	svc := &service{repo: &repository{postgres: db}}
+	job := &RekeyJob{JobID: uuid.New(), UserID: userID, FromVersion: 1, ToVersion: 2, Status: RekeyFailed, Error: "connection reset", Total: 3, Done: 1}
+
+	if err := svc.rekeyBatches(ctx, job, ring); err != nil {
+		t.Fatal(err)
+	}
+
+	if secrets := rekeyedSecrets(t, db, userID, ring); len(secrets) != 2 || secrets[0] != "second" || secrets[1] != "third" {
+		t.Fatalf("resumed job rekeyed %v, want the entries left", secrets)
+	}
+
+	// the resumed batch is recorded as running again, the job finishes once nothing is left
+	updates := []pgtest.Exec{}
+	for _, exec := range db.Execs {
+		if exec.SQL == UpdateRekeyJobQuery {
+			updates = append(updates, exec)
+		}
+	}
+
+	if len(updates) != 2 || updates[0].Args[0] != RekeyRunning || updates[0].Args[2] != "" || updates[1].Args[0] != RekeyDone {
+		t.Fatalf("job updated with %+v, want running then done", updates)
+	}
+
+	if job.Status != RekeyDone || job.Done != 3 || job.Error != "" || db.Commits != 2 {
+		t.Fatalf("job %+v after %d commits, want it done", job, db.Commits)
+	}
+}
+
+func Test_ProcessRewrapsRetriesFailedRewraps(t *testing.T) {
+	failing, clientSide := uuid.New(), uuid.New()
+	queued := time.Now().Add(-time.Hour)
+	rewrapRow := func(userID uuid.UUID, attempts int) []any {
+		return []any{uuid.New(), userID, "previous hash", queued, attempts, queued}
+	}
+
+	failed, done := rewrapRow(failing, 1), rewrapRow(clientSide, 0)
+	db := &pgtest.DB{
+		Results: map[string][][]any{
+			GetDueRewrapsQuery: {failed, done},
+			GetRewrapQuery:     {done},
+			GetVaultQuery:      {{clientSide, ClientMode, nil, nil, nil, 1, nil, queued, nil, nil}},
+		},
+		Once: map[string][][]any{GetRewrapQuery: {failed}},
+		Fail: func(sql string, args []any) error {
+			if sql == GetVaultQuery && args[0] == failing {
+				return errors.New("connection reset")
+			}
+			return nil
+		},
+	}
+	svc := &service{repo: &repository{postgres: db}}
+
+	rewrapped, err := svc.ProcessRewraps(context.Background())
+	if err != nil || rewrapped != 1 {
+		t.Fatalf("ProcessRewraps() = %d, %v, want 1 vault rewrapped", rewrapped, err)
+	}
+
+	// the failed rewrap stays pending and waits longer than after its first failure
+	retried := db.Executed(RetryRewrapQuery)
+	if len(retried) != 1 || retried[0].Args[0] != failed[0] || retried[0].Args[1] != 2 {
+		t.Fatalf("retried rewraps %v, want %v on its second attempt", retried, failed[0])
+	}
+
+	if wait := time.Until(retried[0].Args[2].(time.Time)); wait < rewrapInterval || wait > 2*rewrapInterval {
+		t.Fatalf("retry in %v, want %v", wait, 2*rewrapInterval)
+	}
+
+	// the other one is dropped up to the reset it was read for
+	deleted := db.Executed(DeleteRewrapsQuery)
+	if len(deleted) != 1 || deleted[0].Args[0] != clientSide || !deleted[0].Args[1].(time.Time).Equal(queued) {
+		t.Fatalf("deleted rewraps %v, want the ones of %v", deleted, clientSide)
+	}
+}
+
+func Test_RewrapBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: rewrapInterval, 2: 2 * rewrapInterval, 60: rewrapMaxBackoff} {
+		if got := rewrapBackoff(attempts); got != want {
+			t.Errorf("rewrapBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -3,24 +3,32 @@ package passwords
 import (
 	"context"
 	"errors"
+	"time"
 
-	"github.com/go-redis/redis"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 	"github.com/tuan882612/apiutils"
 
-	"nestpass/pkg/httputils"
+	"nestpass/pkg/pagination"
 )
 
+// postgres operations the repository runs, satisfied by *pgxpool.Pool
+type database interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type repository struct {
-	postgres *pgxpool.Pool
-	cache    *redis.Client
+	postgres database
 }
 
-func NewRepository(pg *pgxpool.Pool, cache *redis.Client) *repository {
-	return &repository{postgres: pg, cache: cache}
+func NewRepository(pg *pgxpool.Pool) *repository {
+	return &repository{postgres: pg}
 }
 
 func (r *repository) GetKDFData(ctx context.Context, userID uuid.UUID) (*kdfData, error) {
@@ -40,34 +48,66 @@ func (r *repository) GetKDFData(ctx context.Context, userID uuid.UUID) (*kdfData
 	return kdf, nil
 }
 
-func (r *repository) GetResetHash(ctx context.Context, userID uuid.UUID) (string, error) {
-	data := r.cache.Get("reset:" + userID.String())
+// Retrieves the user's vault settings, users without a vault row use server side encryption.
+func (r *repository) GetVault(ctx context.Context, userID uuid.UUID) (*Vault, error) {
+	return r.scanVault(ctx, r.postgres.QueryRow(ctx, GetVaultQuery, userID), userID)
+}
+
+// Retrieves and locks the user's vault settings for the rest of the transaction.
+// Writers take a shared lock, switching the encryption mode takes an exclusive one.
+func (r *repository) LockVault(ctx context.Context, tx pgx.Tx, userID uuid.UUID, exclusive bool) (*Vault, error) {
+	if _, err := tx.Exec(ctx, EnsureVaultQuery, userID); err != nil {
+		log.Error().Str("location", "LockVault").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	query := ShareVaultQuery
+	if exclusive {
+		query = LockVaultQuery
+	}
+
+	return r.scanVault(ctx, tx.QueryRow(ctx, query, userID), userID)
+}
 
-	if err := data.Err(); err != nil {
-		if err == redis.Nil {
-			return "", apiutils.NewErrNotFound("reset hashes not found")
+// helper: scanVault scans the vault row defaulting to server side encryption.
+func (r *repository) scanVault(ctx context.Context, row pgx.Row, userID uuid.UUID) (*Vault, error) {
+	vault := &Vault{}
+	if err := vault.Scan(row); err != nil {
+		if err == pgx.ErrNoRows {
+			return &Vault{UserID: userID, Mode: ServerMode}, nil
 		}
 
-		log.Error().Str("location", "GetResetHashes").Msgf("%v: %v", userID, data.Err())
-		return "", data.Err()
+		log.Error().Str("location", "GetVault").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return vault, nil
+}
+
+func (r *repository) UpsertVault(ctx context.Context, tx pgx.Tx, vault *Vault) error {
+	_, err := tx.Exec(ctx, UpsertVaultQuery, vault.UserID, vault.Mode, vault.WrappedKey,
+		vault.WrappedDEK, vault.PrevDEK, vault.KeyVersion, vault.KDF, vault.Updated, vault.PublicKey, vault.WrappedPrivate)
+	if err != nil {
+		log.Error().Str("location", "UpsertVault").Msgf("%v: %v", vault.UserID, err)
+		return err
 	}
 
-	return data.Val(), nil
+	return nil
 }
 
-func (r *repository) GetAllPasswords(ctx context.Context, userID uuid.UUID, pageParams *httputils.Pagination) ([]*PasswordEncrypt, error) {
-	rows, err := r.postgres.Query(ctx, GetAllPasswordsQuery, userID, pageParams.Index, pageParams.Limit)
+// Retrieves and locks a batch of entries still encrypted with the given key version.
+func (r *repository) GetStalePasswords(ctx context.Context, tx pgx.Tx, userID uuid.UUID, keyVersion, limit int) ([]*PasswordEncrypt, error) {
+	rows, err := tx.Query(ctx, GetStalePasswordsQuery, userID, keyVersion, limit)
 	if err != nil {
-		log.Error().Str("location", "GetAllPasswords").Msgf("%v: %v", userID, err)
+		log.Error().Str("location", "GetStalePasswords").Msgf("%v: %v", userID, err)
 		return nil, err
 	}
 
-	// retrieve passwords
 	passwords := []*PasswordEncrypt{}
 	for rows.Next() {
 		password := &PasswordEncrypt{}
 		if err := password.Scan(rows); err != nil {
-			log.Error().Str("location", "GetAllPasswords").Msgf("%v: %v", userID, err)
+			log.Error().Str("location", "GetStalePasswords").Msgf("%v: %v", userID, err)
 			return nil, err
 		}
 
@@ -77,14 +117,297 @@ func (r *repository) GetAllPasswords(ctx context.Context, userID uuid.UUID, page
 	return passwords, nil
 }
 
-func (r *repository) GetAllPasswordsByCategory(
-	ctx context.Context,
-	userID, categoryID uuid.UUID,
-	pageParms *httputils.Pagination) ([]*PasswordEncrypt, error) {
+// Retrieves the entry and locks it until the transaction ends.
+func (r *repository) GetPasswordForUpdate(ctx context.Context, tx pgx.Tx, userID, passwordID, categoryID uuid.UUID) (*PasswordEncrypt, error) {
+	password := &PasswordEncrypt{}
+	if err := password.Scan(tx.QueryRow(ctx, GetPasswordForUpdateQuery, userID, passwordID, categoryID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("password not found")
+		}
+
+		log.Error().Str("location", "GetPasswordForUpdate").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return password, nil
+}
+
+// Stores the revision and drops the entry's revisions past the retention count.
+func (r *repository) CreateRevision(ctx context.Context, tx pgx.Tx, revision *RevisionEncrypt, retention int) error {
+	_, err := tx.Exec(ctx, CreateRevisionQuery,
+		revision.RevisionID,
+		revision.PasswordID,
+		revision.UserID,
+		revision.CategoryID,
+		revision.Website,
+		revision.Nonce,
+		revision.Encrypted,
+		revision.KeyVersion,
+		revision.Created,
+	)
+
+	if err != nil {
+		log.Error().Str("location", "CreateRevision").Msgf("%v: %v", revision.UserID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, PruneRevisionsQuery, revision.PasswordID, revision.UserID, retention); err != nil {
+		log.Error().Str("location", "CreateRevision").Msgf("%v: %v", revision.UserID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the entry's revisions, newest first.
+func (r *repository) GetRevisions(ctx context.Context, userID, passwordID uuid.UUID, params *pagination.Params) ([]*Revision, error) {
+	query := GetRevisionsQuery
+	if params.Descending() {
+		query = GetRevisionsDescQuery
+	}
+
+	rows, err := r.postgres.Query(ctx, query, passwordID, userID, params.BoundaryValue(), params.Boundary(), params.Fetch())
+	if err != nil {
+		log.Error().Str("location", "GetRevisions").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	revisions := []*Revision{}
+	for rows.Next() {
+		revision := &Revision{}
+		if err := revision.Scan(rows); err != nil {
+			log.Error().Str("location", "GetRevisions").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+func (r *repository) GetRevision(ctx context.Context, userID, passwordID, revisionID uuid.UUID) (*RevisionEncrypt, error) {
+	revision := &RevisionEncrypt{}
+	if err := revision.Scan(r.postgres.QueryRow(ctx, GetRevisionQuery, revisionID, passwordID, userID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("revision not found")
+		}
+
+		log.Error().Str("location", "GetRevision").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return revision, nil
+}
+
+// Retrieves and locks every revision of the user's entries.
+func (r *repository) GetVaultRevisions(ctx context.Context, tx pgx.Tx, userID uuid.UUID) ([]*RevisionEncrypt, error) {
+	return r.queryRevisions(ctx, tx, "GetVaultRevisions", GetVaultRevisionsQuery, userID)
+}
+
+// Retrieves and locks up to limit revisions encrypted with the given key version.
+func (r *repository) GetStaleRevisions(ctx context.Context, tx pgx.Tx, userID uuid.UUID, keyVersion, limit int) ([]*RevisionEncrypt, error) {
+	return r.queryRevisions(ctx, tx, "GetStaleRevisions", GetStaleRevisionsQuery, userID, keyVersion, limit)
+}
+
+// helper: queryRevisions runs a query returning encrypted revisions.
+func (r *repository) queryRevisions(ctx context.Context, tx pgx.Tx, location, query string, userID uuid.UUID, args ...any) ([]*RevisionEncrypt, error) {
+	rows, err := tx.Query(ctx, query, append([]any{userID}, args...)...)
+	if err != nil {
+		log.Error().Str("location", location).Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	revisions := []*RevisionEncrypt{}
+	for rows.Next() {
+		revision := &RevisionEncrypt{}
+		if err := revision.Scan(rows); err != nil {
+			log.Error().Str("location", location).Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+// Replaces the encrypted content of a revision after it was rekeyed.
+func (r *repository) UpdateRevision(ctx context.Context, tx pgx.Tx, revision *RevisionEncrypt) error {
+	_, err := tx.Exec(ctx, UpdateRevisionQuery,
+		revision.Nonce,
+		revision.Encrypted,
+		revision.KeyVersion,
+		revision.RevisionID,
+		revision.UserID,
+	)
+
+	if err != nil {
+		log.Error().Str("location", "UpdateRevision").Msgf("%v: %v", revision.UserID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Deletes every revision of the user's entries.
+func (r *repository) DeleteVaultRevisions(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	if _, err := tx.Exec(ctx, DeleteVaultRevisionsQuery, userID); err != nil {
+		log.Error().Str("location", "DeleteVaultRevisions").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Counts the entries not encrypted with the given key version.
+func (r *repository) CountStalePasswords(ctx context.Context, tx pgx.Tx, userID uuid.UUID, keyVersion int) (int, error) {
+	var row pgx.Row
+	if tx != nil {
+		row = tx.QueryRow(ctx, CountStalePasswordsQuery, userID, keyVersion)
+	} else {
+		row = r.postgres.QueryRow(ctx, CountStalePasswordsQuery, userID, keyVersion)
+	}
+
+	count := 0
+	if err := row.Scan(&count); err != nil {
+		log.Error().Str("location", "CountStalePasswords").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *repository) CreateRekeyJob(ctx context.Context, tx pgx.Tx, job *RekeyJob) error {
+	_, err := tx.Exec(ctx, CreateRekeyJobQuery,
+		job.JobID,
+		job.UserID,
+		job.FromVersion,
+		job.ToVersion,
+		job.Status,
+		job.Total,
+		job.Done,
+		job.Error,
+		job.Started,
+		job.Updated,
+	)
+
+	if err != nil {
+		log.Error().Str("location", "CreateRekeyJob").Msgf("%v: %v", job.UserID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Persists the job's status and progress, outside of a transaction when tx is nil.
+func (r *repository) UpdateRekeyJob(ctx context.Context, tx pgx.Tx, job *RekeyJob) error {
+	args := []any{job.Status, job.Done, job.Error, job.Updated, job.JobID}
+
+	var err error
+	if tx != nil {
+		_, err = tx.Exec(ctx, UpdateRekeyJobQuery, args...)
+	} else {
+		_, err = r.postgres.Exec(ctx, UpdateRekeyJobQuery, args...)
+	}
+
+	if err != nil {
+		log.Error().Str("location", "UpdateRekeyJob").Msgf("%v: %v", job.UserID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the user's most recent rekey job, nil if the vault was never rekeyed.
+func (r *repository) GetLatestRekeyJob(ctx context.Context, userID uuid.UUID) (*RekeyJob, error) {
+	job := &RekeyJob{}
+	if err := job.Scan(r.postgres.QueryRow(ctx, GetLatestRekeyJobQuery, userID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+
+		log.Error().Str("location", "GetLatestRekeyJob").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Retrieves every job that is still running or has failed.
+func (r *repository) GetUnfinishedRekeyJobs(ctx context.Context) ([]*RekeyJob, error) {
+	rows, err := r.postgres.Query(ctx, GetUnfinishedRekeyJobsQuery)
+	if err != nil {
+		log.Error().Str("location", "GetUnfinishedRekeyJobs").Msg(err.Error())
+		return nil, err
+	}
+
+	jobs := []*RekeyJob{}
+	for rows.Next() {
+		job := &RekeyJob{}
+		if err := job.Scan(rows); err != nil {
+			log.Error().Str("location", "GetUnfinishedRekeyJobs").Msg(err.Error())
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// Retrieves the oldest password reset of the user still waiting for the vault to be rewrapped.
+func (r *repository) GetRewrap(ctx context.Context, userID uuid.UUID) (*Rewrap, error) {
+	rewrap := &Rewrap{}
+	if err := rewrap.Scan(r.postgres.QueryRow(ctx, GetRewrapQuery, userID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("no pending rewrap")
+		}
+
+		log.Error().Str("location", "GetRewrap").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return rewrap, nil
+}
+
+// Retrieves up to limit users whose pending rewrap is due, oldest reset first.
+func (r *repository) GetDueRewraps(ctx context.Context, limit int) ([]*Rewrap, error) {
+	rows, err := r.postgres.Query(ctx, GetDueRewrapsQuery, limit)
+	if err != nil {
+		log.Error().Str("location", "GetDueRewraps").Msg(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	rewraps := []*Rewrap{}
+	for rows.Next() {
+		rewrap := &Rewrap{}
+		if err := rewrap.Scan(rows); err != nil {
+			log.Error().Str("location", "GetDueRewraps").Msg(err.Error())
+			return nil, err
+		}
+
+		rewraps = append(rewraps, rewrap)
+	}
+
+	return rewraps, rows.Err()
+}
+
+func (r *repository) RetryRewrap(ctx context.Context, rewrap *Rewrap) error {
+	if _, err := r.postgres.Exec(ctx, RetryRewrapQuery, rewrap.RewrapID, rewrap.Attempts, rewrap.RetryAt); err != nil {
+		log.Error().Str("location", "RetryRewrap").Msgf("%v: %v", rewrap.UserID, err)
+		return err
+	}
+
+	return nil
+}
 
-	rows, err := r.postgres.Query(ctx, GetAllPasswordsByCategoryQuery, userID, categoryID, pageParms.Index, pageParms.Limit)
+// Retrieves a page of entries with a listing query built by buildListQuery.
+func (r *repository) ListPasswords(ctx context.Context, userID uuid.UUID, query string, args []any) ([]*PasswordEncrypt, error) {
+	rows, err := r.postgres.Query(ctx, query, args...)
 	if err != nil {
-		log.Error().Str("location", "GetAllPasswordsByCategory").Msgf("%v: %v", userID, err)
+		log.Error().Str("location", "ListPasswords").Msgf("%v: %v", userID, err)
 		return nil, err
 	}
 
@@ -92,8 +415,8 @@ func (r *repository) GetAllPasswordsByCategory(
 	passwords := []*PasswordEncrypt{}
 	for rows.Next() {
 		password := &PasswordEncrypt{}
-		if err := password.Scan(rows); err != nil {
-			log.Error().Str("location", "GetAllPasswordsByCategory").Msgf("%v: %v", userID, err)
+		if err := password.ScanListed(rows); err != nil {
+			log.Error().Str("location", "ListPasswords").Msgf("%v: %v", userID, err)
 			return nil, err
 		}
 
@@ -125,11 +448,56 @@ func (r *repository) GetAllPasswordsNonPaged(ctx context.Context, userID uuid.UU
 	return passwords, nil
 }
 
+// Retrieves the active entries filed in the categories, only the entry when one is given.
+func (r *repository) GetFiledPasswords(ctx context.Context, userID uuid.UUID, passwordID *uuid.UUID, categoryIDs []uuid.UUID) ([]*PasswordEncrypt, error) {
+	rows, err := r.postgres.Query(ctx, GetFiledPasswordsQuery, userID, passwordID, categoryIDs)
+	if err != nil {
+		log.Error().Str("location", "GetFiledPasswords").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	passwords := []*PasswordEncrypt{}
+	for rows.Next() {
+		password := &PasswordEncrypt{}
+		if err := password.Scan(rows); err != nil {
+			log.Error().Str("location", "GetFiledPasswords").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		passwords = append(passwords, password)
+	}
+
+	return passwords, nil
+}
+
+// Retrieves every entry of the vault, including trashed ones, inside the transaction.
+func (r *repository) GetVaultPasswords(ctx context.Context, tx pgx.Tx, userID uuid.UUID) ([]*PasswordEncrypt, error) {
+	rows, err := tx.Query(ctx, GetVaultPasswordsQuery, userID)
+	if err != nil {
+		log.Error().Str("location", "GetVaultPasswords").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	// retrieve passwords
+	passwords := []*PasswordEncrypt{}
+	for rows.Next() {
+		password := &PasswordEncrypt{}
+		if err := password.Scan(rows); err != nil {
+			log.Error().Str("location", "GetVaultPasswords").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		passwords = append(passwords, password)
+	}
+
+	return passwords, nil
+}
+
 func (r *repository) GetPassword(ctx context.Context, passwordID, categoryID, userID uuid.UUID) (*PasswordEncrypt, error) {
 	password := &PasswordEncrypt{}
 
 	row := r.postgres.QueryRow(ctx, GetPasswordQuery, userID, passwordID, categoryID)
-	if err := password.Scan(row); err != nil {
+	if err := password.ScanListed(row); err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, apiutils.NewErrNotFound("password not found")
 		}
@@ -141,57 +509,677 @@ func (r *repository) GetPassword(ctx context.Context, passwordID, categoryID, us
 	return password, nil
 }
 
-func (r *repository) CreatePassword(ctx context.Context, tx pgx.Tx, data *PasswordEncrypt) error {
-	_, err := tx.Exec(ctx, CreatePasswordQuery,
-		&data.PasswordID,
-		&data.UserID,
-		&data.CategoryID,
-		&data.Website,
-		&data.Nonce,
-		&data.Encrypted,
-	)
-
+// Retrieves a batch of entries without a blind index, locked for the transaction.
+func (r *repository) GetUnindexedPasswords(ctx context.Context, tx pgx.Tx, userID uuid.UUID, limit int) ([]*PasswordEncrypt, error) {
+	rows, err := tx.Query(ctx, GetUnindexedPasswordsQuery, userID, limit)
 	if err != nil {
-		log.Error().Str("location", "CreatePassword").Msgf("%v: %v", &data.UserID, err)
-		return err
+		log.Error().Str("location", "GetUnindexedPasswords").Msgf("%v: %v", userID, err)
+		return nil, err
 	}
 
-	return nil
-}
+	// retrieve passwords
+	passwords := []*PasswordEncrypt{}
+	for rows.Next() {
+		password := &PasswordEncrypt{}
+		if err := password.Scan(rows); err != nil {
+			log.Error().Str("location", "GetUnindexedPasswords").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
 
-func (r *repository) UpdatePassword(ctx context.Context, tx pgx.Tx, data *PasswordEncrypt) error {
-	_, err := tx.Exec(ctx, UpdatePasswordQuery,
-		&data.Website,
-		&data.Nonce,
-		&data.Encrypted,
-		&data.PasswordID,
-		&data.CategoryID,
-		&data.UserID,
-	)
+		passwords = append(passwords, password)
+	}
+
+	return passwords, nil
+}
 
+// Retrieves the owners of vaults with entries that have no blind index yet.
+func (r *repository) GetUnindexedVaults(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := r.postgres.Query(ctx, GetUnindexedVaultsQuery)
 	if err != nil {
-		log.Error().Str("location", "UpdatePassword").Msgf("%v: %v", data.UserID, err)
-		return err
+		log.Error().Str("location", "GetUnindexedVaults").Msg(err.Error())
+		return nil, err
 	}
 
-	return nil
+	userIDs := []uuid.UUID{}
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			log.Error().Str("location", "GetUnindexedVaults").Msg(err.Error())
+			return nil, err
+		}
+
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, nil
 }
 
-func (r *repository) DeletePassword(ctx context.Context, tx pgx.Tx, userID, passwordID, categoryID uuid.UUID) error {
-	_, err := tx.Exec(ctx, DeletePasswordQuery, passwordID, categoryID, userID)
-	if err != nil {
-		log.Error().Str("location", "DeletePassword").Msgf("%v: %v", userID, err)
+func (r *repository) UpdateSearchTokens(ctx context.Context, tx pgx.Tx, userID, passwordID uuid.UUID, tokens [][]byte) error {
+	if _, err := tx.Exec(ctx, UpdateSearchTokensQuery, userID, passwordID, tokens); err != nil {
+		log.Error().Str("location", "UpdateSearchTokens").Msgf("%v: %v", userID, err)
 		return err
 	}
 
 	return nil
 }
 
-func (r *repository) DeleteResetHash(ctx context.Context, userID uuid.UUID) error {
-	key := "reset:" + userID.String()
-	if err := r.cache.Del(key).Err(); err != nil {
-		log.Error().Str("location", "DeleteResetHash").Msgf("%v: %v", userID, err)
-		return err
+// Retrieves the entries matching every term of the blind query.
+func (r *repository) SearchPasswords(ctx context.Context, userID uuid.UUID, q *searchQuery, params *pagination.Params) ([]*PasswordEncrypt, error) {
+	query := SearchPasswordsQuery
+	if params.Descending() {
+		query = SearchPasswordsDescQuery
+	}
+
+	rows, err := r.postgres.Query(ctx, query,
+		userID,
+		params.Boundary(),
+		params.Fetch(),
+		q.terms,
+		q.tokenTerms,
+		q.tokens,
+		q.catTerms,
+		q.catIDs,
+	)
+	if err != nil {
+		log.Error().Str("location", "SearchPasswords").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	// retrieve passwords
+	passwords := []*PasswordEncrypt{}
+	for rows.Next() {
+		password := &PasswordEncrypt{}
+		if err := password.ScanListed(rows); err != nil {
+			log.Error().Str("location", "SearchPasswords").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		passwords = append(passwords, password)
+	}
+
+	return passwords, nil
+}
+
+func (r *repository) CreatePassword(ctx context.Context, tx pgx.Tx, data *PasswordEncrypt) error {
+	_, err := tx.Exec(ctx, CreatePasswordQuery,
+		&data.PasswordID,
+		&data.UserID,
+		&data.CategoryID,
+		&data.Website,
+		&data.Nonce,
+		&data.Encrypted,
+		&data.KeyVersion,
+		data.SearchTokens,
+		&data.Updated,
+		&data.Favorite,
+	)
+
+	if err != nil {
+		log.Error().Str("location", "CreatePassword").Msgf("%v: %v", &data.UserID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) UpdatePassword(ctx context.Context, tx pgx.Tx, data *PasswordEncrypt) error {
+	_, err := tx.Exec(ctx, UpdatePasswordQuery,
+		&data.Website,
+		&data.Nonce,
+		&data.Encrypted,
+		&data.KeyVersion,
+		&data.PasswordID,
+		&data.CategoryID,
+		&data.UserID,
+		data.SearchTokens,
+		&data.Updated,
+	)
+
+	if err != nil {
+		log.Error().Str("location", "UpdatePassword").Msgf("%v: %v", data.UserID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Moves the entry to the trash, its revisions are kept until it is purged.
+func (r *repository) TrashPassword(ctx context.Context, tx pgx.Tx, userID, passwordID, categoryID uuid.UUID, deletedAt time.Time) error {
+	tag, err := tx.Exec(ctx, TrashPasswordQuery, passwordID, categoryID, userID, deletedAt)
+	if err != nil {
+		log.Error().Str("location", "TrashPassword").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrNotFound("password not found")
+	}
+
+	return nil
+}
+
+// Retrieves the user's trashed entries, most recently deleted first.
+func (r *repository) GetTrash(ctx context.Context, userID uuid.UUID, params *pagination.Params) ([]*TrashedEncrypt, error) {
+	query := GetTrashQuery
+	if params.Descending() {
+		query = GetTrashDescQuery
+	}
+
+	rows, err := r.postgres.Query(ctx, query, userID, params.BoundaryValue(), params.Boundary(), params.Fetch())
+	if err != nil {
+		log.Error().Str("location", "GetTrash").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	trash := []*TrashedEncrypt{}
+	for rows.Next() {
+		password := &TrashedEncrypt{}
+		if err := password.Scan(rows); err != nil {
+			log.Error().Str("location", "GetTrash").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		trash = append(trash, password)
+	}
+
+	return trash, nil
+}
+
+// Retrieves a trashed entry and locks it until the transaction ends.
+func (r *repository) GetTrashedPassword(ctx context.Context, tx pgx.Tx, userID, passwordID uuid.UUID) (*TrashedEncrypt, error) {
+	password := &TrashedEncrypt{}
+	if err := password.Scan(tx.QueryRow(ctx, GetTrashedPasswordQuery, passwordID, userID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("password not found in trash")
+		}
+
+		log.Error().Str("location", "GetTrashedPassword").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return password, nil
+}
+
+// Checks if the category exists and is not in the trash.
+func (r *repository) CategoryActive(ctx context.Context, tx pgx.Tx, userID, categoryID uuid.UUID) (bool, error) {
+	var active bool
+	if err := tx.QueryRow(ctx, CategoryActiveQuery, categoryID, userID).Scan(&active); err != nil {
+		log.Error().Str("location", "CategoryActive").Msgf("%v: %v", userID, err)
+		return false, err
+	}
+
+	return active, nil
+}
+
+func (r *repository) RestorePassword(ctx context.Context, tx pgx.Tx, userID, passwordID uuid.UUID) error {
+	if _, err := tx.Exec(ctx, RestorePasswordQuery, passwordID, userID); err != nil {
+		log.Error().Str("location", "RestorePassword").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves and locks the ids of the user's trashed entries.
+func (r *repository) GetTrashIDs(ctx context.Context, tx pgx.Tx, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := tx.Query(ctx, GetTrashIDsQuery, userID)
+	if err != nil {
+		log.Error().Str("location", "GetTrashIDs").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			log.Error().Str("location", "GetTrashIDs").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// Permanently deletes the trashed entries along with their revisions.
+func (r *repository) PurgePasswords(ctx context.Context, tx pgx.Tx, userID uuid.UUID, passwordIDs []uuid.UUID) error {
+	if _, err := tx.Exec(ctx, PurgeRevisionsQuery, passwordIDs, userID); err != nil {
+		log.Error().Str("location", "PurgePasswords").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, PurgeAttachmentsQuery, passwordIDs, userID); err != nil {
+		log.Error().Str("location", "PurgePasswords").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, PurgePasswordTagsQuery, passwordIDs, userID); err != nil {
+		log.Error().Str("location", "PurgePasswords").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, PurgePasswordsQuery, passwordIDs, userID); err != nil {
+		log.Error().Str("location", "PurgePasswords").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Permanently deletes every entry trashed before the cutoff, returns the number of entries purged.
+// Retrieves the users owning entries trashed before the cutoff.
+func (r *repository) GetExpiredTrashUsers(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error) {
+	rows, err := r.postgres.Query(ctx, GetExpiredTrashUsersQuery, cutoff)
+	if err != nil {
+		log.Error().Str("location", "GetExpiredTrashUsers").Msg(err.Error())
+		return nil, err
+	}
+
+	users := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			log.Error().Str("location", "GetExpiredTrashUsers").Msg(err.Error())
+			return nil, err
+		}
+
+		users = append(users, id)
+	}
+
+	return users, nil
+}
+
+// Permanently deletes the user's entries trashed before the cutoff, returning how many were deleted.
+func (r *repository) PurgeExpired(ctx context.Context, tx pgx.Tx, userID uuid.UUID, cutoff time.Time) (int64, error) {
+	if _, err := tx.Exec(ctx, PurgeExpiredRevisionsQuery, cutoff, userID); err != nil {
+		log.Error().Str("location", "PurgeExpired").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, PurgeExpiredAttachmentsQuery, cutoff, userID); err != nil {
+		log.Error().Str("location", "PurgeExpired").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, PurgeExpiredPasswordTagsQuery, cutoff, userID); err != nil {
+		log.Error().Str("location", "PurgeExpired").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, PurgeExpiredPasswordsQuery, cutoff, userID)
+	if err != nil {
+		log.Error().Str("location", "PurgeExpired").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// Deletes the user's password resets queued up to the one the vault was rewrapped for.
+func (r *repository) DeleteRewraps(ctx context.Context, userID uuid.UUID, queued time.Time) error {
+	if _, err := r.postgres.Exec(ctx, DeleteRewrapsQuery, userID, queued); err != nil {
+		log.Error().Str("location", "DeleteRewraps").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the organization key sealed to the member.
+func (r *repository) GetOrgKey(ctx context.Context, orgID, userID uuid.UUID) ([]byte, error) {
+	var sealed []byte
+	if err := r.postgres.QueryRow(ctx, GetOrgKeyQuery, orgID, userID).Scan(&sealed); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("organization not found")
+		}
+
+		log.Error().Str("location", "GetOrgKey").Msgf("%v: %v: %v", orgID, userID, err)
+		return nil, err
+	}
+
+	return sealed, nil
+}
+
+func (r *repository) CountUserShares(ctx context.Context, tx pgx.Tx, userID uuid.UUID) (int, error) {
+	count := 0
+	if err := tx.QueryRow(ctx, CountUserSharesQuery, userID).Scan(&count); err != nil {
+		log.Error().Str("location", "CountUserShares").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *repository) CountOrgMemberships(ctx context.Context, tx pgx.Tx, userID uuid.UUID) (int, error) {
+	count := 0
+	if err := tx.QueryRow(ctx, CountOrgMembershipsQuery, userID).Scan(&count); err != nil {
+		log.Error().Str("location", "CountOrgMemberships").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *repository) CountEmergencyContacts(ctx context.Context, tx pgx.Tx, userID uuid.UUID) (int, error) {
+	count := 0
+	if err := tx.QueryRow(ctx, CountEmergencyContactsQuery, userID).Scan(&count); err != nil {
+		log.Error().Str("location", "CountEmergencyContacts").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *repository) CreateAttachment(ctx context.Context, tx pgx.Tx, attachment *Attachment) error {
+	_, err := tx.Exec(ctx, CreateAttachmentQuery,
+		attachment.AttachmentID,
+		attachment.PasswordID,
+		attachment.UserID,
+		attachment.Name,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.WrappedKey,
+		attachment.KeyVersion,
+		attachment.NoncePrefix,
+		attachment.Created,
+	)
+	if err != nil {
+		log.Error().Str("location", "CreateAttachment").Msgf("%v: %v", attachment.UserID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) GetAttachments(ctx context.Context, passwordID, categoryID, userID uuid.UUID, params *pagination.Params) ([]*Attachment, error) {
+	query := GetAttachmentsQuery
+	if params.Descending() {
+		query = GetAttachmentsDescQuery
+	}
+
+	rows, err := r.postgres.Query(ctx, query, passwordID, categoryID, userID, params.BoundaryValue(), params.Boundary(), params.Fetch())
+	if err != nil {
+		log.Error().Str("location", "GetAttachments").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return scanAttachments(rows, userID)
+}
+
+func (r *repository) GetAttachment(ctx context.Context, attachmentID, userID uuid.UUID) (*Attachment, error) {
+	attachment := &Attachment{}
+	if err := attachment.Scan(r.postgres.QueryRow(ctx, GetAttachmentQuery, attachmentID, userID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("attachment not found")
+		}
+
+		log.Error().Str("location", "GetAttachment").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// Retrieves the bytes stored by the owner, read in the transaction when one is given.
+func (r *repository) GetAttachmentUsage(ctx context.Context, tx pgx.Tx, userID uuid.UUID) (int64, error) {
+	var row pgx.Row
+	if tx != nil {
+		row = tx.QueryRow(ctx, GetAttachmentUsageQuery, userID)
+	} else {
+		row = r.postgres.QueryRow(ctx, GetAttachmentUsageQuery, userID)
+	}
+
+	var used int64
+	if err := row.Scan(&used); err != nil {
+		log.Error().Str("location", "GetAttachmentUsage").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	return used, nil
+}
+
+func (r *repository) CountAttachments(ctx context.Context, tx pgx.Tx, userID uuid.UUID) (int, error) {
+	count := 0
+	if err := tx.QueryRow(ctx, CountAttachmentsQuery, userID).Scan(&count); err != nil {
+		log.Error().Str("location", "CountAttachments").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Retrieves and locks a batch of attachments whose key is wrapped with the given key version.
+func (r *repository) GetStaleAttachments(ctx context.Context, tx pgx.Tx, userID uuid.UUID, keyVersion, limit int) ([]*Attachment, error) {
+	rows, err := tx.Query(ctx, GetStaleAttachmentsQuery, userID, keyVersion, limit)
+	if err != nil {
+		log.Error().Str("location", "GetStaleAttachments").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	return scanAttachments(rows, userID)
+}
+
+func (r *repository) UpdateAttachmentKey(ctx context.Context, tx pgx.Tx, attachment *Attachment) error {
+	if _, err := tx.Exec(ctx, UpdateAttachmentKeyQuery, attachment.AttachmentID, attachment.WrappedKey, attachment.KeyVersion); err != nil {
+		log.Error().Str("location", "UpdateAttachmentKey").Msgf("%v: %v", attachment.UserID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Deletes the attachment and queues its blob for removal.
+func (r *repository) DeleteAttachment(ctx context.Context, tx pgx.Tx, attachmentID, userID uuid.UUID) error {
+	tag, err := tx.Exec(ctx, DeleteAttachmentQuery, attachmentID, userID)
+	if err != nil {
+		log.Error().Str("location", "DeleteAttachment").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrNotFound("attachment not found")
+	}
+
+	return nil
+}
+
+// Lists the blobs of deleted attachments still waiting to be removed, oldest first.
+func (r *repository) GetQueuedBlobs(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	rows, err := r.postgres.Query(ctx, GetQueuedBlobsQuery, limit)
+	if err != nil {
+		log.Error().Str("location", "GetQueuedBlobs").Msg(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		id := uuid.Nil
+		if err := rows.Scan(&id); err != nil {
+			log.Error().Str("location", "GetQueuedBlobs").Msg(err.Error())
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (r *repository) DeleteQueuedBlob(ctx context.Context, attachmentID uuid.UUID) error {
+	if _, err := r.postgres.Exec(ctx, DeleteQueuedBlobQuery, attachmentID); err != nil {
+		log.Error().Str("location", "DeleteQueuedBlob").Msgf("%v: %v", attachmentID, err)
+		return err
+	}
+
+	return nil
+}
+
+// helper: scanAttachments scans and closes the rows.
+func scanAttachments(rows pgx.Rows, userID uuid.UUID) ([]*Attachment, error) {
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+	for rows.Next() {
+		attachment := &Attachment{}
+		if err := attachment.Scan(rows); err != nil {
+			log.Error().Str("location", "scanAttachments").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+func (r *repository) CreateTag(ctx context.Context, tag *Tag) error {
+	if _, err := r.postgres.Exec(ctx, CreateTagQuery, tag.TagID, tag.UserID, tag.Name, tag.Created); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return apiutils.NewErrConflict("tag already exists")
+		}
+
+		log.Error().Str("location", "CreateTag").Msgf("%v: %v", tag.UserID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) GetTags(ctx context.Context, userID uuid.UUID) ([]*Tag, error) {
+	rows, err := r.postgres.Query(ctx, GetTagsQuery, userID)
+	if err != nil {
+		log.Error().Str("location", "GetTags").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	tags := []*Tag{}
+	for rows.Next() {
+		tag := &Tag{}
+		if err := rows.Scan(&tag.TagID, &tag.UserID, &tag.Name, &tag.Created, &tag.Entries); err != nil {
+			log.Error().Str("location", "GetTags").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (r *repository) RenameTag(ctx context.Context, userID, tagID uuid.UUID, name string) error {
+	tag, err := r.postgres.Exec(ctx, RenameTagQuery, tagID, userID, name)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return apiutils.NewErrConflict("tag already exists")
+		}
+
+		log.Error().Str("location", "RenameTag").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrNotFound("tag not found")
+	}
+
+	return nil
+}
+
+// Deletes the tag along with its links to entries.
+func (r *repository) DeleteTag(ctx context.Context, tx pgx.Tx, userID, tagID uuid.UUID) error {
+	if _, err := tx.Exec(ctx, DeleteTagEntriesQuery, tagID, userID); err != nil {
+		log.Error().Str("location", "DeleteTag").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, DeleteTagQuery, tagID, userID)
+	if err != nil {
+		log.Error().Str("location", "DeleteTag").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrNotFound("tag not found")
+	}
+
+	return nil
+}
+
+// Counts how many of the tags belong to the user.
+func (r *repository) CountOwnedTags(ctx context.Context, tx pgx.Tx, userID uuid.UUID, tagIDs []uuid.UUID) (int, error) {
+	var count int
+	if err := tx.QueryRow(ctx, CountOwnedTagsQuery, userID, tagIDs).Scan(&count); err != nil {
+		log.Error().Str("location", "CountOwnedTags").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Replaces the tags of the entry.
+func (r *repository) SetPasswordTags(ctx context.Context, tx pgx.Tx, userID, passwordID uuid.UUID, tagIDs []uuid.UUID) error {
+	if _, err := tx.Exec(ctx, ClearPasswordTagsQuery, passwordID, userID); err != nil {
+		log.Error().Str("location", "SetPasswordTags").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, AddPasswordTagsQuery, passwordID, tagIDs, userID); err != nil {
+		log.Error().Str("location", "SetPasswordTags").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the tags of the entries, keyed by entry.
+func (r *repository) GetPasswordTags(ctx context.Context, userID uuid.UUID, passwordIDs []uuid.UUID) (map[uuid.UUID][]*Tag, error) {
+	rows, err := r.postgres.Query(ctx, GetPasswordTagsQuery, userID, passwordIDs)
+	if err != nil {
+		log.Error().Str("location", "GetPasswordTags").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	tags := map[uuid.UUID][]*Tag{}
+	for rows.Next() {
+		var passwordID uuid.UUID
+		tag := &Tag{}
+		if err := rows.Scan(&passwordID, &tag.TagID, &tag.UserID, &tag.Name, &tag.Created); err != nil {
+			log.Error().Str("location", "GetPasswordTags").Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		tags[passwordID] = append(tags[passwordID], tag)
+	}
+
+	return tags, nil
+}
+
+func (r *repository) SetFavorite(ctx context.Context, userID, passwordID, categoryID uuid.UUID, favorite bool) error {
+	tag, err := r.postgres.Exec(ctx, SetFavoriteQuery, userID, passwordID, categoryID, favorite)
+	if err != nil {
+		log.Error().Str("location", "SetFavorite").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrNotFound("password not found")
+	}
+
+	return nil
+}
+
+func (r *repository) TouchPassword(ctx context.Context, userID, passwordID, categoryID uuid.UUID, used time.Time) error {
+	tag, err := r.postgres.Exec(ctx, TouchPasswordQuery, userID, passwordID, categoryID, used)
+	if err != nil {
+		log.Error().Str("location", "TouchPassword").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrNotFound("password not found")
 	}
 
 	return nil
@@ -0,0 +1,44 @@
+package passwords
+
+import (
+	"context"
+
+	empty "github.com/golang/protobuf/ptypes/empty"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"nestpass/internal/proto/pb/vaultpb"
+	"nestpass/pkg/auth"
+)
+
+// VaultServer serves the internal vault service called by the auth server.
+type VaultServer struct {
+	vaultpb.UnimplementedVaultServiceServer
+	svc *service
+}
+
+func NewVaultServer(handler *Handler) *VaultServer {
+	return &VaultServer{svc: handler.svc}
+}
+
+// Rekeys the user's vault after a password reset, the service token has to be issued for the same user.
+func (s *VaultServer) RekeyVault(ctx context.Context, in *vaultpb.RekeyPayload) (*empty.Empty, error) {
+	userID, err := uuid.Parse(in.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user id")
+	}
+
+	tokenUserID, err := auth.UidFromCtx(ctx)
+	if err != nil || tokenUserID != userID {
+		log.Warn().Str("location", "RekeyVault").Msgf("%v: service token issued for another user", userID)
+		return nil, status.Error(codes.PermissionDenied, "service token not valid for this user")
+	}
+
+	if err := s.svc.ReUpdateAllPasswords(ctx, userID); err != nil {
+		return nil, status.Error(codes.Internal, "failed to rekey vault")
+	}
+
+	return &empty.Empty{}, nil
+}
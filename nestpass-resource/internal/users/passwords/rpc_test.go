@@ -0,0 +1,97 @@
+package passwords
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"nestpass/internal/proto/pb/vaultpb"
+	"nestpass/pkg/auth"
+)
+
+// helper: newServiceKeys serves a key set holding the key service tokens are signed with.
+func newServiceKeys(t *testing.T) (*auth.KeySet, ed25519.PrivateKey) {
+	t.Helper()
+
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]map[string]string{"keys": {
+			{"kty": "OKP", "kid": "service", "alg": "EdDSA", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(pub)},
+		}})
+	}))
+	t.Cleanup(srv.Close)
+
+	return auth.NewKeySet(srv.URL), key
+}
+
+// helper: newServiceToken signs a token for the user issued to the audience, none when audience is empty.
+func newServiceToken(t *testing.T, key ed25519.PrivateKey, userID uuid.UUID, audience string) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{"iss": "nestpass.auth", "exp": time.Now().Add(time.Minute).Unix(), "user_id": userID.String()}
+	if audience != "" {
+		claims["aud"] = audience
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = "service"
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func Test_RekeyVaultRequiresServiceToken(t *testing.T) {
+	keys, key := newServiceKeys(t)
+	userID := uuid.New()
+
+	// calls go through the interceptor the grpc server is created with, the service is never reached
+	server := &VaultServer{}
+	intercept := auth.ServiceAuth(keys)
+	call := func(authorization string) error {
+		ctx := context.Background()
+		if authorization != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", authorization))
+		}
+
+		info := &grpc.UnaryServerInfo{FullMethod: "/vault.VaultService/RekeyVault"}
+		_, err := intercept(ctx, &vaultpb.RekeyPayload{UserId: userID.String()}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return server.RekeyVault(ctx, req.(*vaultpb.RekeyPayload))
+		})
+		return err
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		code          codes.Code
+	}{
+		{"missing token", "", codes.Unauthenticated},
+		{"not a bearer token", newServiceToken(t, key, userID, auth.ServiceAudience), codes.Unauthenticated},
+		{"user token", "Bearer " + newServiceToken(t, key, userID, ""), codes.Unauthenticated},
+		{"wrong audience", "Bearer " + newServiceToken(t, key, userID, "nestpass.notification"), codes.Unauthenticated},
+		{"token of another user", "Bearer " + newServiceToken(t, key, uuid.New(), auth.ServiceAudience), codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		if err := call(tt.authorization); status.Code(err) != tt.code {
+			t.Errorf("%s: RekeyVault() error = %v, want %v", tt.name, err, tt.code)
+		}
+	}
+}
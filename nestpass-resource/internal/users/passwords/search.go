@@ -0,0 +1,268 @@
+package passwords
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/users/categories"
+	"nestpass/pkg/pagination"
+)
+
+// Entries of server side encrypted vaults carry a blind index: keyed hmac tokens of every prefix
+// of the words in their website, username and notes. The hmac key is derived from the data key
+// the entry is encrypted with, so postgres matches tokens without seeing the words, and a rekey
+// regenerates the tokens along with the ciphertext. Equal tokens still reveal that entries share
+// a prefix, which is the price of searching on the server.
+const (
+	searchMinPrefix = 2
+	searchMaxPrefix = 16
+	searchTokenSize = 16
+	searchMaxTokens = 1024 // tokens kept per entry, notes past the limit are not indexed
+	searchMaxTerms  = 8
+	searchBatchSize = 200 // entries indexed per transaction when a vault is backfilled
+)
+
+// helper: searchKey derives the blind index key from a data encryption key.
+func searchKey(dek []byte) []byte {
+	mac := hmac.New(sha256.New, dek)
+	mac.Write([]byte("nestpass search index v1"))
+	return mac.Sum(nil)
+}
+
+// helper: blindToken computes the token of a normalized term.
+func blindToken(key []byte, term string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(term))
+	return mac.Sum(nil)[:searchTokenSize]
+}
+
+// helper: searchWords lowercases the text and splits it into words of letters and digits.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// helper: searchTerm cuts a query word to the longest indexed prefix, empty if it is too short.
+func searchTerm(word string) string {
+	runes := []rune(word)
+	if len(runes) < searchMinPrefix {
+		return ""
+	}
+
+	return string(runes[:min(len(runes), searchMaxPrefix)])
+}
+
+// Computes the blind index of the entry with the key it is encrypted with.
+func searchTokens(dek []byte, psw *Password) [][]byte {
+	text := []string{psw.Website}
+	if psw.Login != nil {
+		text = append(text, psw.Login.Username)
+	}
+	text = append(text, psw.Notes)
+
+	key := searchKey(dek)
+	seen := map[string]bool{}
+	tokens := [][]byte{}
+	for _, word := range searchWords(strings.Join(text, " ")) {
+		runes := []rune(word)
+		for n := searchMinPrefix; n <= min(len(runes), searchMaxPrefix); n++ {
+			term := string(runes[:n])
+			if seen[term] {
+				continue
+			}
+
+			if len(tokens) == searchMaxTokens {
+				return tokens
+			}
+
+			seen[term] = true
+			tokens = append(tokens, blindToken(key, term))
+		}
+	}
+
+	return tokens
+}
+
+// Blind query of a search, every term has to match the entry's index or its category's name.
+type searchQuery struct {
+	terms      int
+	tokenTerms []int32 // term of each token, tokens of every key version the vault holds
+	tokens     [][]byte
+	catTerms   []int32 // term of each category whose name matches it
+	catIDs     []uuid.UUID
+}
+
+// helper: newSearchQuery computes the tokens of the query terms for every key in the ring and
+// matches the terms against the category names, which are not encrypted.
+func newSearchQuery(query string, ring *keyRing, tree []*categories.Category) (*searchQuery, error) {
+	terms := []string{}
+	for _, word := range searchWords(query) {
+		if term := searchTerm(word); term != "" {
+			terms = append(terms, term)
+		}
+	}
+
+	if len(terms) == 0 {
+		return nil, apiutils.NewErrBadRequest("search terms need at least 2 characters")
+	}
+
+	if len(terms) > searchMaxTerms {
+		return nil, apiutils.NewErrBadRequest("too many search terms")
+	}
+
+	// category names match at every level of the tree
+	nodes := categories.Flatten(tree)
+	q := &searchQuery{terms: len(terms), catTerms: []int32{}, catIDs: []uuid.UUID{}}
+	for i, term := range terms {
+		for _, dek := range ring.keys {
+			q.tokenTerms = append(q.tokenTerms, int32(i+1))
+			q.tokens = append(q.tokens, blindToken(searchKey(dek), term))
+		}
+
+		for _, category := range nodes {
+			for _, word := range searchWords(category.Name) {
+				if strings.HasPrefix(word, term) {
+					q.catTerms = append(q.catTerms, int32(i+1))
+					q.catIDs = append(q.catIDs, category.CategoryID)
+					break
+				}
+			}
+		}
+	}
+
+	return q, nil
+}
+
+// Searches the entries by website, username, notes and category name, a page at a time.
+func (s *service) Search(ctx context.Context, userID uuid.UUID, query string, params *pagination.Params) (*pagination.Page[*Password], error) {
+	vault, ring, err := s.vaultKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Mode == ClientMode {
+		return nil, apiutils.NewErrConflict("client side encrypted vaults are searched by the client")
+	}
+
+	tree, err := s.categories.GetSubtree(ctx, userID, nil, categories.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := newSearchQuery(query, ring, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	passwords, err := s.repo.SearchPasswords(ctx, userID, q, params)
+	if err != nil {
+		return nil, err
+	}
+
+	opened, err := openAll(vault, ring, passwords)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attachTags(ctx, userID, opened); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, opened, func(psw *Password) (string, uuid.UUID) {
+		return "", psw.PasswordID
+	})
+}
+
+// Indexes the entries of every vault stored before search existed, meant to run once at startup.
+// Searches only read the index, entries of a vault match once it has been indexed.
+func (s *service) IndexVaults(ctx context.Context) {
+	userIDs, err := s.repo.GetUnindexedVaults(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, userID := range userIDs {
+		if err := s.indexVault(ctx, userID); err != nil {
+			log.Error().Str("location", "IndexVaults").Msgf("%v: failed to index vault: %v", userID, err)
+		}
+	}
+
+	if len(userIDs) != 0 {
+		log.Info().Str("location", "IndexVaults").Msgf("%v vaults indexed", len(userIDs))
+	}
+}
+
+// helper: indexVault computes the blind index of entries stored before search existed.
+func (s *service) indexVault(ctx context.Context, userID uuid.UUID) error {
+	for {
+		indexed, err := s.indexBatch(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		if indexed < searchBatchSize {
+			return nil
+		}
+	}
+}
+
+// helper: indexBatch indexes one batch of unindexed entries, returns the number indexed.
+func (s *service) indexBatch(ctx context.Context, userID uuid.UUID) (int, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "indexBatch").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// the mode and keys can not change while the batch is indexed
+	vault, err := s.repo.LockVault(ctx, tx, userID, false)
+	if err != nil {
+		return 0, err
+	}
+
+	if vault.Mode == ClientMode {
+		return 0, nil
+	}
+
+	passwords, err := s.repo.GetUnindexedPasswords(ctx, tx, userID, searchBatchSize)
+	if err != nil || len(passwords) == 0 {
+		return 0, err
+	}
+
+	ring, err := s.keyRing(ctx, vault)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, password := range passwords {
+		key, err := ring.get(password.KeyVersion)
+		if err != nil {
+			return 0, err
+		}
+
+		psw, err := password.Decrypt(userID, key)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := s.repo.UpdateSearchTokens(ctx, tx, userID, password.PasswordID, searchTokens(key, psw)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "indexBatch").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	return len(passwords), nil
+}
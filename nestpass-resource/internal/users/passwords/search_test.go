@@ -0,0 +1,80 @@
+package passwords
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"nestpass/internal/users/categories"
+)
+
+func hasToken(tokens [][]byte, token []byte) bool {
+	for _, t := range tokens {
+		if bytes.Equal(t, token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func Test_SearchTokens(t *testing.T) {
+	dek := make([]byte, keySize)
+	psw := &Password{Website: "Mail.Example.com", Type: ItemLogin, Login: &Login{Username: "Jane_Doe", Password: "psw"}}
+
+	tokens := searchTokens(dek, psw)
+	key := searchKey(dek)
+	for _, term := range []string{"ma", "mail", "exam", "jane", "doe", "com"} {
+		if !hasToken(tokens, blindToken(key, term)) {
+			t.Fatalf("term %q not indexed", term)
+		}
+	}
+
+	for _, term := range []string{"m", "il", "mail.example", "password", "psw"} {
+		if hasToken(tokens, blindToken(key, term)) {
+			t.Fatalf("term %q indexed", term)
+		}
+	}
+
+	// the index only depends on the key and the content
+	if again := searchTokens(dek, psw); len(again) != len(tokens) || !bytes.Equal(again[0], tokens[0]) {
+		t.Fatal("index is not deterministic")
+	}
+
+	other := make([]byte, keySize)
+	other[0] = 1
+	if hasToken(searchTokens(other, psw), tokens[0]) {
+		t.Fatal("tokens do not depend on the key")
+	}
+}
+
+func Test_NewSearchQuery(t *testing.T) {
+	ring := &keyRing{version: 2, keys: map[int][]byte{1: make([]byte, keySize), 2: bytes.Repeat([]byte{1}, keySize)}}
+	userID := uuid.New()
+	work := categories.New("Work Servers", "", userID, nil)
+	lab := categories.New("Lab", "", userID, &work.CategoryID)
+	lab.Depth = 1
+	legacy := categories.New("Legacy Servers", "", userID, &lab.CategoryID)
+	legacy.Depth = 2
+	tree := categories.BuildTree([]*categories.Category{work, lab, legacy})
+
+	q, err := newSearchQuery("SERV, a example", ring, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// single characters are dropped, each term has a token per key
+	if q.terms != 2 || len(q.tokens) != 4 || !hasToken(q.tokens, blindToken(searchKey(ring.keys[1]), "serv")) {
+		t.Fatalf("unexpected query: %+v", q)
+	}
+
+	// nested categories match as well as the top level
+	if len(q.catIDs) != 2 || q.catIDs[0] != work.CategoryID || q.catIDs[1] != legacy.CategoryID || q.catTerms[0] != 1 || q.catTerms[1] != 1 {
+		t.Fatalf("categories not matched: %+v", q)
+	}
+
+	if _, err := newSearchQuery("a . b", ring, nil); err == nil {
+		t.Fatal("query without terms accepted")
+	}
+}
@@ -2,26 +2,44 @@ package passwords
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/crypto/pbkdf2"
+	"github.com/tuan882612/apiutils"
 
-	"nestpass/pkg/httputils"
+	"nestpass/internal/users/categories"
 )
 
+// Category tree the entries are filed in, used by exports and imports.
+type categoryStore interface {
+	LockTree(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error
+	GetSubtree(ctx context.Context, userID uuid.UUID, categoryID *uuid.UUID, depth int) ([]*categories.Category, error)
+	CreateCategory(ctx context.Context, tx pgx.Tx, category *categories.Category) error
+}
+
 type service struct {
-	repo *repository
+	repo       *repository
+	categories categoryStore
+	kdfPolicy  *KDFParams    // parameters new and upgraded vaults are derived with
+	retention  int           // revisions kept per entry, zero disables the history
+	breaches   *breachCorpus // breached password corpus, nil when breaches are not checked
+	rekeys     sync.Map      // rekey jobs running in this process
+
+	attachments *attachmentStore
+	keks        *kekCache   // recently derived key encryption keys
+	writeHooks  []WriteHook // run after writes to an owner's entries, see OnWrite
 }
 
-func NewService(repo *repository) *service {
-	return &service{repo: repo}
+func NewService(repo *repository, categories categoryStore, kdfPolicy *KDFParams, retention int, breaches *breachCorpus, attachments *attachmentStore) *service {
+	return &service{repo: repo, categories: categories, kdfPolicy: kdfPolicy, retention: retention, breaches: breaches, attachments: attachments, keks: newKEKCache(kdfSlots, kekCacheTTL)}
 }
 
-func (s *service) getKDFKey(ctx context.Context, userID uuid.UUID, kdf kdfType) ([]byte, error) {
+// helper: getKDFKey derives the key encryption key from the current or previous password hash,
+// vaults without stored parameters use the legacy pbkdf2 scheme.
+func (s *service) getKDFKey(ctx context.Context, userID uuid.UUID, kdf kdfType, params *KDFParams) ([]byte, error) {
 	kdfData, err := s.repo.GetKDFData(ctx, userID)
 	if err != nil {
 		return nil, err
@@ -33,82 +51,31 @@ func (s *service) getKDFKey(ctx context.Context, userID uuid.UUID, kdf kdfType)
 	case currKDF:
 		key = kdfData.PswHash
 	case prevKDF:
-		data, err := s.repo.GetResetHash(ctx, userID)
-		if err != nil {
-			return nil, err
-		}
-
-		key64, err := base64.StdEncoding.DecodeString(data)
-		if err != nil {
-			log.Error().Str("location", "getKDFKey").Msgf("%v: %v", userID, err)
-			return nil, err
-		}
-
-		key = string(key64)
-	}
-
-	combinedInput := key + ":" + userID.String()
-	kdfKey := pbkdf2.Key([]byte(combinedInput), kdfData.Salt, 4096, 32, sha256.New)
-	return kdfKey, nil
-}
-
-func (s *service) GetAllPasswords(ctx context.Context, userID uuid.UUID, pageParams *httputils.Pagination) ([]*Password, error) {
-	// retrieve kdf key
-	key, err := s.getKDFKey(ctx, userID, currKDF)
-	if err != nil {
-		return nil, err
-	}
-
-	// retrieve encrypted passwords
-	passwords, err := s.repo.GetAllPasswords(ctx, userID, pageParams)
-	if err != nil {
-		return nil, err
-	}
-
-	// decrypt passwords
-	decryptedPsw := []*Password{}
-	for _, password := range passwords {
-		psw, err := password.Decrypt(userID, key)
+		rewrap, err := s.repo.GetRewrap(ctx, userID)
 		if err != nil {
 			return nil, err
 		}
 
-		decryptedPsw = append(decryptedPsw, psw)
+		key = rewrap.PrevHash
 	}
 
-	return decryptedPsw, nil
-}
-
-func (s *service) GetAllPasswordsByCategory(ctx context.Context, userID, categoryID uuid.UUID, pageParams *httputils.Pagination) ([]*Password, error) {
-	// retrieve kdf key
-	key, err := s.getKDFKey(ctx, userID, currKDF)
-	if err != nil {
-		return nil, err
+	if params == nil {
+		params = legacyKDFParams(kdfData.Salt)
 	}
 
-	// retrieve encrypted passwords
-	passwords, err := s.repo.GetAllPasswordsByCategory(ctx, userID, categoryID, pageParams)
+	combinedInput := key + ":" + userID.String()
+	kdfKey, err := s.keks.Derive(ctx, params, []byte(combinedInput))
 	if err != nil {
+		log.Error().Str("location", "getKDFKey").Msgf("%v: %v", userID, err)
 		return nil, err
 	}
 
-	// decrypt passwords
-	decryptedPsw := []*Password{}
-	for _, password := range passwords {
-		psw, err := password.Decrypt(userID, key)
-		if err != nil {
-			return nil, err
-		}
-
-		decryptedPsw = append(decryptedPsw, psw)
-	}
-
-	return decryptedPsw, nil
+	return kdfKey, nil
 }
 
 func (s *service) GetPassword(ctx context.Context, passwordID, categoryID, userID uuid.UUID) (*Password, error) {
-	// retrieve kdf key
-	key, err := s.getKDFKey(ctx, userID, currKDF)
+	// retrieve the entry keys
+	vault, ring, err := s.vaultKey(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -119,29 +86,44 @@ func (s *service) GetPassword(ctx context.Context, passwordID, categoryID, userI
 		return nil, err
 	}
 
-	// decrypt password
-	psw, err := password.Decrypt(userID, key)
+	opened, err := open(vault, ring, password)
 	if err != nil {
 		return nil, err
 	}
 
-	return psw, nil
+	return opened, s.attachTags(ctx, userID, []*Password{opened})
 }
 
 func (s *service) CreatePassword(ctx context.Context, psw *Password) (uuid.UUID, error) {
-	key, err := s.getKDFKey(ctx, psw.UserID, currKDF)
+	// migrate legacy vaults before writing
+	if _, err := s.prepareVault(ctx, psw.UserID); err != nil {
+		return uuid.Nil, err
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
 	if err != nil {
+		log.Error().Str("location", "CreatePassword").Msgf("%v: %v", psw.UserID, err)
 		return uuid.Nil, err
 	}
+	defer tx.Rollback(ctx)
 
-	data, err := NewPasswordEncrypt(psw, key)
+	// the mode can not change while the entry is written
+	vault, err := s.repo.LockVault(ctx, tx, psw.UserID, false)
 	if err != nil {
 		return uuid.Nil, err
 	}
 
-	tx, err := s.repo.postgres.Begin(ctx)
+	ring, err := s.keyRing(ctx, vault)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if psw.OTP != nil && psw.OTP.Secret == "" {
+		return uuid.Nil, apiutils.NewErrBadRequest("missing otp secret")
+	}
+
+	data, err := seal(vault, ring, psw)
 	if err != nil {
-		log.Error().Str("location", "CreatePassword").Msgf("%v: %v", psw.UserID, err)
 		return uuid.Nil, err
 	}
 
@@ -154,23 +136,53 @@ func (s *service) CreatePassword(ctx context.Context, psw *Password) (uuid.UUID,
 		return uuid.Nil, err
 	}
 
+	s.afterWrite(ctx, psw.UserID, []uuid.UUID{data.PasswordID}, []uuid.UUID{data.CategoryID})
 	return data.PasswordID, nil
 }
 
 func (s *service) UpdatePassword(ctx context.Context, psw *Password) error {
-	key, err := s.getKDFKey(ctx, psw.UserID, currKDF)
+	// migrate legacy vaults before writing
+	if _, err := s.prepareVault(ctx, psw.UserID); err != nil {
+		return err
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "UpdatePassword").Msgf("%v: %v", psw.UserID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// the mode can not change while the entry is written
+	vault, err := s.repo.LockVault(ctx, tx, psw.UserID, false)
 	if err != nil {
 		return err
 	}
 
-	data, err := NewPasswordEncrypt(psw, key)
+	ring, err := s.keyRing(ctx, vault)
 	if err != nil {
 		return err
 	}
 
-	tx, err := s.repo.postgres.Begin(ctx)
+	current, err := s.repo.GetPasswordForUpdate(ctx, tx, psw.UserID, psw.PasswordID, psw.CategoryID)
 	if err != nil {
-		log.Error().Str("location", "UpdatePassword").Msgf("%v: %v", psw.UserID, err)
+		return err
+	}
+
+	// the otp secret is not handed out, so updates leaving it out keep the stored one
+	if psw.OTP != nil && psw.OTP.Secret == "" && vault.Mode != ClientMode {
+		if err := keepOTPSecret(vault, ring, current, psw); err != nil {
+			return err
+		}
+	}
+
+	data, err := seal(vault, ring, psw)
+	if err != nil {
+		return err
+	}
+
+	// keep the previous value as a revision
+	if err := s.addRevision(ctx, tx, current); err != nil {
 		return err
 	}
 
@@ -183,120 +195,160 @@ func (s *service) UpdatePassword(ctx context.Context, psw *Password) error {
 		return err
 	}
 
+	s.afterWrite(ctx, psw.UserID, []uuid.UUID{data.PasswordID}, []uuid.UUID{data.CategoryID})
 	return nil
 }
 
-func (s *service) ReUpdateAllPasswords(ctx context.Context, userID uuid.UUID) error {
-	currKeyCh, prevKeyCh := make(chan kdfKeyRes, 1), make(chan kdfKeyRes, 1)
+func (s *service) GetVault(ctx context.Context, userID uuid.UUID) (*Vault, error) {
+	return s.repo.GetVault(ctx, userID)
+}
+
+// Switches a server side encrypted vault to client side encryption.
+// Every existing entry has to be replaced by its sealed counterpart in the same request.
+func (s *service) EnableClientMode(ctx context.Context, userID uuid.UUID, migration *ClientMigration) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "EnableClientMode").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	vault, err := s.repo.LockVault(ctx, tx, userID, true)
+	if err != nil {
+		return err
+	}
+
+	if vault.Mode == ClientMode {
+		return apiutils.NewErrConflict("vault already uses client side encryption")
+	}
+
+	if len(vault.PrevDEK) != 0 {
+		return apiutils.NewErrConflict("vault rekey in progress")
+	}
+
+	// shared copies are encrypted by the server, which can not read the entries afterwards
+	shares, err := s.repo.CountUserShares(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if shares > 0 {
+		return apiutils.NewErrConflict("revoke shares before enabling client side encryption")
+	}
+
+	// org keys are sealed to the keypair the switch discards
+	memberships, err := s.repo.CountOrgMemberships(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if memberships > 0 {
+		return apiutils.NewErrConflict("leave organizations before enabling client side encryption")
+	}
+
+	// emergency access needs keys held by the server on both sides
+	contacts, err := s.repo.CountEmergencyContacts(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
 
-	// Fetch currKey and prevKey concurrently
-	go func() {
-		key, err := s.getKDFKey(ctx, userID, currKDF)
-		currKeyCh <- kdfKeyRes{Key: key, Err: err}
-	}()
-	go func() {
-		key, err := s.getKDFKey(ctx, userID, prevKDF)
-		prevKeyCh <- kdfKeyRes{Key: key, Err: err}
-	}()
+	if contacts > 0 {
+		return apiutils.NewErrConflict("remove emergency contacts before enabling client side encryption")
+	}
 
-	currKeyRes := <-currKeyCh
-	if currKeyRes.Err != nil {
-		return currKeyRes.Err
+	// attachment keys are wrapped with the server held data key
+	attachments, err := s.repo.CountAttachments(ctx, tx, userID)
+	if err != nil {
+		return err
 	}
 
-	prevKeyRes := <-prevKeyCh
-	if prevKeyRes.Err != nil {
-		return prevKeyRes.Err
+	if attachments > 0 {
+		return apiutils.NewErrConflict("delete attachments before enabling client side encryption")
 	}
 
-	// retrieve encrypted passwords
-	passwords, err := s.repo.GetAllPasswordsNonPaged(ctx, userID)
+	passwords, err := s.repo.GetVaultPasswords(ctx, tx, userID)
 	if err != nil {
 		return err
 	}
 
-	n := len(passwords)
-	wg := new(sync.WaitGroup)
-	chunkSize := 4
-	if n < chunkSize {
-		chunkSize = n
+	// match the sealed entries with the stored ones
+	sealed := map[uuid.UUID][]byte{}
+	for _, entry := range migration.Entries {
+		sealed[entry.PasswordID] = entry.Sealed
+	}
+
+	if len(sealed) != len(passwords) || len(migration.Entries) != len(passwords) {
+		return apiutils.NewErrBadRequest("sealed entries must cover the whole vault")
 	}
 
-	log.Info().Str("location", "ReUpdateAllPasswords").Msgf("%v: %v passwords to rehash now starting...", userID, n)
-	for i := 0; i < n; i += chunkSize {
-		end := i + chunkSize
-		if end > n {
-			end = n
+	for _, password := range passwords {
+		data, ok := sealed[password.PasswordID]
+		if !ok {
+			return apiutils.NewErrBadRequest("missing sealed entry for " + password.PasswordID.String())
+		}
+
+		replaced, err := NewSealedPasswordEncrypt(&Password{
+			PasswordID: password.PasswordID,
+			UserID:     userID,
+			CategoryID: password.CategoryID,
+			Sealed:     data,
+		})
+		if err != nil {
+			return err
 		}
-		wg.Add(1)
-
-		go func(chunk []*PasswordEncrypt) {
-			defer wg.Done()
-
-			// create transaction
-			tx, err := s.repo.postgres.Begin(ctx)
-			if err != nil {
-				log.Error().Str("location", "ReUpdateAllPasswords").Msgf("%v: %v", userID, err)
-				return
-			}
-			defer tx.Rollback(ctx)
-
-			for _, password := range chunk {
-				data, err := password.Decrypt(userID, prevKeyRes.Key)
-				if err != nil {
-					log.Error().Str("location", "ReUpdateAllPasswords").Msgf("%v: %v", userID, err)
-					return
-				}
-
-				newData, err := NewPasswordEncrypt(data, currKeyRes.Key)
-				if err != nil {
-					log.Error().Str("location", "ReUpdateAllPasswords").Msgf("%v: %v", userID, err)
-					return
-				}
-
-				if err := s.repo.UpdatePassword(ctx, tx, newData); err != nil {
-					log.Error().Str("location", "ReUpdateAllPasswords").Msgf("%v: %v", userID, err)
-					return
-				}
-			}
-
-			// commit transaction
-			if err := tx.Commit(ctx); err != nil {
-				log.Error().Str("location", "ReUpdateAllPasswords").Msgf("%v: %v", userID, err)
-				return
-			}
-		}(passwords[i:end])
-	}
-
-	wg.Wait()
-	log.Info().Str("location", "ReUpdateAllPasswords").Msgf("%v: %v passwords rehashed", userID, n)
-
-	// delete reset hash
-	go func() {
-		if err := s.repo.DeleteResetHash(ctx, userID); err != nil {
-			log.Error().Str("location", "ReUpdateAllPasswords").Msgf("%v: %v", userID, err)
-			return
+
+		replaced.Updated = password.Updated
+		if err := s.repo.UpdatePassword(ctx, tx, replaced); err != nil {
+			return err
 		}
+	}
+
+	// revisions can not be sealed by the server, so the history starts over
+	if err := s.repo.DeleteVaultRevisions(ctx, tx, userID); err != nil {
+		return err
+	}
 
-		log.Info().Str("location", "ReUpdateAllPasswords").Msgf("%v: reset hash deleted", userID)
-	}()
+	vault.Mode, vault.WrappedKey, vault.WrappedDEK, vault.KDF = ClientMode, migration.WrappedKey, nil, nil
+	vault.PublicKey, vault.WrappedPrivate = nil, nil
+	vault.Updated = time.Now()
+	if err := s.repo.UpsertVault(ctx, tx, vault); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "EnableClientMode").Msgf("%v: %v", userID, err)
+		return err
+	}
 
+	log.Info().Str("location", "EnableClientMode").Msgf("%v: %v entries migrated to client side encryption", userID, len(passwords))
 	return nil
 }
 
-func (s *service) DeletePassword(ctx context.Context, userID, passwordID, categoryID uuid.UUID) error {
+// Replaces the wrapped vault key of a client side encrypted vault.
+func (s *service) UpdateWrappedKey(ctx context.Context, userID uuid.UUID, wrappedKey []byte) error {
 	tx, err := s.repo.postgres.Begin(ctx)
 	if err != nil {
-		log.Error().Str("location", "DeletePassword").Msgf("%v: %v", categoryID, err)
+		log.Error().Str("location", "UpdateWrappedKey").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	vault, err := s.repo.LockVault(ctx, tx, userID, true)
+	if err != nil {
 		return err
 	}
 
-	if err := s.repo.DeletePassword(ctx, tx, userID, passwordID, categoryID); err != nil {
+	if vault.Mode != ClientMode {
+		return apiutils.NewErrBadRequest("vault does not use client side encryption")
+	}
+
+	vault.WrappedKey, vault.Updated = wrappedKey, time.Now()
+	if err := s.repo.UpsertVault(ctx, tx, vault); err != nil {
 		return err
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		log.Error().Str("location", "DeletePassword").Msgf("%v: %v", categoryID, err)
+		log.Error().Str("location", "UpdateWrappedKey").Msgf("%v: %v", userID, err)
 		return err
 	}
 
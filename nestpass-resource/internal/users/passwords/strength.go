@@ -0,0 +1,198 @@
+package passwords
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Pattern checks a password can fail, reported with the weak finding.
+const (
+	WeaknessShort    = "short"
+	WeaknessCommon   = "common"
+	WeaknessRepeated = "repeated"
+	WeaknessSequence = "sequence"
+	WeaknessKeyboard = "keyboard"
+	WeaknessPersonal = "personal" // contains the username or website of the entry
+	WeaknessEntropy  = "low_entropy"
+)
+
+const (
+	minPasswordLength = 10
+	weakEntropy       = 50 // bits below which a password is weak
+	strongEntropy     = 80 // bits from which a password gets the full score
+	patternRun        = 3  // runes in a row that make a pattern
+)
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// passwords found at the top of every breach, compared after the common substitutions and
+// without trailing digits and symbols
+var commonPasswords = map[string]bool{
+	"password": true, "passwort": true, "qwerty": true, "letmein": true, "welcome": true,
+	"admin": true, "administrator": true, "iloveyou": true, "monkey": true, "dragon": true,
+	"football": true, "baseball": true, "sunshine": true, "princess": true, "master": true,
+	"shadow": true, "superman": true, "batman": true, "trustno": true, "login": true,
+	"abc": true, "starwars": true, "whatever": true, "hello": true, "freedom": true,
+	"michael": true, "charlie": true, "jordan": true, "hunter": true, "secret": true,
+	"changeme": true, "default": true, "summer": true, "winter": true, "spring": true,
+	"autumn": true, "soccer": true, "killer": true, "pokemon": true, "cookie": true,
+	"flower": true, "lovely": true, "access": true, "mustang": true, "computer": true,
+	"internet": true, "guest": true, "root": true, "test": true, "user": true,
+}
+
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// Estimate of how hard a password is to guess.
+type Strength struct {
+	Entropy    float64  `json:"entropy"` // estimated bits
+	Weaknesses []string `json:"weaknesses,omitempty"`
+}
+
+// Weak passwords are short or estimated below the weak entropy.
+func (s *Strength) Weak() bool {
+	return s.Entropy < weakEntropy || slices.Contains(s.Weaknesses, WeaknessShort)
+}
+
+// helper: poolSize returns the size of the character classes the password draws from.
+func poolSize(runes []rune) int {
+	classes := map[string]int{}
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			classes["lower"] = 26
+		case r >= 'A' && r <= 'Z':
+			classes["upper"] = 26
+		case r >= '0' && r <= '9':
+			classes["digit"] = 10
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			classes["symbol"] = 33
+		default:
+			classes["other"] = 100
+		}
+	}
+
+	pool := 0
+	for _, size := range classes {
+		pool += size
+	}
+
+	return max(pool, 1)
+}
+
+// helper: keyboardStep checks if the runes are neighbours on a keyboard row.
+func keyboardStep(a, b rune) bool {
+	for _, row := range keyboardRows {
+		i, j := strings.IndexRune(row, a), strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// helper: patternRunes marks the runes continuing a run of repeated, sequential or keyboard
+// adjacent characters and reports the kinds of runs found.
+func patternRunes(runes []rune) ([]bool, map[string]bool) {
+	marked := make([]bool, len(runes))
+	found := map[string]bool{}
+
+	mark := func(kind string, continues func(start, i int) bool) {
+		start := 0
+		for i := 1; i <= len(runes); i++ {
+			if i < len(runes) && continues(start, i) {
+				continue
+			}
+
+			// the first rune of a run is kept, the ones following it are predictable
+			if i-start >= patternRun {
+				found[kind] = true
+				for j := start + 1; j < i; j++ {
+					marked[j] = true
+				}
+			}
+			start = i
+		}
+	}
+
+	mark(WeaknessRepeated, func(_, i int) bool { return runes[i] == runes[i-1] })
+	mark(WeaknessSequence, func(start, i int) bool {
+		step := runes[i] - runes[i-1]
+		return (step == 1 || step == -1) && (i-1 == start || runes[i-1]-runes[i-2] == step)
+	})
+	mark(WeaknessKeyboard, func(_, i int) bool { return keyboardStep(runes[i-1], runes[i]) })
+
+	return marked, found
+}
+
+// helper: isCommon checks the password against the common list once substitutions and
+// trailing digits and symbols are removed.
+func isCommon(lower string) bool {
+	base := strings.TrimRightFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+	return base != "" && (commonPasswords[base] || commonPasswords[leetReplacer.Replace(base)])
+}
+
+// Estimates the entropy of the password from its character classes, with runs of patterns,
+// common passwords and words of the entry's username or website counting next to nothing.
+func estimateStrength(password string, personal ...string) *Strength {
+	runes := []rune(password)
+	lower := strings.ToLower(password)
+	strength := &Strength{}
+
+	marked, found := patternRunes([]rune(lower))
+	for _, word := range personal {
+		for _, part := range searchWords(word) {
+			if len([]rune(part)) < 4 {
+				continue
+			}
+
+			for offset := 0; ; {
+				i := strings.Index(lower[offset:], part)
+				if i < 0 {
+					break
+				}
+
+				found[WeaknessPersonal] = true
+				start := len([]rune(lower[:offset+i]))
+				for j := start + 1; j < start+len([]rune(part)); j++ {
+					marked[j] = true
+				}
+				offset += i + len(part)
+			}
+		}
+	}
+
+	bits := math.Log2(float64(poolSize(runes)))
+	for _, predictable := range marked {
+		if predictable {
+			strength.Entropy++
+		} else {
+			strength.Entropy += bits
+		}
+	}
+
+	if isCommon(lower) {
+		found[WeaknessCommon] = true
+		strength.Entropy = min(strength.Entropy, 10)
+	}
+
+	if len(runes) < minPasswordLength {
+		found[WeaknessShort] = true
+	}
+
+	if strength.Entropy < weakEntropy {
+		found[WeaknessEntropy] = true
+	}
+
+	// stable order for the report
+	for _, kind := range []string{WeaknessShort, WeaknessCommon, WeaknessRepeated, WeaknessSequence, WeaknessKeyboard, WeaknessPersonal, WeaknessEntropy} {
+		if found[kind] {
+			strength.Weaknesses = append(strength.Weaknesses, kind)
+		}
+	}
+
+	strength.Entropy = math.Round(strength.Entropy*10) / 10
+	return strength
+}
@@ -0,0 +1,192 @@
+package passwords
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+)
+
+// Label grouping entries across categories, an entry may carry many tags.
+type Tag struct {
+	TagID   uuid.UUID `json:"tag_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	Name    string    `json:"name" validate:"required,max=64"`
+	Entries int       `json:"entries,omitempty"` // active entries carrying the tag, set when tags are listed
+	Created time.Time `json:"created"`
+}
+
+func (t *Tag) Deserialize(data io.ReadCloser) error {
+	if err := json.NewDecoder(data).Decode(t); err != nil {
+		log.Error().Str("location", "Tag.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	t.Name = strings.TrimSpace(t.Name)
+	if err := validator.New().Struct(t); err != nil {
+		log.Error().Str("location", "Tag.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Request data for replacing the tags of an entry.
+type EntryTagsRequest struct {
+	TagIDs []uuid.UUID `json:"tag_ids" validate:"max=32"`
+}
+
+func (e *EntryTagsRequest) Deserialize(data io.ReadCloser) error {
+	if err := json.NewDecoder(data).Decode(e); err != nil {
+		log.Error().Str("location", "EntryTagsRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	if err := validator.New().Struct(e); err != nil {
+		log.Error().Str("location", "EntryTagsRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Request data for marking an entry as a favorite.
+type FavoriteRequest struct {
+	Favorite bool `json:"favorite"`
+}
+
+func (f *FavoriteRequest) Deserialize(data io.ReadCloser) error {
+	if err := json.NewDecoder(data).Decode(f); err != nil {
+		log.Error().Str("location", "FavoriteRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Lists the owner's tags with the number of entries carrying each.
+func (s *service) GetTags(ctx context.Context, ownerID uuid.UUID) ([]*Tag, error) {
+	return s.repo.GetTags(ctx, ownerID)
+}
+
+func (s *service) CreateTag(ctx context.Context, ownerID uuid.UUID, name string) (*Tag, error) {
+	tag := &Tag{TagID: uuid.New(), UserID: ownerID, Name: name, Created: time.Now()}
+	if err := s.repo.CreateTag(ctx, tag); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+func (s *service) RenameTag(ctx context.Context, ownerID, tagID uuid.UUID, name string) error {
+	return s.repo.RenameTag(ctx, ownerID, tagID, name)
+}
+
+// Deletes the tag and takes it off every entry carrying it.
+func (s *service) DeleteTag(ctx context.Context, ownerID, tagID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "DeleteTag").Msgf("%v: %v", ownerID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.repo.DeleteTag(ctx, tx, ownerID, tagID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "DeleteTag").Msgf("%v: %v", ownerID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Replaces the tags of the entry, every tag has to belong to the owner.
+func (s *service) SetEntryTags(ctx context.Context, ownerID, passwordID, categoryID uuid.UUID, tagIDs []uuid.UUID) ([]*Tag, error) {
+	unique := map[uuid.UUID]bool{}
+	for _, tagID := range tagIDs {
+		unique[tagID] = true
+	}
+
+	tagIDs = make([]uuid.UUID, 0, len(unique))
+	for tagID := range unique {
+		tagIDs = append(tagIDs, tagID)
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "SetEntryTags").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := s.repo.GetPasswordForUpdate(ctx, tx, ownerID, passwordID, categoryID); err != nil {
+		return nil, err
+	}
+
+	owned, err := s.repo.CountOwnedTags(ctx, tx, ownerID, tagIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if owned != len(tagIDs) {
+		return nil, apiutils.NewErrNotFound("tag not found")
+	}
+
+	if err := s.repo.SetPasswordTags(ctx, tx, ownerID, passwordID, tagIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "SetEntryTags").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+
+	tags, err := s.repo.GetPasswordTags(ctx, ownerID, []uuid.UUID{passwordID})
+	if err != nil {
+		return nil, err
+	}
+
+	return tags[passwordID], nil
+}
+
+// Marks or unmarks the entry as a favorite, the content and its updated time are left as they are.
+func (s *service) SetFavorite(ctx context.Context, ownerID, passwordID, categoryID uuid.UUID, favorite bool) error {
+	return s.repo.SetFavorite(ctx, ownerID, passwordID, categoryID, favorite)
+}
+
+// Records that the entry was just used, e.g. copied or filled in by a client.
+func (s *service) TouchPassword(ctx context.Context, ownerID, passwordID, categoryID uuid.UUID) error {
+	return s.repo.TouchPassword(ctx, ownerID, passwordID, categoryID, time.Now())
+}
+
+// helper: attachTags sets the tags of the listed entries.
+func (s *service) attachTags(ctx context.Context, ownerID uuid.UUID, passwords []*Password) error {
+	if len(passwords) == 0 {
+		return nil
+	}
+
+	passwordIDs := make([]uuid.UUID, len(passwords))
+	for i, password := range passwords {
+		passwordIDs[i] = password.PasswordID
+	}
+
+	tags, err := s.repo.GetPasswordTags(ctx, ownerID, passwordIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, password := range passwords {
+		password.Tags = tags[password.PasswordID]
+	}
+
+	return nil
+}
@@ -0,0 +1,305 @@
+package passwords
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+
+	"nestpass/internal/users/categories"
+)
+
+func testArchive(t *testing.T, payload []byte) []byte {
+	policy, err := NewKDFPolicy(KDFArgon2id, 19*1024, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	writer, err := newArchiveWriter(context.Background(), out, "correct horse battery", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := writer.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.Bytes()
+}
+
+func readArchive(data []byte, passphrase string) ([]byte, error) {
+	reader, err := newArchiveReader(context.Background(), bytes.NewReader(data), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(reader)
+}
+
+func Test_ArchiveRoundTrip(t *testing.T) {
+	// spans several chunks
+	payload := bytes.Repeat([]byte("nestpass"), archiveChunkSize/4)
+	archive := testArchive(t, payload)
+
+	opened, err := readArchive(archive, "correct horse battery")
+	if err != nil || !bytes.Equal(opened, payload) {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+
+	if _, err := readArchive(archive, "wrong passphrase"); err == nil {
+		t.Fatal("archive opened with the wrong passphrase")
+	}
+
+	// dropping the last chunk has to be detected
+	last := len(archive) - (len(payload)%archiveChunkSize + 16 + 4)
+	if _, err := readArchive(archive[:last], "correct horse battery"); err == nil {
+		t.Fatal("truncated archive opened")
+	}
+
+	tampered := bytes.Clone(archive)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := readArchive(tampered, "correct horse battery"); err == nil {
+		t.Fatal("tampered archive opened")
+	}
+}
+
+func Test_CheckArchiveKDF(t *testing.T) {
+	tests := []struct {
+		name   string
+		params *KDFParams
+		valid  bool
+	}{
+		{"default argon2id", &KDFParams{Algorithm: KDFArgon2id, Memory: 64 * 1024, Iterations: 3, Parallelism: 4}, true},
+		{"default pbkdf2", &KDFParams{Algorithm: KDFPBKDF2, Iterations: 600000}, true},
+		{"weak argon2id", &KDFParams{Algorithm: KDFArgon2id, Memory: 1024, Iterations: 1, Parallelism: 1}, false},
+		{"argon2id with pbkdf2 iterations", &KDFParams{Algorithm: KDFArgon2id, Memory: 64 * 1024, Iterations: 600000, Parallelism: 4}, false},
+		{"argon2id with too much memory", &KDFParams{Algorithm: KDFArgon2id, Memory: 1024 * 1024, Iterations: 3, Parallelism: 4}, false},
+		{"pbkdf2 with too many iterations", &KDFParams{Algorithm: KDFPBKDF2, Iterations: 10000000}, false},
+		{"missing", nil, false},
+	}
+
+	for _, tt := range tests {
+		if err := checkArchiveKDF(tt.params); (err == nil) != tt.valid {
+			t.Errorf("%s: checkArchiveKDF() error = %v", tt.name, err)
+		}
+	}
+}
+
+func Test_ExportNestedCategories(t *testing.T) {
+	policy, err := NewKDFPolicy(KDFArgon2id, 19*1024, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+	work := categories.New("Work", "", userID, nil)
+	servers := categories.New("Servers", "", userID, &work.CategoryID)
+	servers.Depth = 1
+	legacy := categories.New("Legacy", "", userID, &servers.CategoryID)
+	legacy.Depth = 2
+
+	dek, _ := newDEK()
+	vault := &Vault{UserID: userID, Mode: ServerMode, KeyVersion: 1}
+	ring := &keyRing{version: 1, keys: map[int][]byte{1: dek}}
+	data, err := NewPasswordEncrypt(&Password{PasswordID: uuid.New(), UserID: userID, CategoryID: legacy.CategoryID, Website: "db", Type: ItemLogin, Login: &Login{Username: "root", Password: "psw"}}, dek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.KeyVersion = 1
+
+	export := &Export{vault: vault, ring: ring, policy: policy, categories: categories.BuildTree([]*categories.Category{work, servers, legacy}), passwords: []*PasswordEncrypt{data}}
+	out := &bytes.Buffer{}
+	if err := export.WriteArchive(context.Background(), out, "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+
+	// entries filed below the top level keep their whole path
+	items, err := parseArchive(context.Background(), out.Bytes(), "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || items[0].Folder != "Work/Servers/Legacy" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
+
+func Test_ParseArchive(t *testing.T) {
+	parentID, childID := uuid.New(), uuid.New()
+	payload := `{"version":1,"exported":"2024-01-01T00:00:00Z","categories":[
+		{"category_id":"` + parentID.String() + `","name":"Work"},
+		{"category_id":"` + childID.String() + `","parent_id":"` + parentID.String() + `","name":"Servers"}],
+		"items":[{"category_id":"` + childID.String() + `","website":"db","item":{"v":2,"type":"login","login":{"username":"root","password":"psw"}}}]}`
+
+	items, err := parseArchive(context.Background(), testArchive(t, []byte(payload)), "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || items[0].Folder != "Work/Servers" || items[0].Password.Login.Username != "root" {
+		t.Fatalf("unexpected items: %+v", items[0])
+	}
+}
+
+func Test_ParseBitwarden(t *testing.T) {
+	data := `{"encrypted":false,"folders":[{"id":"f1","name":"Social/Chat"}],"items":[
+		{"type":1,"name":"","folderId":"f1","login":{"username":"user","password":"psw","uris":[{"uri":"https://chat.example.com/login"}]}},
+		{"type":2,"name":"memo","notes":"remember"},
+		{"type":3,"name":"visa","card":{"number":"4111111111111111","expMonth":"4","expYear":"2030","code":"123"}}]}`
+
+	items, err := parseBitwarden([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(items))
+	}
+
+	if items[0].Folder != "Social/Chat" || items[0].Password.Website != "chat.example.com" {
+		t.Fatalf("unexpected login: %+v", items[0].Password)
+	}
+
+	if items[1].Password.Type != ItemNote || items[1].Password.Note.Text != "remember" {
+		t.Fatalf("unexpected note: %+v", items[1].Password)
+	}
+
+	if card := items[2].Password.Card; card.ExpMonth != 4 || card.ExpYear != 2030 {
+		t.Fatalf("unexpected card: %+v", card)
+	}
+
+	for _, item := range items {
+		if err := item.Password.Validate(); err != nil {
+			t.Fatalf("%v: %v", item.Password.Website, err)
+		}
+	}
+
+	if _, err := parseBitwarden([]byte(`{"encrypted":true}`)); err == nil {
+		t.Fatal("encrypted export accepted")
+	}
+}
+
+func Test_ParseCSV(t *testing.T) {
+	data := "url,username,password,extra,name,grouping\n" +
+		"https://example.com,user,psw,,Example,Personal\\Shopping\n" +
+		"http://sn,,,my secret note,Note,\n"
+
+	items, err := parseCSV([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+
+	login := items[0].Password
+	if login.Type != ItemLogin || login.Login.Password != "psw" || folderPath(items[0].Folder) != "Personal/Shopping" {
+		t.Fatalf("unexpected login: %+v", login)
+	}
+
+	if note := items[1].Password; note.Type != ItemNote || note.Note.Text != "my secret note" {
+		t.Fatalf("unexpected note: %+v", note)
+	}
+}
+
+func Test_ParseKeePass(t *testing.T) {
+	data := `<KeePassFile><Meta><RecycleBinUUID>bin</RecycleBinUUID></Meta><Root><Group><UUID>root</UUID><Name>Database</Name>
+		<Entry><String><Key>Title</Key><Value>mail</Value></String><String><Key>UserName</Key><Value>me</Value></String>
+			<String><Key>Password</Key><Value ProtectInMemory="True">psw</Value></String>
+			<String><Key>PIN</Key><Value ProtectInMemory="True">1234</Value></String></Entry>
+		<Group><UUID>g1</UUID><Name>Banking</Name>
+			<Entry><String><Key>Title</Key><Value>bank</Value></String><String><Key>UserName</Key><Value>me</Value></String>
+				<String><Key>Password</Key><Value>psw</Value></String></Entry></Group>
+		<Group><UUID>bin</UUID><Name>Recycle Bin</Name>
+			<Entry><String><Key>Title</Key><Value>old</Value></String></Entry></Group>
+	</Group></Root></KeePassFile>`
+
+	items, err := parseKeePass([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+
+	if items[0].Folder != "" || len(items[0].Password.Fields) != 1 || items[0].Password.Fields[0].Type != FieldHidden {
+		t.Fatalf("unexpected entry: %+v", items[0].Password)
+	}
+
+	if folderPath(items[1].Folder) != "Banking" {
+		t.Fatalf("unexpected folder %q", items[1].Folder)
+	}
+
+	protected := strings.Replace(data, `<Value>psw</Value>`, `<Value Protected="True">cHN3</Value>`, 1)
+	if _, err := parseKeePass([]byte(protected)); err == nil {
+		t.Fatal("protected values accepted")
+	}
+}
+
+func Test_ImportValidationSkipsOwnership(t *testing.T) {
+	psw := &Password{Website: "example.com", Type: ItemLogin, Login: &Login{Username: "user", Password: "psw"}}
+	if err := validator.New().StructExcept(psw, "UserID", "CategoryID"); err != nil {
+		t.Fatalf("imported entry rejected before it is filed: %v", err)
+	}
+}
+
+func Test_FolderMapper(t *testing.T) {
+	userID := uuid.New()
+	work := categories.New("Work", "", userID, nil)
+	servers := categories.New("Servers", "", userID, &work.CategoryID)
+	servers.Depth = 1
+	legacy := categories.New("Legacy", "", userID, &servers.CategoryID)
+	legacy.Depth = 2
+	mapped := categories.New("Mapped", "", userID, nil)
+	tree := categories.BuildTree([]*categories.Category{work, mapped, servers, legacy})
+
+	// nested categories can be the target and mapped to
+	opts := &ImportOptions{TargetID: &servers.CategoryID, CategoryMap: map[string]uuid.UUID{"Old/Stuff": legacy.CategoryID}}
+	if _, err := newFolderMapper(userID, tree, opts); err != nil {
+		t.Fatalf("nested categories not found: %v", err)
+	}
+
+	opts = &ImportOptions{CategoryMap: map[string]uuid.UUID{"Old/Stuff": mapped.CategoryID}}
+	m, err := newFolderMapper(userID, tree, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id := m.resolve("Work/Servers"); id != servers.CategoryID {
+		t.Fatal("existing path not matched")
+	}
+
+	// existing nested folders are not planned again
+	if id := m.resolve("Work/Servers/Legacy"); id != legacy.CategoryID || len(m.created) != 0 {
+		t.Fatalf("existing nested folder planned again: %+v", m.created)
+	}
+
+	if id := m.resolve(" Old / Stuff "); id != mapped.CategoryID {
+		t.Fatal("mapped folder not used")
+	}
+
+	dbID := m.resolve("Work/Servers/Databases")
+	if len(m.created) != 1 || m.created[0].CategoryID != dbID || *m.created[0].ParentID != servers.CategoryID {
+		t.Fatalf("missing folder not planned below its parent: %+v", m.created)
+	}
+
+	// unfiled entries share one category at the root
+	if m.resolve("") != m.resolve("") || len(m.created) != 2 || m.created[1].Name != importCategory {
+		t.Fatalf("unexpected categories: %v", m.paths)
+	}
+
+	if _, err := newFolderMapper(userID, nil, &ImportOptions{TargetID: &work.CategoryID}); err == nil {
+		t.Fatal("unknown target accepted")
+	}
+}
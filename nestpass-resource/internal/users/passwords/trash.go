@@ -0,0 +1,195 @@
+package passwords
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/pkg/pagination"
+)
+
+// Moves the entry to the trash, it can be restored until it is purged.
+func (s *service) DeletePassword(ctx context.Context, userID, passwordID, categoryID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "DeletePassword").Msgf("%v: %v", categoryID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.repo.TrashPassword(ctx, tx, userID, passwordID, categoryID, time.Now()); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "DeletePassword").Msgf("%v: %v", categoryID, err)
+		return err
+	}
+
+	s.afterWrite(ctx, userID, []uuid.UUID{passwordID}, []uuid.UUID{categoryID})
+	return nil
+}
+
+// Lists the trashed entries decrypted, or sealed for client side encrypted vaults, most recently
+// deleted first.
+func (s *service) GetTrash(ctx context.Context, userID uuid.UUID, params *pagination.Params) (*pagination.Page[*Password], error) {
+	vault, ring, err := s.vaultKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	trash, err := s.repo.GetTrash(ctx, userID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	opened := []*Password{}
+	for _, password := range trash {
+		psw, err := open(vault, ring, &password.PasswordEncrypt)
+		if err != nil {
+			return nil, err
+		}
+
+		psw.DeletedAt = &password.DeletedAt
+		opened = append(opened, psw)
+	}
+
+	return pagination.NewPage(params, opened, func(psw *Password) (string, uuid.UUID) {
+		return psw.DeletedAt.Format(time.RFC3339Nano), psw.PasswordID
+	})
+}
+
+// Moves the entry out of the trash back into its category.
+func (s *service) RestorePassword(ctx context.Context, userID, passwordID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "RestorePassword").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	password, err := s.repo.GetTrashedPassword(ctx, tx, userID, passwordID)
+	if err != nil {
+		return err
+	}
+
+	active, err := s.repo.CategoryActive(ctx, tx, userID, password.CategoryID)
+	if err != nil {
+		return err
+	}
+
+	if !active {
+		return apiutils.NewErrConflict("the password's category is in the trash, restore the category first")
+	}
+
+	if err := s.repo.RestorePassword(ctx, tx, userID, passwordID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "RestorePassword").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	s.afterWrite(ctx, userID, []uuid.UUID{passwordID}, []uuid.UUID{password.CategoryID})
+	return nil
+}
+
+// Permanently deletes the trashed entry, or the whole trash when passwordID is nil.
+func (s *service) PurgeTrash(ctx context.Context, userID uuid.UUID, passwordID *uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "PurgeTrash").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	ids, err := s.trashIDs(ctx, tx, userID, passwordID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.PurgePasswords(ctx, tx, userID, ids); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "PurgeTrash").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// helper: trashIDs locks the trashed entries to purge.
+func (s *service) trashIDs(ctx context.Context, tx pgx.Tx, userID uuid.UUID, passwordID *uuid.UUID) ([]uuid.UUID, error) {
+	if passwordID == nil {
+		return s.repo.GetTrashIDs(ctx, tx, userID)
+	}
+
+	password, err := s.repo.GetTrashedPassword(ctx, tx, userID, *passwordID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []uuid.UUID{password.PasswordID}, nil
+}
+
+// Permanently deletes every entry trashed before the cutoff, one user at a time. A user whose
+// trash fails to purge is logged and left for the next run.
+func (s *service) PurgeExpired(ctx context.Context, cutoff time.Time) error {
+	users, err := s.repo.GetExpiredTrashUsers(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+
+	var purged int64
+	failed := 0
+	for _, userID := range users {
+		n, err := s.purgeExpired(ctx, userID, cutoff)
+		if err != nil {
+			log.Error().Str("location", "PurgeExpired").Msgf("%v: failed to purge trashed passwords: %v", userID, err)
+			failed++
+			continue
+		}
+
+		purged += n
+	}
+
+	if purged != 0 {
+		log.Info().Str("location", "PurgeExpired").Msgf("%v trashed passwords purged", purged)
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("trashed passwords of %d users not purged", failed)
+	}
+
+	return nil
+}
+
+// helper: purgeExpired deletes the user's entries trashed before the cutoff.
+func (s *service) purgeExpired(ctx context.Context, userID uuid.UUID, cutoff time.Time) (int64, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "PurgeExpired").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	purged, err := s.repo.PurgeExpired(ctx, tx, userID, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "PurgeExpired").Msgf("%v: %v", userID, err)
+		return 0, err
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,483 @@
+package passwords
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+)
+
+// Data encryption keys of a server side encrypted vault by version.
+// A vault holds the previous version as well while a rekey job moves its entries.
+type keyRing struct {
+	version int
+	keys    map[int][]byte
+	private []byte // private key of the user's keypair, nil until one is created
+	legacy  bool   // key derived from the password of a vault not migrated yet, it encrypts every entry
+}
+
+// Returns the key new entries are encrypted with.
+func (k *keyRing) current() []byte {
+	return k.keys[k.version]
+}
+
+// Returns the key of the given version.
+func (k *keyRing) get(version int) ([]byte, error) {
+	if k.legacy {
+		return k.current(), nil
+	}
+
+	key, ok := k.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("no data key for version %d", version)
+	}
+
+	return key, nil
+}
+
+// helper: unwrapRing unwraps the vault's data encryption keys with the key encryption key.
+func unwrapRing(vault *Vault, kek []byte) (*keyRing, error) {
+	dek, err := unwrapKey(kek, vault.WrappedDEK, vault.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &keyRing{version: vault.KeyVersion, keys: map[int][]byte{vault.KeyVersion: dek}}
+	if len(vault.PrevDEK) != 0 {
+		prev, err := unwrapKey(kek, vault.PrevDEK, vault.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		ring.keys[vault.KeyVersion-1] = prev
+	}
+
+	if len(vault.WrappedPrivate) != 0 {
+		if ring.private, err = unwrapKey(kek, vault.WrappedPrivate, vault.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	return ring, nil
+}
+
+// helper: keyRing unwraps the data encryption keys of a server side encrypted vault, client side encrypted vaults have none.
+func (s *service) keyRing(ctx context.Context, vault *Vault) (*keyRing, error) {
+	if vault.Mode == ClientMode {
+		return nil, nil
+	}
+
+	if vault.Mode == OrgMode {
+		return s.orgRing(ctx, vault)
+	}
+
+	// entries stay encrypted with the password derived key until a write migrates the vault
+	if vault.IsLegacy() {
+		legacyKey, err := s.getKDFKey(ctx, vault.UserID, currKDF, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return &keyRing{version: vault.KeyVersion, keys: map[int][]byte{vault.KeyVersion: legacyKey}, legacy: true}, nil
+	}
+
+	kek, err := s.getKDFKey(ctx, vault.UserID, currKDF, vault.KDF)
+	if err != nil {
+		return nil, err
+	}
+
+	ring, err := unwrapRing(vault, kek)
+	if err != nil {
+		log.Error().Str("location", "keyRing").Msgf("%v: failed to unwrap data key: %v", vault.UserID, err)
+		return nil, err
+	}
+
+	return ring, nil
+}
+
+// helper: wrapRing wraps the data encryption keys with a key derived from the current
+// password hash using fresh parameters from the policy, and stores them on the vault.
+func (s *service) wrapRing(ctx context.Context, vault *Vault, ring *keyRing) error {
+	params, err := s.kdfPolicy.withSalt()
+	if err != nil {
+		return err
+	}
+
+	kek, err := s.getKDFKey(ctx, vault.UserID, currKDF, params)
+	if err != nil {
+		return err
+	}
+
+	if vault.WrappedDEK, err = wrapKey(kek, ring.current(), vault.UserID); err != nil {
+		return err
+	}
+
+	vault.PrevDEK = nil
+	if prev, ok := ring.keys[ring.version-1]; ok {
+		if vault.PrevDEK, err = wrapKey(kek, prev, vault.UserID); err != nil {
+			return err
+		}
+	}
+
+	if ring.private != nil {
+		if vault.WrappedPrivate, err = wrapKey(kek, ring.private, vault.UserID); err != nil {
+			return err
+		}
+	}
+
+	vault.KeyVersion, vault.KDF, vault.Updated = ring.version, params, time.Now()
+	return nil
+}
+
+// helper: loadVault retrieves the vault as it is stored, reads never migrate it.
+func (s *service) loadVault(ctx context.Context, userID uuid.UUID) (*Vault, error) {
+	return s.repo.GetVault(ctx, userID)
+}
+
+// helper: prepareVault migrates a legacy vault and upgrades weak key derivation before a write.
+// Both recheck the vault behind its row lock, so concurrent writers migrate it once.
+func (s *service) prepareVault(ctx context.Context, userID uuid.UUID) (*Vault, error) {
+	vault, err := s.repo.GetVault(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.IsLegacy() {
+		return s.migrateVault(ctx, userID, currKDF)
+	}
+
+	if s.needsKDFUpgrade(vault) {
+		return s.upgradeKDF(ctx, userID)
+	}
+
+	return vault, nil
+}
+
+// helper: vaultKey retrieves the vault along with its data encryption keys for reading.
+func (s *service) vaultKey(ctx context.Context, userID uuid.UUID) (*Vault, *keyRing, error) {
+	vault, err := s.loadVault(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ring, err := s.keyRing(ctx, vault)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return vault, ring, nil
+}
+
+// helper: prepareVaultKey is vaultKey for writes that persist keys derived from the ring,
+// the vault is prepared first so the ring is never the legacy one.
+func (s *service) prepareVaultKey(ctx context.Context, userID uuid.UUID) (*Vault, *keyRing, error) {
+	vault, err := s.prepareVault(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ring, err := s.keyRing(ctx, vault)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return vault, ring, nil
+}
+
+// helper: needsKDFUpgrade checks if the vault key is derived with weaker parameters than the policy,
+// legacy vaults are migrated instead.
+func (s *service) needsKDFUpgrade(vault *Vault) bool {
+	if vault.Mode != ServerMode || vault.IsLegacy() {
+		return false
+	}
+
+	return vault.KDF == nil || vault.KDF.NeedsUpgrade(s.kdfPolicy)
+}
+
+// helper: upgradeKDF rewraps the data encryption keys with a key derived using the current policy.
+func (s *service) upgradeKDF(ctx context.Context, userID uuid.UUID) (*Vault, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "upgradeKDF").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	vault, err := s.repo.LockVault(ctx, tx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// upgraded by a concurrent request
+	if !s.needsKDFUpgrade(vault) {
+		return vault, nil
+	}
+
+	ring, err := s.keyRing(ctx, vault)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.wrapRing(ctx, vault, ring); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpsertVault(ctx, tx, vault); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "upgradeKDF").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	log.Info().Str("location", "upgradeKDF").Msgf("%v: key derivation upgraded to %s", userID, vault.KDF.Algorithm)
+	return vault, nil
+}
+
+// helper: migrateVault moves a legacy vault, whose entries are encrypted with the key derived from
+// the given password hash, to a random data encryption key wrapped by the current password derived key.
+// Entries and the wrapped key are written in one transaction so the vault is never left in mixed state.
+func (s *service) migrateVault(ctx context.Context, userID uuid.UUID, legacyKDF kdfType) (*Vault, error) {
+	legacyKey, err := s.getKDFKey(ctx, userID, legacyKDF, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "migrateVault").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	vault, err := s.repo.LockVault(ctx, tx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// migrated by a concurrent request
+	if !vault.IsLegacy() {
+		return vault, nil
+	}
+
+	dek, err := newDEK()
+	if err != nil {
+		return nil, err
+	}
+	ring := &keyRing{version: vault.KeyVersion, keys: map[int][]byte{vault.KeyVersion: dek}}
+
+	passwords, err := s.repo.GetVaultPasswords(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, password := range passwords {
+		newData, err := reencrypt(password, legacyKey, ring)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.repo.UpdatePassword(ctx, tx, newData); err != nil {
+			return nil, err
+		}
+	}
+
+	revisions, err := s.repo.GetVaultRevisions(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, revision := range revisions {
+		newData, err := reencrypt(&revision.PasswordEncrypt, legacyKey, ring)
+		if err != nil {
+			return nil, err
+		}
+
+		revision.PasswordEncrypt = *newData
+		if err := s.repo.UpdateRevision(ctx, tx, revision); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.wrapRing(ctx, vault, ring); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpsertVault(ctx, tx, vault); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "migrateVault").Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	log.Info().Str("location", "migrateVault").Msgf("%v: %v entries migrated to a wrapped data key", userID, len(passwords))
+	return vault, nil
+}
+
+// helper: reencrypt decrypts the entry with the old key and encrypts it with the ring's current key.
+func reencrypt(password *PasswordEncrypt, oldKey []byte, ring *keyRing) (*PasswordEncrypt, error) {
+	data, err := password.Decrypt(password.UserID, oldKey)
+	if err != nil {
+		log.Error().Str("location", "reencrypt").Msgf("%v: failed to decrypt %v: %v", password.UserID, password.PasswordID, err)
+		return nil, err
+	}
+
+	newData, err := NewPasswordEncrypt(data, ring.current())
+	if err != nil {
+		return nil, err
+	}
+
+	newData.KeyVersion, newData.Updated = ring.version, password.Updated
+	return newData, nil
+}
+
+// helper: openAll decrypts the entries of server side encrypted vaults and passes sealed entries through.
+func openAll(vault *Vault, ring *keyRing, passwords []*PasswordEncrypt) ([]*Password, error) {
+	opened := []*Password{}
+	for _, password := range passwords {
+		psw, err := open(vault, ring, password)
+		if err != nil {
+			return nil, err
+		}
+
+		opened = append(opened, psw)
+	}
+
+	return opened, nil
+}
+
+// helper: open decrypts a server side encrypted entry with the key of its version or passes a sealed entry through.
+func open(vault *Vault, ring *keyRing, password *PasswordEncrypt) (*Password, error) {
+	if vault.Mode == ClientMode {
+		return password.Sealed(), nil
+	}
+
+	key, err := ring.get(password.KeyVersion)
+	if err != nil {
+		log.Error().Str("location", "open").Msgf("%v: %v: %v", vault.UserID, password.PasswordID, err)
+		return nil, err
+	}
+
+	return password.Decrypt(vault.UserID, key)
+}
+
+// helper: seal encrypts the entry for the vault's mode, rejecting input meant for the other mode.
+func seal(vault *Vault, ring *keyRing, psw *Password) (*PasswordEncrypt, error) {
+	if vault.Mode == ClientMode {
+		if len(psw.Sealed) == 0 || psw.hasContent() {
+			return nil, apiutils.NewErrBadRequest("vault uses client side encryption, only sealed entries are accepted")
+		}
+
+		return NewSealedPasswordEncrypt(psw)
+	}
+
+	if len(psw.Sealed) != 0 {
+		return nil, apiutils.NewErrBadRequest("vault uses server side encryption, sealed entries are not accepted")
+	}
+
+	data, err := NewPasswordEncrypt(psw, ring.current())
+	if err != nil {
+		return nil, err
+	}
+
+	data.KeyVersion = ring.version
+	return data, nil
+}
+
+// Rewraps the vault's data encryption keys after a password reset and starts rotating the data key,
+// since the previous password could still unwrap the old one. Legacy vaults are migrated from the
+// previous password hash instead. Resets without a pending rewrap were already handled.
+func (s *service) ReUpdateAllPasswords(ctx context.Context, userID uuid.UUID) error {
+	rewrap, err := s.repo.GetRewrap(ctx, userID)
+	if err != nil {
+		if _, ok := err.(apiutils.ErrNotFound); ok {
+			return nil
+		}
+
+		return err
+	}
+
+	vault, err := s.repo.GetVault(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case vault.Mode == ClientMode:
+		// the login password does not protect client side encrypted vaults
+	case vault.IsLegacy():
+		if _, err := s.migrateVault(ctx, userID, prevKDF); err != nil {
+			return err
+		}
+	default:
+		if err := s.rewrapVault(ctx, userID); err != nil {
+			return err
+		}
+	}
+
+	// the pending rewrap is only dropped once the vault is readable with the new password
+	if err := s.repo.DeleteRewraps(ctx, userID, rewrap.Queued); err != nil {
+		return err
+	}
+
+	if vault.Mode == ClientMode {
+		return nil
+	}
+
+	_, err = s.Rekey(ctx, userID)
+	return err
+}
+
+// helper: rewrapVault rewraps the data encryption keys from the previous to the current password derived key.
+func (s *service) rewrapVault(ctx context.Context, userID uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "rewrapVault").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	vault, err := s.repo.LockVault(ctx, tx, userID, true)
+	if err != nil {
+		return err
+	}
+
+	prevKEK, err := s.getKDFKey(ctx, userID, prevKDF, vault.KDF)
+	if err != nil {
+		return err
+	}
+
+	ring, err := unwrapRing(vault, prevKEK)
+	if err != nil {
+		// already rewrapped by a previous attempt
+		if _, currErr := s.keyRing(ctx, vault); currErr == nil {
+			return nil
+		}
+
+		log.Error().Str("location", "rewrapVault").Msgf("%v: failed to unwrap data key: %v", userID, err)
+		return err
+	}
+
+	// a reset also moves the vault to fresh parameters from the policy
+	if err := s.wrapRing(ctx, vault, ring); err != nil {
+		return err
+	}
+
+	if err := s.repo.UpsertVault(ctx, tx, vault); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "rewrapVault").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	log.Info().Str("location", "rewrapVault").Msgf("%v: data key rewrapped", userID)
+	return nil
+}
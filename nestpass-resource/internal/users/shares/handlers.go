@@ -0,0 +1,181 @@
+package shares
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/dependencies"
+	"nestpass/internal/users/categories"
+	"nestpass/internal/users/passwords"
+	"nestpass/pkg/auth"
+	"nestpass/pkg/pagination"
+)
+
+type Handler struct {
+	svc   *service
+	pager *pagination.Pager
+}
+
+func NewHandler(deps *dependencies.Dependencies, vault vault, tree categoryWrites) *Handler {
+	repo := NewRepository(deps.Databases.Postgres)
+	svc := NewService(repo, vault, categories.NewRepository(deps.Databases.Postgres))
+
+	// writes to the owner's entries or to the categories holding them queue a rebuild of their shares
+	vault.OnWrite(svc.queueSync)
+	tree.OnWrite(svc.queueCategorySync)
+	return &Handler{svc: svc, pager: deps.Pager}
+}
+
+// Rebuilds the shares covering queued writes until the context ends.
+func (h *Handler) RunSyncs(ctx context.Context) {
+	h.svc.RunSyncs(ctx)
+}
+
+func (h *Handler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	req := &ShareRequest{}
+	if err := req.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	share, err := h.svc.Share(r.Context(), userID, req)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusCreated, "", share)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetShares(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	params, err := h.pager.Parse(r)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	shares, err := h.svc.GetShares(r.Context(), userID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", shares)
+	resp.SendRes(w)
+}
+
+func (h *Handler) GetSharedWithMe(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	params, err := h.pager.Parse(r)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	received, err := h.svc.SharedWithMe(r.Context(), userID, params)
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", received)
+	resp.AddHeader(w, map[string]string{"Cache-Control": "no-store"})
+	resp.SendRes(w)
+}
+
+func (h *Handler) UpdateShared(w http.ResponseWriter, r *http.Request) {
+	shareID, err := queryUUID(r, "share_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	psw := &passwords.Password{}
+	if err := psw.Deserialize(r.Body); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.UpdateShared(r.Context(), userID, shareID, psw); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+func (h *Handler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	shareID, err := queryUUID(r, "share_id")
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	// without a recipient the whole share is revoked
+	var recipientID *uuid.UUID
+	if r.URL.Query().Get("recipient_id") != "" {
+		id, err := queryUUID(r, "recipient_id")
+		if err != nil {
+			apiutils.HandleHttpErrors(w, err)
+			return
+		}
+		recipientID = &id
+	}
+
+	userID, err := auth.UidFromCtx(r.Context())
+	if err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	if err := h.svc.RevokeShare(r.Context(), userID, shareID, recipientID); err != nil {
+		apiutils.HandleHttpErrors(w, err)
+		return
+	}
+
+	resp := apiutils.NewRes(http.StatusOK, "", nil)
+	resp.SendRes(w)
+}
+
+// helper: queryUUID parses a required id query parameter.
+func queryUUID(r *http.Request, name string) (uuid.UUID, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return uuid.Nil, apiutils.NewErrBadRequest("missing " + name)
+	}
+
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, apiutils.NewErrBadRequest("invalid " + name)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,97 @@
+package shares
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"nestpass/internal/users/passwords"
+)
+
+// share permissions
+const (
+	ShareRead      = "read"
+	ShareReadWrite = "read_write"
+)
+
+// Entry or category shared by its owner, the members read copies of the entries encrypted
+// with the share key, which is sealed to the owner and each member.
+type Share struct {
+	ShareID    uuid.UUID      `json:"share_id"`
+	OwnerID    uuid.UUID      `json:"owner_id"`
+	PasswordID *uuid.UUID     `json:"password_id,omitempty"` // nil when a category is shared
+	CategoryID uuid.UUID      `json:"category_id"`           // category of the entry or the shared category
+	OwnerKey   []byte         `json:"-"`
+	KeyVersion int            `json:"key_version"` // bumped each time a revocation rotates the share key
+	Created    time.Time      `json:"created"`
+	Members    []*ShareMember `json:"members,omitempty"`
+}
+
+func (s *Share) Scan(row pgx.Row) error {
+	return row.Scan(&s.ShareID, &s.OwnerID, &s.PasswordID, &s.CategoryID, &s.OwnerKey, &s.KeyVersion, &s.Created)
+}
+
+type ShareMember struct {
+	RecipientID uuid.UUID `json:"recipient_id"`
+	Email       string    `json:"email"`
+	Permission  string    `json:"permission"`
+	SealedKey   []byte    `json:"-"`
+	Created     time.Time `json:"created"`
+}
+
+func (m *ShareMember) Scan(row pgx.Row) error {
+	return row.Scan(&m.RecipientID, &m.Email, &m.Permission, &m.SealedKey, &m.Created)
+}
+
+// Write to the owner's entries or categories queued until the shares covering it are rebuilt.
+// Writes to categories carry no entries, every entry filed in the categories counts as written.
+type ShareSync struct {
+	SyncID      uuid.UUID
+	OwnerID     uuid.UUID
+	PasswordIDs []uuid.UUID
+	CategoryIDs []uuid.UUID
+	Queued      time.Time
+	Attempts    int       // rebuilds of its shares that failed so far
+	RetryAt     time.Time // when the write is claimed again
+}
+
+func (s *ShareSync) Scan(row pgx.Row) error {
+	return row.Scan(&s.SyncID, &s.OwnerID, &s.PasswordIDs, &s.CategoryIDs, &s.Queued, &s.Attempts, &s.RetryAt)
+}
+
+// Share received by the user with the entries it holds.
+type SharedWithMe struct {
+	ShareID    uuid.UUID             `json:"share_id"`
+	OwnerID    uuid.UUID             `json:"owner_id"`
+	PasswordID *uuid.UUID            `json:"password_id,omitempty"`
+	CategoryID uuid.UUID             `json:"category_id"`
+	Permission string                `json:"permission"`
+	Entries    []*passwords.Password `json:"entries"`
+}
+
+// Request data for sharing an entry, or the whole category when no entry is given.
+type ShareRequest struct {
+	PasswordID *uuid.UUID `json:"password_id"`
+	CategoryID uuid.UUID  `json:"category_id" validate:"required"`
+	Email      string     `json:"email" validate:"required,email"`
+	Permission string     `json:"permission" validate:"required,oneof=read read_write"`
+}
+
+func (s *ShareRequest) Deserialize(data io.ReadCloser) error {
+	if err := json.NewDecoder(data).Decode(s); err != nil {
+		log.Error().Str("location", "ShareRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	if err := validator.New().Struct(s); err != nil {
+		log.Error().Str("location", "ShareRequest.Deserialize").Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
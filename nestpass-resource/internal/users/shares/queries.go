@@ -0,0 +1,127 @@
+package shares
+
+const (
+	GetUserIDByEmailQuery = `
+	SELECT user_id FROM users WHERE email = $1`
+
+	CreateShareQuery = `
+	INSERT INTO shares (share_id, owner_id, password_id, category_id, owner_key, key_version, created)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	// the share of an entry or a category, at most one per shared object
+	FindShareQuery = `
+	SELECT share_id, owner_id, password_id, category_id, owner_key, key_version, created FROM shares
+	WHERE owner_id = $1 AND password_id IS NOT DISTINCT FROM $2 AND category_id = $3
+	FOR UPDATE`
+
+	GetShareQuery = `
+	SELECT share_id, owner_id, password_id, category_id, owner_key, key_version, created FROM shares
+	WHERE share_id = $1`
+
+	LockShareQuery = `
+	SELECT share_id, owner_id, password_id, category_id, owner_key, key_version, created FROM shares
+	WHERE share_id = $1
+	FOR UPDATE`
+
+	GetOwnedSharesQuery = `
+	SELECT share_id, owner_id, password_id, category_id, owner_key, key_version, created FROM shares
+	WHERE owner_id = $1
+	ORDER BY created ASC`
+
+	HasSharesQuery = `
+	SELECT EXISTS (SELECT 1 FROM shares WHERE owner_id = $1)`
+
+	ListOwnedSharesQuery = `
+	SELECT share_id, owner_id, password_id, category_id, owner_key, key_version, created FROM shares
+	WHERE owner_id = $1 AND ($2::timestamptz IS NULL OR (created, share_id) > ($2, $3::uuid))
+	ORDER BY created ASC, share_id ASC
+	LIMIT $4`
+
+	ListOwnedSharesDescQuery = `
+	SELECT share_id, owner_id, password_id, category_id, owner_key, key_version, created FROM shares
+	WHERE owner_id = $1 AND ($2::timestamptz IS NULL OR (created, share_id) < ($2, $3::uuid))
+	ORDER BY created DESC, share_id DESC
+	LIMIT $4`
+
+	ListReceivedSharesQuery = `
+	SELECT s.share_id, s.owner_id, s.password_id, s.category_id, s.owner_key, s.key_version, s.created FROM shares s
+	JOIN share_members m ON m.share_id = s.share_id
+	WHERE m.recipient_id = $1 AND ($2::timestamptz IS NULL OR (s.created, s.share_id) > ($2, $3::uuid))
+	ORDER BY s.created ASC, s.share_id ASC
+	LIMIT $4`
+
+	ListReceivedSharesDescQuery = `
+	SELECT s.share_id, s.owner_id, s.password_id, s.category_id, s.owner_key, s.key_version, s.created FROM shares s
+	JOIN share_members m ON m.share_id = s.share_id
+	WHERE m.recipient_id = $1 AND ($2::timestamptz IS NULL OR (s.created, s.share_id) < ($2, $3::uuid))
+	ORDER BY s.created DESC, s.share_id DESC
+	LIMIT $4`
+
+	UpdateShareKeyQuery = `
+	UPDATE shares SET owner_key = $2, key_version = $3
+	WHERE share_id = $1`
+
+	DeleteShareQuery = `
+	DELETE FROM shares WHERE share_id = $1`
+
+	UpsertShareMemberQuery = `
+	INSERT INTO share_members (share_id, recipient_id, permission, sealed_key, created)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (share_id, recipient_id) DO UPDATE
+	SET permission = EXCLUDED.permission, sealed_key = EXCLUDED.sealed_key`
+
+	GetShareMembersQuery = `
+	SELECT m.recipient_id, u.email, m.permission, m.sealed_key, m.created FROM share_members m
+	JOIN users u ON u.user_id = m.recipient_id
+	WHERE m.share_id = $1
+	ORDER BY m.created ASC`
+
+	GetShareMemberQuery = `
+	SELECT m.recipient_id, u.email, m.permission, m.sealed_key, m.created FROM share_members m
+	JOIN users u ON u.user_id = m.recipient_id
+	WHERE m.share_id = $1 AND m.recipient_id = $2`
+
+	DeleteShareMemberQuery = `
+	DELETE FROM share_members WHERE share_id = $1 AND recipient_id = $2`
+
+	DeleteShareMembersQuery = `
+	DELETE FROM share_members WHERE share_id = $1`
+
+	CreateSharedPasswordQuery = `
+	INSERT INTO shared_passwords (
+		share_id, password_id, user_id, category_id, website, nonce, encrypted, key_version, updated
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	// copies are encrypted with the share key, key_version is the version of the share key
+	GetSharedPasswordsQuery = `
+	SELECT password_id, user_id, category_id, website, nonce, encrypted, key_version, updated FROM shared_passwords
+	WHERE share_id = $1
+	ORDER BY password_id ASC`
+
+	DeleteSharedPasswordsQuery = `
+	DELETE FROM shared_passwords WHERE share_id = $1`
+
+	QueueShareSyncQuery = `
+	INSERT INTO share_syncs (sync_id, owner_id, password_ids, category_ids, queued, retry_at)
+	VALUES ($1, $2, $3, $4, $5, $5)`
+
+	// every due write of the owner with the oldest due write, writes claimed by another worker are skipped
+	ClaimShareSyncsQuery = `
+	SELECT sync_id, owner_id, password_ids, category_ids, queued, attempts, retry_at FROM share_syncs
+	WHERE owner_id = (
+		SELECT owner_id FROM share_syncs
+		WHERE retry_at <= now()
+		ORDER BY queued ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	) AND retry_at <= now()
+	ORDER BY queued ASC
+	FOR UPDATE SKIP LOCKED`
+
+	RetryShareSyncQuery = `
+	UPDATE share_syncs SET attempts = $2, retry_at = $3
+	WHERE sync_id = $1`
+
+	DeleteShareSyncsQuery = `
+	DELETE FROM share_syncs WHERE sync_id = ANY($1::uuid[])`
+)
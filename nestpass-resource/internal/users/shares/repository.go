@@ -0,0 +1,355 @@
+package shares
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/users/passwords"
+	"nestpass/pkg/pagination"
+)
+
+// postgres operations the repository runs, satisfied by *pgxpool.Pool
+type database interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type repository struct {
+	postgres database
+}
+
+func NewRepository(pg *pgxpool.Pool) *repository {
+	return &repository{postgres: pg}
+}
+
+func (r *repository) GetUserIDByEmail(ctx context.Context, email string) (uuid.UUID, error) {
+	userID := uuid.Nil
+	if err := r.postgres.QueryRow(ctx, GetUserIDByEmailQuery, email).Scan(&userID); err != nil {
+		if err == pgx.ErrNoRows {
+			return uuid.Nil, apiutils.NewErrNotFound("user not found")
+		}
+
+		log.Error().Str("location", "GetUserIDByEmail").Msg(err.Error())
+		return uuid.Nil, err
+	}
+
+	return userID, nil
+}
+
+func (r *repository) CreateShare(ctx context.Context, tx pgx.Tx, share *Share) error {
+	_, err := tx.Exec(ctx, CreateShareQuery,
+		share.ShareID,
+		share.OwnerID,
+		share.PasswordID,
+		share.CategoryID,
+		share.OwnerKey,
+		share.KeyVersion,
+		share.Created,
+	)
+
+	if err != nil {
+		log.Error().Str("location", "CreateShare").Msgf("%v: %v", share.OwnerID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves and locks the share of the entry, or of the category when passwordID is nil, nil when it is not shared.
+func (r *repository) FindShare(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID, passwordID *uuid.UUID, categoryID uuid.UUID) (*Share, error) {
+	share := &Share{}
+	if err := share.Scan(tx.QueryRow(ctx, FindShareQuery, ownerID, passwordID, categoryID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+
+		log.Error().Str("location", "FindShare").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+
+	return share, nil
+}
+
+func (r *repository) GetShare(ctx context.Context, shareID uuid.UUID) (*Share, error) {
+	share := &Share{}
+	if err := share.Scan(r.postgres.QueryRow(ctx, GetShareQuery, shareID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("share not found")
+		}
+
+		log.Error().Str("location", "GetShare").Msgf("%v: %v", shareID, err)
+		return nil, err
+	}
+
+	return share, nil
+}
+
+func (r *repository) LockShare(ctx context.Context, tx pgx.Tx, shareID uuid.UUID) (*Share, error) {
+	share := &Share{}
+	if err := share.Scan(tx.QueryRow(ctx, LockShareQuery, shareID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("share not found")
+		}
+
+		log.Error().Str("location", "LockShare").Msgf("%v: %v", shareID, err)
+		return nil, err
+	}
+
+	return share, nil
+}
+
+// Retrieves every share the user owns.
+func (r *repository) GetShares(ctx context.Context, ownerID uuid.UUID) ([]*Share, error) {
+	return r.queryShares(ctx, "GetShares", ownerID, GetOwnedSharesQuery, ownerID)
+}
+
+// Retrieves a page of the shares the user owns, or is a member of when received.
+func (r *repository) ListShares(ctx context.Context, userID uuid.UUID, received bool, params *pagination.Params) ([]*Share, error) {
+	query := ListOwnedSharesQuery
+	switch {
+	case received && params.Descending():
+		query = ListReceivedSharesDescQuery
+	case received:
+		query = ListReceivedSharesQuery
+	case params.Descending():
+		query = ListOwnedSharesDescQuery
+	}
+
+	return r.queryShares(ctx, "ListShares", userID, query, userID, params.BoundaryValue(), params.Boundary(), params.Fetch())
+}
+
+// helper: queryShares runs a query returning shares.
+func (r *repository) queryShares(ctx context.Context, location string, userID uuid.UUID, query string, args ...any) ([]*Share, error) {
+	rows, err := r.postgres.Query(ctx, query, args...)
+	if err != nil {
+		log.Error().Str("location", location).Msgf("%v: %v", userID, err)
+		return nil, err
+	}
+
+	shares := []*Share{}
+	for rows.Next() {
+		share := &Share{}
+		if err := share.Scan(rows); err != nil {
+			log.Error().Str("location", location).Msgf("%v: %v", userID, err)
+			return nil, err
+		}
+
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
+func (r *repository) UpdateShareKey(ctx context.Context, tx pgx.Tx, share *Share) error {
+	if _, err := tx.Exec(ctx, UpdateShareKeyQuery, share.ShareID, share.OwnerKey, share.KeyVersion); err != nil {
+		log.Error().Str("location", "UpdateShareKey").Msgf("%v: %v", share.ShareID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Deletes the share along with its members and copies.
+func (r *repository) DeleteShare(ctx context.Context, tx pgx.Tx, shareID uuid.UUID) error {
+	for _, query := range []string{DeleteSharedPasswordsQuery, DeleteShareMembersQuery, DeleteShareQuery} {
+		if _, err := tx.Exec(ctx, query, shareID); err != nil {
+			log.Error().Str("location", "DeleteShare").Msgf("%v: %v", shareID, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *repository) UpsertShareMember(ctx context.Context, tx pgx.Tx, shareID uuid.UUID, member *ShareMember) error {
+	_, err := tx.Exec(ctx, UpsertShareMemberQuery, shareID, member.RecipientID, member.Permission, member.SealedKey, member.Created)
+	if err != nil {
+		log.Error().Str("location", "UpsertShareMember").Msgf("%v: %v", shareID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) GetShareMembers(ctx context.Context, tx pgx.Tx, shareID uuid.UUID) ([]*ShareMember, error) {
+	var rows pgx.Rows
+	var err error
+	if tx != nil {
+		rows, err = tx.Query(ctx, GetShareMembersQuery, shareID)
+	} else {
+		rows, err = r.postgres.Query(ctx, GetShareMembersQuery, shareID)
+	}
+
+	if err != nil {
+		log.Error().Str("location", "GetShareMembers").Msgf("%v: %v", shareID, err)
+		return nil, err
+	}
+
+	members := []*ShareMember{}
+	for rows.Next() {
+		member := &ShareMember{}
+		if err := member.Scan(rows); err != nil {
+			log.Error().Str("location", "GetShareMembers").Msgf("%v: %v", shareID, err)
+			return nil, err
+		}
+
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+func (r *repository) GetShareMember(ctx context.Context, shareID, recipientID uuid.UUID) (*ShareMember, error) {
+	member := &ShareMember{}
+	if err := member.Scan(r.postgres.QueryRow(ctx, GetShareMemberQuery, shareID, recipientID)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, apiutils.NewErrNotFound("share not found")
+		}
+
+		log.Error().Str("location", "GetShareMember").Msgf("%v: %v", shareID, err)
+		return nil, err
+	}
+
+	return member, nil
+}
+
+func (r *repository) DeleteShareMember(ctx context.Context, tx pgx.Tx, shareID, recipientID uuid.UUID) error {
+	tag, err := tx.Exec(ctx, DeleteShareMemberQuery, shareID, recipientID)
+	if err != nil {
+		log.Error().Str("location", "DeleteShareMember").Msgf("%v: %v", shareID, err)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return apiutils.NewErrNotFound("share member not found")
+	}
+
+	return nil
+}
+
+// Replaces the copies of the share with the given ones.
+func (r *repository) ReplaceSharedPasswords(ctx context.Context, tx pgx.Tx, shareID uuid.UUID, copies []*passwords.PasswordEncrypt) error {
+	if _, err := tx.Exec(ctx, DeleteSharedPasswordsQuery, shareID); err != nil {
+		log.Error().Str("location", "ReplaceSharedPasswords").Msgf("%v: %v", shareID, err)
+		return err
+	}
+
+	for _, data := range copies {
+		_, err := tx.Exec(ctx, CreateSharedPasswordQuery,
+			shareID,
+			data.PasswordID,
+			data.UserID,
+			data.CategoryID,
+			data.Website,
+			data.Nonce,
+			data.Encrypted,
+			data.KeyVersion,
+			data.Updated,
+		)
+
+		if err != nil {
+			log.Error().Str("location", "ReplaceSharedPasswords").Msgf("%v: %v", shareID, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *repository) GetSharedPasswords(ctx context.Context, shareID uuid.UUID) ([]*passwords.PasswordEncrypt, error) {
+	rows, err := r.postgres.Query(ctx, GetSharedPasswordsQuery, shareID)
+	if err != nil {
+		log.Error().Str("location", "GetSharedPasswords").Msgf("%v: %v", shareID, err)
+		return nil, err
+	}
+
+	copies := []*passwords.PasswordEncrypt{}
+	for rows.Next() {
+		data := &passwords.PasswordEncrypt{}
+		if err := data.Scan(rows); err != nil {
+			log.Error().Str("location", "GetSharedPasswords").Msgf("%v: %v", shareID, err)
+			return nil, err
+		}
+
+		copies = append(copies, data)
+	}
+
+	return copies, nil
+}
+
+// Checks if the user owns any share.
+func (r *repository) HasShares(ctx context.Context, ownerID uuid.UUID) (bool, error) {
+	exists := false
+	if err := r.postgres.QueryRow(ctx, HasSharesQuery, ownerID).Scan(&exists); err != nil {
+		log.Error().Str("location", "HasShares").Msgf("%v: %v", ownerID, err)
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *repository) QueueSync(ctx context.Context, sync *ShareSync) error {
+	_, err := r.postgres.Exec(ctx, QueueShareSyncQuery,
+		sync.SyncID,
+		sync.OwnerID,
+		sync.PasswordIDs,
+		sync.CategoryIDs,
+		sync.Queued,
+	)
+
+	if err != nil {
+		log.Error().Str("location", "QueueSync").Msgf("%v: %v", sync.OwnerID, err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves and locks the queued writes of the owner with the oldest write, none when the queue is empty.
+func (r *repository) ClaimSyncs(ctx context.Context, tx pgx.Tx) ([]*ShareSync, error) {
+	rows, err := tx.Query(ctx, ClaimShareSyncsQuery)
+	if err != nil {
+		log.Error().Str("location", "ClaimSyncs").Msg(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	syncs := []*ShareSync{}
+	for rows.Next() {
+		sync := &ShareSync{}
+		if err := sync.Scan(rows); err != nil {
+			log.Error().Str("location", "ClaimSyncs").Msg(err.Error())
+			return nil, err
+		}
+
+		syncs = append(syncs, sync)
+	}
+
+	return syncs, rows.Err()
+}
+
+func (r *repository) RetrySync(ctx context.Context, tx pgx.Tx, sync *ShareSync) error {
+	if _, err := tx.Exec(ctx, RetryShareSyncQuery, sync.SyncID, sync.Attempts, sync.RetryAt); err != nil {
+		log.Error().Str("location", "RetrySync").Msgf("%v: %v", sync.OwnerID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteSyncs(ctx context.Context, tx pgx.Tx, syncIDs []uuid.UUID) error {
+	if _, err := tx.Exec(ctx, DeleteShareSyncsQuery, syncIDs); err != nil {
+		log.Error().Str("location", "DeleteSyncs").Msg(err.Error())
+		return err
+	}
+
+	return nil
+}
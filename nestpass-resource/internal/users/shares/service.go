@@ -0,0 +1,765 @@
+package shares
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/users/categories"
+	"nestpass/internal/users/passwords"
+	"nestpass/pkg/pagination"
+)
+
+// Shares give other users copies of an entry, or of every entry below a category, encrypted
+// with a random share key. The share key is sealed to the keypair of the owner and of each
+// member, so sharing never needs the recipient's password. Every write to the owner's entries,
+// by the owner or by a member, queues a rebuild of the shares covering them, which a background
+// worker runs off the request path, so listing a share only reads it. Revoking a member rotates
+// the share key and re-encrypts the copies.
+
+// size of a share key, AES-256
+const shareKeySize = 32
+
+// how often the queue is looked at without a write waking the worker, picks up writes queued by
+// other instances or before a restart
+const shareSyncInterval = time.Minute
+
+// longest a write whose shares keep failing to rebuild waits before it is retried, the wait
+// doubles from shareSyncInterval with each failure
+const shareSyncMaxBackoff = time.Hour
+
+// vault reaches the owner's entries and the keypairs share keys are sealed to, implemented by the passwords package.
+type vault interface {
+	OnWrite(hook passwords.WriteHook)
+	EnsureKeyPair(ctx context.Context, userID uuid.UUID) error
+	SealToUser(ctx context.Context, userID uuid.UUID, key, aad []byte) ([]byte, error)
+	OpenAsUser(ctx context.Context, userID uuid.UUID, sealed, aad []byte) ([]byte, error)
+	LockVault(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID) (*passwords.Vault, error)
+	PrepareVault(ctx context.Context, ownerID uuid.UUID) error
+	SharedEntries(ctx context.Context, ownerID uuid.UUID, passwordID *uuid.UUID, categoryIDs []uuid.UUID) ([]*passwords.Password, error)
+	WriteShared(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID, psw *passwords.Password) error
+}
+
+// Category tree a shared category is resolved in.
+type categoryStore interface {
+	GetSubtree(ctx context.Context, userID uuid.UUID, categoryID *uuid.UUID, depth int) ([]*categories.Category, error)
+}
+
+// categoryWrites reports writes moving the owner's entries between categories, implemented by the categories package.
+type categoryWrites interface {
+	OnWrite(hook categories.WriteHook)
+}
+
+type service struct {
+	repo       *repository
+	vault      vault
+	categories categoryStore
+	wake       chan struct{} // signals the sync worker a write was queued
+}
+
+func NewService(repo *repository, vault vault, categories categoryStore) *service {
+	return &service{repo: repo, vault: vault, categories: categories, wake: make(chan struct{}, 1)}
+}
+
+// helper: shareAAD binds a sealed share key to the share and the user it is sealed to.
+func shareAAD(shareID, userID uuid.UUID) []byte {
+	return append(shareID[:], userID[:]...)
+}
+
+// helper: newShareKey generates a random share key.
+func newShareKey() ([]byte, error) {
+	key := make([]byte, shareKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		log.Error().Str("location", "newShareKey").Msg(err.Error())
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Shares the entry, or the category when no entry is given, with the user registered under the
+// email. Sharing again with a member updates its permission.
+func (s *service) Share(ctx context.Context, ownerID uuid.UUID, req *ShareRequest) (*Share, error) {
+	recipientID, err := s.repo.GetUserIDByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if recipientID == ownerID {
+		return nil, apiutils.NewErrBadRequest("entries can not be shared with their owner")
+	}
+
+	// keypairs are created behind a vault lock of their own, before the owner's vault is locked
+	if err := s.vault.EnsureKeyPair(ctx, recipientID); err != nil {
+		return nil, err
+	}
+
+	if err := s.vault.EnsureKeyPair(ctx, ownerID); err != nil {
+		return nil, err
+	}
+
+	// the shared object has to exist when it is shared, afterwards it may go away
+	if req.PasswordID != nil {
+		entries, err := s.vault.SharedEntries(ctx, ownerID, req.PasswordID, []uuid.UUID{req.CategoryID})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entries) == 0 {
+			return nil, apiutils.NewErrNotFound("password not found")
+		}
+	} else {
+		tree, err := s.categories.GetSubtree(ctx, ownerID, &req.CategoryID, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tree) == 0 {
+			return nil, apiutils.NewErrNotFound("category not found")
+		}
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "Share").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// the mode can not change while the copies are written
+	if _, err := s.vault.LockVault(ctx, tx, ownerID); err != nil {
+		return nil, err
+	}
+
+	share, err := s.repo.FindShare(ctx, tx, ownerID, req.PasswordID, req.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	if share == nil {
+		if key, err = newShareKey(); err != nil {
+			return nil, err
+		}
+
+		share = &Share{ShareID: uuid.New(), OwnerID: ownerID, PasswordID: req.PasswordID, CategoryID: req.CategoryID, KeyVersion: 1, Created: time.Now()}
+		if share.OwnerKey, err = s.vault.SealToUser(ctx, ownerID, key, shareAAD(share.ShareID, ownerID)); err != nil {
+			return nil, err
+		}
+
+		if err := s.repo.CreateShare(ctx, tx, share); err != nil {
+			return nil, err
+		}
+	} else if key, err = s.ownerKey(ctx, share); err != nil {
+		return nil, err
+	}
+
+	member := &ShareMember{RecipientID: recipientID, Email: req.Email, Permission: req.Permission, Created: time.Now()}
+	if member.SealedKey, err = s.vault.SealToUser(ctx, recipientID, key, shareAAD(share.ShareID, recipientID)); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpsertShareMember(ctx, tx, share.ShareID, member); err != nil {
+		return nil, err
+	}
+
+	if err := s.syncShare(ctx, tx, share, key); err != nil {
+		return nil, err
+	}
+
+	if share.Members, err = s.repo.GetShareMembers(ctx, tx, share.ShareID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "Share").Msgf("%v: %v", ownerID, err)
+		return nil, err
+	}
+
+	log.Info().Str("location", "Share").Msgf("%v: share %v granted %v to %v", ownerID, share.ShareID, req.Permission, recipientID)
+	return share, nil
+}
+
+// helper: ownerKey opens the share key sealed to the owner.
+func (s *service) ownerKey(ctx context.Context, share *Share) ([]byte, error) {
+	return s.vault.OpenAsUser(ctx, share.OwnerID, share.OwnerKey, shareAAD(share.ShareID, share.OwnerID))
+}
+
+// helper: sharedCategories returns the categories the share covers, a shared category takes its
+// whole subtree along.
+func (s *service) sharedCategories(ctx context.Context, share *Share) ([]uuid.UUID, error) {
+	if share.PasswordID != nil {
+		return []uuid.UUID{share.CategoryID}, nil
+	}
+
+	tree, err := s.categories.GetSubtree(ctx, share.OwnerID, &share.CategoryID, categories.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	categoryIDs := []uuid.UUID{}
+	for _, category := range categories.Flatten(tree) {
+		categoryIDs = append(categoryIDs, category.CategoryID)
+	}
+
+	return categoryIDs, nil
+}
+
+// helper: syncShare rebuilds the copies of the share from the owner's active entries.
+func (s *service) syncShare(ctx context.Context, tx pgx.Tx, share *Share, key []byte) error {
+	categoryIDs, err := s.sharedCategories(ctx, share)
+	if err != nil {
+		return err
+	}
+
+	entries, err := s.vault.SharedEntries(ctx, share.OwnerID, share.PasswordID, categoryIDs)
+	if err != nil {
+		return err
+	}
+
+	copies, err := shareCopies(share, key, entries)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.ReplaceSharedPasswords(ctx, tx, share.ShareID, copies)
+}
+
+// helper: shareCopies encrypts the shared entries with the share key.
+func shareCopies(share *Share, key []byte, entries []*passwords.Password) ([]*passwords.PasswordEncrypt, error) {
+	copies := []*passwords.PasswordEncrypt{}
+	for _, psw := range entries {
+		data, err := passwords.NewPasswordEncrypt(psw, key)
+		if err != nil {
+			return nil, err
+		}
+
+		data.KeyVersion, data.Updated = share.KeyVersion, psw.Updated
+		copies = append(copies, data)
+	}
+
+	return copies, nil
+}
+
+// helper: refreshShare rebuilds the copies of the share under its lock.
+func (s *service) refreshShare(ctx context.Context, share *Share) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "refreshShare").Msgf("%v: %v", share.ShareID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := s.vault.LockVault(ctx, tx, share.OwnerID); err != nil {
+		return err
+	}
+
+	// the share key may have been rotated since the share was listed
+	if share, err = s.repo.LockShare(ctx, tx, share.ShareID); err != nil {
+		return err
+	}
+
+	key, err := s.ownerKey(ctx, share)
+	if err != nil {
+		return err
+	}
+
+	if err := s.syncShare(ctx, tx, share, key); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "refreshShare").Msgf("%v: %v", share.ShareID, err)
+		return err
+	}
+
+	return nil
+}
+
+// helper: queueSync queues the rebuild of the shares covering a committed write to the owner's
+// entries and wakes the worker, owners without shares queue nothing. A write failing to queue is
+// logged and its shares catch up with the next write.
+func (s *service) queueSync(ctx context.Context, ownerID uuid.UUID, passwordIDs, categoryIDs []uuid.UUID) {
+	if len(passwordIDs) == 0 && len(categoryIDs) == 0 {
+		return
+	}
+
+	shared, err := s.repo.HasShares(ctx, ownerID)
+	if err != nil || !shared {
+		return
+	}
+
+	sync := &ShareSync{
+		SyncID:      uuid.New(),
+		OwnerID:     ownerID,
+		PasswordIDs: append([]uuid.UUID{}, passwordIDs...),
+		CategoryIDs: append([]uuid.UUID{}, categoryIDs...),
+		Queued:      time.Now(),
+	}
+
+	if err := s.repo.QueueSync(ctx, sync); err != nil {
+		return
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// helper: queueCategorySync queues the rebuild of the shares covering a write to the owner's categories.
+func (s *service) queueCategorySync(ctx context.Context, ownerID uuid.UUID, categoryIDs []uuid.UUID) {
+	s.queueSync(ctx, ownerID, nil, categoryIDs)
+}
+
+// Rebuilds the shares covering queued writes until the context ends, woken by every queued write
+// and each shareSyncInterval.
+func (s *service) RunSyncs(ctx context.Context) {
+	ticker := time.NewTicker(shareSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		processed, err := s.ProcessSyncs(ctx)
+		if err != nil {
+			log.Error().Str("location", "RunSyncs").Msgf("failed to process share syncs: %v", err)
+		} else if processed > 0 {
+			log.Info().Str("location", "RunSyncs").Msgf("%v queued writes synced to their shares", processed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Processes the due writes an owner at a time until none is left, returning how many writes
+// were synced to their shares.
+func (s *service) ProcessSyncs(ctx context.Context) (int, error) {
+	synced := 0
+	for {
+		claimed, n, err := s.processOwnerSyncs(ctx)
+		if err != nil || claimed == 0 {
+			return synced, err
+		}
+
+		synced += n
+	}
+}
+
+// helper: processOwnerSyncs claims the due writes of one owner and rebuilds each share covering
+// any of them once, returning how many writes were claimed and how many synced. A write stays
+// queued while a share covering it fails to rebuild and is retried with a growing delay.
+func (s *service) processOwnerSyncs(ctx context.Context) (int, int, error) {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "processOwnerSyncs").Msg(err.Error())
+		return 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	syncs, err := s.repo.ClaimSyncs(ctx, tx)
+	if err != nil || len(syncs) == 0 {
+		return 0, 0, err
+	}
+
+	ownerID := syncs[0].OwnerID
+	shares, err := s.repo.GetShares(ctx, ownerID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	failed := map[uuid.UUID]bool{}
+	for _, share := range shares {
+		covered, err := s.coveredSyncs(ctx, share, syncs)
+		if err == nil && len(covered) > 0 {
+			err = s.refreshShare(ctx, share)
+		}
+
+		if err != nil {
+			log.Error().Str("location", "processOwnerSyncs").Msgf("%v: failed to rebuild share %v: %v", ownerID, share.ShareID, err)
+
+			// a share whose subtree could not be resolved may cover any of the writes
+			if covered == nil {
+				covered = syncs
+			}
+
+			for _, sync := range covered {
+				failed[sync.SyncID] = true
+			}
+		}
+	}
+
+	syncIDs := []uuid.UUID{}
+	for _, sync := range syncs {
+		if !failed[sync.SyncID] {
+			syncIDs = append(syncIDs, sync.SyncID)
+			continue
+		}
+
+		sync.Attempts++
+		sync.RetryAt = time.Now().Add(syncBackoff(sync.Attempts))
+		if err := s.repo.RetrySync(ctx, tx, sync); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err := s.repo.DeleteSyncs(ctx, tx, syncIDs); err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "processOwnerSyncs").Msgf("%v: %v", ownerID, err)
+		return 0, 0, err
+	}
+
+	return len(syncs), len(syncIDs), nil
+}
+
+// helper: syncBackoff returns how long a write waits after its shares failed to rebuild attempts times.
+func syncBackoff(attempts int) time.Duration {
+	backoff := shareSyncInterval
+	for i := 1; i < attempts && backoff < shareSyncMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, shareSyncMaxBackoff)
+}
+
+// helper: coveredSyncs returns the writes touching an entry the share holds, the subtree of a
+// shared category is only looked up when its entries were not written directly.
+func (s *service) coveredSyncs(ctx context.Context, share *Share, syncs []*ShareSync) ([]*ShareSync, error) {
+	covered := []*ShareSync{}
+	uncovered := []*ShareSync{}
+	for _, sync := range syncs {
+		if coveredBy(share, nil, sync) {
+			covered = append(covered, sync)
+		} else {
+			uncovered = append(uncovered, sync)
+		}
+	}
+
+	if share.PasswordID != nil || len(uncovered) == 0 {
+		return covered, nil
+	}
+
+	categoryIDs, err := s.sharedCategories(ctx, share)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sync := range uncovered {
+		if coveredBy(share, categoryIDs, sync) {
+			covered = append(covered, sync)
+		}
+	}
+
+	return covered, nil
+}
+
+// helper: coveredBy checks the share against a write. An entry share holds its entry, which
+// writes to its category touch as well, a category share every entry filed in its subtree. The
+// shared category itself always counts, its subtree is gone once it is trashed.
+func coveredBy(share *Share, subtree []uuid.UUID, sync *ShareSync) bool {
+	if share.PasswordID != nil && slices.Contains(sync.PasswordIDs, *share.PasswordID) {
+		return true
+	}
+
+	if slices.Contains(sync.CategoryIDs, share.CategoryID) && (share.PasswordID == nil || len(sync.PasswordIDs) == 0) {
+		return true
+	}
+
+	return share.PasswordID == nil && slices.ContainsFunc(sync.CategoryIDs, func(categoryID uuid.UUID) bool {
+		return slices.Contains(subtree, categoryID)
+	})
+}
+
+// Lists the shares the user owns with their members.
+func (s *service) GetShares(ctx context.Context, ownerID uuid.UUID, params *pagination.Params) (*pagination.Page[*Share], error) {
+	shares, err := s.repo.ListShares(ctx, ownerID, false, params)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := pagination.NewPage(params, shares, shareCursor)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, share := range page.Items {
+		if share.Members, err = s.repo.GetShareMembers(ctx, nil, share.ShareID); err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// helper: shareCursor returns the keyset position of a share in a listing.
+func shareCursor(share *Share) (string, uuid.UUID) {
+	return share.Created.Format(time.RFC3339Nano), share.ShareID
+}
+
+// Lists the shares the user is a member of with their entries decrypted.
+func (s *service) SharedWithMe(ctx context.Context, userID uuid.UUID, params *pagination.Params) (*pagination.Page[*SharedWithMe], error) {
+	shares, err := s.repo.ListShares(ctx, userID, true, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// the page is cut from the shares, so skipping one does not shift the cursors
+	page, err := pagination.NewPage(params, shares, shareCursor)
+	if err != nil {
+		return nil, err
+	}
+
+	received := &pagination.Page[*SharedWithMe]{Items: []*SharedWithMe{}, Next: page.Next, Prev: page.Prev, HasMore: page.HasMore}
+
+	// the copies are kept current by the writes, a share that fails to open is left out
+	for _, share := range page.Items {
+		entries, member, err := s.openShare(ctx, share, userID)
+		if err != nil {
+			log.Error().Str("location", "SharedWithMe").Msgf("%v: skipped share %v: %v", userID, share.ShareID, err)
+			continue
+		}
+
+		received.Items = append(received.Items, &SharedWithMe{
+			ShareID:    share.ShareID,
+			OwnerID:    share.OwnerID,
+			PasswordID: share.PasswordID,
+			CategoryID: share.CategoryID,
+			Permission: member.Permission,
+			Entries:    entries,
+		})
+	}
+
+	return received, nil
+}
+
+// helper: openShare decrypts the copies of the share with the key sealed to the member.
+func (s *service) openShare(ctx context.Context, share *Share, userID uuid.UUID) ([]*passwords.Password, *ShareMember, error) {
+	member, err := s.repo.GetShareMember(ctx, share.ShareID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := s.vault.OpenAsUser(ctx, userID, member.SealedKey, shareAAD(share.ShareID, userID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	copies, err := s.repo.GetSharedPasswords(ctx, share.ShareID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries, err := openCopies(share, key, copies)
+	if err != nil {
+		log.Error().Str("location", "openShare").Msgf("%v: failed to decrypt share %v: %v", userID, share.ShareID, err)
+		return nil, nil, err
+	}
+
+	return entries, member, nil
+}
+
+// helper: openCopies decrypts the copies of the share with the share key.
+func openCopies(share *Share, key []byte, copies []*passwords.PasswordEncrypt) ([]*passwords.Password, error) {
+	entries := []*passwords.Password{}
+	for _, data := range copies {
+		psw, err := data.Decrypt(share.OwnerID, key)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, psw)
+	}
+
+	return entries, nil
+}
+
+// Writes a shared entry through to the owner's vault, the member needs read-write permission.
+func (s *service) UpdateShared(ctx context.Context, userID, shareID uuid.UUID, psw *passwords.Password) error {
+	// members only learn about the shares they are part of
+	if _, err := s.repo.GetShareMember(ctx, shareID, userID); err != nil {
+		return err
+	}
+
+	share, err := s.repo.GetShare(ctx, shareID)
+	if err != nil {
+		return err
+	}
+
+	// migrate legacy vaults before the lock is taken
+	if err := s.vault.PrepareVault(ctx, share.OwnerID); err != nil {
+		return err
+	}
+
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "UpdateShared").Msgf("%v: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// the owner's vault is locked before the share, as everywhere else
+	if _, err := s.vault.LockVault(ctx, tx, share.OwnerID); err != nil {
+		return err
+	}
+
+	if share, err = s.repo.LockShare(ctx, tx, shareID); err != nil {
+		return err
+	}
+
+	// the permission is checked under the share lock, a concurrent revoke or downgrade wins
+	member, err := s.repo.GetShareMember(ctx, shareID, userID)
+	if err != nil {
+		return err
+	}
+
+	copies, err := s.repo.GetSharedPasswords(ctx, shareID)
+	if err != nil {
+		return err
+	}
+
+	shared, err := writableCopy(member, copies, psw.PasswordID)
+	if err != nil {
+		return err
+	}
+
+	// members edit the content, the entry stays where the owner filed it
+	psw.CategoryID = shared.CategoryID
+	if err := s.vault.WriteShared(ctx, tx, share.OwnerID, psw); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "UpdateShared").Msgf("%v: %v", userID, err)
+		return err
+	}
+
+	// this share and any other of the owner holding the entry are rebuilt in the background
+	s.queueSync(ctx, share.OwnerID, []uuid.UUID{psw.PasswordID}, []uuid.UUID{psw.CategoryID})
+	return nil
+}
+
+// helper: writableCopy finds the shared copy of the entry the member may write through.
+func writableCopy(member *ShareMember, copies []*passwords.PasswordEncrypt, passwordID uuid.UUID) (*passwords.PasswordEncrypt, error) {
+	if member.Permission != ShareReadWrite {
+		return nil, apiutils.NewErrForbidden("share is read only")
+	}
+
+	for _, data := range copies {
+		if data.PasswordID == passwordID {
+			return data, nil
+		}
+	}
+
+	return nil, apiutils.NewErrNotFound("entry is not part of the share")
+}
+
+// Removes the member from the share, or deletes the share when no member is given. Remaining
+// members get a new share key and the copies are re-encrypted with it, so the key the revoked
+// member held opens nothing that is still shared.
+func (s *service) RevokeShare(ctx context.Context, ownerID, shareID uuid.UUID, recipientID *uuid.UUID) error {
+	tx, err := s.repo.postgres.Begin(ctx)
+	if err != nil {
+		log.Error().Str("location", "RevokeShare").Msgf("%v: %v", ownerID, err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := s.vault.LockVault(ctx, tx, ownerID); err != nil {
+		return err
+	}
+
+	share, err := s.repo.LockShare(ctx, tx, shareID)
+	if err != nil {
+		return err
+	}
+
+	if share.OwnerID != ownerID {
+		return apiutils.NewErrNotFound("share not found")
+	}
+
+	if err := s.revokeMember(ctx, tx, share, recipientID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Str("location", "RevokeShare").Msgf("%v: %v", ownerID, err)
+		return err
+	}
+
+	log.Info().Str("location", "RevokeShare").Msgf("%v: share %v revoked", ownerID, shareID)
+	return nil
+}
+
+// helper: revokeMember removes the member and rotates the share key for the remaining ones.
+func (s *service) revokeMember(ctx context.Context, tx pgx.Tx, share *Share, recipientID *uuid.UUID) error {
+	if recipientID == nil {
+		return s.repo.DeleteShare(ctx, tx, share.ShareID)
+	}
+
+	if err := s.repo.DeleteShareMember(ctx, tx, share.ShareID, *recipientID); err != nil {
+		return err
+	}
+
+	members, err := s.repo.GetShareMembers(ctx, tx, share.ShareID)
+	if err != nil {
+		return err
+	}
+
+	if len(members) == 0 {
+		return s.repo.DeleteShare(ctx, tx, share.ShareID)
+	}
+
+	key, err := rotateShareKey(share, members, func(userID uuid.UUID, key, aad []byte) ([]byte, error) {
+		return s.vault.SealToUser(ctx, userID, key, aad)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdateShareKey(ctx, tx, share); err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if err := s.repo.UpsertShareMember(ctx, tx, share.ShareID, member); err != nil {
+			return err
+		}
+	}
+
+	return s.syncShare(ctx, tx, share, key)
+}
+
+// helper: rotateShareKey replaces the share key with a new version sealed to the owner and to
+// each remaining member, returning the new key.
+func rotateShareKey(share *Share, members []*ShareMember, seal func(userID uuid.UUID, key, aad []byte) ([]byte, error)) ([]byte, error) {
+	key, err := newShareKey()
+	if err != nil {
+		return nil, err
+	}
+
+	share.KeyVersion++
+	if share.OwnerKey, err = seal(share.OwnerID, key, shareAAD(share.ShareID, share.OwnerID)); err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		if member.SealedKey, err = seal(member.RecipientID, key, shareAAD(share.ShareID, member.RecipientID)); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
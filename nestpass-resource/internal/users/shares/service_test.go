@@ -0,0 +1,299 @@
+package shares
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tuan882612/apiutils"
+
+	"nestpass/internal/databases/pgtest"
+	"nestpass/internal/users/categories"
+	"nestpass/internal/users/passwords"
+)
+
+// fakeCategories serves a category tree nested the way the category service lists it.
+type fakeCategories struct {
+	nodes []*categories.Category
+}
+
+func (f *fakeCategories) GetSubtree(ctx context.Context, userID uuid.UUID, categoryID *uuid.UUID, depth int) ([]*categories.Category, error) {
+	return categories.BuildTree(f.nodes), nil
+}
+
+// helper: newShareFixture creates a share of a category holding two entries of its owner.
+func newShareFixture(t *testing.T) (*Share, []*passwords.Password) {
+	t.Helper()
+
+	share := &Share{ShareID: uuid.New(), OwnerID: uuid.New(), CategoryID: uuid.New(), KeyVersion: 1}
+	entries := []*passwords.Password{}
+	for _, secret := range []string{"first", "second"} {
+		entries = append(entries, &passwords.Password{PasswordID: uuid.New(), UserID: share.OwnerID, CategoryID: share.CategoryID, Website: "example.com", Type: passwords.ItemLogin, Login: &passwords.Login{Username: "user", Password: secret}})
+	}
+
+	return share, entries
+}
+
+func Test_ShareCopies(t *testing.T) {
+	share, entries := newShareFixture(t)
+	key, _ := newShareKey()
+
+	copies, err := shareCopies(share, key, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(copies) != 2 || copies[0].PasswordID != entries[0].PasswordID || copies[0].KeyVersion != 1 {
+		t.Fatalf("shareCopies() = %d copies, want one per entry", len(copies))
+	}
+
+	opened, err := openCopies(share, key, copies)
+	if err != nil || len(opened) != 2 || opened[1].Login.Password != "second" {
+		t.Fatalf("openCopies() = %v, %v", opened, err)
+	}
+
+	other, _ := newShareKey()
+	if _, err := openCopies(share, other, copies); err == nil {
+		t.Fatal("copies opened with another key")
+	}
+}
+
+func Test_RotateShareKeyOnRevoke(t *testing.T) {
+	share, entries := newShareFixture(t)
+	revokedKey, _ := newShareKey()
+
+	// keys are sealed by the vault, here they are kept as is to check who got which
+	sealed := map[uuid.UUID][]byte{}
+	seal := func(userID uuid.UUID, key, aad []byte) ([]byte, error) {
+		if !bytes.Equal(aad, shareAAD(share.ShareID, userID)) {
+			t.Fatalf("key for %v sealed with the wrong aad", userID)
+		}
+
+		sealed[userID] = key
+		return key, nil
+	}
+
+	// the revoked member is gone, the remaining one gets the new key
+	kept := &ShareMember{RecipientID: uuid.New(), Permission: ShareRead}
+	key, err := rotateShareKey(share, []*ShareMember{kept}, seal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if share.KeyVersion != 2 {
+		t.Fatalf("key version = %d, want 2", share.KeyVersion)
+	}
+
+	if !bytes.Equal(sealed[share.OwnerID], key) || !bytes.Equal(kept.SealedKey, key) || len(sealed) != 2 {
+		t.Fatal("rotated key not sealed to the owner and the remaining member")
+	}
+
+	// the copies re-encrypted with the new key are out of reach of the revoked member's key
+	copies, err := shareCopies(share, key, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if copies[0].KeyVersion != 2 {
+		t.Fatalf("copy key version = %d, want 2", copies[0].KeyVersion)
+	}
+
+	if _, err := openCopies(share, revokedKey, copies); err == nil {
+		t.Fatal("revoked key opened the rotated copies")
+	}
+}
+
+func Test_WritableCopy(t *testing.T) {
+	share, entries := newShareFixture(t)
+	key, _ := newShareKey()
+	copies, err := shareCopies(share, key, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := &ShareMember{RecipientID: uuid.New(), Permission: ShareRead}
+	if _, err := writableCopy(reader, copies, copies[0].PasswordID); err == nil {
+		t.Fatal("read only member allowed to write")
+	} else if _, ok := err.(apiutils.ErrForbidden); !ok {
+		t.Fatalf("writableCopy() error = %v, want forbidden", err)
+	}
+
+	writer := &ShareMember{RecipientID: uuid.New(), Permission: ShareReadWrite}
+	if shared, err := writableCopy(writer, copies, copies[1].PasswordID); err != nil || shared != copies[1] {
+		t.Fatalf("writableCopy() = %v, %v", shared, err)
+	}
+
+	// entries of the owner outside the share stay out of reach
+	if _, err := writableCopy(writer, copies, uuid.New()); err == nil {
+		t.Fatal("member allowed to write an entry outside the share")
+	} else if _, ok := err.(apiutils.ErrNotFound); !ok {
+		t.Fatalf("writableCopy() error = %v, want not found", err)
+	}
+}
+
+func Test_SharedCategories(t *testing.T) {
+	share, _ := newShareFixture(t)
+	root := &categories.Category{CategoryID: share.CategoryID, UserID: share.OwnerID}
+	child := &categories.Category{CategoryID: uuid.New(), UserID: share.OwnerID, ParentID: &root.CategoryID, Depth: 1}
+	grandchild := &categories.Category{CategoryID: uuid.New(), UserID: share.OwnerID, ParentID: &child.CategoryID, Depth: 2}
+	svc := &service{categories: &fakeCategories{nodes: []*categories.Category{root, child, grandchild}}}
+
+	// a shared category takes every level below it along
+	categoryIDs, err := svc.sharedCategories(context.Background(), share)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(categoryIDs) != 3 || categoryIDs[0] != root.CategoryID || categoryIDs[1] != child.CategoryID || categoryIDs[2] != grandchild.CategoryID {
+		t.Fatalf("sharedCategories() = %v, want the category and both levels below it", categoryIDs)
+	}
+
+	// an entry share stays in the category the entry is filed in
+	share.PasswordID = &uuid.UUID{}
+	if categoryIDs, err = svc.sharedCategories(context.Background(), share); err != nil || len(categoryIDs) != 1 || categoryIDs[0] != share.CategoryID {
+		t.Fatalf("sharedCategories() for an entry = %v, %v", categoryIDs, err)
+	}
+}
+
+func Test_CoveredBy(t *testing.T) {
+	share, entries := newShareFixture(t)
+	child, other := uuid.New(), uuid.New()
+	subtree := []uuid.UUID{share.CategoryID, child}
+
+	entryWrite := func(passwordID, categoryID uuid.UUID) *ShareSync {
+		return &ShareSync{PasswordIDs: []uuid.UUID{passwordID}, CategoryIDs: []uuid.UUID{categoryID}}
+	}
+	categoryWrite := func(categoryIDs ...uuid.UUID) *ShareSync {
+		return &ShareSync{CategoryIDs: categoryIDs}
+	}
+
+	// a category share holds every entry filed below it, and nothing else
+	if !coveredBy(share, subtree, entryWrite(uuid.New(), child)) {
+		t.Error("category share missed a write to an entry of its subtree")
+	}
+
+	if coveredBy(share, subtree, entryWrite(uuid.New(), other)) {
+		t.Error("category share rebuilt for an entry outside its subtree")
+	}
+
+	// a trashed shared category has no subtree left, the write still names it
+	if !coveredBy(share, nil, categoryWrite(share.CategoryID)) {
+		t.Error("category share missed the write trashing its category")
+	}
+
+	// an entry share only holds its entry, writes to its neighbours leave it alone
+	share.PasswordID = &entries[0].PasswordID
+	if !coveredBy(share, nil, entryWrite(entries[0].PasswordID, share.CategoryID)) {
+		t.Error("entry share missed a write to its entry")
+	}
+
+	if coveredBy(share, nil, entryWrite(entries[1].PasswordID, share.CategoryID)) {
+		t.Error("entry share rebuilt for another entry of its category")
+	}
+
+	// moving the entry's category around touches every entry filed in it
+	if !coveredBy(share, nil, categoryWrite(other, share.CategoryID)) {
+		t.Error("entry share missed a write to its category")
+	}
+}
+
+// fakeVault hands out the owner's entries and opens every sealed share key to the same key.
+type fakeVault struct {
+	key     []byte
+	entries []*passwords.Password
+}
+
+func (f *fakeVault) OnWrite(hook passwords.WriteHook)                          {}
+func (f *fakeVault) EnsureKeyPair(ctx context.Context, userID uuid.UUID) error { return nil }
+func (f *fakeVault) PrepareVault(ctx context.Context, ownerID uuid.UUID) error { return nil }
+
+func (f *fakeVault) SealToUser(ctx context.Context, userID uuid.UUID, key, aad []byte) ([]byte, error) {
+	return key, nil
+}
+
+func (f *fakeVault) OpenAsUser(ctx context.Context, userID uuid.UUID, sealed, aad []byte) ([]byte, error) {
+	return f.key, nil
+}
+
+func (f *fakeVault) LockVault(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID) (*passwords.Vault, error) {
+	return &passwords.Vault{UserID: ownerID}, nil
+}
+
+func (f *fakeVault) SharedEntries(ctx context.Context, ownerID uuid.UUID, passwordID *uuid.UUID, categoryIDs []uuid.UUID) ([]*passwords.Password, error) {
+	return f.entries, nil
+}
+
+func (f *fakeVault) WriteShared(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID, psw *passwords.Password) error {
+	return nil
+}
+
+func Test_ProcessOwnerSyncsKeepsFailedWrites(t *testing.T) {
+	category, entries := newShareFixture(t)
+	key, _ := newShareKey()
+	ownerID := category.OwnerID
+
+	// one entry share per entry, the first can not be rebuilt
+	shareRow := func(psw *passwords.Password) []any {
+		return []any{uuid.New(), ownerID, &psw.PasswordID, psw.CategoryID, []byte("sealed"), 1, time.Now()}
+	}
+	syncRow := func(psw *passwords.Password) []any {
+		return []any{uuid.New(), ownerID, []uuid.UUID{psw.PasswordID}, []uuid.UUID{psw.CategoryID}, time.Now(), 0, time.Now()}
+	}
+
+	failing, rebuilt := shareRow(entries[0]), shareRow(entries[1])
+	failed, synced := syncRow(entries[0]), syncRow(entries[1])
+	failed[5] = 2
+
+	db := &pgtest.DB{
+		Results: map[string][][]any{
+			ClaimShareSyncsQuery: {failed, synced},
+			GetOwnedSharesQuery:  {failing, rebuilt},
+			LockShareQuery:       {rebuilt},
+		},
+		Fail: func(sql string, args []any) error {
+			if sql == LockShareQuery && args[0] == failing[0] {
+				return errors.New("lock timeout")
+			}
+			return nil
+		},
+	}
+
+	svc := NewService(&repository{postgres: db}, &fakeVault{key: key, entries: entries[1:]}, &fakeCategories{})
+	claimed, n, err := svc.processOwnerSyncs(context.Background())
+	if err != nil || claimed != 2 || n != 1 {
+		t.Fatalf("processOwnerSyncs() = %d, %d, %v, want 2 claimed and 1 synced", claimed, n, err)
+	}
+
+	// only the write whose shares were rebuilt leaves the queue
+	deleted := db.Executed(DeleteShareSyncsQuery)
+	if len(deleted) != 1 || !slices.Equal(deleted[0].Args[0].([]uuid.UUID), []uuid.UUID{synced[0].(uuid.UUID)}) {
+		t.Fatalf("deleted syncs %v, want only %v", deleted, synced[0])
+	}
+
+	// the other one waits longer with every failure
+	retried := db.Executed(RetryShareSyncQuery)
+	if len(retried) != 1 || retried[0].Args[0] != failed[0] || retried[0].Args[1] != 3 {
+		t.Fatalf("retried syncs %v, want %v on its third attempt", retried, failed[0])
+	}
+
+	if wait := time.Until(retried[0].Args[2].(time.Time)); wait < 3*shareSyncInterval || wait > 4*shareSyncInterval {
+		t.Fatalf("retry in %v, want %v", wait, 4*shareSyncInterval)
+	}
+
+	if copies := db.Executed(CreateSharedPasswordQuery); len(copies) != 1 || copies[0].Args[1] != entries[1].PasswordID {
+		t.Fatalf("rebuilt copies %v, want the second entry only", copies)
+	}
+}
+
+func Test_SyncBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: shareSyncInterval, 2: 2 * shareSyncInterval, 3: 4 * shareSyncInterval, 60: shareSyncMaxBackoff} {
+		if got := syncBackoff(attempts); got != want {
+			t.Errorf("syncBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
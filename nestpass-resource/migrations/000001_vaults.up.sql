@@ -0,0 +1,7 @@
+-- vault of each owner, the mode says who encrypts its entries
+CREATE TABLE vaults (
+	user_id     uuid PRIMARY KEY,
+	mode        text NOT NULL DEFAULT 'server' CHECK (mode IN ('server', 'client')),
+	wrapped_key bytea,
+	updated     timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1 @@
+ALTER TABLE vaults DROP COLUMN wrapped_dek;
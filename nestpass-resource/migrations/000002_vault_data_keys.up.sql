@@ -0,0 +1,3 @@
+-- data encryption key wrapped by the password derived key, vaults without one are converted
+-- from the legacy scheme on their next write
+ALTER TABLE vaults ADD COLUMN wrapped_dek bytea;
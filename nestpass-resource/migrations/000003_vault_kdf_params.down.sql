@@ -0,0 +1 @@
+ALTER TABLE vaults DROP COLUMN kdf_params;
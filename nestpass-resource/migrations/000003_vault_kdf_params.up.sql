@@ -0,0 +1,2 @@
+-- derivation of the key wrapping the data key, null for vaults still on the legacy pbkdf2 scheme
+ALTER TABLE vaults ADD COLUMN kdf_params jsonb;
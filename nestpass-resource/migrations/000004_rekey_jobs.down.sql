@@ -0,0 +1,7 @@
+DROP TABLE rekey_jobs;
+
+ALTER TABLE passwords DROP COLUMN key_version;
+
+ALTER TABLE vaults
+	DROP COLUMN key_version,
+	DROP COLUMN prev_wrapped_dek;
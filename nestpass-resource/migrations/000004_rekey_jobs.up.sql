@@ -0,0 +1,25 @@
+-- version of the vault's data key, entries record the version they are encrypted with so a
+-- rekey can tell which ones are left
+ALTER TABLE vaults
+	ADD COLUMN prev_wrapped_dek bytea,
+	ADD COLUMN key_version integer NOT NULL DEFAULT 1;
+
+ALTER TABLE passwords ADD COLUMN key_version integer NOT NULL DEFAULT 1;
+
+CREATE TABLE rekey_jobs (
+	job_id       uuid PRIMARY KEY,
+	user_id      uuid NOT NULL,
+	from_version integer NOT NULL,
+	to_version   integer NOT NULL,
+	status       text NOT NULL CHECK (status IN ('running', 'failed', 'done')),
+	total        integer NOT NULL,
+	done         integer NOT NULL DEFAULT 0,
+	error        text NOT NULL DEFAULT '',
+	started      timestamptz NOT NULL,
+	updated      timestamptz NOT NULL
+);
+
+CREATE INDEX rekey_jobs_user_id_started_idx ON rekey_jobs (user_id, started DESC);
+
+-- jobs resumed at startup
+CREATE INDEX rekey_jobs_unfinished_idx ON rekey_jobs (status) WHERE status <> 'done';
@@ -0,0 +1,6 @@
+DROP INDEX categories_sibling_name_key;
+DROP INDEX categories_root_name_key;
+
+ALTER TABLE categories DROP COLUMN parent_id;
+
+ALTER TABLE categories ADD CONSTRAINT categories_user_id_name_key UNIQUE (user_id, name);
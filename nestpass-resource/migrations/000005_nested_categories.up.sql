@@ -0,0 +1,7 @@
+ALTER TABLE categories ADD COLUMN parent_id uuid REFERENCES categories (category_id);
+
+-- names are unique among siblings instead of across the whole tree
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_user_id_name_key;
+
+CREATE UNIQUE INDEX categories_root_name_key ON categories (user_id, name) WHERE parent_id IS NULL;
+CREATE UNIQUE INDEX categories_sibling_name_key ON categories (user_id, parent_id, name) WHERE parent_id IS NOT NULL;
@@ -0,0 +1,15 @@
+-- values an entry held before each update, pruned to the newest revisions kept per entry
+CREATE TABLE password_history (
+	revision_id uuid PRIMARY KEY,
+	password_id uuid NOT NULL REFERENCES passwords (password_id),
+	user_id     uuid NOT NULL,
+	category_id uuid NOT NULL,
+	website     text NOT NULL,
+	nonce       bytea NOT NULL,
+	encrypted   bytea NOT NULL,
+	key_version integer NOT NULL,
+	created     timestamptz NOT NULL
+);
+
+CREATE INDEX password_history_password_id_created_idx ON password_history (password_id, user_id, created, revision_id);
+CREATE INDEX password_history_user_id_idx ON password_history (user_id, key_version);
@@ -0,0 +1,11 @@
+DROP INDEX categories_sibling_name_key;
+DROP INDEX categories_root_name_key;
+
+CREATE UNIQUE INDEX categories_root_name_key ON categories (user_id, name) WHERE parent_id IS NULL;
+CREATE UNIQUE INDEX categories_sibling_name_key ON categories (user_id, parent_id, name) WHERE parent_id IS NOT NULL;
+
+DROP INDEX categories_trash_idx;
+DROP INDEX passwords_trash_idx;
+
+ALTER TABLE categories DROP COLUMN deleted_at;
+ALTER TABLE passwords DROP COLUMN deleted_at;
@@ -0,0 +1,15 @@
+-- entries and categories in the trash keep the time they were deleted at until they are purged
+ALTER TABLE passwords ADD COLUMN deleted_at timestamptz;
+ALTER TABLE categories ADD COLUMN deleted_at timestamptz;
+
+CREATE INDEX passwords_trash_idx ON passwords (user_id, deleted_at, password_id) WHERE deleted_at IS NOT NULL;
+CREATE INDEX categories_trash_idx ON categories (user_id, deleted_at, category_id) WHERE deleted_at IS NOT NULL;
+
+-- a trashed category no longer holds its name among its siblings
+DROP INDEX categories_root_name_key;
+DROP INDEX categories_sibling_name_key;
+
+CREATE UNIQUE INDEX categories_root_name_key ON categories (user_id, name)
+	WHERE parent_id IS NULL AND deleted_at IS NULL;
+CREATE UNIQUE INDEX categories_sibling_name_key ON categories (user_id, parent_id, name)
+	WHERE parent_id IS NOT NULL AND deleted_at IS NULL;
@@ -0,0 +1,4 @@
+DROP INDEX passwords_unindexed_idx;
+DROP INDEX passwords_search_tokens_idx;
+
+ALTER TABLE passwords DROP COLUMN search_tokens;
@@ -0,0 +1,7 @@
+-- keyed blind index of each entry, null until the entry is indexed
+ALTER TABLE passwords ADD COLUMN search_tokens bytea[];
+
+CREATE INDEX passwords_search_tokens_idx ON passwords USING gin (search_tokens);
+
+-- entries stored before they were indexed
+CREATE INDEX passwords_unindexed_idx ON passwords (user_id) WHERE search_tokens IS NULL;
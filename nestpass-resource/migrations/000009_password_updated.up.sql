@@ -0,0 +1,2 @@
+-- last time the content of an entry changed, entries stored before are counted from the migration
+ALTER TABLE passwords ADD COLUMN updated timestamptz NOT NULL DEFAULT now();
@@ -0,0 +1,7 @@
+DROP TABLE shared_passwords;
+DROP TABLE share_members;
+DROP TABLE shares;
+
+ALTER TABLE vaults
+	DROP COLUMN wrapped_private_key,
+	DROP COLUMN public_key;
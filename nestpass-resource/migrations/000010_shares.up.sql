@@ -0,0 +1,46 @@
+-- keypair shares are sealed to, created when the user first shares or receives a share
+ALTER TABLE vaults
+	ADD COLUMN public_key bytea,
+	ADD COLUMN wrapped_private_key bytea;
+
+-- a shared entry, or a shared category when password_id is null, owner_key is the share key
+-- sealed to the owner's keypair
+CREATE TABLE shares (
+	share_id    uuid PRIMARY KEY,
+	owner_id    uuid NOT NULL,
+	password_id uuid,
+	category_id uuid NOT NULL,
+	owner_key   bytea NOT NULL,
+	key_version integer NOT NULL,
+	created     timestamptz NOT NULL
+);
+
+-- at most one share per shared object
+CREATE UNIQUE INDEX shares_password_key ON shares (owner_id, password_id, category_id) WHERE password_id IS NOT NULL;
+CREATE UNIQUE INDEX shares_category_key ON shares (owner_id, category_id) WHERE password_id IS NULL;
+CREATE INDEX shares_owner_id_created_idx ON shares (owner_id, created, share_id);
+
+CREATE TABLE share_members (
+	share_id     uuid NOT NULL REFERENCES shares (share_id) ON DELETE CASCADE,
+	recipient_id uuid NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+	permission   text NOT NULL CHECK (permission IN ('read', 'read_write')),
+	sealed_key   bytea NOT NULL,
+	created      timestamptz NOT NULL,
+	PRIMARY KEY (share_id, recipient_id)
+);
+
+CREATE INDEX share_members_recipient_id_idx ON share_members (recipient_id);
+
+-- copies of the shared entries encrypted with the share key
+CREATE TABLE shared_passwords (
+	share_id    uuid NOT NULL REFERENCES shares (share_id) ON DELETE CASCADE,
+	password_id uuid NOT NULL,
+	user_id     uuid NOT NULL,
+	category_id uuid NOT NULL,
+	website     text NOT NULL,
+	nonce       bytea NOT NULL,
+	encrypted   bytea NOT NULL,
+	key_version integer NOT NULL,
+	updated     timestamptz NOT NULL,
+	PRIMARY KEY (share_id, password_id)
+);
@@ -0,0 +1,6 @@
+DROP TABLE org_invites;
+DROP TABLE org_members;
+DROP TABLE orgs;
+
+ALTER TABLE vaults DROP CONSTRAINT vaults_mode_check;
+ALTER TABLE vaults ADD CONSTRAINT vaults_mode_check CHECK (mode IN ('server', 'client'));
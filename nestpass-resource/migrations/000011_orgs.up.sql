@@ -0,0 +1,36 @@
+-- an organization's vault, entries and collections are stored under its id
+ALTER TABLE vaults DROP CONSTRAINT vaults_mode_check;
+ALTER TABLE vaults ADD CONSTRAINT vaults_mode_check CHECK (mode IN ('server', 'client', 'org'));
+
+CREATE TABLE orgs (
+	org_id  uuid PRIMARY KEY,
+	name    text NOT NULL,
+	created timestamptz NOT NULL
+);
+
+-- sealed_key is the organization key sealed to the member's keypair
+CREATE TABLE org_members (
+	org_id     uuid NOT NULL REFERENCES orgs (org_id),
+	user_id    uuid NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+	role       text NOT NULL CHECK (role IN ('owner', 'admin', 'member', 'read_only')),
+	sealed_key bytea NOT NULL,
+	joined     timestamptz NOT NULL,
+	PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX org_members_user_id_idx ON org_members (user_id);
+CREATE INDEX org_members_joined_idx ON org_members (org_id, joined, user_id);
+
+-- one pending invite per email, inviting again replaces it
+CREATE TABLE org_invites (
+	invite_id  uuid PRIMARY KEY,
+	org_id     uuid NOT NULL REFERENCES orgs (org_id),
+	email      text NOT NULL,
+	role       text NOT NULL CHECK (role IN ('owner', 'admin', 'member', 'read_only')),
+	invited_by uuid NOT NULL,
+	created    timestamptz NOT NULL,
+	expires    timestamptz NOT NULL,
+	UNIQUE (org_id, email)
+);
+
+CREATE INDEX org_invites_email_idx ON org_invites (email);
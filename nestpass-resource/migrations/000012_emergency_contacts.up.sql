@@ -0,0 +1,22 @@
+-- trusted contacts of an owner, sealed_ring holds the owner's data keys sealed to the contact
+-- while access is granted
+CREATE TABLE emergency_contacts (
+	owner_id     uuid NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+	contact_id   uuid NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+	category_ids uuid[] NOT NULL DEFAULT '{}',
+	wait_days    integer NOT NULL,
+	access_days  integer NOT NULL,
+	status       text NOT NULL CHECK (status IN ('idle', 'requested', 'granted', 'vetoed', 'expired')),
+	requested_at timestamptz,
+	granted_at   timestamptz,
+	sealed_ring  bytea,
+	ring_version integer NOT NULL DEFAULT 0,
+	created      timestamptz NOT NULL,
+	PRIMARY KEY (owner_id, contact_id)
+);
+
+CREATE INDEX emergency_contacts_owner_id_created_idx ON emergency_contacts (owner_id, created, contact_id);
+CREATE INDEX emergency_contacts_contact_id_created_idx ON emergency_contacts (contact_id, created, owner_id);
+
+-- requests and grants the timer worker checks
+CREATE INDEX emergency_contacts_pending_idx ON emergency_contacts (status) WHERE status IN ('requested', 'granted');
@@ -0,0 +1,2 @@
+DROP TABLE attachment_deletions;
+DROP TABLE attachments;
@@ -0,0 +1,24 @@
+-- files of an entry, the blob is encrypted in chunks with a file key wrapped with the data key
+CREATE TABLE attachments (
+	attachment_id uuid PRIMARY KEY,
+	password_id   uuid NOT NULL REFERENCES passwords (password_id),
+	user_id       uuid NOT NULL,
+	name          text NOT NULL,
+	content_type  text NOT NULL,
+	size          bigint NOT NULL,
+	wrapped_key   bytea NOT NULL,
+	key_version   integer NOT NULL,
+	nonce_prefix  bytea NOT NULL,
+	created       timestamptz NOT NULL
+);
+
+CREATE INDEX attachments_password_id_created_idx ON attachments (password_id, created, attachment_id);
+CREATE INDEX attachments_user_id_idx ON attachments (user_id, key_version);
+
+-- blobs of deleted attachments, removed from storage once the deletion committed
+CREATE TABLE attachment_deletions (
+	attachment_id uuid PRIMARY KEY,
+	queued        timestamptz NOT NULL
+);
+
+CREATE INDEX attachment_deletions_queued_idx ON attachment_deletions (queued);
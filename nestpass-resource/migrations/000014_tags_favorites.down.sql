@@ -0,0 +1,13 @@
+DROP TABLE password_tags;
+DROP TABLE tags;
+
+DROP INDEX passwords_favorite_idx;
+DROP INDEX passwords_last_used_idx;
+DROP INDEX passwords_updated_idx;
+DROP INDEX passwords_created_idx;
+DROP INDEX passwords_website_idx;
+
+ALTER TABLE passwords
+	DROP COLUMN created,
+	DROP COLUMN last_used,
+	DROP COLUMN favorite;
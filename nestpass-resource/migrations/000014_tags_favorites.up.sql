@@ -0,0 +1,34 @@
+ALTER TABLE passwords
+	ADD COLUMN favorite boolean NOT NULL DEFAULT false,
+	ADD COLUMN last_used timestamptz,
+	ADD COLUMN created timestamptz;
+
+-- entries stored before were created no later than their last change
+UPDATE passwords SET created = updated;
+ALTER TABLE passwords ALTER COLUMN created SET NOT NULL;
+
+-- keyset listings by each sort key, ties broken by id
+CREATE INDEX passwords_website_idx ON passwords (user_id, website, password_id);
+CREATE INDEX passwords_created_idx ON passwords (user_id, created, password_id);
+CREATE INDEX passwords_updated_idx ON passwords (user_id, updated, password_id);
+CREATE INDEX passwords_last_used_idx ON passwords (user_id, coalesce(last_used, '-infinity'), password_id);
+CREATE INDEX passwords_favorite_idx ON passwords (user_id, password_id) WHERE favorite;
+
+-- tag names are unique per owner regardless of case
+CREATE TABLE tags (
+	tag_id  uuid PRIMARY KEY,
+	user_id uuid NOT NULL,
+	name    text NOT NULL,
+	created timestamptz NOT NULL
+);
+
+CREATE UNIQUE INDEX tags_user_id_name_key ON tags (user_id, lower(name));
+
+CREATE TABLE password_tags (
+	password_id uuid NOT NULL REFERENCES passwords (password_id),
+	tag_id      uuid NOT NULL REFERENCES tags (tag_id),
+	user_id     uuid NOT NULL,
+	PRIMARY KEY (password_id, tag_id)
+);
+
+CREATE INDEX password_tags_tag_id_idx ON password_tags (tag_id);
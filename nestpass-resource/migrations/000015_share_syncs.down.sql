@@ -0,0 +1,3 @@
+DROP INDEX passwords_user_id_category_id_idx;
+
+DROP TABLE share_syncs;
@@ -0,0 +1,14 @@
+-- owner writes waiting for the shares covering them to be rebuilt
+CREATE TABLE share_syncs (
+	sync_id      uuid PRIMARY KEY,
+	owner_id     uuid NOT NULL,
+	password_ids uuid[] NOT NULL,
+	category_ids uuid[] NOT NULL,
+	queued       timestamptz NOT NULL
+);
+
+CREATE INDEX share_syncs_owner_id_queued_idx ON share_syncs (owner_id, queued);
+CREATE INDEX share_syncs_queued_idx ON share_syncs (queued);
+
+-- rebuilds load the entries filed in the categories of a share
+CREATE INDEX passwords_user_id_category_id_idx ON passwords (user_id, category_id);
@@ -0,0 +1,6 @@
+DROP INDEX share_syncs_retry_at_queued_idx;
+CREATE INDEX share_syncs_queued_idx ON share_syncs (queued);
+
+ALTER TABLE share_syncs
+	DROP COLUMN retry_at,
+	DROP COLUMN attempts;
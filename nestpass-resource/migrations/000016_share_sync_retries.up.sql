@@ -0,0 +1,10 @@
+-- writes whose shares failed to rebuild wait before they are claimed again
+ALTER TABLE share_syncs
+	ADD COLUMN attempts integer NOT NULL DEFAULT 0,
+	ADD COLUMN retry_at timestamptz;
+
+UPDATE share_syncs SET retry_at = queued;
+ALTER TABLE share_syncs ALTER COLUMN retry_at SET NOT NULL;
+
+DROP INDEX share_syncs_queued_idx;
+CREATE INDEX share_syncs_retry_at_queued_idx ON share_syncs (retry_at, queued);
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// how long fetched keys are trusted before the set is refreshed
+	jwksCacheTTL = 5 * time.Minute
+	// minimum time between refreshes triggered by an unknown kid
+	jwksMinRefresh = 30 * time.Second
+)
+
+// Public key in JSON Web Key format.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Verification key resolved from the key set.
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// KeySet caches the auth server's JWK set, only keys published there can verify tokens.
+// Lookups never wait on the network while holding the lock, concurrent refreshes share one fetch.
+type KeySet struct {
+	url     string
+	client  *http.Client
+	group   singleflight.Group
+	mu      sync.RWMutex
+	keys    map[string]publicKey
+	fetched time.Time
+}
+
+// Creates a new key set fetched from the given jwks url.
+func NewKeySet(url string) *KeySet {
+	return &KeySet{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   map[string]publicKey{},
+	}
+}
+
+// Retrieves the key for the kid, refreshing the set when it is stale or the kid is unknown.
+func (ks *KeySet) key(kid string) (publicKey, error) {
+	key, ok, fresh := ks.cached(kid)
+	if fresh {
+		if !ok {
+			return publicKey{}, fmt.Errorf("unknown key id %q", kid)
+		}
+
+		return key, nil
+	}
+
+	if _, err, _ := ks.group.Do("jwks", func() (interface{}, error) { return nil, ks.refresh() }); err != nil {
+		// keep verifying with known keys if the auth server is unreachable
+		if ok {
+			log.Warn().Str("location", "KeySet").Msgf("failed to refresh jwks, using cached keys: %v", err)
+			return key, nil
+		}
+
+		return publicKey{}, err
+	}
+
+	key, ok, _ = ks.cached(kid)
+	if !ok {
+		return publicKey{}, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	return key, nil
+}
+
+// helper: cached looks the kid up in the fetched set and reports if the answer can be trusted
+// without a refresh, unknown kids only trigger a refresh once per jwksMinRefresh.
+func (ks *KeySet) cached(kid string) (publicKey, bool, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.keys[kid]
+	age := time.Since(ks.fetched)
+	return key, ok, (ok && age < jwksCacheTTL) || (!ok && age < jwksMinRefresh)
+}
+
+// helper: refresh fetches the key set without holding the lock and swaps it in.
+func (ks *KeySet) refresh() error {
+	// a failed fetch also counts so an unreachable auth server is not asked on every request
+	ks.mu.Lock()
+	ks.fetched = time.Now()
+	ks.mu.Unlock()
+
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		log.Error().Str("location", "KeySet.refresh").Msgf("failed to fetch jwks: %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Error().Str("location", "KeySet.refresh").Msgf("failed to fetch jwks: status %d", resp.StatusCode)
+		return fmt.Errorf("jwks request failed with status %d", resp.StatusCode)
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		log.Error().Str("location", "KeySet.refresh").Msgf("failed to decode jwks: %v", err)
+		return err
+	}
+
+	keys := map[string]publicKey{}
+	for _, k := range set.Keys {
+		key, err := parseJWK(k)
+		if err != nil {
+			log.Warn().Str("location", "KeySet.refresh").Msgf("skipping key %s: %v", k.Kid, err)
+			continue
+		}
+
+		keys[k.Kid] = key
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// helper: parseJWK converts a P-256 or Ed25519 jwk into a public key.
+func parseJWK(k jwk) (publicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return publicKey{}, err
+	}
+
+	switch {
+	case k.Kty == "EC" && k.Crv == "P-256" && k.Alg == "ES256":
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return publicKey{}, err
+		}
+
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return publicKey{}, errors.New("point is not on curve")
+		}
+
+		return publicKey{alg: k.Alg, key: pub}, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519" && k.Alg == "EdDSA":
+		if len(x) != ed25519.PublicKeySize {
+			return publicKey{}, errors.New("invalid ed25519 key size")
+		}
+
+		return publicKey{alg: k.Alg, key: ed25519.PublicKey(x)}, nil
+	}
+
+	return publicKey{}, fmt.Errorf("unsupported key %s/%s/%s", k.Kty, k.Crv, k.Alg)
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// helper: newToken signs claims for the user with the given key and kid.
+func newToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid, iss string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, &claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "session",
+			Issuer:    iss,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		UserID: uuid.New(),
+	})
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func Test_DecodeTokenWithJWKS(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(map[string][]jwk{"keys": {
+			{Kty: "EC", Kid: "ec", Alg: "ES256", Crv: "P-256", X: b64(ecKey.X.FillBytes(make([]byte, 32))), Y: b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{Kty: "OKP", Kid: "ed", Alg: "EdDSA", Crv: "Ed25519", X: b64(edPub)},
+		}})
+	}))
+	defer srv.Close()
+	keys := NewKeySet(srv.URL)
+
+	for _, token := range []string{
+		newToken(t, jwt.SigningMethodES256, ecKey, "ec", issuer),
+		newToken(t, jwt.SigningMethodEdDSA, edKey, "ed", issuer),
+	} {
+		decoded, err := DecodeToken(token, keys)
+		if err != nil {
+			t.Fatalf("valid token rejected: %v", err)
+		}
+		if decoded.ID != "session" {
+			t.Fatalf("unexpected jti %q", decoded.ID)
+		}
+	}
+
+	if requests != 1 {
+		t.Fatalf("expected the key set to be fetched once, got %d", requests)
+	}
+
+	rejected := map[string]string{
+		"unknown kid":     newToken(t, jwt.SigningMethodEdDSA, edKey, "missing", issuer),
+		"mismatched alg":  newToken(t, jwt.SigningMethodEdDSA, edKey, "ec", issuer),
+		"foreign issuer":  newToken(t, jwt.SigningMethodEdDSA, edKey, "ed", "nestpass.resource"),
+		"symmetric token": newToken(t, jwt.SigningMethodHS256, []byte("secret"), "ed", issuer),
+	}
+	for name, token := range rejected {
+		if _, err := DecodeToken(token, keys); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+
+	// unknown kids must not hammer the auth server
+	if requests != 1 {
+		t.Fatalf("expected refreshes to be rate limited, got %d requests", requests)
+	}
+}
+
+func Test_KeySetRefreshDoesNotBlockLookups(t *testing.T) {
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	release := make(chan struct{})
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-release
+		}
+
+		json.NewEncoder(w).Encode(map[string][]jwk{"keys": {
+			{Kty: "OKP", Kid: "ed", Alg: "EdDSA", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(edPub)},
+		}})
+	}))
+	defer srv.Close()
+	keys := NewKeySet(srv.URL)
+
+	if _, err := keys.key("ed"); err != nil {
+		t.Fatal(err)
+	}
+
+	// let an unknown kid trigger a refresh, which hangs until released
+	keys.mu.Lock()
+	keys.fetched = time.Now().Add(-jwksMinRefresh)
+	keys.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys.key("rotated")
+		}()
+	}
+
+	for requests.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := keys.key("ed")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("cached key rejected: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lookup of a cached key waited on the refresh")
+	}
+
+	close(release)
+	wg.Wait()
+
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected concurrent refreshes to share one fetch, got %d requests", n)
+	}
+}
+
+func Test_ServiceTokenAudience(t *testing.T) {
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]jwk{"keys": {
+			{Kty: "OKP", Kid: "ed", Alg: "EdDSA", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(edPub)},
+		}})
+	}))
+	defer srv.Close()
+	keys := NewKeySet(srv.URL)
+
+	sign := func(audience ...string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Audience:  audience,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			UserID: uuid.New(),
+		})
+		token.Header["kid"] = "ed"
+		signed, _ := token.SignedString(edKey)
+		return signed
+	}
+
+	service, access := sign(ServiceAudience), sign()
+	if _, err := DecodeServiceToken(service, keys, ServiceAudience); err != nil {
+		t.Fatalf("service token rejected: %v", err)
+	}
+
+	// neither token type is accepted in place of the other
+	if _, err := DecodeToken(service, keys); err == nil {
+		t.Fatal("service token accepted as access token")
+	}
+	if _, err := DecodeServiceToken(access, keys, ServiceAudience); err == nil {
+		t.Fatal("access token accepted as service token")
+	}
+	if _, err := DecodeServiceToken(sign("nestpass.email"), keys, ServiceAudience); err == nil {
+		t.Fatal("service token for another audience accepted")
+	}
+}
@@ -22,12 +22,47 @@ type claims struct {
 	UserID uuid.UUID `json:"user_id"`
 }
 
-// DecodeToken decodes a JWT token and returns the Claims.
-func DecodeToken(token, signKey string) (*claims, error) {
-	// decode token with the given sign key
+// issuer of every token accepted by the resource server
+const issuer = "nestpass.auth"
+
+// DecodeToken decodes a JWT token issued by the auth server and returns the Claims.
+func DecodeToken(token string, keys *KeySet) (*claims, error) {
+	claims, err := decode(token, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// service tokens are only valid for the audience they were issued to
+	if len(claims.Audience) != 0 {
+		return nil, apiutils.NewErrUnauthorized("invalid token")
+	}
+
+	return claims, nil
+}
+
+// DecodeServiceToken decodes a token the auth server issued for internal calls to the audience.
+func DecodeServiceToken(token string, keys *KeySet, audience string) (*claims, error) {
+	return decode(token, keys, jwt.WithAudience(audience))
+}
+
+// helper: decode verifies the token with the key matching its kid and returns the Claims.
+func decode(token string, keys *KeySet, opts ...jwt.ParserOption) (*claims, error) {
+	opts = append(opts, jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg(), jwt.SigningMethodEdDSA.Alg()}), jwt.WithIssuer(issuer))
+
+	// decode token with the key matching its kid
 	payload, err := jwt.ParseWithClaims(token, &claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(signKey), nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, err := keys.key(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.alg != token.Method.Alg() {
+			return nil, jwt.ErrTokenUnverifiable
+		}
+
+		return key.key, nil
+	}, opts...)
 
 	// handle all possible errors from parsing the token
 	if err != nil {
@@ -40,7 +75,7 @@ func DecodeToken(token, signKey string) (*claims, error) {
 		}
 
 		log.Error().Str("location", "GetPayload").Msg(err.Error())
-		return nil, err
+		return nil, apiutils.NewErrUnauthorized("invalid token")
 	}
 
 	// check if the decoded token is valid claims
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/tuan882612/apiutils"
+)
+
+const CtxMemberships ctxKey = "memberships"
+
+// Roles of organization members, from most to least privileged.
+const (
+	RoleOwner    = "owner"
+	RoleAdmin    = "admin"
+	RoleMember   = "member"
+	RoleReadOnly = "read_only"
+)
+
+// Action is what a request does to an organization, roles are checked against it.
+type Action int
+
+const (
+	ActionView        Action = iota // read collections and entries
+	ActionWrite                     // create, edit and delete entries
+	ActionCollections               // create, edit and delete collections
+	ActionManage                    // invite and remove members below owner
+	ActionOwn                       // manage owners and delete the organization
+)
+
+var rolePermissions = map[string]Action{
+	RoleOwner:    ActionOwn,
+	RoleAdmin:    ActionManage,
+	RoleMember:   ActionWrite,
+	RoleReadOnly: ActionView,
+}
+
+// Reports if the role allows the action, each role allows the actions of the roles below it.
+func RoleAllows(role string, action Action) bool {
+	allowed, ok := rolePermissions[role]
+	return ok && action <= allowed
+}
+
+// Memberships of a user by organization id, holding the role in each.
+type Memberships map[uuid.UUID]string
+
+// MembershipStore loads the organizations a user is a member of.
+type MembershipStore interface {
+	GetMemberships(ctx context.Context, userID uuid.UUID) (Memberships, error)
+}
+
+// Retrieves the memberships the authorization middleware put in the context.
+func MembershipsFromCtx(ctx context.Context) Memberships {
+	memberships, ok := ctx.Value(CtxMemberships).(Memberships)
+	if !ok {
+		return Memberships{}
+	}
+
+	return memberships
+}
+
+// Resolves the owner a request acts on: the organization named by the org_id query parameter
+// when the user's role in it allows the action, the user otherwise.
+func OwnerFromRequest(r *http.Request, action Action) (uuid.UUID, error) {
+	raw := r.URL.Query().Get("org_id")
+	if raw == "" {
+		return UidFromCtx(r.Context())
+	}
+
+	orgID, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, apiutils.NewErrBadRequest("invalid org_id")
+	}
+
+	role, ok := MembershipsFromCtx(r.Context())[orgID]
+	if !ok {
+		return uuid.Nil, apiutils.NewErrNotFound("organization not found")
+	}
+
+	if !RoleAllows(role, action) {
+		return uuid.Nil, apiutils.NewErrForbidden("role " + role + " does not allow this")
+	}
+
+	return orgID, nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func Test_RoleAllows(t *testing.T) {
+	if !RoleAllows(RoleOwner, ActionOwn) || !RoleAllows(RoleAdmin, ActionCollections) || !RoleAllows(RoleMember, ActionWrite) {
+		t.Fatal("role denied an action it includes")
+	}
+
+	if RoleAllows(RoleAdmin, ActionOwn) || RoleAllows(RoleMember, ActionCollections) || RoleAllows(RoleReadOnly, ActionWrite) {
+		t.Fatal("role allowed an action above it")
+	}
+
+	if RoleAllows("unknown", ActionView) {
+		t.Fatal("unknown role allowed an action")
+	}
+}
+
+func Test_OwnerFromRequest(t *testing.T) {
+	userID, orgID := uuid.New(), uuid.New()
+	ctx := context.WithValue(context.Background(), CtxUserID, userID)
+	ctx = context.WithValue(ctx, CtxMemberships, Memberships{orgID: RoleReadOnly})
+
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	if owner, err := OwnerFromRequest(r, ActionWrite); err != nil || owner != userID {
+		t.Fatalf("expected the user as owner, got %v: %v", owner, err)
+	}
+
+	r = httptest.NewRequest("GET", "/?org_id="+orgID.String(), nil).WithContext(ctx)
+	if owner, err := OwnerFromRequest(r, ActionView); err != nil || owner != orgID {
+		t.Fatalf("expected the organization as owner, got %v: %v", owner, err)
+	}
+
+	if _, err := OwnerFromRequest(r, ActionWrite); err == nil {
+		t.Fatal("read only member allowed to write")
+	}
+
+	r = httptest.NewRequest("GET", "/?org_id="+uuid.NewString(), nil).WithContext(ctx)
+	if _, err := OwnerFromRequest(r, ActionView); err == nil {
+		t.Fatal("non member allowed to view")
+	}
+}
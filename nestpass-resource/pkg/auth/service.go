@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// audience of the service tokens the auth server issues for internal calls to this server
+const ServiceAudience = "nestpass.resource"
+
+// ServiceAuth authenticates internal grpc calls with service tokens signed by the auth server,
+// the user the token was issued for is set in the context.
+func ServiceAuth(keys *KeySet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) != 1 || !strings.HasPrefix(values[0], "Bearer ") {
+			return nil, status.Error(codes.Unauthenticated, "missing service token")
+		}
+
+		claims, err := DecodeServiceToken(strings.TrimPrefix(values[0], "Bearer "), keys, ServiceAudience)
+		if err != nil {
+			log.Warn().Str("location", "ServiceAuth").Msgf("%s: rejected service token: %v", info.FullMethod, err)
+			return nil, status.Error(codes.Unauthenticated, "invalid service token")
+		}
+
+		return handler(context.WithValue(ctx, CtxUserID, claims.UserID), req)
+	}
+}
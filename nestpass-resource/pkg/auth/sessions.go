@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/rs/zerolog/log"
+)
+
+// how long a session that is not revoked is trusted before asking redis again
+const sessionCacheTTL = 10 * time.Second
+
+// cached sessions kept before expired entries are pruned, after a prune the threshold is twice
+// the entries left so pruning stays amortized constant per lookup
+const sessionPruneThreshold = 1024
+
+// cached revocation state of a session
+type sessionEntry struct {
+	revoked bool
+	expires time.Time
+}
+
+// SessionChecker checks sessions (jti) against the revocation list kept by the auth server,
+// lookups are cached locally so not every request reaches redis.
+type SessionChecker struct {
+	lookup  func(sessionID string) (bool, error)
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]sessionEntry
+	pruneAt int // cache size that triggers the next prune
+}
+
+// Creates a new session checker backed by the shared redis instance.
+func NewSessionChecker(rds *redis.Client) *SessionChecker {
+	return newSessionChecker(func(sessionID string) (bool, error) {
+		n, err := rds.Exists("revoked:" + sessionID).Result()
+		if err != nil {
+			log.Error().Str("location", "SessionChecker").Msgf("%s: failed to check revoked session: %v", sessionID, err)
+			return false, err
+		}
+
+		return n == 1, nil
+	}, sessionCacheTTL)
+}
+
+// helper: newSessionChecker creates a session checker with the given lookup.
+func newSessionChecker(lookup func(string) (bool, error), ttl time.Duration) *SessionChecker {
+	return &SessionChecker{lookup: lookup, ttl: ttl, entries: map[string]sessionEntry{}, pruneAt: sessionPruneThreshold}
+}
+
+// Checks if the session has been revoked, revoked sessions are remembered until the token expires.
+func (s *SessionChecker) IsRevoked(sessionID string, tokenExpires time.Time) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.entries[sessionID]
+	s.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := s.lookup(sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	// a revoked session stays revoked, no need to ask again while its tokens are valid
+	entry = sessionEntry{revoked: revoked, expires: now.Add(s.ttl)}
+	if revoked {
+		entry.expires = tokenExpires
+	}
+
+	s.mu.Lock()
+	if len(s.entries) >= s.pruneAt {
+		s.prune(now)
+		s.pruneAt = max(sessionPruneThreshold, 2*len(s.entries))
+	}
+	s.entries[sessionID] = entry
+	s.mu.Unlock()
+
+	return revoked, nil
+}
+
+// helper: prune removes expired entries, must be called with the lock held.
+func (s *SessionChecker) prune(now time.Time) {
+	for sessionID, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, sessionID)
+		}
+	}
+}
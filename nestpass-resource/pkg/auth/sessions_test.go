@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_SessionCheckerCachesLookups(t *testing.T) {
+	calls := 0
+	revoked := map[string]bool{"revoked": true}
+	checker := newSessionChecker(func(sessionID string) (bool, error) {
+		calls++
+		return revoked[sessionID], nil
+	}, time.Minute)
+
+	exp := time.Now().Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		ok, err := checker.IsRevoked("active", exp)
+		if err != nil || ok {
+			t.Fatalf("expected active session, got revoked=%v err=%v", ok, err)
+		}
+
+		ok, err = checker.IsRevoked("revoked", exp)
+		if err != nil || !ok {
+			t.Fatalf("expected revoked session, got revoked=%v err=%v", ok, err)
+		}
+	}
+
+	if calls != 2 {
+		t.Fatalf("expected 2 lookups, got %d", calls)
+	}
+}
+
+func Test_SessionCheckerRefreshesActiveSessions(t *testing.T) {
+	revoked := false
+	checker := newSessionChecker(func(string) (bool, error) {
+		return revoked, nil
+	}, 0)
+
+	exp := time.Now().Add(time.Minute)
+	if ok, _ := checker.IsRevoked("session", exp); ok {
+		t.Fatal("expected active session")
+	}
+
+	revoked = true
+	if ok, _ := checker.IsRevoked("session", exp); !ok {
+		t.Fatal("expected revocation to be picked up")
+	}
+}
+
+func Test_SessionCheckerLookupError(t *testing.T) {
+	checker := newSessionChecker(func(string) (bool, error) {
+		return false, errors.New("redis down")
+	}, time.Minute)
+
+	if _, err := checker.IsRevoked("session", time.Now().Add(time.Minute)); err == nil {
+		t.Fatal("expected lookup error")
+	}
+}
+
+func Test_SessionCheckerPrunesAtThreshold(t *testing.T) {
+	checker := newSessionChecker(func(string) (bool, error) {
+		return false, nil
+	}, time.Millisecond)
+	checker.pruneAt = 3
+
+	exp := time.Now().Add(time.Minute)
+	for _, sessionID := range []string{"a", "b", "c"} {
+		checker.IsRevoked(sessionID, exp)
+	}
+
+	// below the threshold expired entries are left alone
+	time.Sleep(5 * time.Millisecond)
+	if len(checker.entries) != 3 {
+		t.Fatalf("expected 3 cached sessions, got %d", len(checker.entries))
+	}
+
+	checker.IsRevoked("d", exp)
+	if len(checker.entries) != 1 || checker.pruneAt != sessionPruneThreshold {
+		t.Fatalf("expected a prune down to 1 session, got %d with threshold %d", len(checker.entries), checker.pruneAt)
+	}
+}
@@ -0,0 +1,226 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tuan882612/apiutils"
+)
+
+// page sizes, larger limits are clamped to MaxLimit
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// sort orders
+const (
+	Asc  = "asc"
+	Desc = "desc"
+)
+
+// Position in a listing, the row a page starts after (or before when going back). Cursors are
+// signed, clients hand them back as they got them.
+type Cursor struct {
+	Sort     string    `json:"s,omitempty"` // key the listing is sorted by, empty sorts by id
+	Order    string    `json:"o"`
+	Value    string    `json:"v,omitempty"` // sort value of the boundary row
+	ID       uuid.UUID `json:"i"`           // id of the boundary row, breaks ties of the sort value
+	Backward bool      `json:"b,omitempty"` // the page holds the rows before the boundary row
+}
+
+// Pager signs and verifies the cursors of listings.
+type Pager struct {
+	secret []byte
+}
+
+func NewPager(secret string) *Pager {
+	return &Pager{secret: []byte(secret)}
+}
+
+// Validated pagination of a list request.
+type Params struct {
+	Limit  int
+	Sort   string
+	Order  string
+	Cursor *Cursor // nil on the first page
+	pager  *Pager
+}
+
+// Parses the limit, sort, order and cursor of the request. The sort has to be one of the sorts
+// (empty sorts by id), a cursor carries its own sort and order which the query may only repeat.
+func (p *Pager) Parse(r *http.Request, sorts ...string) (*Params, error) {
+	return p.ParseOrder(r, Asc, sorts...)
+}
+
+// Parses the request like Parse for a listing ordered the given way unless the request asks otherwise.
+func (p *Pager) ParseOrder(r *http.Request, order string, sorts ...string) (*Params, error) {
+	query := r.URL.Query()
+	params := &Params{Limit: DefaultLimit, Sort: query.Get("sort"), Order: query.Get("order"), pager: p}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return nil, apiutils.NewErrBadRequest("invalid limit")
+		}
+
+		params.Limit = min(limit, MaxLimit)
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := p.decode(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		if (params.Sort != "" && params.Sort != cursor.Sort) || (params.Order != "" && params.Order != cursor.Order) {
+			return nil, apiutils.NewErrBadRequest("cursor belongs to another sort")
+		}
+
+		params.Sort, params.Order, params.Cursor = cursor.Sort, cursor.Order, cursor
+	}
+
+	if params.Order == "" {
+		params.Order = order
+	}
+
+	if params.Order != Asc && params.Order != Desc {
+		return nil, apiutils.NewErrBadRequest("invalid order " + params.Order)
+	}
+
+	if params.Sort != "" && !slices.Contains(sorts, params.Sort) {
+		return nil, apiutils.NewErrBadRequest("invalid sort " + params.Sort)
+	}
+
+	return params, nil
+}
+
+// Rows to fetch, one more than the limit tells if there are more.
+func (p *Params) Fetch() int {
+	return p.Limit + 1
+}
+
+// Id of the row the page starts after, nil on the first page.
+func (p *Params) Boundary() *uuid.UUID {
+	if p.Cursor == nil {
+		return nil
+	}
+
+	return &p.Cursor.ID
+}
+
+// Sort value of the row the page starts after, nil on the first page.
+func (p *Params) BoundaryValue() *string {
+	if p.Cursor == nil {
+		return nil
+	}
+
+	return &p.Cursor.Value
+}
+
+// Checks if the rows are fetched in descending order, pages going back fetch against the order.
+func (p *Params) Descending() bool {
+	return (p.Order == Desc) != (p.Cursor != nil && p.Cursor.Backward)
+}
+
+// Page of a listing with the cursors of the pages around it.
+type Page[T any] struct {
+	Items   []T    `json:"items"`
+	Next    string `json:"next,omitempty"`
+	Prev    string `json:"prev,omitempty"`
+	HasMore bool   `json:"has_more"` // more rows follow in the direction the page was requested
+}
+
+// Builds the page from the rows fetched with the params, at most Fetch rows in fetch order. The key
+// returns the sort value and id of a row.
+func NewPage[T any](params *Params, rows []T, key func(T) (string, uuid.UUID)) (*Page[T], error) {
+	backward := params.Cursor != nil && params.Cursor.Backward
+
+	more := len(rows) > params.Limit
+	if more {
+		rows = rows[:params.Limit]
+	}
+
+	// rows of a page going back are fetched nearest first
+	if backward {
+		slices.Reverse(rows)
+	}
+
+	page := &Page[T]{Items: rows, HasMore: more}
+	if len(rows) == 0 {
+		return page, nil
+	}
+
+	// going forward there is a previous page past the first one, going back there is always a next one
+	var err error
+	if more || backward {
+		value, id := key(rows[len(rows)-1])
+		if page.Next, err = params.cursor(value, id, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if (backward && more) || (!backward && params.Cursor != nil) {
+		value, id := key(rows[0])
+		if page.Prev, err = params.cursor(value, id, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// helper: cursor encodes the cursor of a boundary row.
+func (p *Params) cursor(value string, id uuid.UUID, backward bool) (string, error) {
+	return p.pager.encode(&Cursor{Sort: p.Sort, Order: p.Order, Value: value, ID: id, Backward: backward})
+}
+
+// helper: encode serializes and signs the cursor.
+func (p *Pager) encode(cursor *Cursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(p.sign(encoded)), nil
+}
+
+// helper: decode verifies and deserializes the cursor.
+func (p *Pager) decode(raw string) (*Cursor, error) {
+	encoded, signature, ok := strings.Cut(raw, ".")
+	if !ok {
+		return nil, apiutils.NewErrBadRequest("invalid cursor")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, p.sign(encoded)) {
+		return nil, apiutils.NewErrBadRequest("invalid cursor")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, apiutils.NewErrBadRequest("invalid cursor")
+	}
+
+	cursor := &Cursor{}
+	if err := json.Unmarshal(payload, cursor); err != nil {
+		return nil, apiutils.NewErrBadRequest("invalid cursor")
+	}
+
+	return cursor, nil
+}
+
+// helper: sign computes the signature of an encoded cursor.
+func (p *Pager) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,157 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func Test_ParseLimit(t *testing.T) {
+	pager := NewPager(testSecret)
+
+	cases := map[string]int{"": DefaultLimit, "1": 1, "25": 25, "1000000": MaxLimit}
+	for raw, want := range cases {
+		params, err := pager.Parse(httptest.NewRequest("GET", "/?limit="+raw, nil))
+		if err != nil || params.Limit != want {
+			t.Errorf("%q: got %v, %v, want %d", raw, params, err, want)
+		}
+	}
+
+	for _, raw := range []string{"0", "-5", "ten", "99999999999999999999"} {
+		if _, err := pager.Parse(httptest.NewRequest("GET", "/?limit="+raw, nil)); err == nil {
+			t.Errorf("%q: expected an error", raw)
+		}
+	}
+}
+
+func Test_ParseSort(t *testing.T) {
+	pager := NewPager(testSecret)
+
+	params, err := pager.Parse(httptest.NewRequest("GET", "/?sort=name&order=desc", nil), "name")
+	if err != nil || params.Sort != "name" || params.Order != Desc || !params.Descending() {
+		t.Fatalf("got %+v, %v", params, err)
+	}
+
+	for _, query := range []string{"sort=secret", "order=sideways"} {
+		if _, err := pager.Parse(httptest.NewRequest("GET", "/?"+query, nil), "name"); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
+
+func Test_ParseOrder(t *testing.T) {
+	pager := NewPager(testSecret)
+
+	// listings ordered descending by default still take an explicit order
+	params, err := pager.ParseOrder(httptest.NewRequest("GET", "/", nil), Desc)
+	if err != nil || params.Order != Desc || !params.Descending() || params.BoundaryValue() != nil {
+		t.Fatalf("got %+v, %v", params, err)
+	}
+
+	if params, err = pager.ParseOrder(httptest.NewRequest("GET", "/?order=asc", nil), Desc); err != nil || params.Order != Asc {
+		t.Fatalf("got %+v, %v", params, err)
+	}
+
+	raw, err := pager.encode(&Cursor{Order: Desc, Value: "2024-01-01T00:00:00Z", ID: uuid.New()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err = pager.ParseOrder(httptest.NewRequest("GET", "/?cursor="+url.QueryEscape(raw), nil), Desc)
+	if err != nil || *params.BoundaryValue() != "2024-01-01T00:00:00Z" {
+		t.Fatalf("boundary value not taken from the cursor: %+v, %v", params, err)
+	}
+}
+
+func Test_Cursor(t *testing.T) {
+	pager := NewPager(testSecret)
+	want := &Cursor{Sort: "name", Order: Desc, Value: "b", ID: uuid.New(), Backward: true}
+
+	raw, err := pager.encode(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := pager.Parse(httptest.NewRequest("GET", "/?cursor="+url.QueryEscape(raw), nil), "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *params.Cursor != *want || params.Sort != "name" || params.Order != Desc {
+		t.Fatalf("got %+v, want %+v", params.Cursor, want)
+	}
+
+	// a page going back in descending order is fetched ascending
+	if params.Descending() || *params.Boundary() != want.ID {
+		t.Error("cursor direction or boundary not applied")
+	}
+
+	encoded, signature, _ := strings.Cut(raw, ".")
+	rejected := map[string]string{
+		"unsigned":     encoded,
+		"tampered":     encoded[:len(encoded)-2] + "AA." + signature,
+		"other secret": func() string { c, _ := NewPager(strings.Repeat("x", 32)).encode(want); return c }(),
+	}
+
+	for name, cursor := range rejected {
+		if _, err := pager.Parse(httptest.NewRequest("GET", "/?cursor="+url.QueryEscape(cursor), nil), "name"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// the query may only repeat the cursor's sort
+	if _, err := pager.Parse(httptest.NewRequest("GET", "/?order=asc&cursor="+url.QueryEscape(raw), nil), "name"); err == nil {
+		t.Error("expected an error for a conflicting order")
+	}
+}
+
+func Test_NewPage(t *testing.T) {
+	pager := NewPager(testSecret)
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New(), uuid.New()}
+	key := func(id uuid.UUID) (string, uuid.UUID) { return "", id }
+
+	// helper: follow parses the cursor back into params
+	follow := func(cursor string) *Params {
+		params, err := pager.Parse(httptest.NewRequest("GET", "/?limit=2&cursor="+url.QueryEscape(cursor), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return params
+	}
+
+	first, _ := pager.Parse(httptest.NewRequest("GET", "/?limit=2", nil))
+	page, err := NewPage(first, []uuid.UUID{ids[0], ids[1], ids[2]}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Items) != 2 || !page.HasMore || page.Next == "" || page.Prev != "" {
+		t.Fatalf("first page: %+v", page)
+	}
+
+	next := follow(page.Next)
+	if next.Cursor.ID != ids[1] || next.Cursor.Backward {
+		t.Fatalf("next cursor: %+v", next.Cursor)
+	}
+
+	page, _ = NewPage(next, []uuid.UUID{ids[2], ids[3]}, key)
+	if page.HasMore || page.Next != "" || page.Prev == "" {
+		t.Fatalf("last page: %+v", page)
+	}
+
+	// going back from the last page fetches nearest first
+	prev := follow(page.Prev)
+	if prev.Cursor.ID != ids[2] || !prev.Cursor.Backward || !prev.Descending() {
+		t.Fatalf("prev cursor: %+v", prev.Cursor)
+	}
+
+	page, _ = NewPage(prev, []uuid.UUID{ids[1], ids[0]}, key)
+	if page.Items[0] != ids[0] || page.Items[1] != ids[1] || page.HasMore || page.Prev != "" || page.Next == "" {
+		t.Fatalf("previous page: %+v", page)
+	}
+}